@@ -0,0 +1,65 @@
+package iopi
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Mark a pin as active-low, e.g. a relay board switching on low or a
+// button wired to ground, so SetActive and IsActive treat low as active.
+// The inversion is done in software and works for outputs too, unlike the
+// polarity registers which only invert inputs. Raw states written and read
+// with WritePin and ReadPin are unaffected.
+func (dev *Device) SetActiveLow(pin uint8, activeLow bool) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+
+	bit := uint32(1) << (pin - 1)
+	for {
+		old := atomic.LoadUint32(&dev.activeLow)
+		mask := old &^ bit
+		if activeLow {
+			mask |= bit
+		}
+		if atomic.CompareAndSwapUint32(&dev.activeLow, old, mask) {
+			return nil
+		}
+	}
+}
+
+// Return true if the pin is marked active-low, see SetActiveLow.
+func (dev *Device) IsActiveLow(pin uint8) (bool, error) {
+	if pin < 1 || pin > 16 {
+		return false, fmt.Errorf("invalid pin: %d", pin)
+	}
+	return dev.isActiveLow(pin), nil
+}
+
+func (dev *Device) isActiveLow(pin uint8) bool {
+	return atomic.LoadUint32(&dev.activeLow)&(1<<(pin-1)) != 0
+}
+
+// Turn a pin on or off, writing low for on if the pin is active-low.
+func (dev *Device) SetActive(pin uint8, active bool) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	state := Low
+	if active != dev.isActiveLow(pin) {
+		state = High
+	}
+	return dev.WritePin(pin, state)
+}
+
+// Return true if the pin is on: high, or low if the pin is active-low.
+func (dev *Device) IsActive(pin uint8) (bool, error) {
+	if pin < 1 || pin > 16 {
+		return false, fmt.Errorf("invalid pin: %d", pin)
+	}
+	state, err := dev.ReadPin(pin)
+	if err != nil {
+		return false, err
+	}
+	return (state != Low) != dev.isActiveLow(pin), nil
+}
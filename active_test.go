@@ -0,0 +1,74 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestActive(t *testing.T) {
+	t.Run("writes and reads active-high pins", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		file.NextRead = []byte{0x00}
+		if err := dev.SetActive(2, true); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0x02}) {
+			t.Error("pin not written high", file.CallHistory)
+		}
+
+		file.NextRead = []byte{0x02}
+		if active, _ := dev.IsActive(2); !active {
+			t.Error("high pin not active")
+		}
+	})
+
+	t.Run("inverts active-low pins", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		if err := dev.SetActiveLow(10, true); err != nil {
+			t.Fatal(err)
+		}
+
+		file.NextRead = []byte{0xFF}
+		if err := dev.SetActive(10, true); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0xFD}) {
+			t.Error("pin not written low", file.CallHistory)
+		}
+
+		file.NextRead = []byte{0x00}
+		if active, _ := dev.IsActive(10); !active {
+			t.Error("low pin not active")
+		}
+		file.NextRead = []byte{0x02}
+		if active, _ := dev.IsActive(10); active {
+			t.Error("high pin active")
+		}
+
+		dev.SetActiveLow(10, false)
+		if low, _ := dev.IsActiveLow(10); low {
+			t.Error("pin still active-low")
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		for _, pin := range []uint8{0, 17} {
+			if dev.SetActiveLow(pin, true) == nil {
+				t.Error("expected error from SetActiveLow", pin)
+			}
+			if _, err := dev.IsActiveLow(pin); err == nil {
+				t.Error("expected error from IsActiveLow", pin)
+			}
+			if dev.SetActive(pin, true) == nil {
+				t.Error("expected error from SetActive", pin)
+			}
+			if _, err := dev.IsActive(pin); err == nil {
+				t.Error("expected error from IsActive", pin)
+			}
+		}
+	})
+}
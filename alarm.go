@@ -0,0 +1,293 @@
+package iopi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Wiring of the sensor contacts of an alarm zone. Contacts are expected
+// to switch the pin to ground, with the pull-up of the pin enabled.
+type Contact int
+
+const (
+	// Open at rest, e.g. a PIR output; the zone is faulted when low
+	NormallyOpen Contact = iota
+	// Closed at rest, e.g. a door reed switch; the zone is faulted when
+	// high, which includes a cut wire
+	NormallyClosed
+)
+
+// A group of input pins monitored together, e.g. the doors of a floor.
+type AlarmZone struct {
+	Name       string
+	Pins       []uint8
+	Contact    Contact
+	Debounce   time.Duration // of the pins, set on the poller
+	EntryDelay time.Duration // from a fault of the armed zone to the alarm
+	ExitDelay  time.Duration // from arming until the zone is watched
+}
+
+type AlarmState string
+
+const (
+	Disarmed AlarmState = "disarmed"
+	Exiting  AlarmState = "exiting" // armed, within the exit delay
+	Armed    AlarmState = "armed"
+	Entering AlarmState = "entering" // faulted while armed, within the entry delay
+	Alarming AlarmState = "alarm"
+)
+
+// A change of the state of a zone, or of whether it is faulted
+type AlarmEvent struct {
+	Zone    string     `json:"zone"`
+	State   AlarmState `json:"state"`
+	Faulted bool       `json:"faulted"` // a pin of the zone is in fault
+	Time    time.Time  `json:"time"`
+}
+
+type alarmZone struct {
+	AlarmZone
+	state    AlarmState
+	faulted  map[uint8]bool // by pin
+	deadline time.Time      // end of the exit or entry delay
+}
+
+func (z *alarmZone) isFaulted() bool {
+	for _, f := range z.faulted {
+		if f {
+			return true
+		}
+	}
+	return false
+}
+
+// Alarm monitors alarm zones on the input pins of a poller, with a
+// consolidated stream of the states of all zones. Zones start disarmed,
+// and are reported while disarmed too, so the stream doubles as a status
+// of the doors and windows of a building.
+type Alarm struct {
+	Clock Clock
+
+	poller *Poller
+	mutex  sync.Mutex
+	zones  []*alarmZone
+	events chan AlarmEvent
+	wake   chan struct{}
+}
+
+// Create an alarm of zones with unique names on pins watched by a poller,
+// setting the debounce of the pins. The poller must be run separately.
+func NewAlarm(poller *Poller, zones ...AlarmZone) (*Alarm, error) {
+	a := &Alarm{
+		poller: poller,
+		events: make(chan AlarmEvent, subscriberBuffer),
+		wake:   make(chan struct{}, 1),
+	}
+	names := make(map[string]bool)
+	for _, z := range zones {
+		if z.Name == "" || names[z.Name] {
+			return nil, fmt.Errorf("invalid or duplicate zone name: %q", z.Name)
+		}
+		names[z.Name] = true
+		if len(z.Pins) == 0 {
+			return nil, fmt.Errorf("zone %s has no pins", z.Name)
+		}
+
+		zone := &alarmZone{AlarmZone: z, state: Disarmed, faulted: make(map[uint8]bool)}
+		for _, pin := range z.Pins {
+			if pin < 1 || pin > 16 {
+				return nil, fmt.Errorf("zone %s: invalid pin: %d", z.Name, pin)
+			}
+			zone.faulted[pin] = false
+			if z.Debounce > 0 {
+				poller.SetDebounce(pin, z.Debounce)
+			}
+		}
+		a.zones = append(a.zones, zone)
+	}
+	return a, nil
+}
+
+// Return the channel of zone events. Events are dropped if the channel is
+// not read.
+func (a *Alarm) Events() <-chan AlarmEvent {
+	return a.events
+}
+
+// Arm a zone. It is watched once its exit delay has passed.
+func (a *Alarm) Arm(name string) error {
+	return a.set(name, func(z *alarmZone, now time.Time) {
+		if z.state != Disarmed {
+			return
+		}
+		z.state, z.deadline = Exiting, now.Add(z.ExitDelay)
+	})
+}
+
+// Disarm a zone, silencing its alarm.
+func (a *Alarm) Disarm(name string) error {
+	return a.set(name, func(z *alarmZone, now time.Time) {
+		z.state, z.deadline = Disarmed, time.Time{}
+	})
+}
+
+func (a *Alarm) set(name string, fn func(z *alarmZone, now time.Time)) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, z := range a.zones {
+		if z.Name == name {
+			now := ClockOr(a.Clock).Now()
+			before := z.state
+			fn(z, now)
+			if z.state != before {
+				a.emit(z, now)
+			}
+			a.expire(z, now)
+			select {
+			case a.wake <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown zone: %s", name)
+}
+
+// Return the current state of all zones, in the order given to NewAlarm.
+func (a *Alarm) Status() []AlarmEvent {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := ClockOr(a.Clock).Now()
+	status := make([]AlarmEvent, len(a.zones))
+	for i, z := range a.zones {
+		status[i] = AlarmEvent{z.Name, z.state, z.isFaulted(), now}
+	}
+	return status
+}
+
+// Read the pins of all zones, then follow their changes and delays until
+// the context is cancelled.
+func (a *Alarm) Run(ctx context.Context) error {
+	events, cancel := a.poller.Subscribe()
+	defer cancel()
+
+	if err := a.read(); err != nil {
+		return err
+	}
+
+	clock := ClockOr(a.Clock)
+	for {
+		var timer <-chan time.Time
+		if next := a.nextDeadline(); !next.IsZero() {
+			timer = clock.After(next.Sub(clock.Now()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-events:
+			a.handle(ev)
+		case now := <-timer:
+			a.mutex.Lock()
+			for _, z := range a.zones {
+				a.expire(z, now)
+			}
+			a.mutex.Unlock()
+		case <-a.wake:
+		}
+	}
+}
+
+// Read the initial state of the pins of all zones.
+func (a *Alarm) read() error {
+	ports, err := a.poller.Device().ReadPorts()
+	if err != nil {
+		return fmt.Errorf("failed to read alarm zones: %w", err)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := ClockOr(a.Clock).Now()
+	for _, z := range a.zones {
+		for _, pin := range z.Pins {
+			bit, port := GetPinPort(pin)
+			z.faulted[pin] = z.fault(State(GetBit(ports[port], bit)))
+		}
+		a.emit(z, now)
+	}
+	return nil
+}
+
+// Return true if a pin in `state` is in fault.
+func (z *alarmZone) fault(state State) bool {
+	return state.Bool() == (z.Contact == NormallyClosed)
+}
+
+func (a *Alarm) handle(ev PinEvent) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, z := range a.zones {
+		if _, ok := z.faulted[ev.Pin]; !ok {
+			continue
+		}
+		was := z.isFaulted()
+		z.faulted[ev.Pin] = z.fault(ev.State)
+		faulted := z.isFaulted()
+		if faulted == was {
+			continue
+		}
+
+		if faulted && z.state == Armed {
+			z.state, z.deadline = Entering, ev.Time.Add(z.EntryDelay)
+		}
+		a.emit(z, ev.Time)
+		a.expire(z, ev.Time)
+	}
+}
+
+// Move a zone on from a delay that has ended, with the mutex held.
+func (a *Alarm) expire(z *alarmZone, now time.Time) {
+	if z.deadline.IsZero() || now.Before(z.deadline) {
+		return
+	}
+	z.deadline = time.Time{}
+
+	switch z.state {
+	case Exiting:
+		z.state = Armed
+		if z.isFaulted() {
+			z.state, z.deadline = Entering, now.Add(z.EntryDelay)
+		}
+		a.emit(z, now)
+		a.expire(z, now)
+	case Entering:
+		z.state = Alarming
+		a.emit(z, now)
+	}
+}
+
+func (a *Alarm) nextDeadline() time.Time {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var next time.Time
+	for _, z := range a.zones {
+		if !z.deadline.IsZero() && (next.IsZero() || z.deadline.Before(next)) {
+			next = z.deadline
+		}
+	}
+	return next
+}
+
+func (a *Alarm) emit(z *alarmZone, now time.Time) {
+	select {
+	case a.events <- AlarmEvent{z.Name, z.state, z.isFaulted(), now}:
+	default:
+	}
+}
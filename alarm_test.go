@@ -0,0 +1,147 @@
+package iopi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Return the next event of an alarm, failing if there is none
+func nextAlarmEvent(t *testing.T, a *Alarm) AlarmEvent {
+	t.Helper()
+	select {
+	case ev := <-a.Events():
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no alarm event")
+		return AlarmEvent{}
+	}
+}
+
+// Move zones on from delays ended by `now`, as Run does
+func expireAll(a *Alarm, now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, z := range a.zones {
+		a.expire(z, now)
+	}
+}
+
+func TestAlarm(t *testing.T) {
+	t.Run("follows exit and entry delays", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		a, err := NewAlarm(NewPoller(dev, time.Millisecond), AlarmZone{
+			Name: "doors", Pins: []uint8{1, 2}, Contact: NormallyClosed,
+			ExitDelay: 30 * time.Second, EntryDelay: 20 * time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Clock = clock
+
+		a.Arm("doors")
+		if ev := nextAlarmEvent(t, a); ev.State != Exiting {
+			t.Error("expected exiting", ev)
+		}
+		clock.Advance(30 * time.Second)
+		expireAll(a, clock.Now())
+		if ev := nextAlarmEvent(t, a); ev.State != Armed {
+			t.Error("expected armed", ev)
+		}
+
+		// A door opens, breaking its circuit
+		a.handle(PinEvent{Pin: 2, State: State(1), Time: clock.Now()})
+		if ev := nextAlarmEvent(t, a); ev.State != Entering || !ev.Faulted {
+			t.Error("expected entering", ev)
+		}
+		clock.Advance(20 * time.Second)
+		expireAll(a, clock.Now())
+		if ev := nextAlarmEvent(t, a); ev.State != Alarming {
+			t.Error("expected alarm", ev)
+		}
+
+		a.Disarm("doors")
+		if ev := nextAlarmEvent(t, a); ev.State != Disarmed || !ev.Faulted {
+			t.Error("expected disarmed", ev)
+		}
+	})
+
+	t.Run("reports faults while disarmed", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		a, _ := NewAlarm(NewPoller(dev, time.Millisecond), AlarmZone{Name: "pir", Pins: []uint8{9}, Contact: NormallyOpen})
+
+		a.handle(PinEvent{Pin: 9, State: Low})
+		if ev := nextAlarmEvent(t, a); ev.State != Disarmed || !ev.Faulted {
+			t.Error("expected faulted", ev)
+		}
+		a.handle(PinEvent{Pin: 9, State: Low})
+		a.handle(PinEvent{Pin: 10, State: Low})
+		if st := a.Status(); len(st) != 1 || !st[0].Faulted || len(a.Events()) != 0 {
+			t.Error("unexpected status", st)
+		}
+	})
+
+	t.Run("alarms when armed while faulted", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		a, _ := NewAlarm(NewPoller(dev, time.Millisecond), AlarmZone{Name: "window", Pins: []uint8{3}, Contact: NormallyClosed})
+
+		a.handle(PinEvent{Pin: 3, State: High})
+		nextAlarmEvent(t, a)
+		a.Arm("window")
+		for _, want := range []AlarmState{Exiting, Entering, Alarming} {
+			if ev := nextAlarmEvent(t, a); ev.State != want {
+				t.Errorf("expected %s, got %v", want, ev)
+			}
+		}
+	})
+
+	t.Run("watches the pins of a poller", func(t *testing.T) {
+		dev, err := Open(SimPrefix+"alarm", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dev.Close()
+		if err := dev.Init(); err != nil {
+			t.Fatal(err)
+		}
+		chip, _ := SimChip(SimPrefix+"alarm", 0x20)
+		poller := NewPoller(dev, time.Millisecond, 12)
+		a, _ := NewAlarm(poller, AlarmZone{Name: "hall", Pins: []uint8{12}, Contact: NormallyOpen})
+		chip.SetInput(12, true) // pulled up
+		poller.Poll()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go poller.Run(ctx)
+		go a.Run(ctx)
+
+		if ev := nextAlarmEvent(t, a); ev.Faulted {
+			t.Error("expected idle zone", ev)
+		}
+		chip.SetInput(12, false)
+		if ev := nextAlarmEvent(t, a); !ev.Faulted {
+			t.Error("expected faulted zone", ev)
+		}
+	})
+
+	t.Run("rejects invalid zones", func(t *testing.T) {
+		p := NewPoller(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), time.Millisecond)
+		for _, zones := range [][]AlarmZone{
+			{{Name: "a"}},
+			{{Name: "a", Pins: []uint8{17}}},
+			{{Name: "a", Pins: []uint8{1}}, {Name: "a", Pins: []uint8{2}}},
+		} {
+			if _, err := NewAlarm(p, zones...); err == nil {
+				t.Error("expected error for", zones)
+			}
+		}
+		a, _ := NewAlarm(p)
+		if err := a.Arm("missing"); err == nil {
+			t.Error("expected error for unknown zone")
+		}
+	})
+}
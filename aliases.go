@@ -0,0 +1,98 @@
+package iopi
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Identifies a pin across devices.
+type PinRef struct {
+	Address byte  `json:"address"` // I2C address of the device
+	Pin     uint8 `json:"pin"`
+}
+
+// Aliases names pins across devices, e.g. "conveyor_start" for pin 12 of
+// the device at 0x21, so integrations can show names instead of numbers.
+// A nil *Aliases has no names.
+type Aliases struct {
+	mutex sync.RWMutex
+	names map[PinRef]string
+	refs  map[string]PinRef
+}
+
+func NewAliases() *Aliases {
+	return &Aliases{
+		names: make(map[PinRef]string),
+		refs:  make(map[string]PinRef),
+	}
+}
+
+// Name a pin, replacing any previous name of the pin. Returns an error if
+// the name is used by another pin.
+func (a *Aliases) Set(name string, ref PinRef) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if other, ok := a.refs[name]; ok && other != ref {
+		return fmt.Errorf("name %q already used by pin %d on 0x%02x", name, other.Pin, other.Address)
+	}
+	if old, ok := a.names[ref]; ok {
+		delete(a.refs, old)
+	}
+	a.names[ref] = name
+	a.refs[name] = ref
+	return nil
+}
+
+// Return the name of a pin, or "" if it has none.
+func (a *Aliases) Name(ref PinRef) string {
+	if a == nil {
+		return ""
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.names[ref]
+}
+
+// Return the pin with a name.
+func (a *Aliases) Lookup(name string) (PinRef, bool) {
+	if a == nil {
+		return PinRef{}, false
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	ref, ok := a.refs[name]
+	return ref, ok
+}
+
+// Return all names, sorted.
+func (a *Aliases) Names() []string {
+	if a == nil {
+		return nil
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	names := make([]string, 0, len(a.refs))
+	for name := range a.refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the name of a pin, or a description like "0x21 pin 12" if it
+// has none.
+func (a *Aliases) Label(ref PinRef) string {
+	if name := a.Name(ref); name != "" {
+		return name
+	}
+	return fmt.Sprintf("0x%02x pin %d", ref.Address, ref.Pin)
+}
+
+// Return the event with the name of its pin filled in.
+func (a *Aliases) Annotate(ev PinEvent) PinEvent {
+	ev.Name = a.Name(PinRef{ev.Address, ev.Pin})
+	return ev
+}
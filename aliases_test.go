@@ -0,0 +1,64 @@
+package iopi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	a := NewAliases()
+	conveyor := PinRef{Address: 0x21, Pin: 12}
+
+	if err := a.Set("conveyor_start", conveyor); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("looks up names and pins", func(t *testing.T) {
+		if a.Name(conveyor) != "conveyor_start" {
+			t.Error("unexpected name", a.Name(conveyor))
+		}
+		if ref, ok := a.Lookup("conveyor_start"); !ok || ref != conveyor {
+			t.Error("unexpected pin", ref, ok)
+		}
+		if _, ok := a.Lookup("pump"); ok {
+			t.Error("unexpected pin for unknown name")
+		}
+	})
+
+	t.Run("labels pins", func(t *testing.T) {
+		if a.Label(conveyor) != "conveyor_start" {
+			t.Error("unexpected label", a.Label(conveyor))
+		}
+		if l := a.Label(PinRef{0x20, 3}); l != "0x20 pin 3" {
+			t.Error("unexpected label", l)
+		}
+	})
+
+	t.Run("annotates events", func(t *testing.T) {
+		ev := a.Annotate(PinEvent{Address: 0x21, Pin: 12})
+		if ev.Name != "conveyor_start" {
+			t.Error("unexpected name", ev.Name)
+		}
+	})
+
+	t.Run("rejects duplicate names", func(t *testing.T) {
+		if err := a.Set("conveyor_start", PinRef{0x20, 1}); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("renames pins", func(t *testing.T) {
+		a.Set("conveyor_stop", PinRef{0x21, 13})
+		a.Set("belt_start", conveyor)
+		if names := a.Names(); !reflect.DeepEqual(names, []string{"belt_start", "conveyor_stop"}) {
+			t.Error("unexpected names", names)
+		}
+	})
+
+	t.Run("nil has no names", func(t *testing.T) {
+		var none *Aliases
+		if none.Name(conveyor) != "" || none.Names() != nil || none.Label(conveyor) != "0x21 pin 12" {
+			t.Error("unexpected name")
+		}
+	})
+}
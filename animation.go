@@ -0,0 +1,119 @@
+package iopi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A frame of an animation: the state of the animated pins, one bit per
+// pin, and how long it is shown.
+type Frame struct {
+	State    uint16
+	Duration time.Duration
+}
+
+// Loops value playing an animation until cancelled
+const Forever = -1
+
+// A sequence of frames, played `Loops` times. An animation is played once
+// if Loops is 0.
+type Animation struct {
+	Frames []Frame
+	Loops  int
+}
+
+// Animator plays animations across a group of pins, such as a port of
+// LEDs. Bit 0 of a frame is the first pin of the animator, bit 1 the
+// second, and so on. Pins must be set to output beforehand.
+type Animator struct {
+	Clock Clock
+
+	pins *PinGroup
+}
+
+// Create an animator for `pins`. All 16 pins are animated if no pins are
+// given.
+func NewAnimator(dev *Device, pins ...uint8) *Animator {
+	if len(pins) == 0 {
+		pins = append(PortPins(PortA), PortPins(PortB)...)
+	}
+	return &Animator{pins: NewPinGroup(dev, pins...)}
+}
+
+// Return the pin numbers of a port, in bit order.
+func PortPins(port Port) []uint8 {
+	offset := uint8(1)
+	if port == PortB {
+		offset = 9
+	}
+	pins := make([]uint8, 8)
+	for i := range pins {
+		pins[i] = offset + uint8(i)
+	}
+	return pins
+}
+
+// Play animations one after another until done or the context is
+// cancelled. Pins keep the state of the last frame shown.
+func (a *Animator) Play(ctx context.Context, anims ...Animation) error {
+	if err := a.pins.validate(); err != nil {
+		return err
+	}
+
+	for _, anim := range anims {
+		for n := 0; anim.Loops == Forever || n < anim.Loops || n == 0; n++ {
+			for _, f := range anim.Frames {
+				if err := a.Show(f.State); err != nil {
+					return err
+				}
+
+				if SleepContext(ctx, a.Clock, f.Duration) != nil {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Set the pins to a frame state.
+func (a *Animator) Show(state uint16) error {
+	if err := a.pins.WriteValue(uint(state)); err != nil {
+		return fmt.Errorf("failed to show frame: %w", err)
+	}
+	return nil
+}
+
+// A single lit pin moving across `n` pins.
+func Chaser(n int, d time.Duration) Animation {
+	var anim Animation
+	for i := 0; i < n; i++ {
+		anim.Frames = append(anim.Frames, Frame{1 << i, d})
+	}
+	return anim
+}
+
+// A single lit pin moving back and forth across `n` pins.
+func Bounce(n int, d time.Duration) Animation {
+	anim := Chaser(n, d)
+	for i := n - 2; i > 0; i-- {
+		anim.Frames = append(anim.Frames, Frame{1 << i, d})
+	}
+	return anim
+}
+
+// Light `n` pins one by one, then turn them off one by one.
+func Fill(n int, d time.Duration) Animation {
+	var anim Animation
+	var state uint16
+	for i := 0; i < n; i++ {
+		state |= 1 << i
+		anim.Frames = append(anim.Frames, Frame{state, d})
+	}
+	for i := 0; i < n; i++ {
+		state &^= 1 << i
+		anim.Frames = append(anim.Frames, Frame{state, d})
+	}
+	return anim
+}
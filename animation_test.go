@@ -0,0 +1,107 @@
+package iopi
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Return the values written to a register, in order
+func registerWrites(file *FakeFile, reg Register) []byte {
+	var vals []byte
+	for _, c := range file.CallHistory {
+		if c.Fn == "Write" && len(c.Arg) == 2 && c.Arg[0] == byte(reg) {
+			vals = append(vals, c.Arg[1])
+		}
+	}
+	return vals
+}
+
+func TestAnimatorShow(t *testing.T) {
+	t.Run("writes full ports without reading", func(t *testing.T) {
+		file := NewFakeFile()
+		a := NewAnimator(NewDevice(file, 0x20, &sync.Mutex{}))
+
+		if err := a.Show(0x8001); err != nil {
+			t.Fatal(err)
+		}
+		expected := []Call{
+			{"Write", []byte{byte(GPIOA), 0x01}},
+			{"Write", []byte{byte(GPIOB), 0x80}},
+		}
+		if !reflect.DeepEqual(file.CallHistory, expected) {
+			t.Error("unexpected calls", file.CallHistory)
+		}
+	})
+
+	t.Run("keeps pins outside the animation", func(t *testing.T) {
+		file := NewFakeFile()
+		a := NewAnimator(NewDevice(file, 0x20, &sync.Mutex{}), 3, 4)
+
+		file.NextRead = []byte{0b11110000}
+		if err := a.Show(0b01); err != nil {
+			t.Fatal(err)
+		}
+		if vals := registerWrites(file, GPIOA); !reflect.DeepEqual(vals, []byte{0b11110100}) {
+			t.Errorf("unexpected writes: %08b", vals)
+		}
+	})
+}
+
+func TestAnimatorPlay(t *testing.T) {
+	t.Run("plays chained animations", func(t *testing.T) {
+		file := NewFakeFile()
+		a := NewAnimator(NewDevice(file, 0x20, &sync.Mutex{}), PortPins(PortA)...)
+
+		first := Animation{Frames: []Frame{{0x01, time.Microsecond}, {0x02, time.Microsecond}}, Loops: 2}
+		second := Animation{Frames: []Frame{{0xFF, time.Microsecond}}}
+		if err := a.Play(context.Background(), first, second); err != nil {
+			t.Fatal(err)
+		}
+
+		if vals := registerWrites(file, GPIOA); !reflect.DeepEqual(vals, []byte{0x01, 0x02, 0x01, 0x02, 0xFF}) {
+			t.Error("unexpected frames", vals)
+		}
+	})
+
+	t.Run("loops until cancelled", func(t *testing.T) {
+		a := NewAnimator(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		anim := Chaser(16, time.Millisecond)
+		anim.Loops = Forever
+		if err := a.Play(ctx, anim); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		a := NewAnimator(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), 0)
+		if a.Play(context.Background(), Chaser(1, 0)) == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestAnimations(t *testing.T) {
+	states := func(anim Animation) []uint16 {
+		var s []uint16
+		for _, f := range anim.Frames {
+			s = append(s, f.State)
+		}
+		return s
+	}
+
+	if s := states(Chaser(3, 0)); !reflect.DeepEqual(s, []uint16{1, 2, 4}) {
+		t.Error("unexpected chaser", s)
+	}
+	if s := states(Bounce(3, 0)); !reflect.DeepEqual(s, []uint16{1, 2, 4, 2}) {
+		t.Error("unexpected bounce", s)
+	}
+	if s := states(Fill(2, 0)); !reflect.DeepEqual(s, []uint16{1, 3, 2, 0}) {
+		t.Error("unexpected fill", s)
+	}
+}
@@ -0,0 +1,110 @@
+package iopi
+
+import "fmt"
+
+// Encode a number as binary-coded decimal, four bits per digit with the
+// least significant digit in the lowest bits.
+func EncodeBCD(n uint, digits int) (uint, error) {
+	var v uint
+	for i := 0; i < digits; i++ {
+		v |= (n % 10) << (4 * i)
+		n /= 10
+	}
+	if n != 0 {
+		return 0, fmt.Errorf("number does not fit in %d digits", digits)
+	}
+	return v, nil
+}
+
+// Decode `digits` binary-coded decimal digits. Returns an error if a digit
+// is not 0-9, e.g. when a thumbwheel is read between two positions.
+func DecodeBCD(v uint, digits int) (uint, error) {
+	var n, scale uint = 0, 1
+	for i := 0; i < digits; i++ {
+		d := v >> (4 * i) & 0x0F
+		if d > 9 {
+			return 0, fmt.Errorf("invalid bcd digit %d: 0x%X", i, d)
+		}
+		n += d * scale
+		scale *= 10
+	}
+	return n, nil
+}
+
+// BCDWriter outputs numbers in binary-coded decimal, e.g. to CD4511 display
+// decoders. Each group of four pins is a digit, least significant first.
+type BCDWriter struct {
+	// Pin latching the value into the decoders after it is written, 0 if
+	// there is none. The strobe is pulsed to its active level and back.
+	Strobe          uint8
+	StrobeActiveLow bool // e.g. LE of the CD4511 is transparent when low
+
+	group *PinGroup
+}
+
+// Create a writer on a group of output pins, four per digit.
+func NewBCDWriter(group *PinGroup) *BCDWriter {
+	return &BCDWriter{group: group}
+}
+
+// Return the number of digits.
+func (w *BCDWriter) Digits() int {
+	return len(w.group.pins) / 4
+}
+
+// Write a number and pulse the strobe.
+func (w *BCDWriter) Write(n uint) error {
+	if len(w.group.pins)%4 != 0 {
+		return fmt.Errorf("bcd needs four pins per digit, got %d pins", len(w.group.pins))
+	}
+	v, err := EncodeBCD(n, w.Digits())
+	if err != nil {
+		return err
+	}
+	if err := w.group.WriteValue(v); err != nil {
+		return err
+	}
+
+	if w.Strobe == 0 {
+		return nil
+	}
+	active, idle := High, Low
+	if w.StrobeActiveLow {
+		active, idle = Low, High
+	}
+	if err := w.group.dev.WritePin(w.Strobe, active); err != nil {
+		return fmt.Errorf("failed to strobe: %w", err)
+	}
+	if err := w.group.dev.WritePin(w.Strobe, idle); err != nil {
+		return fmt.Errorf("failed to strobe: %w", err)
+	}
+	return nil
+}
+
+// BCDReader reads numbers in binary-coded decimal, e.g. from thumbwheel
+// switches. Each group of four pins is a digit, least significant first.
+type BCDReader struct {
+	Inverted bool // digits read as their complement, e.g. switches to ground with pull-ups
+
+	group *PinGroup
+}
+
+// Create a reader on a group of input pins, four per digit.
+func NewBCDReader(group *PinGroup) *BCDReader {
+	return &BCDReader{group: group}
+}
+
+// Read and decode the number. Returns an error if a digit is invalid.
+func (r *BCDReader) Read() (uint, error) {
+	if len(r.group.pins)%4 != 0 {
+		return 0, fmt.Errorf("bcd needs four pins per digit, got %d pins", len(r.group.pins))
+	}
+	v, err := r.group.ReadValue()
+	if err != nil {
+		return 0, err
+	}
+	if r.Inverted {
+		v = ^v & (1<<len(r.group.pins) - 1)
+	}
+	return DecodeBCD(v, len(r.group.pins)/4)
+}
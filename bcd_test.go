@@ -0,0 +1,90 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBCD(t *testing.T) {
+	t.Run("encodes", func(t *testing.T) {
+		if v, err := EncodeBCD(42, 2); err != nil || v != 0x42 {
+			t.Errorf("unexpected value: 0x%X %v", v, err)
+		}
+		if v, err := EncodeBCD(7, 3); err != nil || v != 0x007 {
+			t.Errorf("unexpected value: 0x%X %v", v, err)
+		}
+		if _, err := EncodeBCD(100, 2); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("decodes", func(t *testing.T) {
+		if n, err := DecodeBCD(0x1234, 4); err != nil || n != 1234 {
+			t.Error("unexpected number", n, err)
+		}
+		if _, err := DecodeBCD(0x1A, 2); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestBCDWriter(t *testing.T) {
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+	w := NewBCDWriter(NewPinGroup(dev, PortPins(PortA)...))
+	w.Strobe = 9
+	w.StrobeActiveLow = true
+
+	if err := w.Write(59); err != nil {
+		t.Fatal(err)
+	}
+	if !file.HasCall("Write", []byte{byte(GPIOA), 0x59}) {
+		t.Error("digits not written", file.CallHistory)
+	}
+
+	// Strobe pulsed low, then back high
+	strobe := registerWrites(file, GPIOB)
+	if len(strobe) != 2 || strobe[0]&0x01 != 0 || strobe[1]&0x01 != 1 {
+		t.Errorf("unexpected strobe: %08b", strobe)
+	}
+
+	if w.Write(100) == nil {
+		t.Error("expected error")
+	}
+	if NewBCDWriter(NewPinGroup(dev, 1, 2, 3)).Write(1) == nil {
+		t.Error("expected error for incomplete digit")
+	}
+}
+
+func TestBCDReader(t *testing.T) {
+	t.Run("reads digits", func(t *testing.T) {
+		file := NewFakeFile()
+		r := NewBCDReader(NewPinGroup(NewDevice(file, 0x20, &sync.Mutex{}), PortPins(PortB)...))
+
+		file.NextRead = []byte{0x37}
+		if n, err := r.Read(); err != nil || n != 37 {
+			t.Error("unexpected number", n, err)
+		}
+	})
+
+	t.Run("reads inverted digits", func(t *testing.T) {
+		file := NewFakeFile()
+		r := NewBCDReader(NewPinGroup(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2, 3, 4))
+		r.Inverted = true
+
+		file.NextRead = []byte{0xF9}
+		if n, err := r.Read(); err != nil || n != 6 {
+			t.Error("unexpected number", n, err)
+		}
+	})
+
+	t.Run("rejects invalid digits", func(t *testing.T) {
+		file := NewFakeFile()
+		r := NewBCDReader(NewPinGroup(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2, 3, 4))
+
+		file.NextRead = []byte{0x0C}
+		if _, err := r.Read(); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
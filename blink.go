@@ -0,0 +1,199 @@
+package iopi
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A blink pattern: alternating on and off durations, starting with on.
+// A pattern is repeated until stopped.
+type Pattern []time.Duration
+
+var (
+	Heartbeat   = Pattern{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 700 * time.Millisecond}
+	DoubleFlash = Pattern{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 1000 * time.Millisecond}
+	SOS         = sos(200 * time.Millisecond)
+)
+
+// Patterns by name, e.g. for configuration files.
+var Patterns = map[string]Pattern{
+	"heartbeat":    Heartbeat,
+	"double-flash": DoubleFlash,
+	"sos":          SOS,
+}
+
+// Build the morse code for SOS with a time unit of `dot`.
+func sos(dot time.Duration) Pattern {
+	var p Pattern
+	for _, on := range []time.Duration{1, 1, 1, 3, 3, 3, 1, 1, 1} {
+		p = append(p, on*dot, dot)
+	}
+	p[len(p)-1] = 7 * dot // pause between words
+	return p
+}
+
+// Blinker plays blink patterns on output pins of a device, one pattern per
+// pin, so status LEDs don't need a goroutine of their own. Pins must be set
+// to output beforehand.
+type Blinker struct {
+	// Called when writing a pin fails. The pattern of the pin is stopped.
+	OnError func(pin uint8, err error)
+	Clock   Clock
+
+	dev     *Device
+	mutex   sync.Mutex
+	running map[uint8]*blink
+}
+
+type blink struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewBlinker(dev *Device) *Blinker {
+	return &Blinker{
+		dev:     dev,
+		running: make(map[uint8]*blink),
+	}
+}
+
+// Blink a pin on and off, with `interval` in each state.
+func (b *Blinker) Blink(pin uint8, interval time.Duration) error {
+	return b.Play(pin, Pattern{interval, interval})
+}
+
+// Play a pattern on a pin until stopped, replacing any pattern playing.
+func (b *Blinker) Play(pin uint8, p Pattern) error {
+	return b.PlayCount(pin, p, 0)
+}
+
+// Play a pattern `count` times and leave the pin low, or until stopped if
+// count is 0. Replaces any pattern playing on the pin.
+func (b *Blinker) PlayCount(pin uint8, p Pattern, count int) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	if len(p) == 0 || len(p)%2 != 0 {
+		return fmt.Errorf("pattern must have an even number of durations, got %d", len(p))
+	}
+	for _, d := range p {
+		if d <= 0 {
+			return fmt.Errorf("invalid pattern duration: %s", d)
+		}
+	}
+	if count < 0 {
+		return fmt.Errorf("invalid count: %d", count)
+	}
+
+	// Replace the pattern in one go, so concurrent calls cannot both miss
+	// the pattern of the other. The new pattern starts once the old one
+	// has stopped.
+	bl := &blink{make(chan struct{}), make(chan struct{})}
+	b.mutex.Lock()
+	old := b.running[pin]
+	b.running[pin] = bl
+	b.mutex.Unlock()
+
+	if old != nil {
+		old.halt()
+	}
+	go b.run(pin, append(Pattern(nil), p...), count, bl)
+	return nil
+}
+
+// Stop playing a pattern and wait for it.
+func (bl *blink) halt() {
+	close(bl.stop)
+	<-bl.done
+}
+
+func (b *Blinker) run(pin uint8, p Pattern, count int, bl *blink) {
+	defer close(bl.done)
+
+	clock := ClockOr(b.Clock)
+
+	for i := 0; count == 0 || i < count*len(p); i++ {
+		state := Low
+		if i%2 == 0 {
+			state = High
+		}
+		i := i % len(p)
+		if err := b.dev.WritePin(pin, state); err != nil {
+			if b.OnError != nil {
+				b.OnError(pin, err)
+			}
+			return
+		}
+
+		select {
+		case <-clock.After(p[i]):
+		case <-bl.stop:
+			return
+		}
+	}
+
+	b.mutex.Lock()
+	if b.running[pin] == bl {
+		delete(b.running, pin)
+	}
+	b.mutex.Unlock()
+
+	if err := b.dev.WritePin(pin, Low); err != nil && b.OnError != nil {
+		b.OnError(pin, err)
+	}
+}
+
+// Wait until the pattern of a pin has played its count, or is stopped.
+// Returns immediately if no pattern is playing.
+func (b *Blinker) Wait(pin uint8) {
+	b.mutex.Lock()
+	bl, ok := b.running[pin]
+	b.mutex.Unlock()
+
+	if ok {
+		<-bl.done
+	}
+}
+
+// Stop the pattern of a pin and leave it low. Does nothing if no pattern
+// is playing.
+func (b *Blinker) Stop(pin uint8) error {
+	b.mutex.Lock()
+	bl, ok := b.running[pin]
+	delete(b.running, pin)
+	b.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	bl.halt()
+	return b.dev.WritePin(pin, Low)
+}
+
+// Stop all patterns, leaving their pins low.
+func (b *Blinker) StopAll() error {
+	b.mutex.Lock()
+	pins := make([]uint8, 0, len(b.running))
+	for pin := range b.running {
+		pins = append(pins, pin)
+	}
+	b.mutex.Unlock()
+
+	var firstErr error
+	for _, pin := range pins {
+		if err := b.Stop(pin); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Return true if a pattern is playing on the pin.
+func (b *Blinker) Playing(pin uint8) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	_, ok := b.running[pin]
+	return ok
+}
@@ -0,0 +1,168 @@
+package iopi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Count the writes to a GPIO register, read under the device mutex
+func gpioWrites(dev *Device, file *FakeFile, reg Register) int {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+
+	n := 0
+	for _, c := range file.CallHistory {
+		if c.Fn == "Write" && len(c.Arg) == 2 && c.Arg[0] == byte(reg) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBlinker(t *testing.T) {
+	t.Run("blinks until stopped", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		b := NewBlinker(dev)
+
+		if err := b.Blink(3, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; gpioWrites(dev, file, GPIOA) < 4; i++ {
+			if i == 100 {
+				t.Fatal("pin not blinking")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := b.Stop(3); err != nil {
+			t.Fatal(err)
+		}
+		if b.Playing(3) {
+			t.Error("still playing")
+		}
+
+		last := file.CallHistory[len(file.CallHistory)-1]
+		if last.Fn != "Write" || last.Arg[0] != byte(GPIOA) || GetBit(last.Arg[1], 2) != 0 {
+			t.Error("pin not left low", last)
+		}
+		n := gpioWrites(dev, file, GPIOA)
+		time.Sleep(5 * time.Millisecond)
+		if gpioWrites(dev, file, GPIOA) != n {
+			t.Error("pin written after stop")
+		}
+	})
+
+	t.Run("replaces playing pattern", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		b := NewBlinker(dev)
+		defer b.StopAll()
+
+		b.Play(1, Heartbeat)
+		b.Play(1, SOS)
+		b.Play(9, DoubleFlash)
+		if !b.Playing(1) || !b.Playing(9) || len(b.running) != 2 {
+			t.Error("unexpected patterns", b.running)
+		}
+	})
+
+	t.Run("replaces patterns played concurrently", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		b := NewBlinker(dev)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.Blink(3, time.Millisecond)
+			}()
+		}
+		wg.Wait()
+
+		if err := b.Stop(3); err != nil {
+			t.Fatal(err)
+		}
+		n := gpioWrites(dev, file, GPIOA)
+		time.Sleep(5 * time.Millisecond)
+		if gpioWrites(dev, file, GPIOA) != n {
+			t.Error("pin written after stop")
+		}
+	})
+
+	t.Run("stops on write error", func(t *testing.T) {
+		dev := NewDevice(&failingFile{NewFakeFile()}, 0x20, &sync.Mutex{})
+		b := NewBlinker(dev)
+
+		errc := make(chan error, 1)
+		b.OnError = func(pin uint8, err error) { errc <- err }
+		b.Blink(1, time.Millisecond)
+
+		select {
+		case <-errc:
+		case <-time.After(time.Second):
+			t.Fatal("error not reported")
+		}
+	})
+
+	t.Run("plays a pattern a number of times", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		b := NewBlinker(dev)
+
+		if err := b.PlayCount(2, Pattern{time.Millisecond, time.Millisecond}, 3); err != nil {
+			t.Fatal(err)
+		}
+		b.Wait(2)
+
+		if b.Playing(2) {
+			t.Error("still playing")
+		}
+		// 3 times on and off, then left low
+		if n := gpioWrites(dev, file, GPIOA); n != 7 {
+			t.Error("unexpected number of writes", n)
+		}
+		last := file.CallHistory[len(file.CallHistory)-1]
+		if last.Fn != "Write" || last.Arg[0] != byte(GPIOA) || GetBit(last.Arg[1], 1) != 0 {
+			t.Error("pin not left low", last)
+		}
+	})
+
+	t.Run("rejects invalid patterns", func(t *testing.T) {
+		b := NewBlinker(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}))
+		for _, p := range []Pattern{nil, {time.Second}, {time.Second, 0}} {
+			if b.Play(1, p) == nil {
+				t.Error("expected error for", p)
+			}
+		}
+		if b.Blink(17, time.Second) == nil {
+			t.Error("expected error for invalid pin")
+		}
+		if b.PlayCount(1, Heartbeat, -1) == nil {
+			t.Error("expected error for negative count")
+		}
+	})
+}
+
+func TestPatterns(t *testing.T) {
+	for name, p := range Patterns {
+		if len(p)%2 != 0 {
+			t.Error("odd pattern length", name)
+		}
+	}
+	if len(SOS) != 18 || SOS[6] != 600*time.Millisecond {
+		t.Error("unexpected SOS pattern", SOS)
+	}
+}
+
+// A fake file failing all writes
+type failingFile struct {
+	*FakeFile
+}
+
+func (f *failingFile) Write(b []byte) (int, error) {
+	return 0, errors.New("bus error")
+}
@@ -0,0 +1,112 @@
+// Package board describes the IO Pi boards by the MCP23017 chips on them,
+// so all pins of a board can be addressed as one. The chips are driven by
+// package iopi.
+package board
+
+import (
+	"fmt"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// The chips of a board
+type Profile struct {
+	Name      string
+	Addresses []byte // default i2c address of each chip, in pin order
+}
+
+var (
+	IOPiPlus = Profile{Name: "IO Pi Plus", Addresses: []byte{0x20, 0x21}}
+	IOPiZero = Profile{Name: "IO Pi Zero", Addresses: []byte{0x20}}
+)
+
+// Profiles by name, e.g. for configuration files.
+var Profiles = map[string]Profile{
+	"iopi-plus": IOPiPlus,
+	"iopi-zero": IOPiZero,
+}
+
+// Number of pins on the board, 16 per chip.
+func (p Profile) Pins() int {
+	return 16 * len(p.Addresses)
+}
+
+// Board is an open board, with a device for each of its chips.
+type Board struct {
+	Profile   Profile
+	Devices   []*iopi.Device // in the order of Profile.Addresses
+	Numbering iopi.Numbering // of pin labels, see ParsePin and PinLabel
+}
+
+// Open the chips of a board on the bus at `path`, without touching their
+// configuration, see iopi.Open. Call Init on the devices to reset them.
+func Open(path string, p Profile) (*Board, error) {
+	b := &Board{Profile: p}
+	for _, addr := range p.Addresses {
+		dev, err := iopi.Open(path, addr)
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("failed to open %s: %s", p.Name, err)
+		}
+		b.Devices = append(b.Devices, dev)
+	}
+	return b, nil
+}
+
+// Close all devices of the board. Returns the first error.
+func (b *Board) Close() error {
+	var first error
+	for _, dev := range b.Devices {
+		if err := dev.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Return the device and its pin 1-16 for pin `n` of the board, numbered
+// from 1 across the chips, e.g. 17-32 for the second chip of an IO Pi
+// Plus.
+func (b *Board) Pin(n int) (*iopi.Device, uint8, error) {
+	if n < 1 || n > 16*len(b.Devices) {
+		return nil, 0, fmt.Errorf("invalid pin: %d", n)
+	}
+	return b.Devices[(n-1)/16], uint8((n-1)%16 + 1), nil
+}
+
+// Return the pin of the board for a label in its numbering, e.g. 17 for
+// "16" numbered from zero or "C0" numbered by port, continuing across the
+// chips.
+func (b *Board) ParsePin(s string) (int, error) {
+	n, err := b.Numbering.Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	if n > 16*len(b.Devices) {
+		return 0, fmt.Errorf("invalid pin: %s", s)
+	}
+	return n, nil
+}
+
+// Return the label of pin `n` of the board in its numbering.
+func (b *Board) PinLabel(n int) string {
+	return b.Numbering.Format(n)
+}
+
+// Write a pin of the board, see Pin.
+func (b *Board) WritePin(n int, state iopi.State) error {
+	dev, pin, err := b.Pin(n)
+	if err != nil {
+		return err
+	}
+	return dev.WritePin(pin, state)
+}
+
+// Read a pin of the board, see Pin.
+func (b *Board) ReadPin(n int) (iopi.State, error) {
+	dev, pin, err := b.Pin(n)
+	if err != nil {
+		return 0, err
+	}
+	return dev.ReadPin(pin)
+}
@@ -0,0 +1,81 @@
+package board
+
+import (
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestBoard(t *testing.T) {
+	t.Run("numbers pins across chips", func(t *testing.T) {
+		b, err := Open("sim://board-pins", IOPiPlus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		if IOPiPlus.Pins() != 32 || len(b.Devices) != 2 {
+			t.Fatal("unexpected board", b)
+		}
+		for n, expected := range map[int]struct {
+			dev int
+			pin uint8
+		}{1: {0, 1}, 16: {0, 16}, 17: {1, 1}, 32: {1, 16}} {
+			dev, pin, err := b.Pin(n)
+			if err != nil || dev != b.Devices[expected.dev] || pin != expected.pin {
+				t.Errorf("pin %d: unexpected device or pin %d, %v", n, pin, err)
+			}
+		}
+		for _, n := range []int{0, 33} {
+			if _, _, err := b.Pin(n); err == nil {
+				t.Error("expected error for pin", n)
+			}
+		}
+	})
+
+	t.Run("drives the second chip", func(t *testing.T) {
+		b, err := Open("sim://board-write", IOPiPlus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		if err := b.Devices[1].SetPinMode(2, iopi.Output); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.WritePin(18, iopi.High); err != nil {
+			t.Fatal(err)
+		}
+		if state, _ := b.ReadPin(18); state != 1 {
+			t.Error("pin 18 not high")
+		}
+		chip, _ := iopi.SimChip("sim://board-write", 0x21)
+		if !chip.Level(2) {
+			t.Error("pin 2 of the second chip not high")
+		}
+	})
+
+	t.Run("labels pins in its numbering", func(t *testing.T) {
+		b := &Board{Devices: make([]*iopi.Device, 2), Numbering: iopi.NumberByPort}
+		if n, err := b.ParsePin("c1"); err != nil || n != 18 {
+			t.Error("unexpected pin", n, err)
+		}
+		if label := b.PinLabel(32); label != "D7" {
+			t.Error("unexpected label", label)
+		}
+		if _, err := b.ParsePin("E0"); err == nil {
+			t.Error("expected error for pin past the board")
+		}
+
+		b.Numbering = iopi.NumberFromZero
+		if n, _ := b.ParsePin("31"); n != 32 {
+			t.Error("unexpected pin", n)
+		}
+	})
+
+	t.Run("fails on missing chips", func(t *testing.T) {
+		if _, err := Open("sim://board-missing", Profile{Name: "test", Addresses: []byte{0x20, 0x27}}); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+// Package bus is the transport layer of package iopi: it opens the i2c
+// buses devices are reached through, on Linux, simulated in memory, or on
+// another machine over TCP.
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// File is an open bus with a device selected. Reads and writes are i2c
+// transfers with the device. The file descriptor of an i2c bus is only
+// used when opening it.
+type File interface {
+	io.ReadWriteCloser
+	Name() string // path of the bus
+}
+
+// As defined in /usr/include/linux/i2c-dev.h
+const I2C_SLAVE = 0x0703
+
+// Range of valid 7-bit i2c addresses, excluding reserved addresses
+const (
+	MinAddress = 0x03
+	MaxAddress = 0x77
+)
+
+// Returned when opening an i2c bus on a platform other than Linux. The
+// simulated buses, see SimPrefix, work on all platforms.
+var ErrUnsupportedPlatform = errors.New("i2c buses are only supported on linux")
+
+// Open the i2c bus at `path` and select the device at `addr`. The path
+// may be a simulated bus, see SimPrefix, or a remote bus, see
+// RemotePrefix.
+func Open(path string, addr byte) (File, error) {
+	if IsSimulated(path) {
+		return openSim(path, addr)
+	}
+	if IsRemote(path) {
+		return openRemote(path, addr)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, os.ModeCharDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open i2c device at '%s': %s", path, err)
+	}
+
+	err = retry(func() error { return selectAddress(file.Fd(), int(addr)) })
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write to i2c device at address '%02b': %s",
+			addr, err)
+	}
+
+	return retryFile{file}, nil
+}
+
+// Attempts of a transfer failing with a transient error, see transient
+const transientAttempts = 4
+
+// Return true for errors of transfers that may succeed if repeated: the
+// call was interrupted by a signal, or the adapter was busy, e.g. having
+// lost arbitration of the bus.
+func transient(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)
+}
+
+// Call `fn` until it succeeds, fails with an error that is not transient,
+// or has been called transientAttempts times.
+func retry(fn func() error) error {
+	var err error
+	for i := 0; i < transientAttempts; i++ {
+		if err = fn(); !transient(err) {
+			break
+		}
+	}
+	return err
+}
+
+// An i2c bus retrying transfers failing with transient errors, so a
+// signal received by the process, e.g. from systemd or a profiler, does
+// not fail an operation of a device.
+type retryFile struct {
+	*os.File
+}
+
+func (f retryFile) Read(p []byte) (n int, err error) {
+	err = retry(func() error {
+		n, err = f.File.Read(p)
+		return err
+	})
+	return n, err
+}
+
+func (f retryFile) Write(p []byte) (n int, err error) {
+	err = retry(func() error {
+		n, err = f.File.Write(p)
+		return err
+	})
+	return n, err
+}
+
+// Probe all valid i2c addresses on the bus at `path` by attempting a one
+// byte read, and return the addresses that answered. This is the same
+// method as `i2cdetect -r`. A simulated bus lists the addresses of its
+// chips, and a remote bus is scanned by its server.
+func Scan(path string) ([]byte, error) {
+	if IsSimulated(path) {
+		return append([]byte(nil), SimAddresses...), nil
+	}
+	if IsRemote(path) {
+		return scanRemote(path)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, os.ModeCharDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open i2c device at '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	var found []byte
+	buf := make([]byte, 1)
+	for addr := MinAddress; addr <= MaxAddress; addr++ {
+		if err := selectAddress(file.Fd(), addr); err != nil {
+			return nil, fmt.Errorf("failed to select address 0x%02x: %s", addr, err)
+		}
+		if _, err := file.Read(buf); err == nil {
+			found = append(found, byte(addr))
+		}
+	}
+
+	return found, nil
+}
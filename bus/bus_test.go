@@ -0,0 +1,91 @@
+package bus
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	t.Run("opens simulated buses", func(t *testing.T) {
+		file, err := Open("sim://bus-open", 0x21)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Name() != "sim://bus-open" {
+			t.Error("unexpected name", file.Name())
+		}
+		if _, err := file.Write([]byte{0x14, 0x01}); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		chip, _ := SimChip("sim://bus-open", 0x21)
+		if chip.Register(0x14) != 0x01 {
+			t.Error("write did not reach the chip")
+		}
+	})
+
+	t.Run("fails on missing devices", func(t *testing.T) {
+		if _, err := Open("sim://bus-open", 0x27); err == nil {
+			t.Error("expected error for missing simulated device")
+		}
+		if _, err := Open("/nonexistent/i2c-1", 0x20); err == nil {
+			t.Error("expected error for missing bus")
+		}
+	})
+}
+
+func TestScan(t *testing.T) {
+	found, err := Scan("sim://bus-scan")
+	if err != nil || string(found) != string(SimAddresses) {
+		t.Error("unexpected addresses", found, err)
+	}
+	if _, err := Scan("/nonexistent/i2c-1"); err == nil {
+		t.Error("expected error for missing bus")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	// Fail with the errors in turn, then succeed
+	failing := func(calls *int, errs ...error) func() error {
+		return func() error {
+			*calls++
+			if len(errs) == 0 {
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		}
+	}
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		var calls int
+		interrupted := &os.PathError{Op: "read", Path: "/dev/i2c-1", Err: syscall.EINTR}
+		err := retry(failing(&calls, interrupted, syscall.EAGAIN))
+		if err != nil || calls != 3 {
+			t.Error("expected success after 3 calls, got", calls, err)
+		}
+	})
+
+	t.Run("gives up after a bounded number of attempts", func(t *testing.T) {
+		var calls int
+		errs := make([]error, 10)
+		for i := range errs {
+			errs[i] = syscall.EAGAIN
+		}
+		if err := retry(failing(&calls, errs...)); err != syscall.EAGAIN || calls != transientAttempts {
+			t.Error("unexpected result", calls, err)
+		}
+	})
+
+	t.Run("returns other errors", func(t *testing.T) {
+		var calls int
+		other := errors.New("remote I/O error")
+		if err := retry(failing(&calls, other)); err != other || calls != 1 {
+			t.Error("unexpected result", calls, err)
+		}
+	})
+}
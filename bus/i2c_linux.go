@@ -0,0 +1,9 @@
+package bus
+
+import "golang.org/x/sys/unix"
+
+// Select the device at `addr` for the reads and writes of the i2c bus
+// open as `fd`.
+func selectAddress(fd uintptr, addr int) error {
+	return unix.IoctlSetInt(int(fd), I2C_SLAVE, addr)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package bus
+
+func selectAddress(fd uintptr, addr int) error {
+	return ErrUnsupportedPlatform
+}
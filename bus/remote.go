@@ -0,0 +1,301 @@
+package bus
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bus paths starting with RemotePrefix, e.g. tcp://pi:4020/dev/i2c-1,
+// select a bus on another machine served by a Server, so a program on a
+// workstation can drive a board attached to a Raspberry Pi during
+// development. The path after the host is the bus on the remote machine,
+// and may be simulated, e.g. tcp://pi:4020/sim://demo.
+//
+// The protocol has no authentication or encryption of its own. Only serve
+// buses on trusted networks, or over TLS, see RemoteTLSPrefix.
+const RemotePrefix = "tcp://"
+
+// Bus paths starting with RemoteTLSPrefix, e.g. tls://pi:4020/dev/i2c-1,
+// select a remote bus reached over TLS, configured by RemoteTLSConfig. The
+// server must listen with TLS, e.g. through tls.NewListener, and may
+// require client certificates.
+const RemoteTLSPrefix = "tls://"
+
+// Configuration of TLS connections to remote buses. The system roots
+// verify servers if nil.
+var RemoteTLSConfig *tls.Config
+
+// Time allowed for each transfer with a remote bus, including the network
+// round trip.
+var RemoteTimeout = 5 * time.Second
+
+// Operations of the remote protocol. A request is a frame with one of these
+// operations, answered by a frame with statusOK and the result, or
+// statusError and an error message. A frame is the operation or status
+// byte, followed by a big-endian 16-bit length and the payload.
+const (
+	opOpen  = 'O' // payload: address, then path; selects the device of the connection
+	opScan  = 'S' // payload: path; answered with the addresses found
+	opWrite = 'W' // payload: data to write; answered with the 16-bit number of bytes written
+	opRead  = 'R' // payload: 16-bit number of bytes to read; answered with the data
+
+	statusOK    = 0
+	statusError = 1
+)
+
+// Return true if the path selects a remote bus.
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, RemotePrefix) || strings.HasPrefix(path, RemoteTLSPrefix)
+}
+
+// Split a remote bus path into the address of the server and the path of
+// the bus on the remote machine.
+func splitRemote(path string) (string, string, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, RemotePrefix), RemoteTLSPrefix)
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", fmt.Errorf("invalid remote bus: %s", path)
+	}
+
+	host, bus := rest[:i], rest[i+1:]
+	if !IsSimulated(bus) {
+		bus = "/" + bus
+	}
+	return host, bus, nil
+}
+
+// A device selected on a remote bus, over its own connection
+type remoteFile struct {
+	conn net.Conn
+	name string
+	buf  []byte // of received frames; transfers are serialised by the device mutex
+}
+
+// Dial the server of a remote bus path and send a request. Returns the
+// connection and the result.
+func dialRemote(path string, op byte, payload []byte) (net.Conn, []byte, error) {
+	host, bus, err := splitRemote(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var conn net.Conn
+	if strings.HasPrefix(path, RemoteTLSPrefix) {
+		dialer := &net.Dialer{Timeout: RemoteTimeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, RemoteTLSConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", host, RemoteTimeout)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %s", host, err)
+	}
+
+	res, err := request(conn, op, append(payload, bus...), nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, res, nil
+}
+
+func openRemote(path string, addr byte) (File, error) {
+	conn, _, err := dialRemote(path, opOpen, []byte{addr})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open remote bus %s: %s", path, err)
+	}
+	return &remoteFile{conn: conn, name: path, buf: make([]byte, 64)}, nil
+}
+
+func scanRemote(path string) ([]byte, error) {
+	conn, addrs, err := dialRemote(path, opScan, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan remote bus %s: %s", path, err)
+	}
+	conn.Close()
+	return addrs, nil
+}
+
+func (f *remoteFile) Write(b []byte) (int, error) {
+	res, err := request(f.conn, opWrite, b, f.buf)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 2 {
+		return 0, fmt.Errorf("invalid write result: %d bytes", len(res))
+	}
+	if n := int(binary.BigEndian.Uint16(res)); n < len(b) {
+		return n, io.ErrShortWrite
+	}
+	return len(b), nil
+}
+
+func (f *remoteFile) Read(b []byte) (int, error) {
+	var n [2]byte
+	binary.BigEndian.PutUint16(n[:], uint16(len(b)))
+	data, err := request(f.conn, opRead, n[:], f.buf)
+	if err != nil {
+		return 0, err
+	}
+	return copy(b, data), nil
+}
+
+func (f *remoteFile) Close() error {
+	return f.conn.Close()
+}
+
+func (f *remoteFile) Name() string {
+	return f.name
+}
+
+// Send a request and wait for its result, read into `buf` if large enough.
+func request(conn net.Conn, op byte, payload []byte, buf []byte) ([]byte, error) {
+	conn.SetDeadline(time.Now().Add(RemoteTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := writeFrame(conn, op, payload); err != nil {
+		return nil, err
+	}
+	status, res, err := readFrame(conn, buf)
+	if err != nil {
+		return nil, err
+	}
+	if status != statusOK {
+		return nil, errors.New(string(res))
+	}
+	return res, nil
+}
+
+// Buffers of frames being written, so transfers do not allocate
+var framePool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+func writeFrame(w io.Writer, kind byte, payload []byte) error {
+	if len(payload) > 0xFFFF {
+		return fmt.Errorf("frame too large: %d bytes", len(payload))
+	}
+	bp := framePool.Get().(*[]byte)
+	defer framePool.Put(bp)
+
+	buf := append((*bp)[:0], kind, byte(len(payload)>>8), byte(len(payload)))
+	buf = append(buf, payload...)
+	*bp = buf
+	_, err := w.Write(buf)
+	return err
+}
+
+// Read a frame, with the payload in `buf` if it is large enough, or newly
+// allocated.
+func readFrame(r io.Reader, buf []byte) (byte, []byte, error) {
+	if cap(buf) < 3 {
+		buf = make([]byte, 3)
+	}
+	head := buf[:3]
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	kind, n := head[0], int(binary.BigEndian.Uint16(head[1:]))
+
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	payload := buf[:n]
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return kind, payload, nil
+}
+
+// Server serves local buses to clients opening remote bus paths, see
+// RemotePrefix. Each connection selects one device.
+type Server struct {
+	Paths []string // buses that may be opened, e.g. /dev/i2c-1; none if empty
+}
+
+// Accept connections until the listener is closed. Returns the error of
+// the listener.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// Serve requests on a connection until it is closed by the client, then
+// close the device opened, if any.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	var file File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	buf := make([]byte, 0xFFFF)
+	req := make([]byte, 0xFFFF)
+	for {
+		op, payload, err := readFrame(conn, req)
+		if err != nil {
+			return
+		}
+
+		var res []byte
+		switch {
+		case op == opOpen && file == nil && len(payload) > 1:
+			path := string(payload[1:])
+			if err = s.allow(path); err == nil {
+				file, err = Open(path, payload[0])
+			}
+		case op == opScan && file == nil:
+			path := string(payload)
+			if err = s.allow(path); err == nil {
+				res, err = Scan(path)
+			}
+		case op == opWrite && file != nil:
+			var n int
+			n, err = file.Write(payload)
+			res = buf[:2]
+			binary.BigEndian.PutUint16(res, uint16(n))
+		case op == opRead && file != nil && len(payload) == 2:
+			var n int
+			n, err = file.Read(buf[:binary.BigEndian.Uint16(payload)])
+			res = buf[:n]
+		default:
+			err = fmt.Errorf("unexpected request: %c", op)
+		}
+
+		if err != nil {
+			err = writeFrame(conn, statusError, []byte(err.Error()))
+		} else {
+			err = writeFrame(conn, statusOK, res)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Return an error if the bus at `path` may not be served.
+func (s *Server) allow(path string) error {
+	if IsRemote(path) {
+		return fmt.Errorf("remote bus not served: %s", path)
+	}
+	for _, p := range s.Paths {
+		if p == path {
+			return nil
+		}
+	}
+	return fmt.Errorf("bus not served: %s", path)
+}
@@ -0,0 +1,187 @@
+package bus
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Serve buses on a local port. Returns the prefix of remote bus paths.
+func serveRemote(t *testing.T, s *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go s.Serve(l)
+	return RemotePrefix + l.Addr().String() + "/"
+}
+
+func TestRemote(t *testing.T) {
+	t.Run("reads and writes a remote device", func(t *testing.T) {
+		prefix := serveRemote(t, &Server{Paths: []string{"sim://remote-rw"}})
+
+		file, err := Open(prefix+"sim://remote-rw", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if file.Name() != prefix+"sim://remote-rw" {
+			t.Error("unexpected name", file.Name())
+		}
+		if n, err := file.Write([]byte{0x14, 0x5A}); err != nil || n != 2 {
+			t.Fatal("write failed", n, err)
+		}
+		chip, _ := SimChip("sim://remote-rw", 0x20)
+		if chip.Register(0x14) != 0x5A {
+			t.Error("register not written on the remote bus")
+		}
+
+		file.Write([]byte{0x14})
+		buf := make([]byte, 1)
+		if n, err := file.Read(buf); err != nil || n != 1 || buf[0] != 0x5A {
+			t.Error("unexpected read", buf, n, err)
+		}
+	})
+
+	t.Run("reports remote errors", func(t *testing.T) {
+		prefix := serveRemote(t, &Server{Paths: []string{"sim://remote-error", "sim://remote-missing"}})
+
+		if _, err := Open(prefix+"sim://remote-missing", 0x27); err == nil {
+			t.Error("expected error for missing device")
+		}
+
+		file, _ := Open(prefix+"sim://remote-error", 0x20)
+		defer file.Close()
+		if _, err := file.Write([]byte{0x16}); err == nil {
+			t.Error("expected error for invalid register")
+		}
+	})
+
+	t.Run("reports short writes", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			readFrame(server, nil)
+			writeFrame(server, statusOK, []byte{0x00, 0x01})
+		}()
+
+		file := &remoteFile{conn: client, buf: make([]byte, 64)}
+		if n, err := file.Write([]byte{0x14, 0x5A}); n != 1 || err != io.ErrShortWrite {
+			t.Error("unexpected write", n, err)
+		}
+	})
+
+	t.Run("scans a remote bus", func(t *testing.T) {
+		prefix := serveRemote(t, &Server{Paths: []string{"sim://remote-scan"}})
+
+		addrs, err := Scan(prefix + "sim://remote-scan")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(addrs, SimAddresses) {
+			t.Error("unexpected addresses", addrs)
+		}
+	})
+
+	t.Run("only serves allowed buses", func(t *testing.T) {
+		prefix := serveRemote(t, &Server{Paths: []string{"sim://remote-allowed"}})
+
+		if _, err := Open(prefix+"sim://remote-denied", 0x20); err == nil {
+			t.Error("expected error for bus not served")
+		}
+		file, err := Open(prefix+"sim://remote-allowed", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		prefix = serveRemote(t, &Server{})
+		if _, err := Open(prefix+"sim://remote-allowed", 0x20); err == nil {
+			t.Error("expected error without allowed buses")
+		}
+	})
+
+	t.Run("connects over tls", func(t *testing.T) {
+		certs, err := iopitest.WriteCertificates(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := tls.LoadX509KeyPair(certs.ServerCert, certs.ServerKey)
+		client, _ := tls.LoadX509KeyPair(certs.ClientCert, certs.ClientKey)
+		ca, _ := os.ReadFile(certs.CA)
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go (&Server{Paths: []string{"sim://remote-tls"}}).Serve(l)
+		path := RemoteTLSPrefix + l.Addr().String() + "/sim://remote-tls"
+
+		defer func() { RemoteTLSConfig = nil }()
+		RemoteTLSConfig = &tls.Config{RootCAs: pool}
+		if _, err := Open(path, 0x20); err == nil {
+			t.Error("expected error without a client certificate")
+		}
+
+		RemoteTLSConfig = &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{client}}
+		file, err := Open(path, 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.Write([]byte{0x14, 0x01}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("parses remote paths", func(t *testing.T) {
+		host, bus, err := splitRemote("tcp://pi:4020/dev/i2c-1")
+		if err != nil || host != "pi:4020" || bus != "/dev/i2c-1" {
+			t.Error("unexpected split", host, bus, err)
+		}
+		for _, path := range []string{"tcp://pi:4020", "tcp:///dev/i2c-1", "tcp://pi:4020/"} {
+			if _, _, err := splitRemote(path); err == nil {
+				t.Error("expected error for", path)
+			}
+		}
+	})
+}
+
+func TestFrameAllocations(t *testing.T) {
+	payload := []byte{0x14, 0x5A}
+	writeFrame(io.Discard, opWrite, payload) // fills the pool
+
+	if n := testing.AllocsPerRun(100, func() { writeFrame(io.Discard, opWrite, payload) }); n != 0 {
+		t.Error("writing a frame allocates", n)
+	}
+
+	var frame bytes.Buffer
+	writeFrame(&frame, statusOK, payload)
+	r := bytes.NewReader(frame.Bytes())
+	buf := make([]byte, 16)
+	n := testing.AllocsPerRun(100, func() {
+		r.Seek(0, io.SeekStart)
+		if _, res, err := readFrame(r, buf); err != nil || !bytes.Equal(res, payload) {
+			t.Fatal("unexpected frame", res, err)
+		}
+	})
+	if n != 0 {
+		t.Error("reading a frame into a buffer allocates", n)
+	}
+}
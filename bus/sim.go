@@ -0,0 +1,82 @@
+package bus
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Bus paths starting with SimPrefix, e.g. sim://demo, select a simulated
+// bus held in memory instead of an i2c device, so applications can run
+// without hardware, e.g. for demos and CI. Use it anywhere a bus path is
+// taken, such as iopi.Open, Scan or IOPI_BUS.
+//
+// A simulated bus holds an IO Pi Plus: an MCP23017 at each of
+// SimAddresses. Chips keep their state for the lifetime of the process,
+// across Close and reopening, and buses with different names are
+// independent. Inputs are driven through the chip returned by SimChip.
+const SimPrefix = "sim://"
+
+// Addresses of the chips on a simulated bus
+var SimAddresses = []byte{0x20, 0x21}
+
+var simBuses = struct {
+	sync.Mutex
+	chips map[string]*iopitest.Chip // by path and address
+}{chips: make(map[string]*iopitest.Chip)}
+
+// Return true if the path selects a simulated bus.
+func IsSimulated(path string) bool {
+	return strings.HasPrefix(path, SimPrefix)
+}
+
+// Return the chip at `addr` on the simulated bus at `path`, e.g. to drive
+// its inputs.
+func SimChip(path string, addr byte) (*iopitest.Chip, error) {
+	if !IsSimulated(path) {
+		return nil, fmt.Errorf("not a simulated bus: %s", path)
+	}
+
+	found := false
+	for _, a := range SimAddresses {
+		found = found || a == addr
+	}
+	if !found {
+		return nil, fmt.Errorf("no device at address 0x%02x on %s", addr, path)
+	}
+
+	simBuses.Lock()
+	defer simBuses.Unlock()
+
+	key := fmt.Sprintf("%s@%02x", path, addr)
+	chip, ok := simBuses.chips[key]
+	if !ok {
+		chip = iopitest.NewChip()
+		simBuses.chips[key] = chip
+	}
+	return chip, nil
+}
+
+// A handle to a simulated chip. Closing it leaves the chip in place.
+type simFile struct {
+	*iopitest.Chip
+	path string
+}
+
+func openSim(path string, addr byte) (*simFile, error) {
+	chip, err := SimChip(path, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open i2c device at '%s': %s", path, err)
+	}
+	return &simFile{chip, path}, nil
+}
+
+func (f *simFile) Close() error {
+	return nil
+}
+
+func (f *simFile) Name() string {
+	return f.path
+}
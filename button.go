@@ -0,0 +1,147 @@
+package iopi
+
+import (
+	"context"
+	"time"
+)
+
+type ButtonEventType int
+
+const (
+	ButtonPress ButtonEventType = iota
+	ButtonRelease
+	ButtonLongPress   // held for Button.LongPress, sent while still held
+	ButtonDoublePress // pressed again within Button.DoublePress of the last press
+)
+
+func (t ButtonEventType) String() string {
+	switch t {
+	case ButtonPress:
+		return "press"
+	case ButtonRelease:
+		return "release"
+	case ButtonLongPress:
+		return "long-press"
+	case ButtonDoublePress:
+		return "double-press"
+	default:
+		return "unknown"
+	}
+}
+
+type ButtonEvent struct {
+	Type ButtonEventType
+	Pin  uint8
+	Time time.Time
+	Held time.Duration // how long the button was held, for releases and long presses
+}
+
+// Button classifies the changes of an input pin into presses, releases,
+// long presses and double presses. Debounce the pin on the poller if the
+// button bounces.
+type Button struct {
+	LongPress   time.Duration // hold time of a long press
+	DoublePress time.Duration // maximum time between the presses of a double press
+	ActiveLow   bool          // pressed when low, e.g. wired to ground with a pull-up
+	Clock       Clock
+
+	pin       uint8
+	poller    *Poller
+	events    chan ButtonEvent
+	pressed   bool
+	pressedAt time.Time
+	lastPress time.Time
+	long      bool // long press sent for the current press
+}
+
+// Create a button on a pin watched by a poller. The poller must be run
+// separately.
+func NewButton(poller *Poller, pin uint8) *Button {
+	return &Button{
+		LongPress:   time.Second,
+		DoublePress: 300 * time.Millisecond,
+		pin:         pin,
+		poller:      poller,
+		events:      make(chan ButtonEvent, subscriberBuffer),
+	}
+}
+
+// Return the channel of button events. Events are dropped if the channel
+// is not read.
+func (b *Button) Events() <-chan ButtonEvent {
+	return b.events
+}
+
+// Classify pin events until the context is cancelled.
+func (b *Button) Run(ctx context.Context) error {
+	events, cancel := b.poller.Subscribe()
+	defer cancel()
+
+	clock := ClockOr(b.Clock)
+	var hold <-chan time.Time // fires LongPress after a press
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-events:
+			if ev.Pin != b.pin {
+				continue
+			}
+			b.emit(b.handle(ev))
+			hold = nil
+			if b.pressed {
+				hold = clock.After(b.LongPress)
+			}
+		case now := <-hold:
+			hold = nil
+			b.emit(b.hold(now))
+		}
+	}
+}
+
+// Classify a change of the pin.
+func (b *Button) handle(ev PinEvent) []ButtonEvent {
+	pressed := ev.State != Low
+	if b.ActiveLow {
+		pressed = !pressed
+	}
+	if pressed == b.pressed {
+		return nil
+	}
+	b.pressed = pressed
+
+	if !pressed {
+		return []ButtonEvent{{ButtonRelease, b.pin, ev.Time, ev.Time.Sub(b.pressedAt)}}
+	}
+
+	events := []ButtonEvent{{ButtonPress, b.pin, ev.Time, 0}}
+	if !b.lastPress.IsZero() && ev.Time.Sub(b.lastPress) <= b.DoublePress {
+		events = append(events, ButtonEvent{ButtonDoublePress, b.pin, ev.Time, 0})
+		b.lastPress = time.Time{} // a third press starts a new pair
+	} else {
+		b.lastPress = ev.Time
+	}
+	b.pressedAt, b.long = ev.Time, false
+	return events
+}
+
+// Report a long press if the button is still held.
+func (b *Button) hold(now time.Time) []ButtonEvent {
+	held := now.Sub(b.pressedAt)
+	if !b.pressed || b.long || held < b.LongPress {
+		return nil
+	}
+	b.long = true
+	return []ButtonEvent{{ButtonLongPress, b.pin, now, held}}
+}
+
+// Send events without blocking.
+func (b *Button) emit(events []ButtonEvent) {
+	for _, ev := range events {
+		select {
+		case b.events <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package iopi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func types(events []ButtonEvent) []ButtonEventType {
+	var t []ButtonEventType
+	for _, ev := range events {
+		t = append(t, ev.Type)
+	}
+	return t
+}
+
+func TestButtonClassify(t *testing.T) {
+	start := time.Unix(0, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	change := func(state State, ms int) PinEvent {
+		return PinEvent{Pin: 1, State: state, Time: at(ms)}
+	}
+
+	t.Run("presses and releases", func(t *testing.T) {
+		b := NewButton(nil, 1)
+		if ev := b.handle(change(High, 0)); len(ev) != 1 || ev[0].Type != ButtonPress {
+			t.Error("expected press", ev)
+		}
+		ev := b.handle(change(Low, 150))
+		if len(ev) != 1 || ev[0].Type != ButtonRelease || ev[0].Held != 150*time.Millisecond {
+			t.Error("expected release", ev)
+		}
+	})
+
+	t.Run("detects double presses", func(t *testing.T) {
+		b := NewButton(nil, 1)
+		b.handle(change(High, 0))
+		b.handle(change(Low, 50))
+		ev := b.handle(change(High, 200))
+		if len(ev) != 2 || ev[1].Type != ButtonDoublePress {
+			t.Error("expected double press", types(ev))
+		}
+
+		// A third press does not pair with the second
+		b.handle(change(Low, 250))
+		if ev := b.handle(change(High, 300)); len(ev) != 1 {
+			t.Error("unexpected double press", types(ev))
+		}
+
+		// Presses further apart are single presses
+		b.handle(change(Low, 350))
+		if ev := b.handle(change(High, 1000)); len(ev) != 1 {
+			t.Error("unexpected double press", types(ev))
+		}
+	})
+
+	t.Run("detects long presses once", func(t *testing.T) {
+		b := NewButton(nil, 1)
+		b.handle(change(High, 0))
+		if ev := b.hold(at(500)); ev != nil {
+			t.Error("early long press", ev)
+		}
+		ev := b.hold(at(1000))
+		if len(ev) != 1 || ev[0].Type != ButtonLongPress || ev[0].Held != time.Second {
+			t.Error("expected long press", ev)
+		}
+		if ev := b.hold(at(2000)); ev != nil {
+			t.Error("repeated long press", ev)
+		}
+		b.handle(change(Low, 2500))
+		if ev := b.hold(at(3000)); ev != nil {
+			t.Error("long press after release", ev)
+		}
+	})
+
+	t.Run("supports active low buttons", func(t *testing.T) {
+		b := NewButton(nil, 1)
+		b.ActiveLow = true
+		if ev := b.handle(change(Low, 0)); len(ev) != 1 || ev[0].Type != ButtonPress {
+			t.Error("expected press", ev)
+		}
+	})
+}
+
+func TestButtonRun(t *testing.T) {
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+	clock := iopitest.NewFakeClock(time.Unix(0, 0))
+	poller := NewPoller(dev, time.Hour, 1)
+	poller.Clock = clock
+	b := NewButton(poller, 1)
+	b.Clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+
+	// Wait for the subscription before polling
+	for i := 0; ; i++ {
+		poller.mutex.Lock()
+		n := len(poller.subs)
+		poller.mutex.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("button did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	file.NextRead = []byte{0x00}
+	poller.Poll()
+	file.NextRead = []byte{0x01}
+	poller.Poll()
+
+	expect := func(expected ButtonEventType, held time.Duration) {
+		t.Helper()
+		select {
+		case ev := <-b.Events():
+			if ev.Type != expected || ev.Pin != 1 || ev.Held != held {
+				t.Error("unexpected event", ev.Type, ev.Held, "expected", expected, held)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+	}
+
+	expect(ButtonPress, 0)
+	clock.BlockUntil(1) // the long press timer
+	clock.Advance(b.LongPress)
+	expect(ButtonLongPress, b.LongPress)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,71 @@
+package iopi
+
+import (
+	"fmt"
+	"time"
+)
+
+// The highest tone frequency a Buzzer will try to produce, in Hz.
+//
+// Every edge is a read and a write of the GPIO register over I2C, which
+// takes around half a millisecond at the default 100 kHz bus speed. That
+// is at most about 1000 edges a second, two per period, so 500 Hz is the
+// highest tone the bus can carry. Scheduling jitter makes tones near it
+// rough. Use a self-oscillating (active) buzzer or a PWM capable pin for
+// anything that needs a clean or high pitched tone.
+const MaxToneFrequency = 500
+
+// Buzzer plays beeps on an output pin connected to a buzzer, using a
+// Blinker to time them. The pin must be set to output beforehand.
+type Buzzer struct {
+	blinker *Blinker
+	pin     uint8
+}
+
+func NewBuzzer(blinker *Blinker, pin uint8) *Buzzer {
+	return &Buzzer{blinker: blinker, pin: pin}
+}
+
+// Beep `repeat` times for `d`, with a pause of `d` between beeps. Returns
+// without waiting for the beeps to finish; see Wait.
+func (b *Buzzer) Beep(d time.Duration, repeat int) error {
+	if repeat < 1 {
+		return fmt.Errorf("invalid repeat: %d", repeat)
+	}
+	return b.Play(Pattern{d, d}, repeat)
+}
+
+// Play a pattern `count` times, or until stopped if count is 0.
+func (b *Buzzer) Play(p Pattern, count int) error {
+	return b.blinker.PlayCount(b.pin, p, count)
+}
+
+// Beep SOS in morse code once.
+func (b *Buzzer) SOS() error {
+	return b.Play(SOS, 1)
+}
+
+// Toggle the pin at `freq` Hz for `d`, for buzzers without an oscillator
+// of their own. Frequencies above MaxToneFrequency are refused.
+func (b *Buzzer) Tone(freq int, d time.Duration) error {
+	if freq < 1 || freq > MaxToneFrequency {
+		return fmt.Errorf("invalid tone frequency: %d Hz (max %d Hz)", freq, MaxToneFrequency)
+	}
+
+	half := time.Second / time.Duration(2*freq)
+	periods := int(d / (2 * half))
+	if periods < 1 {
+		return fmt.Errorf("tone duration %s is shorter than one period", d)
+	}
+	return b.Play(Pattern{half, half}, periods)
+}
+
+// Wait until the current beeps have finished.
+func (b *Buzzer) Wait() {
+	b.blinker.Wait(b.pin)
+}
+
+// Stop beeping and leave the pin low.
+func (b *Buzzer) Stop() error {
+	return b.blinker.Stop(b.pin)
+}
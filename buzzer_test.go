@@ -0,0 +1,70 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuzzer(t *testing.T) {
+	t.Run("beeps", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		bz := NewBuzzer(NewBlinker(dev), 9)
+
+		if err := bz.Beep(time.Millisecond, 2); err != nil {
+			t.Fatal(err)
+		}
+		bz.Wait()
+
+		if n := gpioWrites(dev, file, GPIOB); n != 5 {
+			t.Error("unexpected number of writes", n)
+		}
+	})
+
+	t.Run("plays tones", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		bz := NewBuzzer(NewBlinker(dev), 1)
+
+		// 5 periods of 2ms
+		if err := bz.Tone(MaxToneFrequency, 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		bz.Wait()
+
+		if n := gpioWrites(dev, file, GPIOA); n != 11 {
+			t.Error("unexpected number of writes", n)
+		}
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		b := NewBlinker(dev)
+		bz := NewBuzzer(b, 1)
+
+		bz.Play(Pattern{time.Second, time.Second}, 0)
+		if err := bz.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		if b.Playing(1) {
+			t.Error("still playing")
+		}
+	})
+
+	t.Run("rejects invalid tones", func(t *testing.T) {
+		bz := NewBuzzer(NewBlinker(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})), 1)
+		if bz.Tone(MaxToneFrequency+1, time.Second) == nil {
+			t.Error("expected error above max frequency")
+		}
+		if bz.Tone(0, time.Second) == nil {
+			t.Error("expected error for zero frequency")
+		}
+		if bz.Tone(100, time.Millisecond) == nil {
+			t.Error("expected error for duration shorter than a period")
+		}
+		if bz.Beep(time.Millisecond, 0) == nil {
+			t.Error("expected error for zero repeats")
+		}
+	})
+}
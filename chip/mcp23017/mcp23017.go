@@ -0,0 +1,97 @@
+// Package mcp23017 holds the register map of the MCP23017 16-bit I/O
+// expander used on IO Pi boards, for the driver in package iopi and the
+// fake in package iopitest. Package iopi re-exports it for backwards
+// compatibility. It is not a driver: package iopi drives MCP23017 chips
+// only.
+package mcp23017
+
+import "fmt"
+
+// Register is a register of the chip, by its address in the default
+// register layout (IOCON.BANK=0).
+type Register byte
+
+// Registers in the default register layout (IOCON.BANK=0), as defined in
+// the C implementation
+const (
+	IODIRA   Register = 0x00
+	IODIRB   Register = 0x01
+	IPOLA    Register = 0x02
+	IPOLB    Register = 0x03
+	GPINTENA Register = 0x04
+	GPINTENB Register = 0x05
+	DEFVALA  Register = 0x06
+	DEFVALB  Register = 0x07
+	INTCONA  Register = 0x08
+	INTCONB  Register = 0x09
+	IOCON    Register = 0x0A
+	GPPUA    Register = 0x0C
+	GPPUB    Register = 0x0D
+	INTFA    Register = 0x0E
+	INTFB    Register = 0x0F
+	INTCAPA  Register = 0x10
+	INTCAPB  Register = 0x11
+	GPIOA    Register = 0x12
+	GPIOB    Register = 0x13
+	OLATA    Register = 0x14
+	OLATB    Register = 0x15
+)
+
+// Names of the registers indexed by address. IOCON is mirrored at two
+// addresses.
+var registerNames = [...]string{
+	IODIRA:    "IODIRA",
+	IODIRB:    "IODIRB",
+	IPOLA:     "IPOLA",
+	IPOLB:     "IPOLB",
+	GPINTENA:  "GPINTENA",
+	GPINTENB:  "GPINTENB",
+	DEFVALA:   "DEFVALA",
+	DEFVALB:   "DEFVALB",
+	INTCONA:   "INTCONA",
+	INTCONB:   "INTCONB",
+	IOCON:     "IOCON",
+	IOCON + 1: "IOCON",
+	GPPUA:     "GPPUA",
+	GPPUB:     "GPPUB",
+	INTFA:     "INTFA",
+	INTFB:     "INTFB",
+	INTCAPA:   "INTCAPA",
+	INTCAPB:   "INTCAPB",
+	GPIOA:     "GPIOA",
+	GPIOB:     "GPIOB",
+	OLATA:     "OLATA",
+	OLATB:     "OLATB",
+}
+
+// Number of registers on the chip
+const RegisterCount = len(registerNames)
+
+// Return the name of a register, or its address in hex if unknown.
+func RegisterName(reg byte) string {
+	return Register(reg).String()
+}
+
+// Return the name of the register, e.g. "IODIRA", or its address in hex
+// if unknown.
+func (r Register) String() string {
+	if int(r) < len(registerNames) {
+		return registerNames[r]
+	}
+	return fmt.Sprintf("0x%02X", byte(r))
+}
+
+// Return the port of the register, 0 for A and 1 for B. IOCON is on both.
+func (r Register) Port() int {
+	return int(r) % 2
+}
+
+// Return the address of the register in the register layout selected by
+// IOCON.BANK. With BANK=1 the registers of each port are grouped, port A
+// at 0x00-0x0A and port B at 0x10-0x1A.
+func (r Register) Address(bank bool) byte {
+	if !bank {
+		return byte(r)
+	}
+	return byte(r.Port()*0x10) + byte(r)/2
+}
@@ -0,0 +1,40 @@
+package mcp23017
+
+import "testing"
+
+func TestRegisterName(t *testing.T) {
+	for reg, expected := range map[Register]string{
+		IODIRA:    "IODIRA",
+		IOCON:     "IOCON",
+		IOCON + 1: "IOCON",
+		OLATB:     "OLATB",
+		0x16:      "0x16",
+	} {
+		if name := reg.String(); name != expected || RegisterName(byte(reg)) != expected {
+			t.Errorf("register %s: expected %s, got %s", reg, expected, name)
+		}
+	}
+	if RegisterCount != 0x16 {
+		t.Error("unexpected register count", RegisterCount)
+	}
+}
+
+func TestRegisterAddress(t *testing.T) {
+	for reg, expected := range map[Register]byte{
+		IODIRA:    0x00,
+		IODIRB:    0x10,
+		IPOLB:     0x11,
+		IOCON:     0x05,
+		IOCON + 1: 0x15,
+		GPIOA:     0x09,
+		OLATA:     0x0A,
+		OLATB:     0x1A,
+	} {
+		if addr := reg.Address(false); addr != byte(reg) {
+			t.Errorf("%s: bank 0 address 0x%02x", reg, addr)
+		}
+		if addr := reg.Address(true); addr != expected {
+			t.Errorf("%s: expected bank 1 address 0x%02x, got 0x%02x", reg, expected, addr)
+		}
+	}
+}
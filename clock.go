@@ -0,0 +1,59 @@
+package iopi
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits for the timing dependent features of the
+// package, so they can be tested with a fake clock instead of sleeping,
+// see iopitest.FakeClock. Features take a Clock in their Clock field, and
+// use the real clock if it is nil.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// The clock of the system
+var RealClock Clock = realClock{}
+
+// Return the clock, or the real clock if it is nil, for features taking a
+// Clock in other packages.
+func ClockOr(c Clock) Clock {
+	if c == nil {
+		return RealClock
+	}
+	return c
+}
+
+// Wait for `d` on the clock (the real clock if nil), or until the context
+// is cancelled. Returns the error of the context.
+func SleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+
+	select {
+	case <-ClockOr(clock).After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait for `d`.
+func sleep(clock Clock, d time.Duration) {
+	if d > 0 {
+		<-ClockOr(clock).After(d)
+	}
+}
@@ -0,0 +1,83 @@
+package iopi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// A fake clock advancing by itself, recording every wait
+type recordingClock struct {
+	*iopitest.FakeClock
+
+	mutex sync.Mutex
+	waits []time.Duration
+}
+
+func newRecordingClock() *recordingClock {
+	c := &recordingClock{FakeClock: iopitest.NewFakeClock(time.Unix(0, 0))}
+	c.AutoAdvance(true)
+	return c
+}
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	c.waits = append(c.waits, d)
+	c.mutex.Unlock()
+	return c.FakeClock.After(d)
+}
+
+func (c *recordingClock) Waits() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
+
+func TestSleepContext(t *testing.T) {
+	t.Run("waits for the clock", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		done := make(chan error)
+		go func() { done <- SleepContext(context.Background(), clock, time.Second) }()
+
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("returns when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		if err := SleepContext(ctx, clock, time.Hour); err != context.Canceled {
+			t.Error("expected cancellation, got", err)
+		}
+		if err := SleepContext(ctx, clock, 0); err != context.Canceled {
+			t.Error("expected cancellation without waiting, got", err)
+		}
+	})
+
+	t.Run("does not wait for no time", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		if err := SleepContext(context.Background(), clock, -time.Second); err != nil || clock.Waiters() != 0 {
+			t.Error("waited", err)
+		}
+	})
+
+	t.Run("defaults to the real clock", func(t *testing.T) {
+		if ClockOr(nil) != RealClock {
+			t.Error("nil clock is not the real clock")
+		}
+		start := time.Now()
+		if err := SleepContext(context.Background(), nil, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(start) < time.Millisecond {
+			t.Error("returned early")
+		}
+	})
+}
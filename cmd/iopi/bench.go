@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Operations measured by bench
+var benchOps = map[string]func(dev *iopi.Device, olat byte) error{
+	// A read of port A, as done by a poller
+	"read": func(dev *iopi.Device, _ byte) error {
+		_, err := dev.ReadPort(iopi.PortA)
+		return err
+	},
+	// A write of the current output latches of port A back to the chip,
+	// so outputs don't change
+	"write": func(dev *iopi.Device, olat byte) error {
+		return dev.WriteByteData(iopi.OLATA, olat)
+	},
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	duration := fs.Duration("duration", 5*time.Second, "time to run each operation for")
+	ops := fs.String("ops", "read,write", "operations to measure: read, write")
+	devFlags := addDeviceFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *duration <= 0 {
+		return errUsage
+	}
+
+	names := strings.Split(*ops, ",")
+	for _, name := range names {
+		if benchOps[name] == nil {
+			return fmt.Errorf("unknown operation: %s", name)
+		}
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	var results []benchResult
+	for _, name := range names {
+		res, err := bench(dev, name, *duration)
+		if err != nil {
+			return err
+		}
+		results = append(results, res)
+	}
+
+	lines := []string{fmt.Sprintf("%-6s %8s %10s %10s %10s %10s %10s %6s",
+		"op", "count", "ops/s", "p50", "p90", "p99", "max", "errors")}
+	for _, r := range results {
+		lines = append(lines, r.String())
+	}
+	printResult(strings.Join(lines, "\n"), results)
+	return nil
+}
+
+// Throughput and latency of an operation
+type benchResult struct {
+	Op     string        `json:"op"`
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	Rate   float64       `json:"ops_per_second"`
+	P50    time.Duration `json:"p50_ns"`
+	P90    time.Duration `json:"p90_ns"`
+	P99    time.Duration `json:"p99_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+func (r benchResult) String() string {
+	return fmt.Sprintf("%-6s %8d %10.0f %10s %10s %10s %10s %6d",
+		r.Op, r.Count, r.Rate, r.P50, r.P90, r.P99, r.Max, r.Errors)
+}
+
+// Run an operation back to back for `d` and measure each call. Failed
+// calls are counted, not timed.
+func bench(dev *iopi.Device, op string, d time.Duration) (benchResult, error) {
+	olat, err := dev.ReadByteData(iopi.OLATA)
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	res := benchResult{Op: op}
+	var latencies []time.Duration
+	start := time.Now()
+	for time.Since(start) < d {
+		t := time.Now()
+		if err := benchOps[op](dev, olat); err != nil {
+			res.Errors++
+			continue
+		}
+		latencies = append(latencies, time.Since(t))
+	}
+	elapsed := time.Since(start)
+
+	res.Count = len(latencies)
+	res.Rate = float64(res.Count) / elapsed.Seconds()
+	if res.Count > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		res.P50 = percentile(latencies, 50)
+		res.P90 = percentile(latencies, 90)
+		res.P99 = percentile(latencies, 99)
+		res.Max = latencies[len(latencies)-1]
+	}
+	return res, nil
+}
+
+// Return the p-th percentile of sorted latencies, by the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
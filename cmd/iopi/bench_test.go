@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	for p, expected := range map[int]time.Duration{50: 50, 90: 90, 99: 99, 100: 100, 0: 1} {
+		if got := percentile(sorted, p); got != expected {
+			t.Errorf("p%d: expected %d, got %d", p, expected, got)
+		}
+	}
+	if got := percentile(sorted[:1], 50); got != 1 {
+		t.Error("unexpected percentile of one sample", got)
+	}
+}
+
+func TestBench(t *testing.T) {
+	dev, err := iopi.Open(iopi.SimPrefix+"bench", 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	if err := dev.WriteByteData(iopi.OLATA, 0x5A); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{"read", "write"} {
+		res, err := bench(dev, op, 10*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Count == 0 || res.Errors != 0 || res.Rate <= 0 {
+			t.Error("unexpected result", res)
+		}
+		if res.P50 > res.P90 || res.P90 > res.P99 || res.P99 > res.Max {
+			t.Error("percentiles out of order", res)
+		}
+	}
+
+	if olat, _ := dev.ReadByteData(iopi.OLATA); olat != 0x5A {
+		t.Errorf("outputs changed by bench: 0x%02x", olat)
+	}
+}
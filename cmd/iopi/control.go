@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stigok/go-io-pi/config"
+	"github.com/stigok/go-io-pi/httpapi"
+)
+
+// Add the --socket flag, reading and writing pins through the control
+// socket of iopid instead of opening the bus.
+func addSocketFlag(fs *flag.FlagSet) *string {
+	return fs.String("socket", os.Getenv(config.EnvPrefix+"SOCKET"), "control socket of iopid to use instead of the bus")
+}
+
+// Send a get or set command for a pin given by number or name to the
+// control socket at `path`, see httpapi.Server.ServeControl.
+func controlPin(path string, cmd string, addr uint, pin string, args ...string) (httpapi.PinState, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return httpapi.PinState{}, fmt.Errorf("failed to connect to iopid: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	line := []string{cmd, pin}
+	if _, err := strconv.ParseUint(pin, 10, 8); err == nil {
+		line = []string{cmd, fmt.Sprintf("0x%02x", addr), pin}
+	}
+	line = append(line, args...)
+	if _, err := fmt.Fprintln(conn, strings.Join(line, " ")); err != nil {
+		return httpapi.PinState{}, fmt.Errorf("failed to send command to iopid: %s", err)
+	}
+
+	var res struct {
+		httpapi.PinState
+		Error string `json:"error"`
+	}
+	data, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return httpapi.PinState{}, fmt.Errorf("failed to read response of iopid: %s", err)
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return httpapi.PinState{}, fmt.Errorf("invalid response of iopid: %s", err)
+	}
+	if res.Error != "" {
+		return httpapi.PinState{}, errors.New(res.Error)
+	}
+	return res.PinState, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/httpapi"
+)
+
+func TestControlPin(t *testing.T) {
+	file := iopi.NewFakeFile()
+	s := httpapi.NewServer(iopi.NewDevice(file, 0x21, &sync.Mutex{}))
+	a := iopi.NewAliases()
+	a.Set("pump", iopi.PinRef{Address: 0x21, Pin: 5})
+	s.SetAliases(a)
+
+	path := filepath.Join(t.TempDir(), "iopid.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeControl(l)
+
+	t.Run("reads a pin by number", func(t *testing.T) {
+		file.NextRead = []byte{0b00000100}
+		res, err := controlPin(path, "get", 0x21, "3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Pin != 3 || res.State != iopi.High {
+			t.Error("unexpected result", res)
+		}
+	})
+
+	t.Run("writes a pin by name", func(t *testing.T) {
+		res, err := controlPin(path, "set", 0x20, "pump", "high")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Pin != 5 || res.Name != "pump" {
+			t.Error("unexpected result", res)
+		}
+	})
+
+	t.Run("returns errors of the daemon", func(t *testing.T) {
+		if _, err := controlPin(path, "get", 0x20, "3"); err == nil {
+			t.Error("expected error for unknown device")
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+func runDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	regs, err := dev.DumpRegisters()
+	if err != nil {
+		return err
+	}
+
+	lines := make([]string, len(regs))
+	for i, r := range regs {
+		lines[i] = r.String()
+	}
+
+	printResult(strings.Join(lines, "\n"), regs)
+	return nil
+}
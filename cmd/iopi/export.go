@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/stigok/go-io-pi/config"
+)
+
+func runExportConfig(args []string) error {
+	fs := flag.NewFlagSet("export-config", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	dc, err := config.ExportConfig(dev)
+	if err != nil {
+		return err
+	}
+
+	cfg := &config.Config{Devices: []config.Device{dc}}
+	data, err := cfg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	printResult(strings.TrimSpace(string(data)), cfg)
+	return nil
+}
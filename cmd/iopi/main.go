@@ -0,0 +1,376 @@
+// Command iopi reads and drives the pins of an IO Pi board from the shell.
+//
+//	iopi write --bus /dev/i2c-1 --addr 0x20 --pin 3 high
+//	iopi read --pin 3
+//	iopi port read A
+//	iopi port write A 0xFF
+//	iopi watch --pins 1-8 --format json
+//	iopi scan /dev/i2c-1
+//	iopi dump --addr 0x20
+//	iopi export-config --addr 0x20 > iopi.yaml
+//	iopi tui
+//	iopi run sequence.yaml
+//	iopi selftest harness.yaml
+//	iopi bench --duration 10s
+//	iopi serve-bus --listen :4020 /dev/i2c-1
+//	iopi serve-bus --cert pi.pem --key pi-key.pem --client-ca clients.pem
+//
+// All commands accept --json to print machine-readable output. The bus and
+// address default to $IOPI_BUS and $IOPI_ADDR when set. A bus of the form
+// sim://name is simulated in memory, for trying things out without a
+// board, and a bus of the form tcp://host:port/dev/i2c-1 is reached
+// through `iopi serve-bus` running on that host. Use tls:// instead of
+// tcp:// if it serves with --cert, with $IOPI_TLS_CA to verify it, and
+// $IOPI_TLS_CERT and $IOPI_TLS_KEY if it requires a client certificate.
+//
+// With --socket (or $IOPI_SOCKET) pointing to the control socket of a
+// running iopid, read and write go through the daemon owning the bus, and
+// pins may be given by the names it knows:
+//
+//	iopi read --socket /run/iopid.sock --pin pump
+//
+// With --config (or $IOPI_CONFIG) pointing to a configuration file (see
+// package config), pins can be given by name, which also selects their
+// device, and names are shown in the output:
+//
+//	iopi write --config /etc/iopid.yaml --pin conveyor_start high
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/config"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"read", "read [flags] --pin N|NAME", runRead},
+		{"write", "write [flags] --pin N|NAME high|low", runWrite},
+		{"port", "port [flags] read A|B\n  port [flags] write A|B VALUE", runPort},
+		{"watch", "watch [flags] [--pins 1-8,10] [--format table|csv|json]", runWatch},
+		{"scan", "scan [--identify] [BUS]", runScan},
+		{"dump", "dump [flags]", runDump},
+		{"export-config", "export-config [flags]", runExportConfig},
+		{"tui", "tui [flags]", runTUI},
+		{"run", "run [flags] SEQUENCE.yaml", runSequence},
+		{"selftest", "selftest [flags] HARNESS.yaml", runSelftest},
+		{"bench", "bench [flags] [--duration 5s] [--ops read,write]", runBench},
+		{"serve-bus", "serve-bus [--listen :4020] [--cert FILE --key FILE [--client-ca FILE]] [BUS]", runServeBus},
+	}
+}
+
+// Returned when the command line is invalid. Makes main print usage.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		err := configureRemoteTLS()
+		if err == nil {
+			err = cmd.run(os.Args[2:])
+		}
+		if err == errUsage {
+			fmt.Fprintf(os.Stderr, "usage: iopi %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		if err != nil {
+			printError(errors.New(strings.TrimSpace(err.Error())))
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  iopi %s\n", cmd.usage)
+	}
+}
+
+// Flags selecting the device, shared by all commands.
+type deviceFlags struct {
+	bus    string
+	addr   uint
+	config string
+}
+
+func addDeviceFlags(fs *flag.FlagSet) *deviceFlags {
+	f := &deviceFlags{}
+	bus, addr := "/dev/i2c-1", uint(0x20)
+	if s, ok := os.LookupEnv(config.EnvPrefix + "BUS"); ok {
+		bus = s
+	}
+	if s, ok := os.LookupEnv(config.EnvPrefix + "ADDR"); ok {
+		if n, err := config.ParseAddress(s); err == nil {
+			addr = uint(n)
+		}
+	}
+	fs.StringVar(&f.bus, "bus", bus, "path to the i2c bus")
+	fs.UintVar(&f.addr, "addr", addr, "i2c address of the device")
+	fs.StringVar(&f.config, "config", os.Getenv(config.EnvPrefix+"CONFIG"), "configuration file naming the pins")
+	addOutputFlags(fs)
+	return f
+}
+
+func (f *deviceFlags) open() (*iopi.Device, error) {
+	if f.addr > 0x7F {
+		return nil, fmt.Errorf("invalid address: 0x%x", f.addr)
+	}
+	return iopi.Open(f.bus, byte(f.addr))
+}
+
+// Load the configuration given with --config. Returns nil if there is none.
+func (f *deviceFlags) loadConfig() (*config.Config, error) {
+	if f.config == "" {
+		return nil, nil
+	}
+	return config.Load(f.config)
+}
+
+// Return the pin names of the configuration given with --config. Returns
+// nil if there is none.
+func (f *deviceFlags) aliases() (*iopi.Aliases, error) {
+	cfg, err := f.loadConfig()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	return cfg.Aliases(), nil
+}
+
+// Parse a pin given by number, or by name if --config is given. A named
+// pin also selects its device. Returns the name of the pin, if any.
+func (f *deviceFlags) resolvePin(s string) (uint8, string, error) {
+	cfg, err := f.loadConfig()
+	if err != nil {
+		return 0, "", err
+	}
+
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+		if err := checkPin(uint(n)); err != nil {
+			return 0, "", err
+		}
+		var name string
+		if cfg != nil {
+			name = cfg.Aliases().Name(iopi.PinRef{Address: byte(f.addr), Pin: uint8(n)})
+		}
+		return uint8(n), name, nil
+	}
+
+	if cfg == nil {
+		return 0, "", fmt.Errorf("invalid pin: %s (pin names require --config)", s)
+	}
+	dc, p, err := cfg.Lookup(s)
+	if err != nil {
+		return 0, "", err
+	}
+	f.bus, f.addr = dc.Bus, uint(dc.Address)
+	return p.Pin, p.Name, nil
+}
+
+type pinResult struct {
+	Pin   uint8      `json:"pin"`
+	State iopi.State `json:"state"`
+	Name  string     `json:"name,omitempty"`
+}
+
+type portResult struct {
+	Port  string `json:"port"`
+	State byte   `json:"state"`
+}
+
+func runRead(args []string) error {
+	fs := flag.NewFlagSet("read", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	pinFlag := fs.String("pin", "", "pin number 1-16, or name with --config")
+	socket := addSocketFlag(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	if *socket != "" {
+		res, err := controlPin(*socket, "get", devFlags.addr, *pinFlag)
+		if err != nil {
+			return err
+		}
+		text, _ := res.State.MarshalText()
+		printResult(string(text), pinResult{res.Pin, res.State, res.Name})
+		return nil
+	}
+	pin, name, err := devFlags.resolvePin(*pinFlag)
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	state, err := dev.ReadPin(pin)
+	if err != nil {
+		return err
+	}
+
+	text, _ := state.MarshalText()
+	printResult(string(text), pinResult{pin, state, name})
+	return nil
+}
+
+func runWrite(args []string) error {
+	fs := flag.NewFlagSet("write", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	pinFlag := fs.String("pin", "", "pin number 1-16, or name with --config")
+	socket := addSocketFlag(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	if *socket != "" {
+		res, err := controlPin(*socket, "set", devFlags.addr, *pinFlag, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		printResult("", pinResult{res.Pin, res.State, res.Name})
+		return nil
+	}
+	pin, name, err := devFlags.resolvePin(*pinFlag)
+	if err != nil {
+		return err
+	}
+	state, err := iopi.ParseState(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	// Latch the state before switching to output, so the pin does not
+	// briefly drive the previous latch
+	if err := dev.WritePin(pin, state); err != nil {
+		return err
+	}
+	if err := dev.SetPinMode(pin, iopi.Output); err != nil {
+		return err
+	}
+
+	printResult("", pinResult{pin, state, name})
+	return nil
+}
+
+func runPort(args []string) error {
+	fs := flag.NewFlagSet("port", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() < 2 {
+		return errUsage
+	}
+
+	port, err := iopi.ParsePort(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "read":
+		if fs.NArg() != 2 {
+			return errUsage
+		}
+		dev, err := devFlags.open()
+		if err != nil {
+			return err
+		}
+		defer dev.Close()
+
+		val, err := dev.ReadPort(port)
+		if err != nil {
+			return err
+		}
+		printResult(fmt.Sprintf("0x%02X 0b%08b", val, val), portResult{fs.Arg(1), val})
+		return nil
+	case "write":
+		if fs.NArg() != 3 {
+			return errUsage
+		}
+		val, err := strconv.ParseUint(fs.Arg(2), 0, 8)
+		if err != nil {
+			return fmt.Errorf("invalid port value: %s", fs.Arg(2))
+		}
+		dev, err := devFlags.open()
+		if err != nil {
+			return err
+		}
+		defer dev.Close()
+
+		if err := dev.WritePort(port, byte(val)); err != nil {
+			return err
+		}
+		if err := dev.SetPortMode(port, iopi.Output); err != nil {
+			return err
+		}
+
+		printResult("", portResult{fs.Arg(1), byte(val)})
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func checkPin(pin uint) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	return nil
+}
+
+// Parse a list of pins and pin ranges, e.g. "1-8,10".
+func parsePins(s string) ([]uint8, error) {
+	var pins []uint8
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pins: %s", s)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pins: %s", s)
+			}
+		}
+		if first > last || checkPin(uint(first)) != nil || checkPin(uint(last)) != nil {
+			return nil, fmt.Errorf("invalid pins: %s", s)
+		}
+		for p := first; p <= last; p++ {
+			pins = append(pins, uint8(p))
+		}
+	}
+	return pins, nil
+}
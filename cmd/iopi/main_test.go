@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestCommandUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"--pin", "3", "extra"},
+		{"--nope"},
+	} {
+		if err := runRead(args); err != errUsage {
+			t.Error("expected usage error for", args, err)
+		}
+	}
+
+	if err := runRead([]string{"--pin", "17"}); err == nil || err == errUsage {
+		t.Error("expected invalid pin error", err)
+	}
+	if err := runPort([]string{"toggle", "A"}); err != errUsage {
+		t.Error("expected usage error", err)
+	}
+}
+
+func TestResolvePin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "iopi.yaml")
+	os.WriteFile(path, []byte(`
+devices:
+  - bus: /dev/i2c-3
+    address: 0x21
+    pins: [{pin: 12, name: conveyor_start}]
+`), 0644)
+
+	t.Run("resolves names", func(t *testing.T) {
+		f := &deviceFlags{bus: "/dev/i2c-1", addr: 0x20, config: path}
+		pin, name, err := f.resolvePin("conveyor_start")
+		if err != nil || pin != 12 || name != "conveyor_start" {
+			t.Error("unexpected pin", pin, name, err)
+		}
+		if f.bus != "/dev/i2c-3" || f.addr != 0x21 {
+			t.Error("device not selected", f.bus, f.addr)
+		}
+	})
+
+	t.Run("names numbered pins", func(t *testing.T) {
+		f := &deviceFlags{addr: 0x21, config: path}
+		if _, name, err := f.resolvePin("12"); err != nil || name != "conveyor_start" {
+			t.Error("unexpected name", name, err)
+		}
+	})
+
+	t.Run("requires config for names", func(t *testing.T) {
+		f := &deviceFlags{addr: 0x20}
+		if _, _, err := f.resolvePin("conveyor_start"); err == nil {
+			t.Error("expected error")
+		}
+		if pin, _, err := f.resolvePin("3"); err != nil || pin != 3 {
+			t.Error("unexpected pin", pin, err)
+		}
+	})
+
+	t.Run("rejects unknown names", func(t *testing.T) {
+		f := &deviceFlags{config: path}
+		if _, _, err := f.resolvePin("pump"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestWriteLatchesFirst(t *testing.T) {
+	chip, err := iopi.SimChip("sim://cli-write", 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sim chips outlive a test run
+	chip.Write([]byte{byte(iopi.IODIRA), 0xFF})
+	chip.Write([]byte{byte(iopi.OLATA), 0x00})
+
+	// Fail switching to output, leaving only what was written before
+	chip.Inject(iopitest.Fault{Op: iopitest.WriteOp, Registers: []byte{byte(iopi.IODIRA)}})
+
+	if err := runWrite([]string{"--bus", "sim://cli-write", "--pin", "2", "high"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if chip.Register(byte(iopi.OLATA))&0x02 == 0 || chip.IsOutput(2) {
+		t.Error("pin not latched before switching to output")
+	}
+	if err := runPort([]string{"--bus", "sim://cli-write", "write", "A", "0x0F"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if chip.Register(byte(iopi.OLATA)) != 0x0F {
+		t.Error("port not latched before switching to output")
+	}
+
+	chip.ClearFaults()
+	if err := runWrite([]string{"--bus", "sim://cli-write", "--pin", "2", "low"}); err != nil {
+		t.Fatal(err)
+	}
+	if !chip.IsOutput(2) || chip.Level(2) {
+		t.Error("pin not written")
+	}
+}
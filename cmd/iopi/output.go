@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Output settings shared by all commands
+var (
+	jsonOutput bool
+	started    = time.Now()
+)
+
+// Envelope of all JSON output
+type jsonResult struct {
+	OK        bool        `json:"ok"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ElapsedMs float64     `json:"elapsed_ms"`
+}
+
+func addOutputFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&jsonOutput, "json", false, "print machine-readable JSON")
+}
+
+// Print the result of a command: `text` normally, or `result` wrapped in a
+// JSON envelope with --json. Empty text prints nothing.
+func printResult(text string, result interface{}) {
+	if jsonOutput {
+		printJSON(jsonResult{OK: true, Result: result})
+		return
+	}
+	if text != "" {
+		fmt.Println(text)
+	}
+}
+
+// Print a failed command.
+func printError(err error) {
+	if jsonOutput {
+		printJSON(jsonResult{OK: false, Error: err.Error()})
+		return
+	}
+	fmt.Fprintln(os.Stderr, "iopi:", err)
+}
+
+func printJSON(res jsonResult) {
+	res.ElapsedMs = float64(time.Since(started).Microseconds()) / 1000
+	json.NewEncoder(os.Stdout).Encode(res)
+}
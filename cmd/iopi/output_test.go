@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Capture what `fn` prints to stdout.
+func captureStdout(t *testing.T, fn func()) []byte {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+
+	out, _ := io.ReadAll(r)
+	return out
+}
+
+func TestPrintResult(t *testing.T) {
+	defer func() { jsonOutput = false }()
+
+	t.Run("prints text by default", func(t *testing.T) {
+		jsonOutput = false
+		out := captureStdout(t, func() { printResult("high", pinResult{Pin: 3, State: iopi.High}) })
+		if string(out) != "high\n" {
+			t.Errorf("unexpected output: %q", out)
+		}
+	})
+
+	t.Run("prints json envelope", func(t *testing.T) {
+		jsonOutput = true
+		out := captureStdout(t, func() { printResult("high", pinResult{Pin: 3, State: iopi.High}) })
+
+		var res struct {
+			OK     bool      `json:"ok"`
+			Result pinResult `json:"result"`
+		}
+		if err := json.Unmarshal(out, &res); err != nil {
+			t.Fatal(err)
+		}
+		if !res.OK || res.Result.Pin != 3 || res.Result.State != iopi.High {
+			t.Errorf("unexpected output: %s", out)
+		}
+	})
+
+	t.Run("prints json errors", func(t *testing.T) {
+		jsonOutput = true
+		out := captureStdout(t, func() { printError(errors.New("bus on fire")) })
+
+		var res jsonResult
+		json.Unmarshal(out, &res)
+		if res.OK || res.Error != "bus on fire" {
+			t.Errorf("unexpected output: %s", out)
+		}
+	})
+}
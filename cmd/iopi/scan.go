@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func runScan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	identify := fs.Bool("identify", false, "identify chips at MCP23017 addresses (writes a register pointer)")
+	addOutputFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+
+	bus := "/dev/i2c-1"
+	if fs.NArg() == 1 {
+		bus = fs.Arg(0)
+	}
+
+	addrs, err := iopi.Scan(bus)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	results := []scanResult{}
+	for _, addr := range addrs {
+		chip := ""
+		if *identify && iopi.IsChipAddress(addr) {
+			chip, err = identifyChip(bus, addr)
+			if err != nil {
+				return err
+			}
+		}
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("0x%02x %s", addr, chip)))
+		results = append(results, scanResult{fmt.Sprintf("0x%02x", addr), chip})
+	}
+
+	printResult(strings.Join(lines, "\n"), results)
+	return nil
+}
+
+type scanResult struct {
+	Address string `json:"address"`
+	Chip    string `json:"chip,omitempty"`
+}
+
+func identifyChip(bus string, addr byte) (string, error) {
+	dev, err := iopi.Open(bus, addr)
+	if err != nil {
+		return "", err
+	}
+	defer dev.Close()
+
+	return dev.Identify()
+}
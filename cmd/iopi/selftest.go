@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"gopkg.in/yaml.v3"
+)
+
+// Loopback harness wiring, read from YAML or JSON:
+//
+//	settle: 5ms   # time between driving an output and reading the input
+//	pairs:
+//	  - {out: 1, in: 9}
+//	  - {out: 2, in: 10}
+type Harness struct {
+	Settle time.Duration `yaml:"settle"`
+	Pairs  []Loopback    `yaml:"pairs"`
+}
+
+// An output pin wired to an input pin
+type Loopback struct {
+	Out uint8 `yaml:"out"`
+	In  uint8 `yaml:"in"`
+}
+
+type loopbackResult struct {
+	Out    uint8  `json:"out"`
+	In     uint8  `json:"in"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func runSelftest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	h, err := loadHarness(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	results, err := h.Run(dev)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{fmt.Sprintf("%-4s %-4s %s", "OUT", "IN", "RESULT")}
+	failed := 0
+	for _, r := range results {
+		status := "pass"
+		if !r.Pass {
+			status = "FAIL " + r.Detail
+			failed++
+		}
+		lines = append(lines, fmt.Sprintf("%-4d %-4d %s", r.Out, r.In, status))
+	}
+	printResult(strings.Join(lines, "\n"), results)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d channels failed", failed, len(results))
+	}
+	return nil
+}
+
+func loadHarness(path string) (*Harness, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read harness: %s", err)
+	}
+
+	h := &Harness{Settle: 5 * time.Millisecond}
+	if err := yaml.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("failed to parse harness: %s", err)
+	}
+
+	if len(h.Pairs) == 0 {
+		return nil, errors.New("invalid harness: no pairs")
+	}
+	for i, p := range h.Pairs {
+		if checkPin(uint(p.Out)) != nil || checkPin(uint(p.In)) != nil || p.Out == p.In {
+			return nil, fmt.Errorf("invalid harness: pair %d: %d -> %d", i+1, p.Out, p.In)
+		}
+	}
+
+	return h, nil
+}
+
+// Configure the harness pins and check that every input follows its output
+// both high and low. Outputs are left low.
+func (h *Harness) Run(dev *iopi.Device) ([]loopbackResult, error) {
+	for _, p := range h.Pairs {
+		if err := dev.WritePin(p.Out, iopi.Low); err != nil {
+			return nil, err
+		}
+		if err := dev.SetPinMode(p.Out, iopi.Output); err != nil {
+			return nil, err
+		}
+		if err := dev.SetPinMode(p.In, iopi.Input); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]loopbackResult, len(h.Pairs))
+	for i, p := range h.Pairs {
+		res := loopbackResult{Out: p.Out, In: p.In, Pass: true}
+
+		var got [2]iopi.State
+		for j, state := range []iopi.State{iopi.High, iopi.Low} {
+			if err := dev.WritePin(p.Out, state); err != nil {
+				return nil, err
+			}
+			time.Sleep(h.Settle)
+			val, err := dev.ReadPin(p.In)
+			if err != nil {
+				return nil, err
+			}
+			got[j] = val
+		}
+
+		switch {
+		case got[0] == iopi.Low && got[1] == iopi.Low:
+			res.Pass, res.Detail = false, "stuck low"
+		case got[0] != iopi.Low && got[1] != iopi.Low:
+			res.Pass, res.Detail = false, "stuck high"
+		case got[0] == iopi.Low:
+			res.Pass, res.Detail = false, "inverted"
+		}
+		results[i] = res
+	}
+
+	return results, nil
+}
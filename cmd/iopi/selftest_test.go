@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func writeHarness(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "harness.yaml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadHarness(t *testing.T) {
+	h, err := loadHarness(writeHarness(t, "settle: 1ms\npairs:\n  - {out: 1, in: 9}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Pairs) != 1 || h.Pairs[0].In != 9 {
+		t.Error("unexpected harness", h)
+	}
+
+	for _, data := range []string{
+		"pairs: []",
+		"pairs: [{out: 1, in: 1}]",
+		"pairs: [{out: 1, in: 17}]",
+	} {
+		if _, err := loadHarness(writeHarness(t, data)); err == nil {
+			t.Error("expected error for", data)
+		}
+	}
+}
+
+func TestHarnessRun(t *testing.T) {
+	// The fake reads back the register address, GPIOB = 0b00010011, so
+	// pin 9 always reads high.
+	dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+	h := &Harness{Pairs: []Loopback{{Out: 1, In: 9}}}
+
+	results, err := h.Run(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Pass || results[0].Detail != "stuck high" {
+		t.Error("unexpected results", results)
+	}
+}
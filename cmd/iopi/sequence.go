@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"gopkg.in/yaml.v3"
+)
+
+// A sequence of pin changes, read from YAML or JSON:
+//
+//	repeat: 3          # -1 repeats forever, defaults to 1
+//	abort_if:          # stop when any input matches, checked continuously
+//	  - {pin: 9, state: high}
+//	steps:
+//	  - {pin: 1, state: high, delay: 100ms}
+//	  - {port: B, value: 0xFF}
+//	  - {delay: 1s}
+type Sequence struct {
+	Repeat  *int        `yaml:"repeat"`
+	AbortIf []Condition `yaml:"abort_if"`
+	Steps   []Step      `yaml:"steps"`
+}
+
+type Condition struct {
+	Pin   uint8  `yaml:"pin"`
+	State string `yaml:"state"`
+}
+
+// A step sets a pin or a port, then waits for `delay`. Both are optional.
+type Step struct {
+	Pin   uint8         `yaml:"pin"`
+	State string        `yaml:"state"`
+	Port  string        `yaml:"port"`
+	Value *uint8        `yaml:"value"`
+	Delay time.Duration `yaml:"delay"`
+}
+
+// Returned when a sequence is stopped by an abort condition
+var errAborted = errors.New("sequence aborted")
+
+// How often abort conditions are checked during delays
+const abortPollInterval = 10 * time.Millisecond
+
+func runSequence(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	seq, err := loadSequence(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start := time.Now()
+	err = seq.Run(ctx, dev)
+	printResult("", struct {
+		Steps     int     `json:"steps"`
+		ElapsedMs float64 `json:"elapsed_ms"`
+	}{len(seq.Steps), float64(time.Since(start).Microseconds()) / 1000})
+	return err
+}
+
+func loadSequence(path string) (*Sequence, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sequence: %s", err)
+	}
+
+	var seq Sequence
+	if err := yaml.Unmarshal(data, &seq); err != nil {
+		return nil, fmt.Errorf("failed to parse sequence: %s", err)
+	}
+	if err := seq.validate(); err != nil {
+		return nil, fmt.Errorf("invalid sequence: %s", err)
+	}
+
+	return &seq, nil
+}
+
+func (seq *Sequence) validate() error {
+	for i, c := range seq.AbortIf {
+		if err := checkPin(uint(c.Pin)); err != nil {
+			return fmt.Errorf("abort condition %d: %s", i+1, err)
+		}
+		if _, err := iopi.ParseState(c.State); err != nil {
+			return fmt.Errorf("abort condition %d: %s", i+1, err)
+		}
+	}
+
+	for i, s := range seq.Steps {
+		if s.Pin != 0 {
+			if err := checkPin(uint(s.Pin)); err != nil {
+				return fmt.Errorf("step %d: %s", i+1, err)
+			}
+			if _, err := iopi.ParseState(s.State); err != nil {
+				return fmt.Errorf("step %d: %s", i+1, err)
+			}
+		}
+		if s.Port != "" {
+			if _, err := iopi.ParsePort(s.Port); err != nil {
+				return fmt.Errorf("step %d: %s", i+1, err)
+			}
+			if s.Value == nil {
+				return fmt.Errorf("step %d: missing port value", i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Set the pins and ports used by the sequence to outputs and play it.
+// Returns errAborted if an abort condition was met.
+func (seq *Sequence) Run(ctx context.Context, dev *iopi.Device) error {
+	for _, s := range seq.Steps {
+		if s.Pin != 0 {
+			if err := dev.SetPinMode(s.Pin, iopi.Output); err != nil {
+				return err
+			}
+		}
+		if s.Port != "" {
+			port, _ := iopi.ParsePort(s.Port)
+			if err := dev.SetPortMode(port, iopi.Output); err != nil {
+				return err
+			}
+		}
+	}
+
+	repeat := 1
+	if seq.Repeat != nil {
+		repeat = *seq.Repeat
+	}
+
+	for i := 0; repeat < 0 || i < repeat; i++ {
+		for _, s := range seq.Steps {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := seq.checkAbort(dev); err != nil {
+				return err
+			}
+			if err := s.apply(dev); err != nil {
+				return err
+			}
+			if err := seq.wait(ctx, dev, s.Delay); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s Step) apply(dev *iopi.Device) error {
+	if s.Pin != 0 {
+		state, _ := iopi.ParseState(s.State)
+		if err := dev.WritePin(s.Pin, state); err != nil {
+			return err
+		}
+	}
+	if s.Port != "" {
+		port, _ := iopi.ParsePort(s.Port)
+		if err := dev.WritePort(port, *s.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sleep while checking abort conditions.
+func (seq *Sequence) wait(ctx context.Context, dev *iopi.Device, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return nil
+		}
+		if len(seq.AbortIf) > 0 && left > abortPollInterval {
+			left = abortPollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(left):
+		}
+
+		if err := seq.checkAbort(dev); err != nil {
+			return err
+		}
+	}
+}
+
+func (seq *Sequence) checkAbort(dev *iopi.Device) error {
+	for _, c := range seq.AbortIf {
+		state, err := dev.ReadPin(c.Pin)
+		if err != nil {
+			return err
+		}
+		want, _ := iopi.ParseState(c.State)
+		if (state != iopi.Low) == (want != iopi.Low) {
+			text, _ := want.MarshalText()
+			return fmt.Errorf("%w: pin %d is %s", errAborted, c.Pin, text)
+		}
+	}
+	return nil
+}
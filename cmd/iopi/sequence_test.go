@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func writeSequence(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "sequence.yaml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSequence(t *testing.T) {
+	t.Run("parses yaml", func(t *testing.T) {
+		seq, err := loadSequence(writeSequence(t, `
+repeat: 2
+abort_if:
+  - {pin: 9, state: high}
+steps:
+  - {pin: 1, state: high, delay: 100ms}
+  - {port: B, value: 0xFF}
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *seq.Repeat != 2 || len(seq.Steps) != 2 || len(seq.AbortIf) != 1 {
+			t.Error("unexpected sequence", seq)
+		}
+		if seq.Steps[0].Delay != 100*time.Millisecond || *seq.Steps[1].Value != 0xFF {
+			t.Error("unexpected steps", seq.Steps)
+		}
+	})
+
+	t.Run("parses json", func(t *testing.T) {
+		seq, err := loadSequence(writeSequence(t, `{"steps": [{"pin": 2, "state": "low"}]}`))
+		if err != nil || len(seq.Steps) != 1 {
+			t.Error("unexpected result", seq, err)
+		}
+	})
+
+	t.Run("rejects invalid steps", func(t *testing.T) {
+		for _, data := range []string{
+			`steps: [{pin: 17, state: high}]`,
+			`steps: [{pin: 1, state: maybe}]`,
+			`steps: [{port: C, value: 1}]`,
+			`steps: [{port: A}]`,
+			`abort_if: [{pin: 0, state: high}]`,
+		} {
+			if _, err := loadSequence(writeSequence(t, data)); err == nil {
+				t.Error("expected error for", data)
+			}
+		}
+	})
+}
+
+func TestSequenceRun(t *testing.T) {
+	t.Run("plays steps", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		value := uint8(0xAA)
+		repeat := 2
+		seq := &Sequence{
+			Repeat: &repeat,
+			Steps:  []Step{{Port: "B", Value: &value}},
+		}
+
+		if err := seq.Run(context.Background(), dev); err != nil {
+			t.Fatal(err)
+		}
+
+		writes := 0
+		for _, c := range file.CallHistory {
+			if c.Fn == "Write" && len(c.Arg) == 2 && c.Arg[0] == byte(iopi.GPIOB) {
+				writes++
+			}
+		}
+		if writes != 2 {
+			t.Error("expected two port writes, got", writes)
+		}
+		if !file.HasCall("Write", []byte{byte(iopi.IODIRB), 0x00}) {
+			t.Error("port not set to output", file.CallHistory)
+		}
+	})
+
+	t.Run("aborts on input", func(t *testing.T) {
+		// The fake reads back the register address, GPIOA = 0b00010010,
+		// so pin 2 reads high.
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+		seq := &Sequence{
+			AbortIf: []Condition{{Pin: 2, State: "high"}},
+			Steps:   []Step{{Delay: time.Second}},
+		}
+
+		err := seq.Run(context.Background(), dev)
+		if !errors.Is(err, errAborted) {
+			t.Error("expected abort", err)
+		}
+	})
+
+	t.Run("stops repeating when cancelled", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+		forever := -1
+		seq := &Sequence{Repeat: &forever, Steps: []Step{{Pin: 1, State: "high"}}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := seq.Run(ctx, dev); !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("expected cancellation", err)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/stigok/go-io-pi/bus"
+	"github.com/stigok/go-io-pi/config"
+)
+
+// Configure TLS connections to remote buses from IOPI_TLS_CERT,
+// IOPI_TLS_KEY and IOPI_TLS_CA, see config.TLSFromEnv.
+func configureRemoteTLS() error {
+	t := config.TLSFromEnv(os.LookupEnv)
+	if !t.Enabled() {
+		return nil
+	}
+	cfg, err := t.ClientConfig()
+	if err != nil {
+		return err
+	}
+	bus.RemoteTLSConfig = cfg
+	return nil
+}
+
+func runServeBus(args []string) error {
+	fs := flag.NewFlagSet("serve-bus", flag.ContinueOnError)
+	listen := fs.String("listen", ":4020", "address to accept connections on")
+	var t config.TLS
+	fs.StringVar(&t.Cert, "cert", "", "serve over TLS with this certificate (PEM)")
+	fs.StringVar(&t.Key, "key", "", "key of the TLS certificate (PEM)")
+	fs.StringVar(&t.CA, "client-ca", "", "require client certificates signed by this CA (PEM)")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+
+	path := "/dev/i2c-1"
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if t.Enabled() {
+		cfg, err := t.ServerConfig()
+		if err != nil {
+			return err
+		}
+		l = tls.NewListener(l, cfg)
+	}
+
+	fmt.Fprintf(os.Stderr, "serving %s on %s\n", path, l.Addr())
+	s := &bus.Server{Paths: []string{path}}
+	return s.Serve(l)
+}
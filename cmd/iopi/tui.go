@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// What is shown on screen
+type tuiState struct {
+	title    string
+	gpio     [2]byte
+	iodir    [2]byte
+	selected uint8 // pin 1-16
+	message  string
+}
+
+type tuiAction int
+
+const (
+	actionNone tuiAction = iota
+	actionQuit
+	actionToggle
+)
+
+func runTUI(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	interval := fs.Duration("interval", 50*time.Millisecond, "refresh interval")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	restore, err := rawTerminal(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// Alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	st := tuiState{
+		title:    fmt.Sprintf("IO Pi 0x%02x on %s", devFlags.addr, devFlags.bus),
+		selected: 1,
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		if err := readTUIState(dev, &st); err != nil {
+			return err
+		}
+		fmt.Print("\x1b[H\x1b[2J" + renderTUI(st))
+
+		select {
+		case <-ticker.C:
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch handleKey(key, &st) {
+			case actionQuit:
+				return nil
+			case actionToggle:
+				if err := togglePin(dev, &st); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func readTUIState(dev *iopi.Device, st *tuiState) error {
+	for _, port := range []iopi.Port{iopi.PortA, iopi.PortB} {
+		val, err := dev.ReadPort(port)
+		if err != nil {
+			return err
+		}
+		st.gpio[port] = val
+
+		reg := iopi.IODIRA
+		if port == iopi.PortB {
+			reg = iopi.IODIRB
+		}
+		dir, err := dev.ReadByteData(reg)
+		if err != nil {
+			return err
+		}
+		st.iodir[port] = dir
+	}
+	return nil
+}
+
+func togglePin(dev *iopi.Device, st *tuiState) error {
+	bit, port := iopi.GetPinPort(st.selected)
+	if iopi.GetBit(st.iodir[port], bit) == 1 {
+		st.message = fmt.Sprintf("pin %d is an input", st.selected)
+		return nil
+	}
+
+	state := iopi.State(iopi.High)
+	if iopi.GetBit(st.gpio[port], bit) == 1 {
+		state = iopi.Low
+	}
+	st.message = ""
+	return dev.WritePin(st.selected, state)
+}
+
+// Update the selection from a key press and return what to do.
+func handleKey(key []byte, st *tuiState) tuiAction {
+	switch string(key) {
+	case "q", "\x1b":
+		return actionQuit
+	case " ", "\n", "\r":
+		return actionToggle
+	case "l", "\x1b[C":
+		if st.selected < 16 {
+			st.selected++
+		}
+	case "h", "\x1b[D":
+		if st.selected > 1 {
+			st.selected--
+		}
+	case "j", "\x1b[B":
+		if st.selected <= 8 {
+			st.selected += 8
+		}
+	case "k", "\x1b[A":
+		if st.selected > 8 {
+			st.selected -= 8
+		}
+	}
+	return actionNone
+}
+
+func renderTUI(st tuiState) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", st.title)
+
+	for _, port := range []iopi.Port{iopi.PortA, iopi.PortB} {
+		first := uint8(1)
+		name := "A"
+		if port == iopi.PortB {
+			first, name = 9, "B"
+		}
+
+		fmt.Fprintf(&b, " Port %s ", name)
+		for i := uint8(0); i < 8; i++ {
+			fmt.Fprintf(&b, " %3d ", first+i)
+		}
+		b.WriteString("\r\n        ")
+		for i := uint8(0); i < 8; i++ {
+			led := "( )"
+			if iopi.GetBit(st.gpio[port], i) == 1 {
+				led = "(*)"
+			}
+			if first+i == st.selected {
+				led = "\x1b[7m" + led + "\x1b[0m"
+			}
+			fmt.Fprintf(&b, " %s ", led)
+		}
+		b.WriteString("\r\n        ")
+		for i := uint8(0); i < 8; i++ {
+			mode := "out"
+			if iopi.GetBit(st.iodir[port], i) == 1 {
+				mode = "in"
+			}
+			fmt.Fprintf(&b, " %3s ", mode)
+		}
+		b.WriteString("\r\n\r\n")
+	}
+
+	b.WriteString("arrows/hjkl: select  space: toggle output  q: quit\r\n")
+	if st.message != "" {
+		fmt.Fprintf(&b, "\r\n%s\r\n", st.message)
+	}
+
+	return b.String()
+}
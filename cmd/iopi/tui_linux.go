@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Put the terminal in non-canonical mode without echo, returning a function
+// restoring the previous mode.
+func rawTerminal(fd int) (func(), error) {
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, fmt.Errorf("stdin is not a terminal: %s", err)
+	}
+
+	raw := *old
+	raw.Lflag &^= unix.ECHO | unix.ICANON
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, fmt.Errorf("failed to configure terminal: %s", err)
+	}
+
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, old) }, nil
+}
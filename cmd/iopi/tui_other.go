@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// The terminal is only switched to raw mode on Linux.
+func rawTerminal(fd int) (func(), error) {
+	return nil, errors.New("tui is only supported on linux")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleKey(t *testing.T) {
+	st := tuiState{selected: 1}
+
+	handleKey([]byte("\x1b[C"), &st)
+	if st.selected != 2 {
+		t.Error("right arrow did not move selection", st.selected)
+	}
+	handleKey([]byte("j"), &st)
+	if st.selected != 10 {
+		t.Error("down did not move to port B", st.selected)
+	}
+	handleKey([]byte("j"), &st)
+	if st.selected != 10 {
+		t.Error("moved beyond port B", st.selected)
+	}
+
+	st.selected = 1
+	handleKey([]byte("h"), &st)
+	if st.selected != 1 {
+		t.Error("moved before pin 1", st.selected)
+	}
+
+	if handleKey([]byte(" "), &st) != actionToggle {
+		t.Error("space should toggle")
+	}
+	if handleKey([]byte("q"), &st) != actionQuit {
+		t.Error("q should quit")
+	}
+}
+
+func TestRenderTUI(t *testing.T) {
+	st := tuiState{
+		title:    "test",
+		gpio:     [2]byte{0b00000001, 0},
+		iodir:    [2]byte{0xFF, 0x00},
+		selected: 16,
+		message:  "hello",
+	}
+	out := renderTUI(st)
+
+	if strings.Count(out, "(*)") != 1 {
+		t.Error("expected a single high pin")
+	}
+	if strings.Count(out, " in ") != 8 || strings.Count(out, " out ") != 8 {
+		t.Error("unexpected modes", out)
+	}
+	if !strings.Contains(out, "\x1b[7m( )\x1b[0m") {
+		t.Error("selected pin not highlighted")
+	}
+	if !strings.Contains(out, "hello") {
+		t.Error("message not shown")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	devFlags := addDeviceFlags(fs)
+	pinsFlag := fs.String("pins", "1-16", "pins to watch, e.g. 1-8,10")
+	format := fs.String("format", "table", "output format: table, csv or json")
+	interval := fs.Duration("interval", 10*time.Millisecond, "polling interval")
+	maxInterval := fs.Duration("max-interval", 0, "back off up to this polling interval while idle")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	// Events are streamed, so --json selects the json format rather than
+	// wrapping the output in a single result.
+	if jsonOutput {
+		*format = "json"
+	}
+
+	pins, err := parsePins(*pinsFlag)
+	if err != nil {
+		return err
+	}
+	aliases, err := devFlags.aliases()
+	if err != nil {
+		return err
+	}
+	write, err := newEventWriter(os.Stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	dev, err := devFlags.open()
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	poller := iopi.NewPoller(dev, *interval, pins...)
+	poller.MaxInterval = *maxInterval
+	events, cancel := poller.Subscribe()
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() { errc <- poller.Run(ctx) }()
+
+	for {
+		select {
+		case ev := <-events:
+			if err := write(aliases.Annotate(ev)); err != nil {
+				return err
+			}
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+// Return a function writing events in the given format. Writes a header
+// first if the format has one.
+func newEventWriter(w io.Writer, format string) (func(iopi.PinEvent) error, error) {
+	switch format {
+	case "table":
+		fmt.Fprintf(w, "%-30s %-4s %-4s %-5s %s\n", "TIME", "ADDR", "PIN", "STATE", "NAME")
+		return func(ev iopi.PinEvent) error {
+			state, _ := ev.State.MarshalText()
+			_, err := fmt.Fprintf(w, "%-30s 0x%02x %-4d %-5s %s\n",
+				ev.Time.Format(time.RFC3339Nano), ev.Address, ev.Pin, state, ev.Name)
+			return err
+		}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "address", "pin", "state", "name"})
+		cw.Flush()
+		return func(ev iopi.PinEvent) error {
+			state, _ := ev.State.MarshalText()
+			cw.Write([]string{
+				ev.Time.Format(time.RFC3339Nano),
+				fmt.Sprintf("0x%02x", ev.Address),
+				strconv.Itoa(int(ev.Pin)),
+				string(state),
+				ev.Name,
+			})
+			cw.Flush()
+			return cw.Error()
+		}, nil
+	case "json":
+		enc := json.NewEncoder(w)
+		return func(ev iopi.PinEvent) error {
+			return enc.Encode(ev)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+}
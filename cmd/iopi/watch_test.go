@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestParsePins(t *testing.T) {
+	pins, err := parsePins("1-3, 10,16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pins, []uint8{1, 2, 3, 10, 16}) {
+		t.Error("unexpected pins", pins)
+	}
+
+	for _, s := range []string{"0", "17", "3-1", "a", "1-"} {
+		if _, err := parsePins(s); err == nil {
+			t.Error("expected error for", s)
+		}
+	}
+}
+
+func TestEventWriter(t *testing.T) {
+	ev := iopi.PinEvent{Address: 0x20, Pin: 3, State: 1, Time: time.Unix(0, 0).UTC()}
+
+	for format, expected := range map[string]string{
+		"csv":  "time,address,pin,state,name\n1970-01-01T00:00:00Z,0x20,3,high,\n",
+		"json": `{"address":32,"pin":3,"state":"high","time":"1970-01-01T00:00:00Z"}` + "\n",
+	} {
+		var buf bytes.Buffer
+		write, err := newEventWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(ev)
+		if buf.String() != expected {
+			t.Errorf("unexpected %s output: %q", format, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	write, _ := newEventWriter(&buf, "table")
+	write(ev)
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Error("expected header and row", lines)
+	}
+
+	if _, err := newEventWriter(&buf, "xml"); err == nil {
+		t.Error("expected error")
+	}
+}
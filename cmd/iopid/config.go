@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stigok/go-io-pi/config"
+	"github.com/stigok/go-io-pi/httpapi"
+	"gopkg.in/yaml.v3"
+)
+
+// Daemon configuration, read from a YAML or JSON file. Devices and pins are
+// declared as described in package config, next to the daemon settings:
+//
+//	http:
+//	  listen: ":8080"
+//	  tls: {cert: server.pem, key: server-key.pem}   # see config.TLS
+//	auth:                       # require credentials on the http api
+//	  tokens: {dashboard: s3cret}
+//	  users: {admin: hunter2}
+//	socket: /run/iopid.sock     # control socket, see httpapi.Server.ServeControl
+//	coap: ":5683"               # refused with auth set, see httpapi.Server.ServeCoAP
+//	coap_insecure: true         # serve coap unauthenticated with auth set
+//	arbitration: reject         # clients must lock pins to write them
+//	poll_interval: 10ms
+//	max_poll_interval: 500ms    # back off while inputs are idle
+//	state_dir: /var/lib/iopid   # persist outputs across restarts
+//	enforce:                    # verify pins against the configuration
+//	  interval: 1m
+//	  correct: true             # reapply settings, otherwise only log
+//	webhooks:                   # see httpapi.Webhook
+//	  - url: https://example.com/hooks/{{.Name}}
+//	    names: [door]
+//	    edge: rising
+//	    retries: 3
+//	dead_letters: /var/log/iopid-webhooks.log  # failed webhook deliveries
+//	devices:
+//	  - bus: /dev/i2c-1
+//	    address: 0x20
+//	    pins:
+//	      - {pin: 1, name: pump, mode: output, state: low}
+//
+// Settings can be overridden from the environment, see config.EnvPrefix,
+// and with IOPI_HTTP_LISTEN, IOPI_SOCKET, IOPI_COAP, IOPI_POLL_INTERVAL
+// and IOPI_STATE_DIR.
+type Config struct {
+	config.Config `yaml:",inline"`
+
+	HTTP struct {
+		Listen string     `yaml:"listen"` // disabled if empty
+		TLS    config.TLS `yaml:"tls"`    // plain http if empty
+	} `yaml:"http"`
+	Auth            httpapi.Auth  `yaml:"auth"`          // disabled if empty, see httpapi.Auth
+	Socket          string        `yaml:"socket"`        // disabled if empty, unless passed by systemd
+	CoAP            string        `yaml:"coap"`          // udp listen address, disabled if empty
+	CoAPInsecure    bool          `yaml:"coap_insecure"` // see httpapi.Server.InsecureCoAP
+	Arbitration     string        `yaml:"arbitration"`   // last-writer-wins (default) or reject
+	PollInterval    time.Duration `yaml:"poll_interval"`
+	MaxPollInterval time.Duration `yaml:"max_poll_interval"` // adaptive if larger, see iopi.Poller.MaxInterval
+	StateDir        string        `yaml:"state_dir"`         // disabled if empty
+
+	Enforce struct {
+		Interval time.Duration `yaml:"interval"` // disabled if zero
+		Correct  bool          `yaml:"correct"`
+	} `yaml:"enforce"`
+
+	Webhooks    []httpapi.Webhook `yaml:"webhooks"`
+	DeadLetters string            `yaml:"dead_letters"` // not logged if empty
+}
+
+// Read the daemon configuration, selecting a profile unless it is empty.
+func loadConfig(path string, profile string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %s", err)
+	}
+
+	cfg := &Config{PollInterval: 10 * time.Millisecond}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %s", err)
+	}
+	if err := cfg.Select(profile); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+
+	return cfg, nil
+}
+
+// Override daemon and device settings from the environment.
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	if s, ok := lookup(config.EnvPrefix + "HTTP_LISTEN"); ok {
+		cfg.HTTP.Listen = s
+	}
+	if s, ok := lookup(config.EnvPrefix + "SOCKET"); ok {
+		cfg.Socket = s
+	}
+	if s, ok := lookup(config.EnvPrefix + "COAP"); ok {
+		cfg.CoAP = s
+	}
+	if s, ok := lookup(config.EnvPrefix + "POLL_INTERVAL"); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%sPOLL_INTERVAL: %s", config.EnvPrefix, err)
+		}
+		cfg.PollInterval = d
+	}
+	if s, ok := lookup(config.EnvPrefix + "STATE_DIR"); ok {
+		cfg.StateDir = s
+	}
+
+	return cfg.ApplyEnv(lookup)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/config"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "iopid.yaml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("parses daemon settings and devices", func(t *testing.T) {
+		path := writeConfig(t, `
+http: {listen: ":8080"}
+auth: {tokens: {dashboard: s3cret}}
+poll_interval: 50ms
+max_poll_interval: 1s
+devices:
+  - bus: /dev/i2c-1
+    address: 0x20
+    pins: [{pin: 1, mode: output, state: high}]
+`)
+
+		cfg, err := loadConfig(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.HTTP.Listen != ":8080" || cfg.PollInterval != 50*time.Millisecond || cfg.MaxPollInterval != time.Second {
+			t.Error("unexpected config", cfg)
+		}
+		if cfg.Auth.Tokens["dashboard"] != "s3cret" {
+			t.Error("unexpected auth", cfg.Auth)
+		}
+		if len(cfg.Devices) != 1 || cfg.Devices[0].Pins[0].Mode != "output" {
+			t.Error("unexpected devices", cfg.Devices)
+		}
+	})
+
+	t.Run("defaults poll interval", func(t *testing.T) {
+		cfg, err := loadConfig(writeConfig(t, `{"devices": []}`), "")
+		if err != nil || cfg.PollInterval != 10*time.Millisecond {
+			t.Error("unexpected result", cfg, err)
+		}
+	})
+
+	t.Run("selects profile", func(t *testing.T) {
+		path := writeConfig(t, `
+pins: {pump: {mode: output}}
+profiles:
+  lab: {devices: [{bus: /dev/i2c-1, address: 0x21, pins: [{pin: 3, name: pump}]}]}
+`)
+		cfg, err := loadConfig(path, "lab")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Devices) != 1 || cfg.Devices[0].Pins[0].Mode != "output" {
+			t.Error("unexpected devices", cfg.Devices)
+		}
+		if _, err := loadConfig(path, "field"); err == nil {
+			t.Error("expected error for unknown profile")
+		}
+	})
+
+	t.Run("parses webhooks", func(t *testing.T) {
+		path := writeConfig(t, `
+webhooks:
+  - {url: "http://example.com/{{.Name}}", names: [door], edge: rising, retries: 3}
+dead_letters: /var/log/iopid-webhooks.log
+`)
+		cfg, err := loadConfig(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Webhooks) != 1 || cfg.Webhooks[0].Edge != iopi.EdgeRising || cfg.Webhooks[0].Retries != 3 {
+			t.Error("unexpected webhooks", cfg.Webhooks)
+		}
+		if cfg.DeadLetters != "/var/log/iopid-webhooks.log" {
+			t.Error("unexpected dead letters", cfg.DeadLetters)
+		}
+	})
+
+	t.Run("rejects invalid devices", func(t *testing.T) {
+		path := writeConfig(t, `devices: [{bus: /dev/i2c-1, pins: [{pin: 17}]}]`)
+		if _, err := loadConfig(path, ""); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestConfigEnv(t *testing.T) {
+	cfg := &Config{}
+	cfg.Devices = []config.Device{{Bus: "/dev/i2c-1", Address: 0x20}}
+
+	err := cfg.applyEnv(func(key string) (string, bool) {
+		v, ok := map[string]string{
+			"IOPI_HTTP_LISTEN":   ":9000",
+			"IOPI_POLL_INTERVAL": "1s",
+			"IOPI_SOCKET":        "/run/iopid.sock",
+			"IOPI_COAP":          ":5683",
+			"IOPI_ADDR":          "0x27",
+		}[key]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTP.Listen != ":9000" || cfg.Socket != "/run/iopid.sock" || cfg.CoAP != ":5683" || cfg.PollInterval != time.Second || cfg.Devices[0].Address != 0x27 {
+		t.Error("unexpected config", cfg)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/config"
+	"github.com/stigok/go-io-pi/httpapi"
+)
+
+// Identifies a device across configurations
+type deviceKey struct {
+	bus  string
+	addr byte
+}
+
+type runningDevice struct {
+	cfg      config.Device
+	dev      *iopi.Device
+	poller   *iopi.Poller
+	enforcer *config.Enforcer // nil if not enforcing
+	cancel   func()           // stops the poller and enforcer
+	tasks    sync.WaitGroup   // running background tasks
+}
+
+// Stop the background tasks of a device, waiting for them to return so
+// the device can be closed.
+func (rd *runningDevice) stop() {
+	rd.cancel()
+	rd.tasks.Wait()
+}
+
+type daemon struct {
+	cfg     *Config
+	server  *httpapi.Server
+	hooks   *httpapi.Webhooks // nil without webhooks
+	devices map[deviceKey]*runningDevice
+	errc    chan error
+
+	// Opens a device, replaced in tests
+	open func(bus string, addr byte) (*iopi.Device, error)
+}
+
+func newDaemon(cfg *Config) *daemon {
+	return &daemon{
+		cfg:     cfg,
+		server:  httpapi.NewServer(),
+		devices: make(map[deviceKey]*runningDevice),
+		errc:    make(chan error, 1),
+		open:    iopi.Open,
+	}
+}
+
+// Open and configure all devices of the configuration.
+func (d *daemon) start(ctx context.Context) error {
+	d.setAliases()
+	d.server.SetAuth(d.cfg.Auth)
+	for _, dc := range d.cfg.Devices {
+		if err := d.startDevice(ctx, dc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *daemon) startDevice(ctx context.Context, dc config.Device) error {
+	if !iopi.IsChipAddress(dc.Address) {
+		log.Printf("warning: device 0x%02x on %s is outside the MCP23017 range 0x%02x-0x%02x",
+			dc.Address, dc.Bus, iopi.MinChipAddress, iopi.MaxChipAddress)
+	}
+
+	dev, err := d.open(dc.Bus, dc.Address)
+	if err != nil {
+		return err
+	}
+
+	if dc.Shared {
+		dev.SetCacheAdvisory(true)
+		dev.SetDriftHandler(func(diff iopi.Difference) {
+			d.server.RecordDrift(dc.Address, 1)
+			log.Printf("register changed on shared device 0x%02x on %s: %s", dc.Address, dc.Bus, diff)
+		})
+	}
+
+	if err := d.configure(dev, dc); err != nil {
+		dev.Close()
+		return err
+	}
+
+	poller := iopi.NewPoller(dev, d.cfg.PollInterval)
+	poller.MaxInterval = d.cfg.MaxPollInterval
+	config.Debounce(poller, dc)
+
+	ctx, cancel := context.WithCancel(ctx)
+	rd := &runningDevice{cfg: dc, dev: dev, poller: poller, cancel: cancel}
+	d.runTask(ctx, rd, poller.Run)
+
+	if d.hooks != nil {
+		events, unsubscribe := poller.Subscribe()
+		d.runTask(ctx, rd, func(ctx context.Context) error {
+			defer unsubscribe()
+			d.hooks.Run(ctx, events)
+			return nil
+		})
+	}
+
+	if d.cfg.Enforce.Interval > 0 {
+		enforcer := config.NewEnforcer(dev, dc, d.cfg.Enforce.Interval)
+		enforcer.Correct = d.cfg.Enforce.Correct
+		enforcer.OnDrift = func(diffs []iopi.Difference) {
+			d.server.RecordDrift(dc.Address, len(diffs))
+			log.Printf("configuration drift on device 0x%02x on %s:\n%s",
+				dc.Address, dc.Bus, iopi.FormatDiff(diffs))
+		}
+		rd.enforcer = enforcer
+		d.runTask(ctx, rd, enforcer.Run)
+	}
+
+	d.devices[deviceKey{dc.Bus, dc.Address}] = rd
+	d.server.AddDevice(dev)
+	d.server.AddPoller(poller)
+
+	log.Printf("configured device 0x%02x on %s", dc.Address, dc.Bus)
+	return nil
+}
+
+// Run a background task of a device, reporting its error to the daemon.
+// Errors of a stopped task, e.g. of a device removed on reload, are
+// dropped.
+func (d *daemon) runTask(ctx context.Context, rd *runningDevice, task func(context.Context) error) {
+	rd.tasks.Add(1)
+	go func() {
+		defer rd.tasks.Done()
+		if err := task(ctx); err != nil && ctx.Err() == nil {
+			select {
+			case d.errc <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// Initialise a device and program its pins in one pass, see config.Init,
+// so outputs start in their safe state. With a state directory, outputs
+// saved by a previous run take precedence over the declared initial
+// states. Shared devices only get their declared pins configured, leaving
+// the pins of other programs untouched.
+func (d *daemon) configure(dev *iopi.Device, dc config.Device) error {
+	var store *iopi.OutputStore
+	if d.cfg.StateDir != "" {
+		name := fmt.Sprintf("%s-0x%02x.json", filepath.Base(dc.Bus), dc.Address)
+		store = iopi.NewOutputStore(filepath.Join(d.cfg.StateDir, name))
+	}
+
+	if dc.Shared {
+		if err := d.configureShared(dev, dc, store); err != nil {
+			return err
+		}
+	} else {
+		layout := config.StartupLayout(dc)
+		if store != nil {
+			a, b, err := store.Load()
+			switch {
+			case err == nil:
+				layout.State = [2]byte{a, b}
+				log.Printf("restored outputs of device 0x%02x on %s", dc.Address, dc.Bus)
+			case !os.IsNotExist(err):
+				return err
+			}
+		}
+		if err := config.InitLayout(dev, dc, layout); err != nil {
+			return err
+		}
+	}
+
+	if store != nil {
+		dev.SetOutputStore(store)
+	}
+	return nil
+}
+
+// Configure the declared pins of a shared device one by one.
+func (d *daemon) configureShared(dev *iopi.Device, dc config.Device, store *iopi.OutputStore) error {
+	if store == nil {
+		return config.ApplyConfig(dev, dc)
+	}
+
+	err := dev.RestoreOutputs(store)
+	switch {
+	case err == nil:
+		log.Printf("restored outputs of device 0x%02x on %s", dc.Address, dc.Bus)
+		return config.ApplySettings(dev, dc)
+	case os.IsNotExist(err):
+		return config.ApplyConfig(dev, dc)
+	}
+	return err
+}
+
+// Release the declared pins of a device and close it.
+func (d *daemon) stopDevice(key deviceKey) {
+	rd := d.devices[key]
+	rd.stop()
+	d.server.RemoveDevice(key.addr)
+
+	for _, p := range rd.cfg.Pins {
+		if err := config.Release(rd.dev, p.Pin); err != nil {
+			log.Printf("failed to release pin %d on 0x%02x: %s", p.Pin, key.addr, err)
+		}
+	}
+
+	rd.dev.Close()
+	delete(d.devices, key)
+	log.Printf("removed device 0x%02x on %s", key.addr, key.bus)
+}
+
+// Apply the differences of a new configuration. Devices and pins that did
+// not change are left untouched.
+func (d *daemon) reload(ctx context.Context, cfg *Config) error {
+	if cfg.PollInterval != d.cfg.PollInterval || cfg.MaxPollInterval != d.cfg.MaxPollInterval || cfg.HTTP != d.cfg.HTTP || cfg.Socket != d.cfg.Socket || cfg.CoAP != d.cfg.CoAP || cfg.CoAPInsecure != d.cfg.CoAPInsecure ||
+		cfg.Arbitration != d.cfg.Arbitration || cfg.Enforce != d.cfg.Enforce ||
+		cfg.DeadLetters != d.cfg.DeadLetters || !reflect.DeepEqual(cfg.Webhooks, d.cfg.Webhooks) {
+		log.Printf("http, socket, coap, arbitration, poll_interval, enforce and webhooks changes require a restart")
+	}
+
+	declared := make(map[deviceKey]bool)
+	for _, dc := range cfg.Devices {
+		declared[deviceKey{dc.Bus, dc.Address}] = true
+	}
+	for key := range d.devices {
+		if !declared[key] {
+			d.stopDevice(key)
+		}
+	}
+
+	for _, dc := range cfg.Devices {
+		rd, ok := d.devices[deviceKey{dc.Bus, dc.Address}]
+		if !ok {
+			if err := d.startDevice(ctx, dc); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if config.DiffDevice(rd.cfg, dc).Empty() {
+			continue
+		}
+		if err := config.Reload(rd.dev, rd.cfg, dc); err != nil {
+			return err
+		}
+		for pin := uint8(1); pin <= 16; pin++ {
+			rd.poller.SetDebounce(pin, 0)
+		}
+		config.Debounce(rd.poller, dc)
+		if rd.enforcer != nil {
+			rd.enforcer.SetConfig(dc)
+		}
+		rd.cfg = dc
+		log.Printf("reconfigured device 0x%02x on %s", dc.Address, dc.Bus)
+	}
+
+	d.cfg.Devices, d.cfg.Auth = cfg.Devices, cfg.Auth
+	d.setAliases()
+	d.server.SetAuth(d.cfg.Auth)
+	return nil
+}
+
+// Name pins as configured, for the api and webhooks.
+func (d *daemon) setAliases() {
+	aliases := d.cfg.Aliases()
+	d.server.SetAliases(aliases)
+	if d.hooks != nil {
+		d.hooks.SetAliases(aliases)
+	}
+}
+
+// Stop polling and close all devices, leaving pins as they are.
+func (d *daemon) close() {
+	for _, rd := range d.devices {
+		rd.stop()
+		rd.dev.Close()
+	}
+}
+
+// Read a register of every device, returning the first error, so a failed
+// bus is noticed while inputs are idle or not polled.
+func (d *daemon) check() error {
+	for _, rd := range d.devices {
+		if _, err := rd.dev.ReadByteData(iopi.IODIRA); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/config"
+)
+
+// A fake device whose calls can be inspected while its poller runs
+type testDevice struct {
+	file  *iopi.FakeFile
+	mutex *sync.Mutex
+}
+
+func (td testDevice) calls() []iopi.Call {
+	td.mutex.Lock()
+	defer td.mutex.Unlock()
+	return append([]iopi.Call(nil), td.file.CallHistory...)
+}
+
+// Create a daemon opening fake devices, returning the fake of each address.
+func newTestDaemon(cfg *Config) (*daemon, map[byte]testDevice) {
+	devices := make(map[byte]testDevice)
+	d := newDaemon(cfg)
+	d.open = func(bus string, addr byte) (*iopi.Device, error) {
+		td := testDevice{iopi.NewFakeFile(), &sync.Mutex{}}
+		devices[addr] = td
+		return iopi.NewDevice(td.file, addr, td.mutex), nil
+	}
+	return d, devices
+}
+
+func TestDaemonReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{}
+	cfg.PollInterval = 1 << 40 // effectively never poll
+	cfg.Devices = []config.Device{
+		{Bus: "bus", Address: 0x20, Pins: []config.Pin{{Pin: 1, Mode: "output"}}},
+		{Bus: "bus", Address: 0x21, Pins: []config.Pin{{Pin: 1, Mode: "output"}}},
+	}
+
+	d, devices := newTestDaemon(cfg)
+	if err := d.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Let the pollers do their initial read before counting calls
+	time.Sleep(10 * time.Millisecond)
+	before := len(devices[0x20].calls())
+
+	newCfg := &Config{}
+	newCfg.PollInterval = cfg.PollInterval
+	newCfg.Devices = []config.Device{
+		{Bus: "bus", Address: 0x20, Pins: []config.Pin{{Pin: 1, Mode: "output"}}},
+		{Bus: "bus", Address: 0x22},
+	}
+	if err := d.reload(ctx, newCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := devices[0x20].calls(); len(calls) != before {
+		t.Error("unchanged device was touched", calls[before:])
+	}
+	calls := devices[0x21].calls()
+	if calls[len(calls)-1].Fn != "Close" {
+		t.Error("removed device not closed")
+	}
+	if _, ok := d.devices[deviceKey{"bus", 0x22}]; !ok {
+		t.Error("added device not started")
+	}
+	if _, ok := d.devices[deviceKey{"bus", 0x21}]; ok {
+		t.Error("removed device still running")
+	}
+}
+
+func TestDaemonStateDir(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{StateDir: t.TempDir()}
+	cfg.PollInterval = 1 << 40
+	cfg.Devices = []config.Device{
+		{Bus: "/dev/i2c-1", Address: 0x20, Pins: []config.Pin{{Pin: 1, Mode: "output", State: "low"}}},
+	}
+
+	d, _ := newTestDaemon(cfg)
+	if err := d.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.devices[deviceKey{"/dev/i2c-1", 0x20}].dev.WritePort(iopi.PortA, 0x01)
+	d.close()
+
+	// A second run restores the saved outputs instead of the initial state
+	d, devices := newTestDaemon(cfg)
+	if err := d.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+
+	calls := devices[0x20].calls()
+	if i := writeIndex(calls, iopi.OLATA); i < 0 || calls[i].Arg[1] != 0x01 || i > writeIndex(calls, iopi.IODIRA) {
+		t.Error("outputs not restored before directions", calls)
+	}
+	for _, c := range calls {
+		if c.Fn == "Write" && len(c.Arg) == 2 && (c.Arg[0] == byte(iopi.GPIOA) || c.Arg[0] == byte(iopi.OLATA) && c.Arg[1] != 0x01) {
+			t.Error("initial state written over restored outputs")
+		}
+	}
+}
+
+// Return the index of the first write of a register, or -1
+func writeIndex(calls []iopi.Call, reg iopi.Register) int {
+	for i, c := range calls {
+		if c.Fn == "Write" && len(c.Arg) == 2 && c.Arg[0] == byte(reg) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestDaemonStartup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{}
+	cfg.PollInterval = 1 << 40
+	cfg.Devices = []config.Device{
+		{Bus: "bus", Address: 0x20, Pins: []config.Pin{{Pin: 1, Mode: "output", State: "high"}, {Pin: 9, Mode: "output"}}},
+		{Bus: "bus", Address: 0x21, Shared: true, Pins: []config.Pin{{Pin: 1, Mode: "output", State: "high"}}},
+	}
+
+	d, devices := newTestDaemon(cfg)
+	if err := d.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+
+	// Latches are written before any pin becomes an output
+	calls := devices[0x20].calls()
+	for _, c := range []struct {
+		olat, iodir iopi.Register
+		value       byte
+	}{
+		{iopi.OLATA, iopi.IODIRA, 0x01},
+		{iopi.OLATB, iopi.IODIRB, 0x00},
+	} {
+		i := writeIndex(calls, c.olat)
+		if i < 0 || calls[i].Arg[1] != c.value || i > writeIndex(calls, c.iodir) {
+			t.Errorf("%s not written before %s: %v", c.olat, c.iodir, calls)
+		}
+	}
+	if writeIndex(calls, iopi.IOCON) < 0 {
+		t.Error("device not initialised", calls)
+	}
+
+	// Shared devices are left to their other users
+	if i := writeIndex(devices[0x21].calls(), iopi.IOCON); i >= 0 {
+		t.Error("shared device initialised")
+	}
+}
+
+func TestDaemonEnforce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{}
+	cfg.PollInterval = 1 << 40
+	cfg.Enforce.Interval = time.Millisecond
+	cfg.Enforce.Correct = true
+	cfg.Devices = []config.Device{
+		{Bus: "bus", Address: 0x20, Pins: []config.Pin{{Pin: 2, Mode: "output"}}},
+	}
+
+	d, devices := newTestDaemon(cfg)
+	if err := d.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+
+	// The fake reads back IPOLA as 0x02, so pin 2 always appears inverted
+	// and is corrected on every check after the initial configuration.
+	polarityWrites := func() int {
+		n := 0
+		for _, c := range devices[0x20].calls() {
+			if c.Fn == "Write" && len(c.Arg) == 2 && c.Arg[0] == byte(iopi.IPOLA) {
+				n++
+			}
+		}
+		return n
+	}
+	for i := 0; polarityWrites() < 2; i++ {
+		if i == 100 {
+			t.Fatal("drift not corrected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// A bus whose devices stopped answering
+type deadBus struct{ *iopi.FakeFile }
+
+var errNoAnswer = errors.New("remote I/O error")
+
+func (deadBus) Read([]byte) (int, error) {
+	return 0, errNoAnswer
+}
+
+func TestDaemonCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &Config{}
+	cfg.PollInterval = 1 << 40
+	cfg.Devices = []config.Device{{Bus: "bus", Address: 0x20}}
+
+	d, _ := newTestDaemon(cfg)
+	if err := d.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+	if err := d.check(); err != nil {
+		t.Fatal(err)
+	}
+
+	dev := iopi.NewDevice(deadBus{iopi.NewFakeFile()}, 0x21, &sync.Mutex{})
+	d.devices[deviceKey{"bus", 0x21}] = &runningDevice{dev: dev, cancel: func() {}}
+	if err := d.check(); !errors.Is(err, errNoAnswer) {
+		t.Error("expected bus error, got", err)
+	}
+}
+
+func TestDaemonStopDevice(t *testing.T) {
+	t.Run("drops errors of stopped tasks", func(t *testing.T) {
+		d := newDaemon(&Config{})
+		ctx, cancel := context.WithCancel(context.Background())
+		rd := &runningDevice{cancel: cancel}
+
+		// A poll in flight fails once the device is closed
+		d.runTask(ctx, rd, func(ctx context.Context) error {
+			<-ctx.Done()
+			return errors.New("bus closed")
+		})
+		rd.stop()
+		select {
+		case err := <-d.errc:
+			t.Error("unexpected daemon error", err)
+		default:
+		}
+	})
+
+	t.Run("removes devices while polling", func(t *testing.T) {
+		cfg := &Config{}
+		cfg.PollInterval = time.Microsecond
+		cfg.Devices = []config.Device{{Bus: "bus", Address: 0x20}}
+		d, _ := newTestDaemon(cfg)
+		if err := d.start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer d.close()
+
+		newCfg := &Config{}
+		newCfg.PollInterval = cfg.PollInterval
+		if err := d.reload(context.Background(), newCfg); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.devices) != 0 {
+			t.Error("device not removed")
+		}
+		select {
+		case err := <-d.errc:
+			t.Error("unexpected daemon error", err)
+		default:
+		}
+	})
+}
@@ -0,0 +1,256 @@
+// Command iopid is a long-running daemon owning one or more IO Pi boards.
+// It configures the pins declared in its configuration file at startup and
+// serves the HTTP API (see package httpapi) for other programs to use, and
+// a control socket for local scripts and the iopi command (see
+// httpapi.Server.ServeControl), so they need not open the bus themselves.
+//
+// The configuration is reloaded on SIGHUP, or when the file changes if
+// -watch is set. Only devices and pins whose declaration changed are
+// touched; pins no longer declared are released to inputs.
+//
+// With -profile (or $IOPI_PROFILE), the devices of a named profile in the
+// configuration file are used instead of the top-level ones.
+//
+//	iopid -config /etc/iopid.yaml -profile production -watch 5s
+//
+// Under systemd, iopid reports its readiness with Type=notify, and with
+// WatchdogSec it sends keep-alives only while every device answers, so a
+// failed i2c bus gets the service restarted. The control socket can be
+// passed by socket activation, in which case the socket setting is not
+// needed:
+//
+//	# iopid.service
+//	[Service]
+//	Type=notify
+//	ExecStart=/usr/bin/iopid -config /etc/iopid.yaml
+//	WatchdogSec=30s
+//	Restart=on-failure
+//
+//	# iopid.socket
+//	[Socket]
+//	ListenStream=/run/iopid.sock
+//	SocketMode=0660
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/stigok/go-io-pi/config"
+	"github.com/stigok/go-io-pi/httpapi"
+)
+
+func main() {
+	configPath := flag.String("config", "/etc/iopid.yaml", "path to the configuration file")
+	profile := flag.String("profile", os.Getenv(config.EnvPrefix+"PROFILE"), "name of the configuration profile to use")
+	watch := flag.Duration("watch", 0, "check the configuration file for changes at this interval")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, *configPath, *profile, *watch); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, path string, profile string, watch time.Duration) error {
+	cfg, err := loadConfig(path, profile)
+	if err != nil {
+		return err
+	}
+
+	mode, err := httpapi.ParseArbitrationMode(cfg.Arbitration)
+	if err != nil {
+		return fmt.Errorf("invalid config: %s", err)
+	}
+
+	sd, err := systemdEnv(os.LookupEnv, os.Getpid())
+	if err != nil {
+		return err
+	}
+
+	d := newDaemon(cfg)
+	defer d.close()
+	d.server.SetArbiter(httpapi.NewArbiter(mode))
+
+	if len(cfg.Webhooks) > 0 {
+		if d.hooks, err = httpapi.NewWebhooks(cfg.Webhooks...); err != nil {
+			return fmt.Errorf("invalid config: %s", err)
+		}
+		if cfg.DeadLetters != "" {
+			f, err := os.OpenFile(cfg.DeadLetters, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+			if err != nil {
+				return fmt.Errorf("failed to open dead letters: %s", err)
+			}
+			defer f.Close()
+			d.hooks.DeadLetters = f
+		}
+	}
+
+	if err := d.start(ctx); err != nil {
+		return err
+	}
+
+	if cfg.HTTP.Listen != "" {
+		srv := &http.Server{Addr: cfg.HTTP.Listen, Handler: d.server}
+		if cfg.HTTP.TLS.Enabled() {
+			srv.TLSConfig, err = cfg.HTTP.TLS.ServerConfig()
+			if err != nil {
+				return fmt.Errorf("invalid config: %s", err)
+			}
+		}
+		go func() {
+			<-ctx.Done()
+			srv.Shutdown(context.Background())
+		}()
+		go func() {
+			log.Printf("serving http on %s", cfg.HTTP.Listen)
+			if cfg.Auth.Empty() {
+				log.Printf("warning: the http api is not authenticated, see auth in the configuration")
+			}
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				d.errc <- err
+			}
+		}()
+	}
+
+	control, err := sd.controlListener()
+	if err != nil {
+		return err
+	}
+	if control == nil && cfg.Socket != "" {
+		if control, err = listenControl(cfg.Socket); err != nil {
+			return err
+		}
+	}
+	if control != nil {
+		l := control
+		defer l.Close()
+		go func() {
+			log.Printf("serving control socket on %s", l.Addr())
+			if err := d.server.ServeControl(l); err != nil && ctx.Err() == nil {
+				d.errc <- err
+			}
+		}()
+	}
+
+	if cfg.CoAP != "" {
+		conn, err := net.ListenPacket("udp", cfg.CoAP)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		d.server.InsecureCoAP = cfg.CoAPInsecure
+		go func() {
+			log.Printf("serving coap on %s", cfg.CoAP)
+			if err := d.server.ServeCoAP(conn); err != nil && ctx.Err() == nil {
+				d.errc <- err
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var changed <-chan time.Time
+	modTime := fileModTime(path)
+	if watch > 0 {
+		ticker := time.NewTicker(watch)
+		defer ticker.Stop()
+		changed = ticker.C
+	}
+
+	var watchdog <-chan time.Time
+	if sd.watchdog > 0 {
+		ticker := time.NewTicker(sd.watchdog / 2)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	notify(sd, "READY=1")
+	defer notify(sd, "STOPPING=1")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-d.errc:
+			return err
+		case <-watchdog:
+			if err := d.check(); err != nil {
+				log.Printf("withholding watchdog keep-alive: %s", err)
+			} else {
+				notify(sd, "WATCHDOG=1")
+			}
+			continue
+		case <-hup:
+		case <-changed:
+			t := fileModTime(path)
+			if t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+		}
+
+		log.Printf("reloading %s", path)
+		newCfg, err := loadConfig(path, profile)
+		if err != nil {
+			log.Printf("keeping current configuration: %s", err)
+			continue
+		}
+		notify(sd, "RELOADING=1")
+		if err := d.reload(ctx, newCfg); err != nil {
+			log.Printf("failed to reload configuration: %s", err)
+		}
+		notify(sd, "READY=1")
+	}
+}
+
+// Notify systemd, logging failures, which are not fatal to the daemon.
+func notify(sd systemd, state string) {
+	if err := sd.notify(state); err != nil {
+		log.Print(err)
+	}
+}
+
+// Listen on a unix domain socket, replacing a socket left behind by a
+// previous run. The socket is only accessible to the user and group of
+// the daemon.
+func listenControl(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %s", err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to listen on control socket: %s", err)
+	}
+	return l, nil
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// First file descriptor passed by socket activation, see sd_listen_fds(3)
+const listenFDsStart = 3
+
+// The environment systemd gives a service, empty when not run by systemd.
+type systemd struct {
+	notifySocket string        // see sd_notify(3)
+	watchdog     time.Duration // see sd_watchdog_enabled(3), 0 if disabled
+	fds          []uintptr     // passed by socket activation
+}
+
+// Read the environment systemd gives the process `pid`. Variables meant for
+// another process, e.g. a parent that did not clear them, are ignored.
+func systemdEnv(lookup func(string) (string, bool), pid int) (systemd, error) {
+	var sd systemd
+	sd.notifySocket, _ = lookup("NOTIFY_SOCKET")
+
+	forUs := func(key string) bool {
+		s, ok := lookup(key)
+		return !ok || s == strconv.Itoa(pid)
+	}
+
+	if s, ok := lookup("WATCHDOG_USEC"); ok && forUs("WATCHDOG_PID") {
+		usec, err := strconv.ParseUint(s, 10, 63)
+		if err != nil {
+			return sd, fmt.Errorf("invalid WATCHDOG_USEC: %w", err)
+		}
+		sd.watchdog = time.Duration(usec) * time.Microsecond
+	}
+
+	if s, ok := lookup("LISTEN_FDS"); ok && forUs("LISTEN_PID") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return sd, fmt.Errorf("invalid LISTEN_FDS: %q", s)
+		}
+		for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+			sd.fds = append(sd.fds, uintptr(fd))
+		}
+	}
+	return sd, nil
+}
+
+// Send a state to the service manager, e.g. READY=1. Does nothing unless
+// the service has a notification socket, i.e. Type=notify or WatchdogSec.
+func (sd systemd) notify(state string) error {
+	if sd.notifySocket == "" {
+		return nil
+	}
+	addr := &net.UnixAddr{Name: sd.notifySocket, Net: "unixgram"}
+	if addr.Name[0] == '@' {
+		addr.Name = "\x00" + addr.Name[1:] // abstract namespace
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// Return the first unix domain socket passed by socket activation, or nil
+// if there is none. Other sockets passed are closed.
+func (sd systemd) controlListener() (net.Listener, error) {
+	var control net.Listener
+	for _, fd := range sd.fds {
+		f := os.NewFile(fd, fmt.Sprintf("LISTEN_FD_%d", fd))
+		l, err := net.FileListener(f)
+		f.Close() // l holds a duplicate
+		if err != nil {
+			return nil, fmt.Errorf("failed to use activated socket: %w", err)
+		}
+		if _, ok := l.(*net.UnixListener); ok && control == nil {
+			control = l
+			continue
+		}
+		l.Close()
+	}
+	return control, nil
+}
@@ -0,0 +1,49 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSystemdControlListener(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "control"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A duplicate, as controlListener takes ownership of the descriptors
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, err := systemd{fds: []uintptr{uintptr(fd)}}.controlListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if control == nil {
+		t.Fatal("activated socket not used")
+	}
+	defer control.Close()
+
+	go net.Dial("unix", l.Addr().String())
+	conn, err := control.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if control, err := (systemd{}).controlListener(); control != nil || err != nil {
+		t.Error("expected no listener", control, err)
+	}
+}
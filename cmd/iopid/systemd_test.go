@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSystemdEnv(t *testing.T) {
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(key string) (string, bool) {
+			v, ok := vars[key]
+			return v, ok
+		}
+	}
+
+	t.Run("reads the environment of the service", func(t *testing.T) {
+		sd, err := systemdEnv(env(map[string]string{
+			"NOTIFY_SOCKET": "/run/systemd/notify",
+			"WATCHDOG_USEC": "30000000",
+			"WATCHDOG_PID":  "42",
+			"LISTEN_FDS":    "2",
+			"LISTEN_PID":    "42",
+		}), 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd.notifySocket != "/run/systemd/notify" || sd.watchdog != 30*time.Second || len(sd.fds) != 2 || sd.fds[0] != 3 {
+			t.Error("unexpected environment", sd)
+		}
+	})
+
+	t.Run("ignores variables of other processes", func(t *testing.T) {
+		sd, err := systemdEnv(env(map[string]string{
+			"WATCHDOG_USEC": "30000000",
+			"WATCHDOG_PID":  "1",
+			"LISTEN_FDS":    "1",
+			"LISTEN_PID":    "1",
+		}), 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd.watchdog != 0 || len(sd.fds) != 0 {
+			t.Error("unexpected environment", sd)
+		}
+	})
+
+	t.Run("rejects invalid variables", func(t *testing.T) {
+		for _, vars := range []map[string]string{
+			{"WATCHDOG_USEC": "30s"},
+			{"LISTEN_FDS": "-1"},
+		} {
+			if _, err := systemdEnv(env(vars), 42); err == nil {
+				t.Error("expected error for", vars)
+			}
+		}
+	})
+}
+
+func TestSystemdNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := (systemd{}).notify("READY=1"); err != nil {
+		t.Error("expected no-op without a socket, got", err)
+	}
+	if err := (systemd{notifySocket: path}).notify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("unexpected notification %q: %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,122 @@
+package iopi
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Coalescer merges writes of pins on the same port arriving within a
+// window into one read of the latch and one write of the port, for code
+// setting many pins in a row, e.g. in a loop. A write is applied when the
+// window opened by the first pending write of its port ends, or on Flush.
+type Coalescer struct {
+	Window time.Duration // writes are applied right away if 0
+
+	// Called when applying the writes of a port fails. The writes are
+	// dropped.
+	OnError func(port Port, err error)
+	Clock   Clock
+
+	dev     *Device
+	mutex   sync.Mutex
+	pending [2]pendingWrite // by port
+}
+
+// The pins written on a port during a window
+type pendingWrite struct {
+	mask  byte
+	state byte
+	gen   uint64 // of the window, so a flushed window is not applied twice
+}
+
+func NewCoalescer(dev *Device, window time.Duration) *Coalescer {
+	return &Coalescer{Window: window, dev: dev}
+}
+
+// Set the state of a pin when the window of its port ends. Later writes
+// of the same pin in the window replace earlier ones.
+func (c *Coalescer) WritePin(pin uint8, state State) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	if c.Window <= 0 {
+		return c.dev.WritePin(pin, state)
+	}
+	bit, port := GetPinPort(pin)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p := &c.pending[port]
+	if p.mask == 0 {
+		go c.expire(port, p.gen)
+	}
+	p.mask |= 1 << bit
+	p.state = SetBit(p.state, bit, int(state))
+	return nil
+}
+
+// Apply the writes of a port when its window ends.
+func (c *Coalescer) expire(port Port, gen uint64) {
+	sleep(c.Clock, c.Window)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.pending[port].gen != gen {
+		return
+	}
+	if err := c.flush(port); err != nil && c.OnError != nil {
+		c.OnError(port, err)
+	}
+}
+
+// Apply pending writes of both ports now. Returns the first error.
+func (c *Coalescer) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	errA := c.flush(PortA)
+	errB := c.flush(PortB)
+	if errA != nil {
+		return errA
+	}
+	return errB
+}
+
+// Apply the pending writes of a port, with the mutex held. Pins with
+// relay timing are written one by one through the sequencer of the
+// device, see Device.SetSequencer.
+func (c *Coalescer) flush(port Port) error {
+	p := &c.pending[port]
+	mask, state := p.mask, p.state
+	p.mask, p.state = 0, 0
+	p.gen++
+
+	var seqErr error
+	if seq := c.dev.sequencer; seq != nil {
+		for bit := uint8(0); bit < 8; bit++ {
+			pin := uint8(port)*8 + bit + 1
+			if mask&(1<<bit) == 0 || !seq.sequenced(pin) {
+				continue
+			}
+			mask &^= 1 << bit
+			if err := seq.write(c.dev, pin, State(GetBit(state, bit))); err != nil && seqErr == nil {
+				seqErr = err
+			}
+		}
+	}
+	if mask == 0 {
+		return seqErr
+	}
+
+	latch, err := c.dev.readLatch(port)
+	if err != nil {
+		return fmt.Errorf("failed to write to port %v: %w", port, err)
+	}
+	if err := c.dev.writePort(port, latch&^mask|state&mask, mask, "WritePin"); err != nil {
+		return err
+	}
+	return seqErr
+}
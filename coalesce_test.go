@@ -0,0 +1,103 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestCoalescer(t *testing.T) {
+	t.Run("merges writes of a port within the window", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(OLATA, 0x80)
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		c := NewCoalescer(dev, 5*time.Millisecond)
+		c.Clock = clock
+
+		for pin := uint8(1); pin <= 4; pin++ {
+			if err := c.WritePin(pin, High); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c.WritePin(4, Low)
+		clock.BlockUntil(1)
+		if n := gpioWrites(dev, file, GPIOA); n != 0 {
+			t.Error("written before the window ended", file.CallHistory)
+		}
+
+		clock.Advance(5 * time.Millisecond)
+		for i := 0; gpioWrites(dev, file, GPIOA) == 0; i++ {
+			if i == 100 {
+				t.Fatal("writes not applied")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0x87}) || gpioWrites(dev, file, GPIOA) != 1 {
+			t.Error("expected one write of the port", file.CallHistory)
+		}
+	})
+
+	t.Run("flushes pending writes", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(OLATA, 0)
+		file.SetRegister(OLATB, 0)
+		c := NewCoalescer(dev, time.Hour)
+
+		c.WritePin(2, High)
+		c.WritePin(16, High)
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0x02}) || !file.HasCall("Write", []byte{byte(GPIOB), 0x80}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+
+		n := len(file.CallHistory)
+		if err := c.Flush(); err != nil || len(file.CallHistory) != n {
+			t.Error("flushed writes twice", file.CallHistory, err)
+		}
+	})
+
+	t.Run("writes right away without a window", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(OLATB, 0)
+		c := NewCoalescer(dev, 0)
+
+		c.WritePin(9, High)
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0x01}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("reports errors of deferred writes", func(t *testing.T) {
+		dev := NewDevice(failingBus{}, 0x20, &sync.Mutex{})
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		clock.AutoAdvance(true)
+		errs := make(chan error, 1)
+		c := NewCoalescer(dev, time.Millisecond)
+		c.Clock = clock
+		c.OnError = func(port Port, err error) { errs <- err }
+
+		c.WritePin(1, High)
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Error("expected error")
+			}
+		case <-time.After(time.Second):
+			t.Error("error not reported")
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		c := NewCoalescer(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), time.Millisecond)
+		if err := c.WritePin(17, High); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
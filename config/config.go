@@ -0,0 +1,314 @@
+// Package config reads declarative descriptions of IO Pi boards and their
+// pins, and applies them to devices.
+//
+//	devices:
+//	  - bus: /dev/i2c-1
+//	    address: 0x20
+//	    pins:
+//	      - {pin: 1, name: pump, mode: output, state: low}
+//	      - {pin: 2, name: relay, mode: output, active_low: true}
+//	      - {pin: 9, name: door, mode: input, pullup: true, inverted: true, debounce: 20ms}
+//
+// Files may be written in YAML or JSON, and may hold several named
+// profiles; see Profile.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Devices  []Device           `yaml:"devices"`
+	Pins     map[string]Pin     `yaml:"pins,omitempty"` // shared definitions by name
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+type Device struct {
+	Bus     string `yaml:"bus"` // e.g. /dev/i2c-1
+	Address byte   `yaml:"address"`
+	Pins    []Pin  `yaml:"pins,omitempty"`
+	// Another controller writes the chip too, see Device.SetCacheAdvisory
+	Shared bool `yaml:"shared,omitempty"`
+}
+
+type Pin struct {
+	Pin      uint8  `yaml:"pin,omitempty"`  // 1-16
+	Name     string `yaml:"name,omitempty"` // optional, unique across all devices
+	Mode     string `yaml:"mode,omitempty"` // "input" (default) or "output"
+	Pullup   bool   `yaml:"pullup,omitempty"`
+	Inverted bool   `yaml:"inverted,omitempty"` // input polarity
+	// Low is on, for Device.SetActive and IsActive. Unlike Inverted, this
+	// is handled in software and does not change the startup State.
+	ActiveLow bool          `yaml:"active_low,omitempty"`
+	State     string        `yaml:"state,omitempty"`    // startup output state, "high" or "low"
+	Debounce  time.Duration `yaml:"debounce,omitempty"` // for inputs, e.g. "20ms"
+}
+
+// Read and validate a configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse and validate a configuration in YAML or JSON.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.Select(""); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) Validate() error {
+	names := make(map[string]bool)
+	addrs := make(map[string]bool)
+
+	for name, p := range cfg.Pins {
+		if _, err := p.mode(); err != nil {
+			return fmt.Errorf("pin %s: %w", name, err)
+		}
+		if _, err := p.state(); err != nil {
+			return fmt.Errorf("pin %s: %w", name, err)
+		}
+	}
+
+	for _, d := range cfg.Devices {
+		if d.Bus == "" {
+			return fmt.Errorf("device 0x%02x: missing bus", d.Address)
+		}
+		if err := iopi.ValidateAddress(d.Address); err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s@%d", d.Bus, d.Address)
+		if addrs[key] {
+			return fmt.Errorf("device 0x%02x: declared twice on %s", d.Address, d.Bus)
+		}
+		addrs[key] = true
+
+		pins := make(map[uint8]bool)
+		for _, p := range d.Pins {
+			if err := p.validate(); err != nil {
+				return fmt.Errorf("device 0x%02x: %w", d.Address, err)
+			}
+			if pins[p.Pin] {
+				return fmt.Errorf("device 0x%02x: pin %d declared twice", d.Address, p.Pin)
+			}
+			pins[p.Pin] = true
+
+			if p.Name != "" {
+				if names[p.Name] {
+					return fmt.Errorf("pin name %q used twice", p.Name)
+				}
+				names[p.Name] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p Pin) validate() error {
+	if p.Pin < 1 || p.Pin > 16 {
+		return fmt.Errorf("invalid pin: %d", p.Pin)
+	}
+	if _, err := p.mode(); err != nil {
+		return fmt.Errorf("pin %d: %w", p.Pin, err)
+	}
+	if _, err := p.state(); err != nil {
+		return fmt.Errorf("pin %d: %w", p.Pin, err)
+	}
+	if p.Debounce < 0 {
+		return fmt.Errorf("pin %d: negative debounce", p.Pin)
+	}
+	return nil
+}
+
+// Parse the mode with iopi.ParseMode, so the same values are accepted as
+// by the command line tool and the HTTP API. A pin is input or output.
+func (p Pin) mode() (iopi.Mode, error) {
+	if p.Mode == "" {
+		return iopi.Input, nil
+	}
+	mode, err := iopi.ParseMode(p.Mode)
+	if err != nil {
+		return 0, err
+	}
+	if mode != iopi.Input && mode != iopi.Output {
+		return 0, fmt.Errorf("invalid mode: %s", p.Mode)
+	}
+	return mode, nil
+}
+
+// Parse the state with iopi.ParseState, see mode.
+func (p Pin) state() (iopi.State, error) {
+	if p.State == "" {
+		return iopi.Low, nil
+	}
+	return iopi.ParseState(p.State)
+}
+
+// Configure the declared pins of a device. The initial state of an output
+// is written before the pin is switched to output, so it starts in the
+// right state. Pins that are not declared are left untouched. Debounce is
+// not a chip setting; see Debounce.
+func ApplyConfig(dev *iopi.Device, cfg Device) error {
+	if dev.Address != cfg.Address {
+		return fmt.Errorf("config for 0x%02x applied to device 0x%02x", cfg.Address, dev.Address)
+	}
+
+	for _, p := range cfg.Pins {
+		if err := applyPin(dev, p, true); err != nil {
+			return fmt.Errorf("failed to configure pin %d: %w", p.Pin, err)
+		}
+	}
+	return nil
+}
+
+// Configure the declared pins of a device like ApplyConfig, but without
+// writing initial output states. Use this when the outputs were restored
+// from elsewhere, e.g. with Device.RestoreOutputs.
+func ApplySettings(dev *iopi.Device, cfg Device) error {
+	if dev.Address != cfg.Address {
+		return fmt.Errorf("config for 0x%02x applied to device 0x%02x", cfg.Address, dev.Address)
+	}
+
+	for _, p := range cfg.Pins {
+		if err := applyPin(dev, p, false); err != nil {
+			return fmt.Errorf("failed to configure pin %d: %w", p.Pin, err)
+		}
+	}
+	return nil
+}
+
+// Configure a pin, writing its initial state only if `withState` is set.
+func applyPin(dev *iopi.Device, p Pin, withState bool) error {
+	mode, err := p.mode()
+	if err != nil {
+		return err
+	}
+	state, err := p.state()
+	if err != nil {
+		return err
+	}
+	if err := dev.SetActiveLow(p.Pin, p.ActiveLow); err != nil {
+		return err
+	}
+
+	if withState && mode == iopi.Output && p.State != "" {
+		if err := dev.WritePin(p.Pin, state); err != nil {
+			return err
+		}
+	}
+
+	pullup := iopi.PullupDisabled
+	if p.Pullup {
+		pullup = iopi.PullupEnabled
+	}
+	if err := dev.SetPinPullup(p.Pin, pullup); err != nil {
+		return err
+	}
+
+	pol := iopi.PolarityNormal
+	if p.Inverted {
+		pol = iopi.PolarityInverted
+	}
+	if err := dev.SetPinPolarity(p.Pin, pol); err != nil {
+		return err
+	}
+
+	return dev.SetPinMode(p.Pin, mode)
+}
+
+// Apply the declared debounce times of a device to a poller.
+func Debounce(poller *iopi.Poller, cfg Device) {
+	for _, p := range cfg.Pins {
+		if p.Debounce > 0 {
+			poller.SetDebounce(p.Pin, p.Debounce)
+		}
+	}
+}
+
+// Find a pin by name. Returns an error if no pin has the name.
+func (cfg *Config) Lookup(name string) (Device, Pin, error) {
+	for _, d := range cfg.Devices {
+		for _, p := range d.Pins {
+			if p.Name == name {
+				return d, p, nil
+			}
+		}
+	}
+	return Device{}, Pin{}, errors.New("no pin named " + name)
+}
+
+// Return the names of all named pins, for integrations to show names
+// instead of pin numbers.
+func (cfg *Config) Aliases() *iopi.Aliases {
+	a := iopi.NewAliases()
+	for _, d := range cfg.Devices {
+		for _, p := range d.Pins {
+			if p.Name != "" {
+				a.Set(p.Name, iopi.PinRef{Address: d.Address, Pin: p.Pin})
+			}
+		}
+	}
+	return a
+}
+
+// Return the startup layout of a device, with the declared settings of its
+// pins. Undeclared pins get the chip defaults: input, no pull-up, normal
+// polarity and a low latch.
+func StartupLayout(cfg Device) iopi.Layout {
+	var l iopi.Layout
+	for _, p := range cfg.Pins {
+		mode, _ := p.mode()
+		state, _ := p.state()
+		bit, port := iopi.GetPinPort(p.Pin)
+
+		if mode == iopi.Output {
+			l.Outputs[port] = iopi.SetBit(l.Outputs[port], bit, 1)
+			if state != iopi.Low {
+				l.State[port] = iopi.SetBit(l.State[port], bit, 1)
+			}
+		}
+		if p.Pullup {
+			l.Pullup[port] = iopi.SetBit(l.Pullup[port], bit, 1)
+		}
+		if p.Inverted {
+			l.Inverted[port] = iopi.SetBit(l.Inverted[port], bit, 1)
+		}
+	}
+	return l
+}
+
+// Initialise a device and program all of its pins from the configuration
+// in one pass, see Device.InitLayout. You are expected to call `.Close()`
+// on the device when you're done.
+func Init(dev *iopi.Device, cfg Device) error {
+	return InitLayout(dev, cfg, StartupLayout(cfg))
+}
+
+// Initialise a device like Init, from a layout based on StartupLayout,
+// e.g. with output latches restored from a previous run.
+func InitLayout(dev *iopi.Device, cfg Device, l iopi.Layout) error {
+	if dev.Address != cfg.Address {
+		return fmt.Errorf("config for 0x%02x applied to device 0x%02x", cfg.Address, dev.Address)
+	}
+	for _, p := range cfg.Pins {
+		if err := dev.SetActiveLow(p.Pin, p.ActiveLow); err != nil {
+			return fmt.Errorf("failed to configure pin %d: %w", p.Pin, err)
+		}
+	}
+	return dev.InitLayout(l)
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+const example = `
+devices:
+  - bus: /dev/i2c-1
+    address: 0x20
+    pins:
+      - {pin: 1, name: pump, mode: output, state: high}
+      - {pin: 9, name: door, pullup: true, inverted: true, debounce: 20ms}
+`
+
+func TestParse(t *testing.T) {
+	t.Run("parses yaml", func(t *testing.T) {
+		cfg, err := Parse([]byte(example))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Devices) != 1 || cfg.Devices[0].Address != 0x20 {
+			t.Fatal("unexpected devices", cfg.Devices)
+		}
+		door := cfg.Devices[0].Pins[1]
+		if door.Name != "door" || !door.Pullup || !door.Inverted || door.Debounce != 20*time.Millisecond {
+			t.Error("unexpected pin", door)
+		}
+	})
+
+	t.Run("parses json", func(t *testing.T) {
+		cfg, err := Parse([]byte(`{"devices": [{"bus": "/dev/i2c-1", "address": 33, "pins": [{"pin": 2}]}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Devices[0].Address != 0x21 || cfg.Devices[0].Pins[0].Pin != 2 {
+			t.Error("unexpected config", cfg)
+		}
+	})
+
+	t.Run("accepts the values of the iopi parsers", func(t *testing.T) {
+		cfg, err := Parse([]byte(`devices: [{bus: b, address: 0x20, pins: [{pin: 1, mode: OUT, state: on}]}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := cfg.Devices[0].Pins[0]
+		if mode, _ := p.mode(); mode != iopi.Output {
+			t.Error("unexpected mode", mode)
+		}
+		if state, _ := p.state(); state != iopi.High {
+			t.Error("unexpected state", state)
+		}
+	})
+
+	t.Run("rejects invalid config", func(t *testing.T) {
+		for _, data := range []string{
+			`devices: [{address: 0x20}]`,
+			`devices: [{bus: b, address: 0x78}]`,
+			`devices: [{bus: b, address: 0x20, pins: [{pin: 0}]}]`,
+			`devices: [{bus: b, address: 0x20, pins: [{pin: 1, mode: sideways}]}]`,
+			`devices: [{bus: b, address: 0x20, pins: [{pin: 1, state: maybe}]}]`,
+			`devices: [{bus: b, address: 0x20, pins: [{pin: 1, mode: 0x0F}]}]`,
+			`devices: [{bus: b, address: 0x20, pins: [{pin: 1}, {pin: 1}]}]`,
+			`devices: [{bus: b, address: 0x20, pins: [{pin: 1, name: x}, {pin: 2, name: x}]}]`,
+			`devices: [{bus: b, address: 0x21}, {bus: b, address: 0x21}]`,
+		} {
+			if _, err := Parse([]byte(data)); err == nil {
+				t.Error("expected error for", data)
+			}
+		}
+	})
+}
+
+func TestLookup(t *testing.T) {
+	cfg, _ := Parse([]byte(example))
+
+	dev, pin, err := cfg.Lookup("door")
+	if err != nil || dev.Address != 0x20 || pin.Pin != 9 {
+		t.Error("unexpected result", dev, pin, err)
+	}
+	if _, _, err := cfg.Lookup("window"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	cfg, _ := Parse([]byte(example))
+
+	t.Run("configures pins", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		if err := ApplyConfig(dev, cfg.Devices[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		// Output state must be latched before the direction is changed
+		state, mode := -1, -1
+		for i, c := range file.CallHistory {
+			if c.Fn != "Write" || len(c.Arg) != 2 {
+				continue
+			}
+			switch iopi.Register(c.Arg[0]) {
+			case iopi.GPIOA:
+				state = i
+			case iopi.IODIRA:
+				mode = i
+			}
+		}
+		if state == -1 || mode == -1 || state > mode {
+			t.Error("unexpected write order", file.CallHistory)
+		}
+	})
+
+	t.Run("marks active-low pins", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+		relay := Device{Address: 0x20, Pins: []Pin{{Pin: 4, Mode: "output", ActiveLow: true}}}
+		if err := ApplyConfig(dev, relay); err != nil {
+			t.Fatal(err)
+		}
+		if low4, _ := dev.IsActiveLow(4); !low4 {
+			t.Error("pin 4 not active-low")
+		}
+		if low3, _ := dev.IsActiveLow(3); low3 {
+			t.Error("unexpected active-low pins")
+		}
+	})
+
+	t.Run("rejects wrong device", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x21, &sync.Mutex{})
+		if ApplyConfig(dev, cfg.Devices[0]) == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestApplySettings(t *testing.T) {
+	cfg, _ := Parse([]byte(example))
+	file := iopi.NewFakeFile()
+	dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+
+	if err := ApplySettings(dev, cfg.Devices[0]); err != nil {
+		t.Fatal(err)
+	}
+	modeSet := false
+	for _, c := range file.CallHistory {
+		if c.Fn != "Write" || len(c.Arg) != 2 {
+			continue
+		}
+		switch iopi.Register(c.Arg[0]) {
+		case iopi.GPIOA, iopi.GPIOB:
+			t.Error("output state written", file.CallHistory)
+		case iopi.IODIRA:
+			modeSet = true
+		}
+	}
+	if !modeSet {
+		t.Error("pin mode not set", file.CallHistory)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	cfg, _ := Parse([]byte(example))
+	a := cfg.Aliases()
+
+	if ref, ok := a.Lookup("door"); !ok || ref != (iopi.PinRef{Address: 0x20, Pin: 9}) {
+		t.Error("unexpected pin", ref, ok)
+	}
+	if names := a.Names(); len(names) != 2 {
+		t.Error("unexpected names", names)
+	}
+}
+
+func TestStartupLayout(t *testing.T) {
+	cfg, _ := Parse([]byte(`
+devices:
+  - bus: b
+    address: 0x20
+    pins:
+      - {pin: 1, mode: output, state: high}
+      - {pin: 2, mode: output, state: low}
+      - {pin: 3, state: high, pullup: true}
+      - {pin: 9, inverted: true}
+      - {pin: 16, mode: output, state: high}
+`))
+
+	l := StartupLayout(cfg.Devices[0])
+	expected := iopi.Layout{
+		State:    [2]byte{0x01, 0x80},
+		Outputs:  [2]byte{0x03, 0x80},
+		Pullup:   [2]byte{0x04, 0x00},
+		Inverted: [2]byte{0x00, 0x01},
+	}
+	if l != expected {
+		t.Errorf("unexpected layout: %+v", l)
+	}
+}
+
+func TestInit(t *testing.T) {
+	dc := Device{Bus: "b", Address: 0x20, Pins: []Pin{{Pin: 1, Mode: "output", State: "high"}}}
+
+	t.Run("starts outputs in the given state", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		l := StartupLayout(dc)
+		l.State[iopi.PortA] = 0x00
+
+		if err := InitLayout(dev, dc, l); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(iopi.OLATA), 0x00}) || !file.HasCall("Write", []byte{byte(iopi.IODIRA), 0xFE}) {
+			t.Error("layout not applied", file.CallHistory)
+		}
+	})
+
+	t.Run("rejects the config of another device", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x21, &sync.Mutex{})
+		if err := Init(dev, dc); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
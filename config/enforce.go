@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Compare the mode, pull-up and polarity of the declared pins of a device
+// against the chip, where the chip is `A` and the configuration is `B` in
+// the returned differences. Output states are not compared, as they change
+// at runtime. Returns nil differences if the device matches.
+func Verify(dev *iopi.Device, cfg Device) ([]iopi.Difference, error) {
+	live, err := dev.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify device: %w", err)
+	}
+
+	var diffs []iopi.Difference
+	for _, p := range cfg.Pins {
+		bit, port := iopi.GetPinPort(p.Pin)
+		regs := live.PortA
+		if port == iopi.PortB {
+			regs = live.PortB
+		}
+
+		mode, _ := p.mode()
+		for _, s := range []struct {
+			reg  iopi.Register
+			live byte
+			want bool
+		}{
+			{iopi.IODIRA, regs.Mode, mode == iopi.Input},
+			{iopi.GPPUA, regs.Pullup, p.Pullup},
+			{iopi.IPOLA, regs.Polarity, p.Inverted},
+		} {
+			got := iopi.GetBit(s.live, bit)
+			var want uint8
+			if s.want {
+				want = 1
+			}
+			if got != want {
+				reg := s.reg + iopi.Register(port)
+				diffs = append(diffs, iopi.Difference{
+					Register: reg.String(), Pin: p.Pin, A: got, B: want,
+				})
+			}
+		}
+	}
+
+	return diffs, nil
+}
+
+// Periodically verifies a device against its configuration, to catch
+// pins reconfigured behind the back of the program, e.g. by another
+// process or an electrical glitch resetting the chip.
+type Enforcer struct {
+	Interval time.Duration
+	Correct  bool // reapply the declared settings of drifted pins
+	Clock    iopi.Clock
+
+	// Called with the differences found, before they are corrected
+	OnDrift func(diffs []iopi.Difference)
+
+	dev   *iopi.Device
+	mutex sync.Mutex
+	cfg   Device
+}
+
+func NewEnforcer(dev *iopi.Device, cfg Device, interval time.Duration) *Enforcer {
+	return &Enforcer{
+		Interval: interval,
+		dev:      dev,
+		cfg:      cfg,
+	}
+}
+
+// Replace the configuration enforced, e.g. after a reload.
+func (e *Enforcer) SetConfig(cfg Device) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.cfg = cfg
+}
+
+// Check the device until the context is cancelled.
+func (e *Enforcer) Run(ctx context.Context) error {
+	clock := iopi.ClockOr(e.Clock)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(e.Interval):
+			if _, err := e.Check(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Verify the device once, reporting and optionally correcting drift.
+// Returns the differences found.
+func (e *Enforcer) Check() ([]iopi.Difference, error) {
+	e.mutex.Lock()
+	cfg := e.cfg
+	e.mutex.Unlock()
+
+	diffs, err := Verify(e.dev, cfg)
+	if err != nil || len(diffs) == 0 {
+		return diffs, err
+	}
+
+	if e.OnDrift != nil {
+		e.OnDrift(diffs)
+	}
+
+	if e.Correct {
+		drifted := make(map[uint8]bool)
+		for _, d := range diffs {
+			drifted[d.Pin] = true
+		}
+		for _, p := range cfg.Pins {
+			if !drifted[p.Pin] {
+				continue
+			}
+			if err := applyPin(e.dev, p, false); err != nil {
+				return diffs, fmt.Errorf("failed to correct pin %d: %w", p.Pin, err)
+			}
+		}
+	}
+
+	return diffs, nil
+}
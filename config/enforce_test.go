@@ -0,0 +1,81 @@
+package config
+
+import (
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// The fake file reads back the register address, so IODIRA reads 0x00
+// (all outputs), IPOLA 0x02 (pin 2 inverted) and GPPUA 0x0C (pull-ups on
+// pins 3 and 4).
+var golden = Device{Address: 0x20, Pins: []Pin{
+	{Pin: 1, Mode: "output"},
+	{Pin: 2, Mode: "output"},
+	{Pin: 3, Mode: "output", Pullup: true},
+}}
+
+func TestVerify(t *testing.T) {
+	t.Run("reports drifted pins", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+
+		diffs, err := Verify(dev, golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffs) != 1 || diffs[0] != (iopi.Difference{Register: "IPOLA", Pin: 2, A: 1, B: 0}) {
+			t.Error("unexpected differences", diffs)
+		}
+	})
+
+	t.Run("returns nil if matching", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+		cfg := Device{Address: 0x20, Pins: []Pin{{Pin: 2, Mode: "output", Inverted: true}}}
+
+		if diffs, err := Verify(dev, cfg); err != nil || diffs != nil {
+			t.Error("unexpected result", diffs, err)
+		}
+	})
+}
+
+func TestEnforcer(t *testing.T) {
+	t.Run("alerts without correcting", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+
+		var alerted []iopi.Difference
+		e := NewEnforcer(dev, golden, 0)
+		e.OnDrift = func(diffs []iopi.Difference) { alerted = diffs }
+
+		if _, err := e.Check(); err != nil {
+			t.Fatal(err)
+		}
+		if len(alerted) != 1 {
+			t.Error("expected alert", alerted)
+		}
+		if len(writtenRegisters(file)) != 0 {
+			t.Error("unexpected writes", writtenRegisters(file))
+		}
+	})
+
+	t.Run("corrects drifted pins", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+
+		e := NewEnforcer(dev, golden, 0)
+		e.Correct = true
+		if _, err := e.Check(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !file.HasCall("Write", []byte{byte(iopi.IPOLA), 0x00}) {
+			t.Error("expected polarity of pin 2 to be corrected", file.CallHistory)
+		}
+		for _, reg := range writtenRegisters(file) {
+			if reg == byte(iopi.GPIOA) || reg == byte(iopi.OLATA) {
+				t.Error("output state written")
+			}
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables overriding the configuration file:
+//
+//	IOPI_BUS              bus of all devices
+//	IOPI_ADDR             address of the device, if only one is declared
+//	IOPI_DEVICE_<n>_BUS   bus of the n-th device, counting from 0
+//	IOPI_DEVICE_<n>_ADDR  address of the n-th device
+//
+// Addresses may be given in decimal or hex (e.g. 32 or 0x20).
+const EnvPrefix = "IOPI_"
+
+// Override settings from environment variables, looked up with a function
+// like os.LookupEnv. The configuration is validated afterwards.
+func (cfg *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	if bus, ok := lookup(EnvPrefix + "BUS"); ok {
+		for i := range cfg.Devices {
+			cfg.Devices[i].Bus = bus
+		}
+	}
+
+	if s, ok := lookup(EnvPrefix + "ADDR"); ok {
+		if len(cfg.Devices) != 1 {
+			return fmt.Errorf("%sADDR requires exactly one device, found %d", EnvPrefix, len(cfg.Devices))
+		}
+		addr, err := ParseAddress(s)
+		if err != nil {
+			return fmt.Errorf("%sADDR: %w", EnvPrefix, err)
+		}
+		cfg.Devices[0].Address = addr
+	}
+
+	for i := range cfg.Devices {
+		prefix := fmt.Sprintf("%sDEVICE_%d_", EnvPrefix, i)
+		if bus, ok := lookup(prefix + "BUS"); ok {
+			cfg.Devices[i].Bus = bus
+		}
+		if s, ok := lookup(prefix + "ADDR"); ok {
+			addr, err := ParseAddress(s)
+			if err != nil {
+				return fmt.Errorf("%sADDR: %w", prefix, err)
+			}
+			cfg.Devices[i].Address = addr
+		}
+	}
+
+	return cfg.Validate()
+}
+
+// Parse an i2c address in decimal or hex.
+func ParseAddress(s string) (byte, error) {
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil || n > 0x7F {
+		return 0, fmt.Errorf("invalid address: %s", s)
+	}
+	return byte(n), nil
+}
+
+// Read a configuration file and apply overrides from the environment.
+func LoadWithEnv(path string) (*Config, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import "testing"
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Run("overrides bus and address", func(t *testing.T) {
+		cfg, _ := Parse([]byte(example))
+		err := cfg.ApplyEnv(env(map[string]string{
+			"IOPI_BUS":  "/dev/i2c-0",
+			"IOPI_ADDR": "0x21",
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Devices[0].Bus != "/dev/i2c-0" || cfg.Devices[0].Address != 0x21 {
+			t.Error("unexpected device", cfg.Devices[0])
+		}
+	})
+
+	t.Run("overrides indexed devices", func(t *testing.T) {
+		cfg, _ := Parse([]byte(`devices: [{bus: a, address: 0x20}, {bus: a, address: 0x21}]`))
+		err := cfg.ApplyEnv(env(map[string]string{
+			"IOPI_DEVICE_1_BUS":  "b",
+			"IOPI_DEVICE_1_ADDR": "34",
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Devices[0].Bus != "a" || cfg.Devices[1].Bus != "b" || cfg.Devices[1].Address != 0x22 {
+			t.Error("unexpected devices", cfg.Devices)
+		}
+	})
+
+	t.Run("rejects ambiguous address", func(t *testing.T) {
+		cfg, _ := Parse([]byte(`devices: [{bus: a, address: 0x20}, {bus: a, address: 0x21}]`))
+		if cfg.ApplyEnv(env(map[string]string{"IOPI_ADDR": "0x22"})) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("rejects invalid address", func(t *testing.T) {
+		cfg, _ := Parse([]byte(example))
+		if cfg.ApplyEnv(env(map[string]string{"IOPI_ADDR": "0x80"})) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("validates result", func(t *testing.T) {
+		cfg, _ := Parse([]byte(`devices: [{bus: a, address: 0x20}, {bus: b, address: 0x20}]`))
+		if cfg.ApplyEnv(env(map[string]string{"IOPI_BUS": "c"})) == nil {
+			t.Error("expected duplicate device error")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+
+	iopi "github.com/stigok/go-io-pi"
+	"gopkg.in/yaml.v3"
+)
+
+// Read the current setup of a device into a configuration declaring all
+// of its pins, e.g. to capture a board configured by hand. Outputs are
+// declared with their current state as the initial state.
+func ExportConfig(dev *iopi.Device) (Device, error) {
+	snap, err := dev.Snapshot()
+	if err != nil {
+		return Device{}, fmt.Errorf("failed to export config: %w", err)
+	}
+
+	cfg := Device{Bus: dev.Path, Address: dev.Address}
+	for pin := uint8(1); pin <= 16; pin++ {
+		bit, port := iopi.GetPinPort(pin)
+		regs := snap.PortA
+		if port == iopi.PortB {
+			regs = snap.PortB
+		}
+
+		p := Pin{
+			Pin:      pin,
+			Mode:     "input",
+			Pullup:   iopi.GetBit(regs.Pullup, bit) == 1,
+			Inverted: iopi.GetBit(regs.Polarity, bit) == 1,
+		}
+		if iopi.GetBit(regs.Mode, bit) == 0 {
+			p.Mode = "output"
+			p.State = "low"
+			if iopi.GetBit(regs.Output, bit) == 1 {
+				p.State = "high"
+			}
+		}
+		cfg.Pins = append(cfg.Pins, p)
+	}
+
+	return cfg, nil
+}
+
+// Encode a configuration as YAML, in the format read by Parse.
+func (cfg *Config) Marshal() ([]byte, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return data, nil
+}
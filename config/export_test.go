@@ -0,0 +1,49 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestExportConfig(t *testing.T) {
+	// The fake file reads back the register address, so all of port A
+	// are outputs (IODIRA 0x00) with OLATA 0x14 (pins 3 and 5 high), pin 2
+	// is inverted (IPOLA 0x02) and pins 3 and 4 have pull-ups (GPPUA 0x0C).
+	dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+
+	cfg, err := ExportConfig(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Bus != "fake" || cfg.Address != 0x20 || len(cfg.Pins) != 16 {
+		t.Fatal("unexpected device", cfg)
+	}
+
+	want := []Pin{
+		{Pin: 1, Mode: "output", State: "low"},
+		{Pin: 2, Mode: "output", State: "low", Inverted: true},
+		{Pin: 3, Mode: "output", State: "high", Pullup: true},
+		{Pin: 4, Mode: "output", State: "low", Pullup: true},
+		{Pin: 5, Mode: "output", State: "high"},
+	}
+	if !reflect.DeepEqual(cfg.Pins[:5], want) {
+		t.Error("unexpected pins", cfg.Pins[:5])
+	}
+
+	t.Run("round trips through yaml", func(t *testing.T) {
+		data, err := (&Config{Devices: []Device{cfg}}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed.Devices[0], cfg) {
+			t.Error("unexpected config", string(data))
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// A named set of devices, selected at load time. Profiles let one file
+// describe several deployments, e.g. a test rig and production, while pin
+// definitions are shared between them:
+//
+//	pins:
+//	  pump: {mode: output, state: low}
+//	  door: {pullup: true, inverted: true, debounce: 20ms}
+//	profiles:
+//	  test-rig:
+//	    devices:
+//	      - bus: /dev/i2c-1
+//	        address: 0x20
+//	        pins: [{pin: 1, name: pump}, {pin: 2, name: door}]
+//	  production:
+//	    devices:
+//	      - bus: /dev/i2c-1
+//	        address: 0x21
+//	        pins: [{pin: 16, name: pump}, {pin: 9, name: door}]
+type Profile struct {
+	Devices []Device `yaml:"devices"`
+}
+
+// Read a configuration file and select a profile.
+func LoadProfile(path string, profile string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return ParseProfile(data, profile)
+}
+
+// Parse a configuration and select a profile.
+func ParseProfile(data []byte, profile string) (*Config, error) {
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Select(profile); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Replace the devices with those of a named profile, and fill in pins from
+// the shared pin definitions. An empty name keeps the top-level devices.
+func (cfg *Config) Select(profile string) error {
+	if profile != "" {
+		p, ok := cfg.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("no profile named %s", profile)
+		}
+		cfg.Devices = make([]Device, len(p.Devices))
+		copy(cfg.Devices, p.Devices)
+	}
+
+	for i, d := range cfg.Devices {
+		pins := make([]Pin, len(d.Pins))
+		for j, p := range d.Pins {
+			if shared, ok := cfg.Pins[p.Name]; ok && p.Name != "" {
+				p = p.inherit(shared)
+			}
+			pins[j] = p
+		}
+		cfg.Devices[i].Pins = pins
+	}
+
+	return cfg.Validate()
+}
+
+// Fill in settings not given on the pin from a shared definition.
+func (p Pin) inherit(shared Pin) Pin {
+	if p.Pin == 0 {
+		p.Pin = shared.Pin
+	}
+	if p.Mode == "" {
+		p.Mode = shared.Mode
+	}
+	if p.State == "" {
+		p.State = shared.State
+	}
+	if p.Debounce == 0 {
+		p.Debounce = shared.Debounce
+	}
+	p.Pullup = p.Pullup || shared.Pullup
+	p.Inverted = p.Inverted || shared.Inverted
+	p.ActiveLow = p.ActiveLow || shared.ActiveLow
+	return p
+}
+
+// Return the names of all profiles in the configuration.
+func (cfg *Config) ProfileNames() []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const profiles = `
+pins:
+  pump: {mode: output, state: low}
+  door: {pullup: true, debounce: 20ms}
+devices:
+  - bus: /dev/i2c-1
+    address: 0x20
+    pins: [{pin: 1, name: pump}]
+profiles:
+  test-rig:
+    devices:
+      - bus: /dev/i2c-1
+        address: 0x20
+        pins: [{pin: 1, name: pump}, {pin: 2, name: door}]
+  production:
+    devices:
+      - bus: /dev/i2c-1
+        address: 0x21
+        pins: [{pin: 16, name: pump, state: high}, {pin: 9, name: door, inverted: true}]
+`
+
+func TestSelect(t *testing.T) {
+	t.Run("uses top-level devices by default", func(t *testing.T) {
+		cfg, err := Parse([]byte(profiles))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Devices) != 1 || cfg.Devices[0].Pins[0].Mode != "output" {
+			t.Error("unexpected devices", cfg.Devices)
+		}
+	})
+
+	t.Run("selects profile with shared pins", func(t *testing.T) {
+		cfg, err := ParseProfile([]byte(profiles), "production")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Devices[0].Address != 0x21 {
+			t.Fatal("unexpected device", cfg.Devices[0])
+		}
+
+		want := []Pin{
+			{Pin: 16, Name: "pump", Mode: "output", State: "high"},
+			{Pin: 9, Name: "door", Pullup: true, Inverted: true, Debounce: 20 * time.Millisecond},
+		}
+		if !reflect.DeepEqual(cfg.Devices[0].Pins, want) {
+			t.Error("unexpected pins", cfg.Devices[0].Pins)
+		}
+	})
+
+	t.Run("does not modify profiles", func(t *testing.T) {
+		cfg, _ := ParseProfile([]byte(profiles), "test-rig")
+		if cfg.Profiles["test-rig"].Devices[0].Pins[0].Mode != "" {
+			t.Error("profile was modified")
+		}
+	})
+
+	t.Run("rejects unknown profile", func(t *testing.T) {
+		if _, err := ParseProfile([]byte(profiles), "staging"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("rejects invalid shared pin", func(t *testing.T) {
+		if _, err := Parse([]byte(`pins: {pump: {mode: sideways}}`)); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("lists profiles", func(t *testing.T) {
+		cfg, _ := Parse([]byte(profiles))
+		if names := cfg.ProfileNames(); !reflect.DeepEqual(names, []string{"production", "test-rig"}) {
+			t.Error("unexpected names", names)
+		}
+	})
+}
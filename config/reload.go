@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Pin declarations of a device that differ between two configurations.
+type Changes struct {
+	Added    []Pin // declared in the new configuration only
+	Modified []Pin // declared in both, with different settings
+	Removed  []Pin // declared in the old configuration only
+}
+
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Removed) == 0
+}
+
+// Compare the pin declarations of two configurations of a device.
+func DiffDevice(old, new Device) Changes {
+	var c Changes
+
+	prev := make(map[uint8]Pin)
+	for _, p := range old.Pins {
+		prev[p.Pin] = p
+	}
+
+	for _, p := range new.Pins {
+		o, ok := prev[p.Pin]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, p)
+		case o != p:
+			c.Modified = append(c.Modified, p)
+		}
+		delete(prev, p.Pin)
+	}
+
+	for _, p := range old.Pins {
+		if _, ok := prev[p.Pin]; ok {
+			c.Removed = append(c.Removed, p)
+		}
+	}
+
+	return c
+}
+
+// Apply the differences between two configurations of a device, leaving
+// unchanged pins untouched. New pins are configured like in ApplyConfig.
+// Modified pins get their new settings, but their state is only written if
+// they were switched to output, so running outputs are not reset. Removed
+// pins are released.
+func Reload(dev *iopi.Device, old, new Device) error {
+	c := DiffDevice(old, new)
+
+	for _, p := range c.Removed {
+		if err := Release(dev, p.Pin); err != nil {
+			return fmt.Errorf("failed to release pin %d: %w", p.Pin, err)
+		}
+	}
+
+	for _, p := range c.Added {
+		if err := applyPin(dev, p, true); err != nil {
+			return fmt.Errorf("failed to configure pin %d: %w", p.Pin, err)
+		}
+	}
+
+	prev := make(map[uint8]Pin)
+	for _, p := range old.Pins {
+		prev[p.Pin] = p
+	}
+	for _, p := range c.Modified {
+		o := prev[p.Pin]
+		oldMode, _ := o.mode()
+		newMode, _ := p.mode()
+		if o.Mode == p.Mode && o.Pullup == p.Pullup && o.Inverted == p.Inverted && o.State == p.State &&
+			o.ActiveLow == p.ActiveLow {
+			continue // e.g. only the name or debounce changed
+		}
+		becameOutput := oldMode != iopi.Output && newMode == iopi.Output
+		if err := applyPin(dev, p, becameOutput); err != nil {
+			return fmt.Errorf("failed to configure pin %d: %w", p.Pin, err)
+		}
+	}
+
+	return nil
+}
+
+// Return a pin to the chip defaults: input, no pull-up, normal polarity,
+// and clear its active-low flag.
+func Release(dev *iopi.Device, pin uint8) error {
+	if err := dev.SetActiveLow(pin, false); err != nil {
+		return err
+	}
+	if err := dev.SetPinMode(pin, iopi.Input); err != nil {
+		return err
+	}
+	if err := dev.SetPinPullup(pin, iopi.PullupDisabled); err != nil {
+		return err
+	}
+	return dev.SetPinPolarity(pin, iopi.PolarityNormal)
+}
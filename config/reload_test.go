@@ -0,0 +1,124 @@
+package config
+
+import (
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestDiffDevice(t *testing.T) {
+	old := Device{Pins: []Pin{{Pin: 1}, {Pin: 2, Mode: "input"}, {Pin: 3}}}
+	new := Device{Pins: []Pin{{Pin: 1}, {Pin: 2, Mode: "output"}, {Pin: 4}}}
+
+	c := DiffDevice(old, new)
+	if len(c.Added) != 1 || c.Added[0].Pin != 4 {
+		t.Error("unexpected added pins", c.Added)
+	}
+	if len(c.Modified) != 1 || c.Modified[0].Pin != 2 {
+		t.Error("unexpected modified pins", c.Modified)
+	}
+	if len(c.Removed) != 1 || c.Removed[0].Pin != 3 {
+		t.Error("unexpected removed pins", c.Removed)
+	}
+	if !DiffDevice(old, old).Empty() {
+		t.Error("expected no changes")
+	}
+}
+
+// Registers written by a device, in order
+func writtenRegisters(file *iopi.FakeFile) []byte {
+	var regs []byte
+	for _, c := range file.CallHistory {
+		if c.Fn == "Write" && len(c.Arg) == 2 {
+			regs = append(regs, c.Arg[0])
+		}
+	}
+	return regs
+}
+
+func TestReload(t *testing.T) {
+	t.Run("leaves unchanged pins alone", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		cfg := Device{Address: 0x20, Pins: []Pin{{Pin: 1, Mode: "output", State: "high"}}}
+
+		if err := Reload(dev, cfg, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if len(file.CallHistory) != 0 {
+			t.Error("unexpected bus traffic", file.CallHistory)
+		}
+	})
+
+	t.Run("ignores name and debounce changes", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		old := Device{Pins: []Pin{{Pin: 9, Name: "a"}}}
+		new := Device{Pins: []Pin{{Pin: 9, Name: "b", Debounce: 5}}}
+
+		Reload(dev, old, new)
+		if len(file.CallHistory) != 0 {
+			t.Error("unexpected bus traffic", file.CallHistory)
+		}
+	})
+
+	t.Run("does not reset running outputs", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		old := Device{Pins: []Pin{{Pin: 1, Mode: "output", State: "low"}}}
+		new := Device{Pins: []Pin{{Pin: 1, Mode: "output", State: "low", Pullup: true}}}
+
+		Reload(dev, old, new)
+		for _, reg := range writtenRegisters(file) {
+			if reg == byte(iopi.GPIOA) {
+				t.Error("output state rewritten")
+			}
+		}
+	})
+
+	t.Run("applies active-low changes", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+		old := Device{Pins: []Pin{{Pin: 3, Mode: "output"}}}
+		new := Device{Pins: []Pin{{Pin: 3, Mode: "output", ActiveLow: true}}}
+
+		if err := Reload(dev, old, new); err != nil {
+			t.Fatal(err)
+		}
+		if low, _ := dev.IsActiveLow(3); !low {
+			t.Error("active-low not applied")
+		}
+	})
+
+	t.Run("clears active-low of removed pins", func(t *testing.T) {
+		dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+		old := Device{Address: 0x20, Pins: []Pin{{Pin: 3, Mode: "output", ActiveLow: true}}}
+		if err := ApplyConfig(dev, old); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Reload(dev, old, Device{}); err != nil {
+			t.Fatal(err)
+		}
+		if low, _ := dev.IsActiveLow(3); low {
+			t.Error("active-low not cleared")
+		}
+	})
+
+	t.Run("configures new pins and releases removed pins", func(t *testing.T) {
+		file := iopi.NewFakeFile()
+		dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+		old := Device{Pins: []Pin{{Pin: 1, Mode: "output"}}}
+		new := Device{Pins: []Pin{{Pin: 9, Mode: "output", State: "high"}}}
+
+		if err := Reload(dev, old, new); err != nil {
+			t.Fatal(err)
+		}
+
+		regs := writtenRegisters(file)
+		want := []byte{byte(iopi.IODIRA), byte(iopi.GPPUA), byte(iopi.IPOLA), byte(iopi.GPIOB), byte(iopi.GPPUB), byte(iopi.IPOLB), byte(iopi.IODIRB)}
+		if string(regs) != string(want) {
+			t.Errorf("unexpected writes: %x", regs)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLS settings of a network connection, naming PEM files:
+//
+//	tls:
+//	  cert: /etc/iopi/server.pem
+//	  key: /etc/iopi/server-key.pem
+//	  ca: /etc/iopi/clients.pem   # require client certificates (mTLS)
+//
+// On a server, CA verifies client certificates, which are then required.
+// On a client, CA verifies the server instead of the system roots, and
+// the certificate is presented to servers requiring one.
+type TLS struct {
+	Cert string `yaml:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty"`
+	CA   string `yaml:"ca,omitempty"`
+}
+
+// Environment variables giving the TLS settings of clients, e.g. of the
+// iopi command opening remote buses: IOPI_TLS_CERT, IOPI_TLS_KEY and
+// IOPI_TLS_CA.
+func TLSFromEnv(lookup func(string) (string, bool)) TLS {
+	var t TLS
+	t.Cert, _ = lookup(EnvPrefix + "TLS_CERT")
+	t.Key, _ = lookup(EnvPrefix + "TLS_KEY")
+	t.CA, _ = lookup(EnvPrefix + "TLS_CA")
+	return t
+}
+
+// Return true if any setting is given.
+func (t TLS) Enabled() bool {
+	return t != TLS{}
+}
+
+// Return the configuration of a server. A certificate is required.
+func (t TLS) ServerConfig() (*tls.Config, error) {
+	if t.Cert == "" || t.Key == "" {
+		return nil, fmt.Errorf("tls server requires a cert and a key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if t.CA != "" {
+		pool, err := loadPool(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Return the configuration of a client.
+func (t TLS) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CA != "" {
+		pool, err := loadPool(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// Read the certificates of a PEM file into a pool.
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tls ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in tls ca: %s", path)
+	}
+	return pool, nil
+}
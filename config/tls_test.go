@@ -0,0 +1,93 @@
+package config
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestTLS(t *testing.T) {
+	certs, err := iopitest.WriteCertificates(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Complete a handshake between a server and a client
+	handshake := func(server, client TLS) error {
+		scfg, err := server.ServerConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ccfg, err := client.ClientConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ccfg.ServerName = "localhost"
+
+		l, err := tls.Listen("tcp", "127.0.0.1:0", scfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		errc := make(chan error, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err == nil {
+				err = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+			errc <- err
+		}()
+
+		conn, err := tls.Dial("tcp", l.Addr().String(), ccfg)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// A rejected client certificate is only reported by the server
+		return <-errc
+	}
+
+	server := TLS{Cert: certs.ServerCert, Key: certs.ServerKey}
+	mutual := TLS{Cert: certs.ServerCert, Key: certs.ServerKey, CA: certs.CA}
+
+	t.Run("verifies the server", func(t *testing.T) {
+		if err := handshake(server, TLS{CA: certs.CA}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("requires client certificates with a ca", func(t *testing.T) {
+		if err := handshake(mutual, TLS{CA: certs.CA}); err == nil {
+			t.Error("expected error without a client certificate")
+		}
+		client := TLS{Cert: certs.ClientCert, Key: certs.ClientKey, CA: certs.CA}
+		if err := handshake(mutual, client); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rejects incomplete settings", func(t *testing.T) {
+		if _, err := (TLS{CA: certs.CA}).ServerConfig(); err == nil {
+			t.Error("expected error for server without a certificate")
+		}
+		if _, err := (TLS{Cert: certs.ClientCert}).ClientConfig(); err == nil {
+			t.Error("expected error for certificate without a key")
+		}
+		if _, err := (TLS{CA: certs.ServerKey}).ClientConfig(); err == nil {
+			t.Error("expected error for ca without certificates")
+		}
+	})
+
+	t.Run("reads the environment", func(t *testing.T) {
+		env := map[string]string{"IOPI_TLS_CA": "ca.pem"}
+		tc := TLSFromEnv(func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		})
+		if tc != (TLS{CA: "ca.pem"}) || !tc.Enabled() || (TLS{}).Enabled() {
+			t.Error("unexpected settings", tc)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package iopi
+
+import (
+	"fmt"
+
+	"github.com/stigok/go-io-pi/chip/mcp23017"
+)
+
+// Number of registers on the chip
+const RegisterCount = mcp23017.RegisterCount
+
+// Return the name of a register, or its address in hex if unknown.
+func RegisterName(reg byte) string {
+	return mcp23017.RegisterName(reg)
+}
+
+// The value of a register at a point in time.
+type RegisterValue struct {
+	Address Register `json:"address"`
+	Name    string   `json:"name"`
+	Value   byte     `json:"value"`
+}
+
+func (r RegisterValue) String() string {
+	return fmt.Sprintf("0x%02X %-8s 0x%02X 0b%08b", byte(r.Address), r.Name, r.Value, r.Value)
+}
+
+// Read all registers of the device. Reading INTCAP clears pending
+// interrupts.
+func (dev *Device) DumpRegisters() ([]RegisterValue, error) {
+	regs := make([]RegisterValue, RegisterCount)
+	for i := range regs {
+		val, err := dev.ReadByteData(Register(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read register %s: %w", Register(i), err)
+		}
+		regs[i] = RegisterValue{Register(i), Register(i).String(), val}
+	}
+	return regs, nil
+}
@@ -0,0 +1,42 @@
+package iopi
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRegisterName(t *testing.T) {
+	if RegisterName(byte(GPIOB)) != "GPIOB" {
+		t.Error("unexpected name", RegisterName(byte(GPIOB)))
+	}
+	if RegisterName(0x0B) != "IOCON" {
+		t.Error("IOCON mirror not named")
+	}
+	if s := fmt.Sprintf("%T %v", GPIOB, GPIOB); s != "mcp23017.Register GPIOB" {
+		t.Error("register constants not typed:", s)
+	}
+	if RegisterName(0x42) != "0x42" {
+		t.Error("unexpected name for unknown register", RegisterName(0x42))
+	}
+}
+
+func TestDumpRegisters(t *testing.T) {
+	dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+	regs, err := dev.DumpRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(regs) != 22 {
+		t.Fatal("expected 22 registers, got", len(regs))
+	}
+	// The fake reads back the register address
+	last := regs[21]
+	if last.Name != "OLATB" || last.Value != byte(OLATB) {
+		t.Error("unexpected register", last)
+	}
+	if last.String() != "0x15 OLATB    0x15 0b00010101" {
+		t.Errorf("unexpected format: %q", last.String())
+	}
+}
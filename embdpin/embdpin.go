@@ -0,0 +1,51 @@
+//go:build embd
+// +build embd
+
+// Package embdpin adapts expander pins to the DigitalPin interface of
+// github.com/kidoman/embd, so code written against embd can drive them
+// unchanged.
+//
+// The package is built with the embd build tag only, so the rest of the
+// module does not depend on embd:
+//
+//	go get github.com/kidoman/embd
+//	go build -tags embd
+package embdpin
+
+import (
+	"fmt"
+
+	"github.com/kidoman/embd"
+	iopi "github.com/stigok/go-io-pi"
+)
+
+var _ embd.DigitalPin = (*Pin)(nil)
+
+// Pin is an embd.DigitalPin backed by a pin of a device.
+type Pin struct {
+	*iopi.Pin
+}
+
+// Return an embd.DigitalPin for pin 1-16 on the device.
+func New(dev *iopi.Device, n uint8) *Pin {
+	return &Pin{dev.Pin(n)}
+}
+
+// Set the pin to embd.In or embd.Out.
+func (p *Pin) SetDirection(dir embd.Direction) error {
+	switch dir {
+	case embd.In:
+		return p.Pin.SetDirection(iopi.Input)
+	case embd.Out:
+		return p.Pin.SetDirection(iopi.Output)
+	}
+	return fmt.Errorf("invalid direction: %v", dir)
+}
+
+// Call `handler` on every matching transition of the pin, see
+// iopi.Pin.Watch.
+func (p *Pin) Watch(edge embd.Edge, handler func(embd.DigitalPin)) error {
+	return p.Pin.Watch(iopi.Edge(edge), func(*iopi.Pin) {
+		handler(p)
+	})
+}
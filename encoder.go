@@ -0,0 +1,132 @@
+package iopi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Encoder counts the position of a quadrature encoder on two input pins by
+// polling them, suited to slow positioning axes and control knobs. Each
+// step of the Gray code counts, so a position is four times the number of
+// cycles of the encoder.
+//
+// The position is a 64-bit counter, which cannot overflow at the rates the
+// bus can be polled. Transitions where both pins changed between two
+// samples are counted as missed, as the direction is unknown; the position
+// is then off by two steps.
+type Encoder struct {
+	Interval time.Duration
+	Clock    Clock
+
+	pins     *PinGroup // A, B
+	mutex    sync.Mutex
+	last     uint // last Gray code, index into encoderSteps
+	ready    bool // true after the first sample
+	position int64
+	stats    EncoderStats
+}
+
+// Counts of the transitions seen by an encoder.
+type EncoderStats struct {
+	Forward uint64 // steps with A leading B
+	Reverse uint64 // steps with B leading A
+	Missed  uint64 // transitions skipping a step
+}
+
+// Index of each state of the pins (bit 0 is A) in the forward cycle
+// 00 -> 01 -> 11 -> 10.
+var encoderSteps = [4]int{0, 1, 3, 2}
+
+// Create an encoder on pins `a` and `b`, polled every millisecond by Run.
+// Pins must be set to input beforehand. Reads are fastest with both pins
+// on the same port.
+func NewEncoder(dev *Device, a, b uint8) *Encoder {
+	return &Encoder{
+		Interval: time.Millisecond,
+		pins:     NewPinGroup(dev, a, b),
+	}
+}
+
+// Sample the pins every `Interval` until the context is cancelled.
+// Returns the first read error, or nil when cancelled.
+func (e *Encoder) Run(ctx context.Context) error {
+	clock := ClockOr(e.Clock)
+
+	for {
+		if err := e.Sample(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(e.Interval):
+		}
+	}
+}
+
+// Read the pins once and count the transition since the last sample. The
+// first call only records the initial state.
+func (e *Encoder) Sample() error {
+	state, err := e.pins.ReadValue()
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.ready {
+		e.last, e.ready = state, true
+		return nil
+	}
+
+	switch (encoderSteps[state] - encoderSteps[e.last] + 4) % 4 {
+	case 1:
+		e.position++
+		e.stats.Forward++
+	case 3:
+		e.position--
+		e.stats.Reverse++
+	case 2:
+		e.stats.Missed++
+	}
+	e.last = state
+	return nil
+}
+
+// Return the position in steps.
+func (e *Encoder) Position() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.position
+}
+
+// Set the position, e.g. when the axis hits a home switch.
+func (e *Encoder) SetPosition(position int64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.position = position
+}
+
+// Return the position and set it to 0 in one operation, so no steps are
+// lost between reading and zeroing.
+func (e *Encoder) ReadAndZero() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	position := e.position
+	e.position = 0
+	return position
+}
+
+// Return the counts of transitions seen.
+func (e *Encoder) Stats() EncoderStats {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.stats
+}
@@ -0,0 +1,62 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	// Sample a sequence of A/B states on pins 1 and 2
+	feed := func(e *Encoder, file *FakeFile, states ...byte) {
+		t.Helper()
+		for _, s := range states {
+			file.NextRead = []byte{s}
+			if err := e.Sample(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("counts steps in both directions", func(t *testing.T) {
+		file := NewFakeFile()
+		e := NewEncoder(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2)
+
+		feed(e, file, 0, 1, 3, 2, 0, 1, 1, 3)
+		if e.Position() != 6 {
+			t.Error("unexpected position", e.Position())
+		}
+		feed(e, file, 1, 0, 2)
+		if e.Position() != 3 {
+			t.Error("unexpected position", e.Position())
+		}
+
+		stats := e.Stats()
+		if stats != (EncoderStats{Forward: 6, Reverse: 3}) {
+			t.Error("unexpected stats", stats)
+		}
+	})
+
+	t.Run("detects missed transitions", func(t *testing.T) {
+		file := NewFakeFile()
+		e := NewEncoder(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2)
+
+		feed(e, file, 0, 3, 0, 1)
+		if e.Position() != 1 || e.Stats().Missed != 2 {
+			t.Error("unexpected position or stats", e.Position(), e.Stats())
+		}
+	})
+
+	t.Run("reads and zeroes", func(t *testing.T) {
+		file := NewFakeFile()
+		e := NewEncoder(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2)
+
+		e.SetPosition(1 << 40)
+		feed(e, file, 0, 2, 3)
+		if n := e.ReadAndZero(); n != 1<<40-2 {
+			t.Error("unexpected position", n)
+		}
+		if e.Position() != 0 {
+			t.Error("position not zeroed", e.Position())
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package iopi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse a state: high, on or 1, or low, off or 0, in any case.
+func ParseState(s string) (State, error) {
+	switch strings.ToLower(s) {
+	case "high", "on", "1":
+		return High, nil
+	case "low", "off", "0":
+		return Low, nil
+	default:
+		return 0, fmt.Errorf("invalid state: %s", s)
+	}
+}
+
+// Parse a mode: input or in, output or out, in any case, or a number
+// giving the mode of each pin of a port, e.g. 0x0F.
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "input", "in":
+		return Input, nil
+	case "output", "out":
+		return Output, nil
+	}
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode: %s", s)
+	}
+	return Mode(n), nil
+}
+
+// Parse a polarity: normal or inverted, in any case, or a number giving
+// the polarity of each pin of a port.
+func ParsePolarity(s string) (Polarity, error) {
+	switch strings.ToLower(s) {
+	case "normal":
+		return PolarityNormal, nil
+	case "inverted":
+		return PolarityInverted, nil
+	}
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid polarity: %s", s)
+	}
+	return Polarity(n), nil
+}
+
+// Parse a port: A or B, optionally prefixed with port, in any case.
+func ParsePort(s string) (Port, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "port") {
+	case "a":
+		return PortA, nil
+	case "b":
+		return PortB, nil
+	default:
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+}
+
+// Marshal as "high" or "low".
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(s.String())), nil
+}
+
+func (s *State) UnmarshalText(text []byte) error {
+	state, err := ParseState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// Marshal as "input" or "output", or the mode of each pin in hex if the
+// port is mixed, e.g. "0x0f".
+func (m Mode) MarshalText() ([]byte, error) {
+	switch m {
+	case Input, Output:
+		return []byte(strings.ToLower(m.String())), nil
+	default:
+		return []byte(fmt.Sprintf("0x%02x", byte(m))), nil
+	}
+}
+
+func (m *Mode) UnmarshalText(text []byte) error {
+	mode, err := ParseMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// Marshal as "normal" or "inverted", or the polarity of each pin in hex if
+// the port is mixed.
+func (p Polarity) MarshalText() ([]byte, error) {
+	switch p {
+	case PolarityNormal, PolarityInverted:
+		return []byte(strings.ToLower(p.String())), nil
+	default:
+		return []byte(fmt.Sprintf("0x%02x", byte(p))), nil
+	}
+}
+
+func (p *Polarity) UnmarshalText(text []byte) error {
+	pol, err := ParsePolarity(string(text))
+	if err != nil {
+		return err
+	}
+	*p = pol
+	return nil
+}
+
+// Marshal as "A" or "B".
+func (p Port) MarshalText() ([]byte, error) {
+	if p != PortA && p != PortB {
+		return nil, fmt.Errorf("invalid port: %d", uint8(p))
+	}
+	return []byte(strings.TrimPrefix(p.String(), "Port")), nil
+}
+
+func (p *Port) UnmarshalText(text []byte) error {
+	port, err := ParsePort(string(text))
+	if err != nil {
+		return err
+	}
+	*p = port
+	return nil
+}
+
+// The JSON forms are the text forms as strings. Numbers are accepted when
+// unmarshalling too, as written before the types had text forms.
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(s)
+}
+
+// Numbers, as written before states were marshalled by name, are High
+// unless 0.
+func (s *State) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, s, func(n uint8) error {
+		*s = StateOf(n != 0)
+		return nil
+	})
+}
+
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(m)
+}
+
+func (m *Mode) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, m, func(n uint8) error {
+		*m = Mode(n)
+		return nil
+	})
+}
+
+func (p Polarity) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(p)
+}
+
+func (p *Polarity) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, p, func(n uint8) error {
+		*p = Polarity(n)
+		return nil
+	})
+}
+
+func (p Port) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(p)
+}
+
+// Numbers are 0 for PortA and 1 for PortB.
+func (p *Port) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, p, func(n uint8) error {
+		if Port(n) != PortA && Port(n) != PortB {
+			return fmt.Errorf("invalid port: %d", n)
+		}
+		*p = Port(n)
+		return nil
+	})
+}
+
+func marshalJSONText(v interface{ MarshalText() ([]byte, error) }) ([]byte, error) {
+	text, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// Unmarshal a JSON string with the text form of `v`, or a number passed
+// to `set`.
+func unmarshalJSONText(data []byte, v interface{ UnmarshalText([]byte) error }, set func(n uint8) error) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return v.UnmarshalText([]byte(s))
+	}
+
+	var n uint8
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid value: %s", data)
+	}
+	return set(n)
+}
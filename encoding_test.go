@@ -0,0 +1,128 @@
+package iopi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("states", func(t *testing.T) {
+		for s, expected := range map[string]State{"high": High, "ON": High, "1": High, "Low": Low, "off": Low, "0": Low} {
+			if state, err := ParseState(s); err != nil || state != expected {
+				t.Errorf("%s: expected %s, got %s, %v", s, expected, state, err)
+			}
+		}
+		if _, err := ParseState("2"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("modes", func(t *testing.T) {
+		for s, expected := range map[string]Mode{"input": Input, "IN": Input, "output": Output, "out": Output, "0x0f": 0x0F, "255": Input} {
+			if mode, err := ParseMode(s); err != nil || mode != expected {
+				t.Errorf("%s: expected %s, got %s, %v", s, expected, mode, err)
+			}
+		}
+		if _, err := ParseMode("sideways"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("polarities", func(t *testing.T) {
+		for s, expected := range map[string]Polarity{"normal": PolarityNormal, "Inverted": PolarityInverted, "0x01": 0x01} {
+			if pol, err := ParsePolarity(s); err != nil || pol != expected {
+				t.Errorf("%s: expected %s, got %s, %v", s, expected, pol, err)
+			}
+		}
+		if _, err := ParsePolarity("0x100"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("ports", func(t *testing.T) {
+		for s, expected := range map[string]Port{"A": PortA, "b": PortB, "PortA": PortA, "portb": PortB} {
+			if port, err := ParsePort(s); err != nil || port != expected {
+				t.Errorf("%s: expected %s, got %s, %v", s, expected, port, err)
+			}
+		}
+		if _, err := ParsePort("C"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestMarshalJSON(t *testing.T) {
+	type all struct {
+		State    State    `json:"state"`
+		Mode     Mode     `json:"mode"`
+		Polarity Polarity `json:"polarity"`
+		Port     Port     `json:"port"`
+	}
+
+	t.Run("marshals names", func(t *testing.T) {
+		data, err := json.Marshal(all{High, Output, PolarityInverted, PortB})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"state":"high","mode":"output","polarity":"inverted","port":"B"}`
+		if string(data) != expected {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+
+		data, _ = json.Marshal(all{State(1), Mode(0x0F), Polarity(0xF0), PortA})
+		expected = `{"state":"high","mode":"0x0f","polarity":"0xf0","port":"A"}`
+		if string(data) != expected {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+
+		if _, err := json.Marshal(Port(2)); err == nil {
+			t.Error("expected error for invalid port")
+		}
+	})
+
+	t.Run("round trips", func(t *testing.T) {
+		for _, v := range []all{
+			{High, Input, PolarityNormal, PortA},
+			{Low, Mode(0x0F), Polarity(0x80), PortB},
+		} {
+			data, _ := json.Marshal(v)
+			var got all
+			if err := json.Unmarshal(data, &got); err != nil || !reflect.DeepEqual(got, v) {
+				t.Errorf("expected %v, got %v, %v", v, got, err)
+			}
+		}
+	})
+
+	t.Run("accepts numbers", func(t *testing.T) {
+		var got all
+		if err := json.Unmarshal([]byte(`{"state":1,"mode":255,"polarity":0,"port":1}`), &got); err != nil {
+			t.Fatal(err)
+		}
+		if expected := (all{High, Input, PolarityNormal, PortB}); got != expected {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("rejects invalid values", func(t *testing.T) {
+		for _, data := range []string{`{"state":"maybe"}`, `{"mode":true}`, `{"port":"C"}`, `{"port":5}`, `{"state":256}`} {
+			var got all
+			if err := json.Unmarshal([]byte(data), &got); err == nil {
+				t.Error("expected error for", data)
+			}
+		}
+	})
+}
+
+func TestMarshalText(t *testing.T) {
+	// Text forms are used for map keys and by encoders like YAML
+	data, err := json.Marshal(map[Port]State{PortA: Low, PortB: High})
+	if err != nil || string(data) != `{"A":"low","B":"high"}` {
+		t.Error("unexpected map", string(data), err)
+	}
+
+	var state State
+	if err := state.UnmarshalText([]byte("HIGH")); err != nil || state != High {
+		t.Error("unexpected state", state, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
@@ -28,18 +29,11 @@ func main() {
 	dev.SetPortMode(iopi.PortA, iopi.Output)
 	dev.SetPortMode(iopi.PortB, iopi.Output)
 
-	pins := []uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
-
-	fmt.Println("Enabling pins:", pins)
-	for _, p := range pins {
-		dev.WritePin(p, iopi.High)
-		time.Sleep(100 * time.Millisecond)
-	}
-
-	fmt.Println("Disabling pins:", pins)
-	for _, p := range pins {
-		dev.WritePin(p, iopi.Low)
-		time.Sleep(100 * time.Millisecond)
+	// Enable pins 1-16 one by one, then disable them one by one
+	fmt.Println("Animating pins 1-16")
+	animator := iopi.NewAnimator(dev)
+	if err := animator.Play(context.Background(), iopi.Fill(16, 100*time.Millisecond)); err != nil {
+		panic(err)
 	}
 
 	fmt.Println("Exiting!")
@@ -0,0 +1,90 @@
+package iopi
+
+import (
+	"fmt"
+	"time"
+)
+
+// The result of a frequency measurement.
+type Frequency struct {
+	Hz    float64
+	Error float64 // estimated error of Hz, ±
+	Edges int     // rising edges seen
+	// Reads of the pin per second. Signals faster than half of this are
+	// aliased and reported too low.
+	SampleRate float64
+}
+
+func (f Frequency) String() string {
+	return fmt.Sprintf("%.3f ±%.3f Hz", f.Hz, f.Error)
+}
+
+// Measure the frequency of an input pin, e.g. a fan tachometer, by reading
+// it as fast as the bus allows for `window` and counting rising edges.
+//
+// With two or more edges the frequency is taken from the time between the
+// first and the last edge, and the error from the largest gap between
+// reads, as each edge may have happened anywhere within one. Otherwise it
+// is the number of edges in the window, ± one edge.
+func (dev *Device) MeasureFrequency(pin uint8, window time.Duration) (Frequency, error) {
+	var f Frequency
+	if pin < 1 || pin > 16 {
+		return f, fmt.Errorf("invalid pin: %d", pin)
+	}
+	if window <= 0 {
+		return f, fmt.Errorf("invalid window: %s", window)
+	}
+
+	var (
+		first, last time.Time
+		maxGap      time.Duration
+		samples     int
+	)
+
+	clock := ClockOr(dev.Clock)
+	start := clock.Now()
+	prev, err := dev.ReadPin(pin)
+	if err != nil {
+		return f, fmt.Errorf("failed to measure frequency: %w", err)
+	}
+	prevTime := start
+
+	for {
+		state, err := dev.ReadPin(pin)
+		if err != nil {
+			return f, fmt.Errorf("failed to measure frequency: %w", err)
+		}
+		now := clock.Now()
+		samples++
+
+		if gap := now.Sub(prevTime); gap > maxGap {
+			maxGap = gap
+		}
+		if prev == Low && state != Low {
+			if f.Edges == 0 {
+				first = now
+			}
+			last = now
+			f.Edges++
+		}
+		prev, prevTime = state, now
+
+		if now.Sub(start) >= window {
+			break
+		}
+	}
+
+	elapsed := clock.Now().Sub(start).Seconds()
+	f.SampleRate = float64(samples) / elapsed
+
+	if f.Edges < 2 {
+		f.Hz = float64(f.Edges) / elapsed
+		f.Error = 1 / elapsed
+		return f, nil
+	}
+
+	span := last.Sub(first)
+	f.Hz = float64(f.Edges-1) / span.Seconds()
+	f.Error = f.Hz * (2 * maxGap).Seconds() / span.Seconds()
+	return f, nil
+}
@@ -0,0 +1,83 @@
+package iopi
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// A fake file reading a square wave on pin 1, starting high. Every read
+// takes a millisecond on the clock.
+type signalFile struct {
+	*FakeFile
+	clock  *iopitest.FakeClock
+	start  time.Time
+	period time.Duration
+}
+
+func newSignalFile(period time.Duration) *signalFile {
+	clock := iopitest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	return &signalFile{NewFakeFile(), clock, clock.Now(), period}
+}
+
+func (f *signalFile) Read(b []byte) (int, error) {
+	f.clock.Advance(time.Millisecond)
+	b[0] = 0
+	if f.clock.Now().Sub(f.start)%f.period < f.period/2 {
+		b[0] = 1
+	}
+	return 1, nil
+}
+
+func (f *signalFile) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func TestMeasureFrequency(t *testing.T) {
+	t.Run("measures a square wave", func(t *testing.T) {
+		file := newSignalFile(10 * time.Millisecond)
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		dev.Clock = file.clock
+
+		f, err := dev.MeasureFrequency(1, 100*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Edges != 10 {
+			t.Error("unexpected number of edges", f.Edges)
+		}
+		if math.Abs(f.Hz-100) > 1e-9 || math.Abs(f.Error-100*0.004/0.09) > 1e-9 {
+			t.Error("unexpected frequency", f)
+		}
+		if math.Abs(f.SampleRate-990) > 1e-9 {
+			t.Error("unexpected sample rate", f.SampleRate)
+		}
+	})
+
+	t.Run("reports a steady pin as 0 Hz", func(t *testing.T) {
+		file := newSignalFile(time.Hour)
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		dev.Clock = file.clock
+
+		f, err := dev.MeasureFrequency(1, 10*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Hz != 0 || f.Edges != 0 || math.Abs(f.Error-100) > 1e-9 {
+			t.Error("unexpected measurement", f)
+		}
+	})
+
+	t.Run("rejects invalid arguments", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if _, err := dev.MeasureFrequency(0, time.Second); err == nil {
+			t.Error("expected error for invalid pin")
+		}
+		if _, err := dev.MeasureFrequency(1, 0); err == nil {
+			t.Error("expected error for invalid window")
+		}
+	})
+}
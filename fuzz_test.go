@@ -0,0 +1,99 @@
+//go:build go1.18
+// +build go1.18
+
+package iopi
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// Run a target with e.g. go test -fuzz=FuzzSetBit. Without -fuzz, the
+// seeds run as regular tests. Fuzzing needs Go 1.18, so older toolchains
+// leave this file out rather than requiring it in go.mod.
+
+func FuzzSetBit(f *testing.F) {
+	f.Add(byte(0x00), uint8(0), 1)
+	f.Add(byte(0xFF), uint8(7), 0)
+	f.Add(byte(0xA5), uint8(8), 1)
+
+	f.Fuzz(func(t *testing.T, byt byte, bit uint8, value int) {
+		got := SetBit(byt, bit, value)
+
+		if bit > 7 {
+			// Out of range bits are shifted out of the byte
+			if got != byt || GetBit(byt, bit) != 0 {
+				t.Fatalf("bit %d changed 0x%02x to 0x%02x", bit, byt, got)
+			}
+			return
+		}
+
+		want := uint8(0)
+		if value != 0 {
+			want = 1
+		}
+		if GetBit(got, bit) != want {
+			t.Fatalf("SetBit(0x%02x, %d, %d) = 0x%02x", byt, bit, value, got)
+		}
+		if (got^byt)&^(1<<bit) != 0 {
+			t.Fatalf("SetBit(0x%02x, %d, %d) changed other bits: 0x%02x", byt, bit, value, got)
+		}
+	})
+}
+
+func FuzzGetPinPort(f *testing.F) {
+	for _, pin := range []uint8{1, 8, 9, 16} {
+		f.Add(pin)
+	}
+
+	f.Fuzz(func(t *testing.T, pin uint8) {
+		if pin < 1 || pin > 16 {
+			return
+		}
+		bit, port := GetPinPort(pin)
+		if bit > 7 || (port != PortA && port != PortB) {
+			t.Fatalf("pin %d translated to bit %d of port %d", pin, bit, port)
+		}
+		if (port == PortB) != (pin > 8) {
+			t.Fatalf("pin %d on wrong port %d", pin, port)
+		}
+		if n := pinNumber(port, bit); n != pin {
+			t.Fatalf("pin %d translated back to %d", pin, n)
+		}
+	})
+}
+
+func FuzzPinGroupPack(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4}, uint(0x0F))
+	f.Add([]byte{16, 1, 9, 8}, uint(0x05))
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, ^uint(0))
+
+	f.Fuzz(func(t *testing.T, pins []byte, v uint) {
+		g := NewPinGroup(nil, pins...)
+		if g.validate() != nil {
+			return
+		}
+
+		value, mask := g.pack(v)
+		if n := bits.OnesCount8(mask[0]) + bits.OnesCount8(mask[1]); n != len(pins) {
+			t.Fatalf("mask 0x%02x 0x%02x has %d pins, want %d", mask[0], mask[1], n, len(pins))
+		}
+		for port := range value {
+			if value[port]&^mask[port] != 0 {
+				t.Fatalf("value 0x%02x outside mask 0x%02x", value[port], mask[port])
+			}
+		}
+
+		// Unpack as ReadValue does
+		var got uint
+		for i, pin := range pins {
+			bit, port := GetPinPort(pin)
+			if GetBit(value[port], bit) == 1 {
+				got |= 1 << i
+			}
+		}
+		if want := v & (1<<len(pins) - 1); got != want {
+			t.Fatalf("packed 0x%x into %v, unpacked 0x%x", want, pins, got)
+		}
+	})
+}
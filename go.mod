@@ -1,5 +1,8 @@
 module github.com/stigok/go-io-pi
 
-go 1.14
+go 1.16
 
-require golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a
+require (
+	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a
+	gopkg.in/yaml.v3 v3.0.1
+)
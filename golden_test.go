@@ -0,0 +1,140 @@
+package iopi
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Rewrite the golden files with the transactions of the code under test:
+//
+//	go test -run Golden -update
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// Compare the transactions recorded by `trace` against the golden file
+// testdata/golden/<name>.txt, or rewrite it with -update.
+func checkGolden(t *testing.T, name string, trace *iopitest.Trace) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".txt")
+	got := trace.String()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -update to create it: %s", err)
+	}
+	if want := string(data); got != want {
+		t.Errorf("transactions differ from %s, run with -update if intended:\n%s",
+			path, diffLines(strings.Split(want, "\n"), strings.Split(got, "\n")))
+	}
+}
+
+// Return a line by line comparison of `want` and `got`, marking lines only
+// in want with - and lines only in got with +.
+func diffLines(want, got []string) string {
+	// Longest common subsequence, small enough for golden files
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			b.WriteString("  " + want[i] + "\n")
+			i, j = i+1, j+1
+		case j < len(got) && (i == len(want) || lcs[i][j+1] >= lcs[i+1][j]):
+			b.WriteString("+ " + got[j] + "\n")
+			j++
+		default:
+			b.WriteString("- " + want[i] + "\n")
+			i++
+		}
+	}
+	return b.String()
+}
+
+// Scenarios whose bus traffic is pinned by golden files. Changing the
+// transactions of any of them, e.g. adding a read or reordering writes,
+// fails the test until the golden file is updated and reviewed.
+var goldenScenarios = []struct {
+	name string
+	run  func(dev *Device) error
+}{
+	{"init", func(dev *Device) error {
+		return dev.Init()
+	}},
+	{"init_layout", func(dev *Device) error {
+		return dev.InitLayout(Layout{State: [2]byte{0x01, 0}, Outputs: [2]byte{0x03, 0x01}, Pullup: [2]byte{0, 0x80}})
+	}},
+	{"write_pin", func(dev *Device) error {
+		if err := dev.SetPinMode(1, Output); err != nil {
+			return err
+		}
+		return dev.WritePin(1, High)
+	}},
+	{"read_pin", func(dev *Device) error {
+		_, err := dev.ReadPin(10)
+		return err
+	}},
+	{"write_port", func(dev *Device) error {
+		if err := dev.SetPortMode(PortB, Output); err != nil {
+			return err
+		}
+		return dev.WritePort(PortB, 0xA5)
+	}},
+	{"pin_group", func(dev *Device) error {
+		return NewPinGroup(dev, 1, 2, 9).WriteValue(0b101)
+	}},
+	{"snapshot", func(dev *Device) error {
+		_, err := dev.Snapshot()
+		return err
+	}},
+}
+
+func TestGolden(t *testing.T) {
+	for _, s := range goldenScenarios {
+		t.Run(s.name, func(t *testing.T) {
+			trace := iopitest.NewTrace(iopitest.NewChip())
+			dev := NewDevice(trace, 0x20, &sync.Mutex{})
+			if err := s.run(dev); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, s.name, trace)
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+	if expected := "  a\n- b\n  c\n+ d\n"; got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,241 @@
+// Package hd44780 drives HD44780 compatible character LCDs connected to
+// the pins of an IO Pi board, using the 4-bit protocol over six pins.
+//
+//	lcd, err := hd44780.New(dev, hd44780.Pins{RS: 1, EN: 2, D4: 3, D5: 4, D6: 5, D7: 6}, 16, 2)
+//	lcd.Print("Hello, world")
+//	lcd.SetCursor(0, 1)
+//	lcd.Print("line two")
+//
+// The R/W pin of the display must be tied to ground.
+package hd44780
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Commands, as defined in the HD44780 datasheet
+const (
+	cmdClear        = 0x01
+	cmdHome         = 0x02
+	cmdEntryMode    = 0x04
+	cmdDisplay      = 0x08
+	cmdFunctionSet  = 0x20
+	cmdSetCGRAMAddr = 0x40
+	cmdSetDDRAMAddr = 0x80
+
+	entryIncrement = 0x02
+	displayOn      = 0x04
+	cursorOn       = 0x02
+	blinkOn        = 0x01
+	twoLines       = 0x08
+)
+
+// Pins of the board connected to the display, numbered 1-16.
+type Pins struct {
+	RS, EN         uint8
+	D4, D5, D6, D7 uint8
+}
+
+func (p Pins) list() []uint8 {
+	return []uint8{p.RS, p.EN, p.D4, p.D5, p.D6, p.D7}
+}
+
+// LCD is a character display. It is safe for concurrent use.
+type LCD struct {
+	bus     *iopi.PinGroup // RS, EN and D4-D7, in that bit order
+	cols    int
+	rows    int
+	display byte // display control flags
+	mutex   sync.Mutex
+
+	sleep func(time.Duration) // replaced in tests
+}
+
+// Set the pins to output and initialise a display of `cols` by `rows`
+// characters.
+func New(dev *iopi.Device, pins Pins, cols, rows int) (*LCD, error) {
+	return newLCD(dev, pins, cols, rows, time.Sleep)
+}
+
+func newLCD(dev *iopi.Device, pins Pins, cols, rows int, sleep func(time.Duration)) (*LCD, error) {
+	if cols < 1 || rows < 1 || rows > 4 {
+		return nil, fmt.Errorf("invalid display size: %dx%d", cols, rows)
+	}
+
+	seen := make(map[uint8]bool)
+	for _, pin := range pins.list() {
+		if pin < 1 || pin > 16 || seen[pin] {
+			return nil, fmt.Errorf("invalid pins: %+v", pins)
+		}
+		seen[pin] = true
+	}
+
+	l := &LCD{
+		bus:     iopi.NewPinGroup(dev, pins.list()...),
+		cols:    cols,
+		rows:    rows,
+		display: displayOn,
+		sleep:   sleep,
+	}
+
+	for _, pin := range pins.list() {
+		if err := dev.SetPinMode(pin, iopi.Output); err != nil {
+			return nil, fmt.Errorf("failed to initialise display: %s", err)
+		}
+	}
+	if err := l.init(); err != nil {
+		return nil, fmt.Errorf("failed to initialise display: %s", err)
+	}
+	return l, nil
+}
+
+// Run the initialisation by instruction sequence from the datasheet,
+// which switches the display to 4-bit mode from any state.
+func (l *LCD) init() error {
+	l.sleep(50 * time.Millisecond)
+	for _, wait := range []time.Duration{4500 * time.Microsecond, 150 * time.Microsecond, 150 * time.Microsecond} {
+		if err := l.writeNibble(0x03, false); err != nil {
+			return err
+		}
+		l.sleep(wait)
+	}
+	if err := l.writeNibble(0x02, false); err != nil {
+		return err
+	}
+
+	function := byte(cmdFunctionSet)
+	if l.rows > 1 {
+		function |= twoLines
+	}
+	for _, cmd := range []byte{function, cmdDisplay | l.display, cmdClear, cmdEntryMode | entryIncrement} {
+		if err := l.command(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear the display and move the cursor home.
+func (l *LCD) Clear() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.command(cmdClear)
+}
+
+// Move the cursor to the first column of the first row.
+func (l *LCD) Home() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.command(cmdHome)
+}
+
+// Move the cursor to a column and row, counting from 0.
+func (l *LCD) SetCursor(col, row int) error {
+	if col < 0 || col >= l.cols || row < 0 || row >= l.rows {
+		return fmt.Errorf("invalid cursor position: %d,%d", col, row)
+	}
+
+	// Rows 3 and 4 continue rows 1 and 2 in display memory
+	offsets := []int{0x00, 0x40, l.cols, 0x40 + l.cols}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.command(cmdSetDDRAMAddr | byte(offsets[row]+col))
+}
+
+// Write text at the cursor. Characters 0-7 show custom characters, see
+// CreateChar.
+func (l *LCD) Print(s string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i := 0; i < len(s); i++ {
+		if err := l.write(s[i], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Define custom character 0-7 from rows of 5 pixels, top to bottom. The
+// cursor position is lost, so set it before printing again.
+func (l *LCD) CreateChar(slot int, bitmap [8]byte) error {
+	if slot < 0 || slot > 7 {
+		return fmt.Errorf("invalid custom character: %d", slot)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.command(cmdSetCGRAMAddr | byte(slot<<3)); err != nil {
+		return err
+	}
+	for _, row := range bitmap {
+		if err := l.write(row&0x1F, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Turn the display, the underline cursor and the blinking cursor on or off.
+func (l *LCD) SetDisplay(display, cursor, blink bool) error {
+	var flags byte
+	if display {
+		flags |= displayOn
+	}
+	if cursor {
+		flags |= cursorOn
+	}
+	if blink {
+		flags |= blinkOn
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.display = flags
+	return l.command(cmdDisplay | flags)
+}
+
+func (l *LCD) command(cmd byte) error {
+	if err := l.write(cmd, false); err != nil {
+		return err
+	}
+	if cmd == cmdClear || cmd == cmdHome {
+		l.sleep(2 * time.Millisecond)
+	}
+	return nil
+}
+
+// Write a byte as two nibbles, high nibble first.
+func (l *LCD) write(b byte, data bool) error {
+	if err := l.writeNibble(b>>4, data); err != nil {
+		return err
+	}
+	return l.writeNibble(b&0x0F, data)
+}
+
+// Bits of the pins in the bus group
+const (
+	busRS = 1 << 0
+	busEN = 1 << 1
+)
+
+// Put a nibble on D4-D7 and pulse EN. The display reads the data lines on
+// the falling edge of EN.
+func (l *LCD) writeNibble(n byte, data bool) error {
+	v := uint(n&0x0F) << 2
+	if data {
+		v |= busRS
+	}
+
+	if err := l.bus.WriteValue(v | busEN); err != nil {
+		return err
+	}
+	return l.bus.WriteValue(v)
+}
@@ -0,0 +1,153 @@
+package hd44780
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// RS and EN on pins 1 and 2, data on pins 3-6 of port A
+var testPins = Pins{RS: 1, EN: 2, D4: 3, D5: 4, D6: 5, D7: 6}
+
+type transfer struct {
+	data  bool // RS high
+	value byte
+}
+
+// Decode the nibbles latched by the display, i.e. the port A writes with
+// EN high, into bytes. The first four nibbles of the initialisation
+// sequence are sent alone and are skipped.
+func transfers(file *iopi.FakeFile) []transfer {
+	var nibbles []transfer
+	for _, c := range file.CallHistory {
+		if c.Fn != "Write" || len(c.Arg) != 2 || c.Arg[0] != byte(iopi.GPIOA) || c.Arg[1]&0x02 == 0 {
+			continue
+		}
+		nibbles = append(nibbles, transfer{c.Arg[1]&0x01 != 0, c.Arg[1] >> 2 & 0x0F})
+	}
+
+	var bytes []transfer
+	for i := 4; i+1 < len(nibbles); i += 2 {
+		bytes = append(bytes, transfer{nibbles[i].data, nibbles[i].value<<4 | nibbles[i+1].value})
+	}
+	return bytes
+}
+
+func newTestLCD(t *testing.T, cols, rows int) (*LCD, *iopi.FakeFile) {
+	file := iopi.NewFakeFile()
+	dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+	l, err := newLCD(dev, testPins, cols, rows, func(time.Duration) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, file
+}
+
+func TestInit(t *testing.T) {
+	_, file := newTestLCD(t, 16, 2)
+
+	expected := []transfer{{false, 0x28}, {false, 0x0C}, {false, 0x01}, {false, 0x06}}
+	if got := transfers(file); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected commands: %v", got)
+	}
+}
+
+func TestLCD(t *testing.T) {
+	t.Run("prints text", func(t *testing.T) {
+		l, file := newTestLCD(t, 16, 2)
+		file.CallHistory = initNibbles()
+
+		if err := l.Print("Hi"); err != nil {
+			t.Fatal(err)
+		}
+		expected := []transfer{{true, 'H'}, {true, 'i'}}
+		if got := transfers(file); !reflect.DeepEqual(got, expected) {
+			t.Errorf("unexpected data: %v", got)
+		}
+	})
+
+	t.Run("moves cursor", func(t *testing.T) {
+		l, file := newTestLCD(t, 20, 4)
+		file.CallHistory = initNibbles()
+
+		for _, pos := range [][2]int{{0, 0}, {3, 1}, {0, 2}, {19, 3}} {
+			if err := l.SetCursor(pos[0], pos[1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected := []transfer{{false, 0x80}, {false, 0xC3}, {false, 0x94}, {false, 0xE7}}
+		if got := transfers(file); !reflect.DeepEqual(got, expected) {
+			t.Errorf("unexpected commands: %v", got)
+		}
+
+		if l.SetCursor(20, 0) == nil || l.SetCursor(0, 4) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("creates custom characters", func(t *testing.T) {
+		l, file := newTestLCD(t, 16, 2)
+		file.CallHistory = initNibbles()
+
+		if err := l.CreateChar(1, [8]byte{0xFF, 0x11}); err != nil {
+			t.Fatal(err)
+		}
+		got := transfers(file)
+		if len(got) != 9 || got[0] != (transfer{false, 0x48}) || got[1] != (transfer{true, 0x1F}) || got[2] != (transfer{true, 0x11}) {
+			t.Errorf("unexpected transfers: %v", got)
+		}
+		if l.CreateChar(8, [8]byte{}) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("controls display", func(t *testing.T) {
+		l, file := newTestLCD(t, 16, 2)
+		file.CallHistory = initNibbles()
+
+		l.SetDisplay(true, true, true)
+		l.Clear()
+		if got := transfers(file); !reflect.DeepEqual(got, []transfer{{false, 0x0F}, {false, 0x01}}) {
+			t.Errorf("unexpected commands: %v", got)
+		}
+	})
+
+	t.Run("leaves other pins alone", func(t *testing.T) {
+		l, file := newTestLCD(t, 16, 2)
+		file.CallHistory = nil
+
+		file.NextRead = []byte{0xC0}
+		l.writeNibble(0x00, true)
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOA), 0xC3}) {
+			t.Error("unexpected calls", file.CallHistory)
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	dev := iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{})
+	for _, pins := range []Pins{
+		{RS: 1, EN: 1, D4: 3, D5: 4, D6: 5, D7: 6},
+		{RS: 0, EN: 2, D4: 3, D5: 4, D6: 5, D7: 6},
+	} {
+		if _, err := newLCD(dev, pins, 16, 2, func(time.Duration) {}); err == nil {
+			t.Error("expected error for", pins)
+		}
+	}
+	if _, err := newLCD(dev, testPins, 16, 5, func(time.Duration) {}); err == nil {
+		t.Error("expected error for size")
+	}
+}
+
+// Four lone nibbles, standing in for the start of the initialisation
+// sequence skipped by transfers.
+func initNibbles() []iopi.Call {
+	calls := make([]iopi.Call, 4)
+	for i := range calls {
+		calls[i] = iopi.Call{Fn: "Write", Arg: []byte{byte(iopi.GPIOA), 0x02}}
+	}
+	return calls
+}
@@ -0,0 +1,201 @@
+package iopi
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hardware-in-the-loop tests run against a real board when IOPI_HIL_BUS
+// is set to its bus, e.g.
+//
+//	IOPI_HIL_BUS=/dev/i2c-1 IOPI_HIL_ADDR=0x20 go test -run HIL
+//
+// IOPI_HIL_ADDR defaults to 0x20. The board must have a loopback harness
+// wiring each pin of port A to the same pin of port B, i.e. pin 1 to 9,
+// 2 to 10 and so on up to 8 to 16, with nothing else connected. Pins are
+// driven by the tests, so never run them on a board wired to anything.
+
+// Time for the wiring to settle after a pin changes
+const hilSettle = time.Millisecond
+
+func hilDevice(t *testing.T) *Device {
+	bus := os.Getenv("IOPI_HIL_BUS")
+	if bus == "" {
+		t.Skip("IOPI_HIL_BUS not set")
+	}
+
+	addr := uint64(0x20)
+	if s := os.Getenv("IOPI_HIL_ADDR"); s != "" {
+		var err error
+		if addr, err = strconv.ParseUint(s, 0, 7); err != nil {
+			t.Fatalf("invalid IOPI_HIL_ADDR: %s", s)
+		}
+	}
+
+	dev := &Device{Address: byte(addr), Path: bus, mutex: &sync.Mutex{}}
+	if err := dev.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dev.Init() // leave all pins as inputs
+		dev.Close()
+	})
+	return dev
+}
+
+// Drive port A and return port B after settling
+func hilLoop(t *testing.T, dev *Device, a byte) byte {
+	t.Helper()
+	if err := dev.WritePort(PortA, a); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(hilSettle)
+	b, err := dev.ReadPort(PortB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestHILInit(t *testing.T) {
+	dev := hilDevice(t)
+
+	for reg, expected := range map[Register]byte{
+		IOCON:  0x22,
+		IODIRA: 0xFF,
+		IODIRB: 0xFF,
+		GPPUA:  0x00,
+		IPOLA:  0x00,
+		OLATA:  0x00,
+	} {
+		val, err := dev.ReadByteData(reg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != expected {
+			t.Errorf("register %s: expected 0x%02x, got 0x%02x", reg, expected, val)
+		}
+	}
+
+	if name, err := dev.Identify(); err != nil || name != "MCP23017" {
+		t.Errorf("device not identified: %q, %v", name, err)
+	}
+}
+
+func TestHILPins(t *testing.T) {
+	dev := hilDevice(t)
+	if err := dev.SetPortMode(PortA, Output); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("ports", func(t *testing.T) {
+		for _, a := range []byte{0x00, 0xFF, 0xA5, 0x5A} {
+			if b := hilLoop(t, dev, a); b != a {
+				t.Errorf("wrote 0x%02x, read 0x%02x", a, b)
+			}
+		}
+	})
+
+	t.Run("pins", func(t *testing.T) {
+		hilLoop(t, dev, 0x00)
+		for pin := uint8(1); pin <= 8; pin++ {
+			if err := dev.WritePin(pin, High); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(hilSettle)
+			for in := uint8(9); in <= 16; in++ {
+				state, err := dev.ReadPin(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if high := in == pin+8; (state == 1) != high {
+					t.Errorf("pin %d high, pin %d read %d", pin, in, state)
+				}
+			}
+			dev.WritePin(pin, Low)
+		}
+	})
+
+	t.Run("polarity", func(t *testing.T) {
+		if err := dev.SetPortPolarity(PortB, PolarityInverted); err != nil {
+			t.Fatal(err)
+		}
+		defer dev.SetPortPolarity(PortB, PolarityNormal)
+
+		if b := hilLoop(t, dev, 0x0F); b != 0xF0 {
+			t.Errorf("expected inverted 0xf0, got 0x%02x", b)
+		}
+	})
+}
+
+func TestHILPullups(t *testing.T) {
+	dev := hilDevice(t)
+
+	// Both sides are inputs, so port B floats to its pull-ups
+	if err := dev.SetPortPullup(PortB, PullupEnabled); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(hilSettle)
+	if b, _ := dev.ReadPort(PortB); b != 0xFF {
+		t.Errorf("pulled up port read 0x%02x", b)
+	}
+
+	// Outputs overcome the pull-ups
+	dev.SetPortMode(PortA, Output)
+	if b := hilLoop(t, dev, 0x00); b != 0x00 {
+		t.Errorf("driven low against pull-ups, read 0x%02x", b)
+	}
+
+	// A pull-up on an input drives the input on the other side
+	dev.SetPortMode(PortA, Input)
+	dev.SetPortPullup(PortB, PullupDisabled)
+	dev.SetPinPullup(3, PullupEnabled)
+	time.Sleep(hilSettle)
+	if state, _ := dev.ReadPin(11); state != 1 {
+		t.Error("pin 11 not pulled up through pin 3")
+	}
+}
+
+func TestHILInterrupts(t *testing.T) {
+	dev := hilDevice(t)
+	dev.SetPortMode(PortA, Output)
+	hilLoop(t, dev, 0x00)
+
+	// Interrupt on change of pins 9 and 10
+	if err := dev.WriteByteData(INTCONB, 0x00); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.WriteByteData(GPINTENB, 0x03); err != nil {
+		t.Fatal(err)
+	}
+	dev.ReadByteData(INTCAPB) // clear any pending interrupt
+
+	// Reading GPIOB would clear the interrupt, so only drive port A
+	drive := func(a byte) {
+		if err := dev.WritePort(PortA, a); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(hilSettle)
+	}
+
+	drive(0x04) // pin 11 is not enabled
+	if intf, _ := dev.ReadByteData(INTFB); intf != 0 {
+		t.Errorf("unexpected interrupt flags: 0x%02x", intf)
+	}
+
+	drive(0x06)
+	if intf, _ := dev.ReadByteData(INTFB); intf != 0x02 {
+		t.Errorf("expected flag of pin 10, got 0x%02x", intf)
+	}
+	if intcap, _ := dev.ReadByteData(INTCAPB); intcap != 0x06 {
+		t.Errorf("expected capture at first interrupt 0x06, got 0x%02x", intcap)
+	}
+	if intf, _ := dev.ReadByteData(INTFB); intf != 0 {
+		t.Errorf("interrupt not cleared by reading INTCAPB: 0x%02x", intf)
+	}
+
+	dev.WriteByteData(GPINTENB, 0x00)
+}
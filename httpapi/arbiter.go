@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// How an Arbiter treats writes to pins not locked by any client
+type ArbitrationMode uint8
+
+const (
+	LastWriterWins ArbitrationMode = iota // any client may write an unlocked pin
+	RejectUnlocked                        // clients must lock a pin to write it
+)
+
+// Parse an arbitration mode: last-writer-wins or reject, in any case.
+func ParseArbitrationMode(s string) (ArbitrationMode, error) {
+	switch strings.ToLower(s) {
+	case "", "last-writer-wins":
+		return LastWriterWins, nil
+	case "reject":
+		return RejectUnlocked, nil
+	default:
+		return 0, fmt.Errorf("invalid arbitration mode: %s", s)
+	}
+}
+
+// The client holding the lock of a pin, and the client that last wrote it
+type PinOwner struct {
+	LockedBy  string    `json:"locked_by,omitempty"`
+	ChangedBy string    `json:"changed_by,omitempty"`
+	Changed   time.Time `json:"changed,omitempty"`
+}
+
+// Arbiter decides which clients may write pins when several share a
+// server. A pin locked by a client can only be written by that client,
+// until it unlocks the pin.
+type Arbiter struct {
+	Mode  ArbitrationMode
+	Clock iopi.Clock // of PinOwner.Changed, the real clock if nil
+
+	mutex sync.Mutex
+	pins  map[iopi.PinRef]*PinOwner
+}
+
+func NewArbiter(mode ArbitrationMode) *Arbiter {
+	return &Arbiter{Mode: mode, pins: make(map[iopi.PinRef]*PinOwner)}
+}
+
+// Returned when a client may not write or lock a pin
+type conflictError struct {
+	ref   iopi.PinRef
+	owner string
+}
+
+func (e conflictError) Error() string {
+	if e.owner == "" {
+		return fmt.Sprintf("pin %d of 0x%02x must be locked to be written", e.ref.Pin, e.ref.Address)
+	}
+	return fmt.Sprintf("pin %d of 0x%02x is locked by %s", e.ref.Pin, e.ref.Address, e.owner)
+}
+
+func (a *Arbiter) owner(ref iopi.PinRef) *PinOwner {
+	o, ok := a.pins[ref]
+	if !ok {
+		o = &PinOwner{}
+		a.pins[ref] = o
+	}
+	return o
+}
+
+// Lock a pin for a client. Locking a pin already held by the client
+// succeeds. Returns an error if another client holds the lock.
+func (a *Arbiter) Lock(ref iopi.PinRef, client string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	o := a.owner(ref)
+	if o.LockedBy != "" && o.LockedBy != client {
+		return conflictError{ref, o.LockedBy}
+	}
+	o.LockedBy = client
+	return nil
+}
+
+// Release the lock of a client on a pin. Returns an error if another
+// client holds the lock.
+func (a *Arbiter) Unlock(ref iopi.PinRef, client string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	o := a.owner(ref)
+	if o.LockedBy != "" && o.LockedBy != client {
+		return conflictError{ref, o.LockedBy}
+	}
+	o.LockedBy = ""
+	return nil
+}
+
+// Release all locks held by a client, e.g. when it disconnects.
+func (a *Arbiter) UnlockAll(client string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, o := range a.pins {
+		if o.LockedBy == client {
+			o.LockedBy = ""
+		}
+	}
+}
+
+// Return the owners of a pin.
+func (a *Arbiter) Owner(ref iopi.PinRef) PinOwner {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if o, ok := a.pins[ref]; ok {
+		return *o
+	}
+	return PinOwner{}
+}
+
+// Write pins for a client if it may write all of them, recording it as
+// their last writer.
+func (a *Arbiter) write(refs []iopi.PinRef, client string, write func() error) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, ref := range refs {
+		owner := a.pins[ref]
+		switch {
+		case owner != nil && owner.LockedBy != "":
+			if owner.LockedBy != client {
+				return conflictError{ref, owner.LockedBy}
+			}
+		case a.Mode == RejectUnlocked:
+			return conflictError{ref, ""}
+		}
+	}
+
+	if err := write(); err != nil {
+		return err
+	}
+
+	now := iopi.ClockOr(a.Clock).Now()
+	for _, ref := range refs {
+		o := a.owner(ref)
+		o.ChangedBy, o.Changed = client, now
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestArbiter(t *testing.T) {
+	ref := iopi.PinRef{Address: 0x20, Pin: 3}
+	ok := func() error { return nil }
+
+	t.Run("lets the last writer win", func(t *testing.T) {
+		a := NewArbiter(LastWriterWins)
+		if err := a.write([]iopi.PinRef{ref}, "alice", ok); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.write([]iopi.PinRef{ref}, "bob", ok); err != nil {
+			t.Fatal(err)
+		}
+		if o := a.Owner(ref); o.ChangedBy != "bob" || o.Changed.IsZero() {
+			t.Error("unexpected owner", o)
+		}
+	})
+
+	t.Run("records changes by the clock", func(t *testing.T) {
+		a := NewArbiter(LastWriterWins)
+		a.Clock = iopitest.NewFakeClock(time.Unix(100, 0))
+		a.write([]iopi.PinRef{ref}, "alice", ok)
+		if o := a.Owner(ref); !o.Changed.Equal(time.Unix(100, 0)) {
+			t.Error("unexpected change time", o.Changed)
+		}
+	})
+
+	t.Run("only lets the holder of a lock write", func(t *testing.T) {
+		a := NewArbiter(LastWriterWins)
+		if err := a.Lock(ref, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if a.Lock(ref, "bob") == nil || a.Unlock(ref, "bob") == nil {
+			t.Error("expected lock conflict")
+		}
+		if err := a.write([]iopi.PinRef{ref}, "bob", ok); err == nil {
+			t.Error("expected write conflict")
+		}
+		if err := a.write([]iopi.PinRef{ref}, "alice", ok); err != nil {
+			t.Error(err)
+		}
+
+		a.UnlockAll("alice")
+		if err := a.write([]iopi.PinRef{ref}, "bob", ok); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rejects writes of unlocked pins", func(t *testing.T) {
+		a := NewArbiter(RejectUnlocked)
+		if err := a.write([]iopi.PinRef{ref}, "alice", ok); err == nil {
+			t.Error("expected write conflict")
+		}
+		a.Lock(ref, "alice")
+		if err := a.write([]iopi.PinRef{ref}, "alice", ok); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("does not record failed writes", func(t *testing.T) {
+		a := NewArbiter(LastWriterWins)
+		err := a.write([]iopi.PinRef{ref}, "alice", func() error { return errors.New("bus error") })
+		if err == nil || a.Owner(ref).ChangedBy != "" {
+			t.Error("failed write recorded", err)
+		}
+	})
+
+	t.Run("parses modes", func(t *testing.T) {
+		if m, _ := ParseArbitrationMode("reject"); m != RejectUnlocked {
+			t.Error("unexpected mode", m)
+		}
+		if m, _ := ParseArbitrationMode(""); m != LastWriterWins {
+			t.Error("unexpected mode", m)
+		}
+		if _, err := ParseArbitrationMode("first-writer-wins"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestArbitratedServer(t *testing.T) {
+	request := func(s http.Handler, method, path, client, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Client", client)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	s, file := newTestServer()
+	s.SetArbiter(NewArbiter(LastWriterWins))
+
+	if rec := request(s, "PUT", "/devices/0x20/pins/3/lock", "alice", ""); rec.Code != http.StatusOK ||
+		!strings.Contains(rec.Body.String(), `"locked_by":"alice"`) {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+	if rec := request(s, "PUT", "/devices/0x20/pins/3", "bob", `{"state": "high"}`); rec.Code != http.StatusConflict {
+		t.Error("unexpected response", rec.Code, rec.Body.String())
+	}
+	if rec := request(s, "PUT", "/devices/0x20/ports/A", "bob", `{"state": 255}`); rec.Code != http.StatusConflict {
+		t.Error("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	file.NextRead = []byte{0x00}
+	rec := request(s, "PUT", "/devices/0x20/pins/3", "alice", `{"state": "high"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"changed_by":"alice"`) {
+		t.Error("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	if rec := request(s, "DELETE", "/devices/0x20/pins/3/lock", "alice", ""); rec.Code != http.StatusOK {
+		t.Error("unexpected response", rec.Code, rec.Body.String())
+	}
+	if rec := request(s, "PUT", "/devices/0x20/ports/A", "bob", `{"state": 255}`); rec.Code != http.StatusOK {
+		t.Error("unexpected response", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Credentials accepted by a server, see SetAuth. Clients authenticate
+// with a bearer token (Authorization: Bearer TOKEN, or ?token=TOKEN for
+// WebSocket clients unable to set headers) or basic auth. The name of the
+// token or user identifies the client to an Arbiter, in place of X-Client.
+type Auth struct {
+	Tokens map[string]string `yaml:"tokens" json:"tokens"` // token by client name
+	Users  map[string]string `yaml:"users" json:"users"`   // password by user name
+}
+
+// Return true if no credentials are configured.
+func (a Auth) Empty() bool {
+	return len(a.Tokens) == 0 && len(a.Users) == 0
+}
+
+// Return the name of the client authenticated by a request, or false if
+// its credentials are missing or wrong.
+func (a Auth) authenticate(r *http.Request) (string, bool) {
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	if token != "" {
+		for name, t := range a.Tokens {
+			if equal(token, t) {
+				return name, true
+			}
+		}
+		return "", false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	want, found := a.Users[user]
+	if !equal(password, want) || !found {
+		return "", false
+	}
+	return user, true
+}
+
+// Compare secrets in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Require clients to authenticate with the given credentials. Empty
+// credentials disable authentication, which is the default.
+func (s *Server) SetAuth(a Auth) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.auth = a
+}
+
+// Authenticate a request, answering it with 401 Unauthorized if it fails.
+// Returns the request with the name of the client in its context, see
+// clientID, or the request as is without authentication.
+func (s *Server) checkAuth(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	s.mutex.RLock()
+	auth := s.auth
+	s.mutex.RUnlock()
+
+	if auth.Empty() {
+		return r, true
+	}
+
+	name, ok := auth.authenticate(r)
+	if !ok {
+		if len(auth.Users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="iopi"`)
+		}
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientKey{}, name)), true
+}
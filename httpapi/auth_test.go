@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	s, _ := newTestServer()
+	s.SetAuth(Auth{
+		Tokens: map[string]string{"dashboard": "s3cret"},
+		Users:  map[string]string{"admin": "hunter2"},
+	})
+
+	get := func(setup func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/devices", nil)
+		setup(req)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for name, c := range map[string]struct {
+		setup func(r *http.Request)
+		code  int
+	}{
+		"no credentials":  {func(r *http.Request) {}, http.StatusUnauthorized},
+		"bearer token":    {func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		"wrong token":     {func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		"query token":     {func(r *http.Request) { r.URL.RawQuery = "token=s3cret" }, http.StatusOK},
+		"basic auth":      {func(r *http.Request) { r.SetBasicAuth("admin", "hunter2") }, http.StatusOK},
+		"wrong password":  {func(r *http.Request) { r.SetBasicAuth("admin", "hunter3") }, http.StatusUnauthorized},
+		"unknown user":    {func(r *http.Request) { r.SetBasicAuth("guest", "") }, http.StatusUnauthorized},
+		"token as a user": {func(r *http.Request) { r.SetBasicAuth("dashboard", "s3cret") }, http.StatusUnauthorized},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if rec := get(c.setup); rec.Code != c.code {
+				t.Error("unexpected status", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("asks for basic auth", func(t *testing.T) {
+		rec := get(func(r *http.Request) {})
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("missing WWW-Authenticate header")
+		}
+	})
+
+	t.Run("identifies the client by its credentials", func(t *testing.T) {
+		s.SetArbiter(NewArbiter(LastWriterWins))
+		defer s.SetArbiter(nil)
+
+		req := httptest.NewRequest("PUT", "/devices/0x20/pins/1/lock", nil)
+		req.Header.Set("X-Client", "someone-else")
+		req.SetBasicAuth("admin", "hunter2")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if !strings.Contains(rec.Body.String(), `"locked_by":"admin"`) {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("ignores X-Client of clients authenticated with an empty name", func(t *testing.T) {
+		s, _ := newTestServer()
+		s.SetAuth(Auth{Tokens: map[string]string{"": "anonymous"}})
+		s.SetArbiter(NewArbiter(LastWriterWins))
+
+		req := httptest.NewRequest("PUT", "/devices/0x20/pins/1/lock", nil)
+		req.Header.Set("X-Client", "someone-else")
+		req.Header.Set("Authorization", "Bearer anonymous")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if strings.Contains(rec.Body.String(), "someone-else") {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("is disabled without credentials", func(t *testing.T) {
+		s, _ := newTestServer()
+		s.SetAuth(Auth{})
+		if rec := do(s, "GET", "/devices", ""); rec.Code != http.StatusOK {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,612 @@
+package httpapi
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Minimal server side of CoAP (RFC 7252) and its Observe extension (RFC
+// 7641), enough for constrained clients to read, write and observe pins.
+
+// Message types
+const (
+	coapCON = 0 // confirmable
+	coapNON = 1 // non-confirmable
+	coapACK = 2
+	coapRST = 3
+)
+
+// Method and response codes, as class<<5 | detail
+const (
+	coapEmpty            = 0x00
+	coapGet              = 0x01
+	coapPut              = 0x03
+	coapChanged          = 0x44 // 2.04
+	coapContent          = 0x45 // 2.05
+	coapBadRequest       = 0x80 // 4.00
+	coapUnauthorized     = 0x81 // 4.01
+	coapForbidden        = 0x83 // 4.03
+	coapNotFound         = 0x84 // 4.04
+	coapMethodNotAllowed = 0x85 // 4.05
+	coapInternalError    = 0xA0 // 5.00
+)
+
+// Option numbers
+const (
+	coapObserve       = 6
+	coapURIPath       = 11
+	coapContentFormat = 12
+)
+
+const coapFormatJSON = 50
+
+// Limits of observations, see RFC 7641 section 4.5
+const (
+	coapMaxObservers  = 8              // per client address
+	coapMaxTotal      = 256            // of all client addresses
+	coapConfirmEvery  = 8              // notifications, of which one is confirmable
+	coapConfirmPeriod = 24 * time.Hour // at most between confirmable notifications
+
+	// Retransmission of confirmable notifications, see RFC 7252 section 4.8
+	coapAckTimeout    = 2 * time.Second
+	coapMaxRetransmit = 4
+
+	// Confirmable requests answered, by client address, to answer
+	// retransmissions without handling them again, see RFC 7252 section
+	// 4.5
+	coapRecentPerPeer = 16
+	coapExchangeTime  = 247 * time.Second // EXCHANGE_LIFETIME
+)
+
+type coapOption struct {
+	num   uint16
+	value []byte
+}
+
+type coapMessage struct {
+	typ     byte
+	code    byte
+	id      uint16
+	token   []byte
+	options []coapOption
+	payload []byte
+}
+
+// Return the first option `num`, or false if the message has none.
+func (m *coapMessage) option(num uint16) ([]byte, bool) {
+	for _, o := range m.options {
+		if o.num == num {
+			return o.value, true
+		}
+	}
+	return nil, false
+}
+
+func (m *coapMessage) path() []string {
+	var parts []string
+	for _, o := range m.options {
+		if o.num == coapURIPath {
+			parts = append(parts, string(o.value))
+		}
+	}
+	return parts
+}
+
+func parseCoAP(b []byte) (*coapMessage, error) {
+	if len(b) < 4 || b[0]>>6 != 1 {
+		return nil, errors.New("invalid coap header")
+	}
+	tkl := int(b[0] & 0x0F)
+	if tkl > 8 || len(b) < 4+tkl {
+		return nil, errors.New("invalid coap token")
+	}
+
+	m := &coapMessage{
+		typ:   b[0] >> 4 & 0x03,
+		code:  b[1],
+		id:    binary.BigEndian.Uint16(b[2:]),
+		token: append([]byte(nil), b[4:4+tkl]...),
+	}
+
+	b = b[4+tkl:]
+	num := 0
+	for len(b) > 0 {
+		if b[0] == 0xFF {
+			if len(b) == 1 {
+				return nil, errors.New("empty coap payload")
+			}
+			m.payload = append([]byte(nil), b[1:]...)
+			break
+		}
+
+		delta, length := int(b[0]>>4), int(b[0]&0x0F)
+		b = b[1:]
+		var err error
+		if delta, b, err = coapExtended(delta, b); err != nil {
+			return nil, err
+		}
+		if length, b, err = coapExtended(length, b); err != nil {
+			return nil, err
+		}
+		if len(b) < length {
+			return nil, errors.New("truncated coap option")
+		}
+
+		num += delta
+		m.options = append(m.options, coapOption{uint16(num), append([]byte(nil), b[:length]...)})
+		b = b[length:]
+	}
+	return m, nil
+}
+
+// Decode the extended form of an option delta or length nibble.
+func coapExtended(n int, b []byte) (int, []byte, error) {
+	switch {
+	case n < 13:
+		return n, b, nil
+	case n == 13 && len(b) >= 1:
+		return int(b[0]) + 13, b[1:], nil
+	case n == 14 && len(b) >= 2:
+		return int(binary.BigEndian.Uint16(b)) + 269, b[2:], nil
+	}
+	return 0, nil, errors.New("invalid coap option")
+}
+
+func (m *coapMessage) marshal() []byte {
+	b := []byte{1<<6 | m.typ<<4 | byte(len(m.token)), m.code, byte(m.id >> 8), byte(m.id)}
+	b = append(b, m.token...)
+
+	sort.SliceStable(m.options, func(i, j int) bool { return m.options[i].num < m.options[j].num })
+	num := 0
+	for _, o := range m.options {
+		delta, length := int(o.num)-num, len(o.value)
+		head := len(b)
+		b = append(b, 0)
+		var dn, ln byte
+		b, dn = coapAppendExtended(b, delta)
+		b, ln = coapAppendExtended(b, length)
+		b[head] = dn<<4 | ln
+		b = append(b, o.value...)
+		num = int(o.num)
+	}
+
+	if len(m.payload) > 0 {
+		b = append(b, 0xFF)
+		b = append(b, m.payload...)
+	}
+	return b
+}
+
+// Append the extended form of an option delta or length, returning its
+// nibble.
+func coapAppendExtended(b []byte, n int) ([]byte, byte) {
+	switch {
+	case n < 13:
+		return b, byte(n)
+	case n < 269:
+		return append(b, byte(n-13)), 13
+	default:
+		return append(b, byte((n-269)>>8), byte(n-269)), 14
+	}
+}
+
+// Encode an unsigned option value in as few bytes as possible.
+func coapUint(v uint32) []byte {
+	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func coapParseUint(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// A client observing a pin
+type coapObserver struct {
+	addr   net.Addr
+	token  []byte
+	ref    iopi.PinRef
+	seq    uint32 // of the Observe option, increasing with each notification
+	lastID uint16 // of the last notification, rejected with a reset
+
+	unconfirmed int       // notifications sent since the last confirmable one
+	confirmed   time.Time // when a notification was last acknowledged
+	awaiting    bool      // an acknowledgement of the notification conID
+	conID       uint16
+}
+
+// A confirmable request answered
+type coapExchange struct {
+	id  uint16
+	res *coapMessage
+	at  time.Time
+}
+
+type coapServer struct {
+	*Server
+	conn  net.PacketConn
+	clock iopi.Clock
+	done  chan struct{} // closed when the connection is
+
+	mutex     sync.Mutex
+	observers map[string]*coapObserver  // by client address and token
+	recent    map[string][]coapExchange // by client address, oldest first
+	nextID    uint16
+}
+
+// Returned by ServeCoAP if credentials are set, see Server.InsecureCoAP.
+var ErrCoAPAuth = errors.New("coap clients cannot authenticate, set InsecureCoAP to serve coap with credentials set")
+
+// Serve CoAP on a UDP connection until it is closed, so constrained clients
+// can use pins without keeping a TCP connection. Returns the error of the
+// connection. Pins are resources at
+//
+//	pins/{name}
+//	devices/{addr}/pins/{n}
+//
+// GET answers with the PinState as JSON. With the Observe option, the
+// client is then notified of every change of the pin until it deregisters
+// or answers a notification with a reset. PUT writes the pin, with the
+// state as payload, e.g. high or 1.
+//
+// A client address may observe up to 8 pins, and up to 256 pins are
+// observed in all; further registrations are answered without the Observe
+// option. Every 8th notification, and the first after a day without one,
+// is confirmable. It is retransmitted until acknowledged, and an observer
+// that never acknowledges it is deregistered. Retransmitted confirmable
+// requests get the answer of the first, and are not handled again.
+//
+// CoAP clients cannot authenticate. With credentials set, see SetAuth,
+// ServeCoAP returns ErrCoAPAuth, and requests are answered with 4.01
+// Unauthorized if credentials are set later, unless InsecureCoAP is set.
+// Clients are named coap-HOST:PORT, see Arbiter, and writes refused by the
+// arbiter are answered with 4.03 Forbidden.
+func (s *Server) ServeCoAP(conn net.PacketConn) error {
+	if !s.coapAllowed() {
+		return ErrCoAPAuth
+	}
+
+	c := &coapServer{
+		Server:    s,
+		conn:      conn,
+		clock:     iopi.ClockOr(s.Clock),
+		done:      make(chan struct{}),
+		observers: make(map[string]*coapObserver),
+		recent:    make(map[string][]coapExchange),
+	}
+
+	events, cancel := s.subscribe(eventFilter{address: -1})
+	defer func() {
+		close(c.done)
+		cancel()
+	}()
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				c.notify(ev)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		req, err := parseCoAP(buf[:n])
+		if err != nil {
+			continue
+		}
+		if res := c.handle(req, addr); res != nil {
+			conn.WriteTo(res.marshal(), addr)
+		}
+	}
+}
+
+// Answer a request, or return nil if it needs no answer.
+func (c *coapServer) handle(req *coapMessage, addr net.Addr) *coapMessage {
+	switch {
+	case req.typ == coapRST:
+		c.reset(addr, req.id)
+		return nil
+	case req.typ == coapACK:
+		c.ack(addr, req.id)
+		return nil
+	case req.code == coapEmpty:
+		// Ping
+		return &coapMessage{typ: coapRST, id: req.id}
+	}
+
+	if req.typ == coapCON {
+		if res, ok := c.answered(addr, req.id); ok {
+			return res
+		}
+	}
+
+	var res *coapMessage
+	if c.coapAllowed() {
+		res = c.serve(req, addr)
+	} else {
+		res = coapError(coapUnauthorized, errors.New("unauthorized"))
+	}
+	res.token = req.token
+	if req.typ == coapCON {
+		res.typ, res.id = coapACK, req.id
+		c.remember(addr, req.id, res)
+	} else {
+		res.typ, res.id = coapNON, c.messageID()
+	}
+	return res
+}
+
+// Return true unless credentials are set without InsecureCoAP.
+func (s *Server) coapAllowed() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.InsecureCoAP || s.auth.Empty()
+}
+
+// Return the answer to the confirmable request `id` of a client, if it was
+// answered within the exchange lifetime.
+func (c *coapServer) answered(addr net.Addr, id uint16) (*coapMessage, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.clock.Now()
+	for _, e := range c.recent[addr.String()] {
+		if e.id == id && now.Sub(e.at) < coapExchangeTime {
+			return e.res, true
+		}
+	}
+	return nil, false
+}
+
+// Remember the answer to a confirmable request, keeping the last few of
+// each client, and forget clients without recent requests.
+func (c *coapServer) remember(addr net.Addr, id uint16, res *coapMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.clock.Now()
+	for key, recent := range c.recent {
+		if now.Sub(recent[len(recent)-1].at) >= coapExchangeTime {
+			delete(c.recent, key)
+		}
+	}
+
+	key := addr.String()
+	recent := append(c.recent[key], coapExchange{id, res, now})
+	if len(recent) > coapRecentPerPeer {
+		recent = recent[len(recent)-coapRecentPerPeer:]
+	}
+	c.recent[key] = recent
+}
+
+func (c *coapServer) serve(req *coapMessage, addr net.Addr) *coapMessage {
+	dev, pin, err := c.resolve(req.path())
+	if err != nil {
+		return coapError(coapNotFound, err)
+	}
+	ref := iopi.PinRef{Address: dev.Address, Pin: pin}
+
+	code := byte(coapContent)
+	switch req.code {
+	case coapGet:
+		if v, ok := req.option(coapObserve); ok {
+			c.observe(addr, req.token, ref, coapParseUint(v) == 0)
+		}
+	case coapPut:
+		state, err := iopi.ParseState(strings.TrimSpace(string(req.payload)))
+		if err != nil {
+			return coapError(coapBadRequest, err)
+		}
+		err = c.writePins(dev, []uint8{pin}, "coap-"+addr.String(), func() error {
+			return dev.WritePin(pin, state)
+		})
+		if _, ok := err.(conflictError); ok {
+			return coapError(coapForbidden, err)
+		}
+		if err != nil {
+			return coapError(coapInternalError, err)
+		}
+		code = coapChanged
+	default:
+		return coapError(coapMethodNotAllowed, errors.New("method not allowed"))
+	}
+
+	state, err := c.pinState(dev, pin)
+	if err != nil {
+		return coapError(coapInternalError, err)
+	}
+	res := coapJSON(code, state)
+	if req.code == coapGet && c.observing(addr, req.token) {
+		res.options = append(res.options, coapOption{coapObserve, nil})
+	}
+	return res
+}
+
+// Return the device and pin of a resource path.
+func (c *coapServer) resolve(path []string) (*iopi.Device, uint8, error) {
+	switch {
+	case len(path) == 2 && path[0] == "pins":
+		ref, ok := c.getAliases().Lookup(path[1])
+		if !ok {
+			return nil, 0, fmt.Errorf("no pin named %s", path[1])
+		}
+		dev, err := c.device(strconv.Itoa(int(ref.Address)))
+		return dev, ref.Pin, err
+	case len(path) == 4 && path[0] == "devices" && path[2] == "pins":
+		dev, err := c.device(path[1])
+		if err != nil {
+			return nil, 0, err
+		}
+		pin, err := parsePin(path[3])
+		return dev, pin, err
+	}
+	return nil, 0, fmt.Errorf("not found: %s", strings.Join(path, "/"))
+}
+
+// Register or deregister an observer of a pin. Registrations beyond the
+// limits of the address or of all addresses are ignored.
+func (c *coapServer) observe(addr net.Addr, token []byte, ref iopi.PinRef, register bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := addr.String() + "/" + string(token)
+	if !register {
+		delete(c.observers, key)
+		return
+	}
+	if _, ok := c.observers[key]; !ok {
+		n := 0
+		for _, o := range c.observers {
+			if o.addr.String() == addr.String() {
+				n++
+			}
+		}
+		if n >= coapMaxObservers || len(c.observers) >= coapMaxTotal {
+			return
+		}
+	}
+	c.observers[key] = &coapObserver{addr: addr, token: token, ref: ref, seq: 1, confirmed: c.clock.Now()}
+}
+
+func (c *coapServer) observing(addr net.Addr, token []byte) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, ok := c.observers[addr.String()+"/"+string(token)]
+	return ok
+}
+
+// Deregister the observer rejecting a notification.
+func (c *coapServer) reset(addr net.Addr, id uint16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, o := range c.observers {
+		if o.addr.String() == addr.String() && o.lastID == id {
+			delete(c.observers, key)
+		}
+	}
+}
+
+// Mark the confirmable notification `id` as acknowledged.
+func (c *coapServer) ack(addr net.Addr, id uint16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, o := range c.observers {
+		if o.awaiting && o.conID == id && o.addr.String() == addr.String() {
+			o.awaiting = false
+			o.confirmed = c.clock.Now()
+		}
+	}
+}
+
+// Notify the observers of the pin of an event.
+func (c *coapServer) notify(ev iopi.PinEvent) {
+	ref := iopi.PinRef{Address: ev.Address, Pin: ev.Pin}
+	state := PinState{Pin: ev.Pin, State: ev.State, Name: c.getAliases().Name(ref)}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, o := range c.observers {
+		if o.ref != ref {
+			continue
+		}
+		o.seq++
+		o.lastID = c.nextMessageID()
+		o.unconfirmed++
+
+		msg := coapJSON(coapContent, state)
+		msg.typ, msg.id, msg.token = coapNON, o.lastID, o.token
+		msg.options = append(msg.options, coapOption{coapObserve, coapUint(o.seq & 0xFFFFFF)})
+		confirm := o.unconfirmed >= coapConfirmEvery || c.clock.Now().Sub(o.confirmed) >= coapConfirmPeriod
+		if confirm && !o.awaiting {
+			msg.typ = coapCON
+			o.unconfirmed, o.awaiting, o.conID = 0, true, o.lastID
+		}
+
+		b := msg.marshal()
+		c.conn.WriteTo(b, o.addr)
+		if msg.typ == coapCON {
+			go c.retransmit(key, o, o.conID, b)
+		}
+	}
+}
+
+// Resend the confirmable notification `id` until it is acknowledged, and
+// deregister the observer if it is not after the last retransmission.
+func (c *coapServer) retransmit(key string, o *coapObserver, id uint16, b []byte) {
+	timeout := coapAckTimeout
+	for i := 0; ; i++ {
+		select {
+		case <-c.clock.After(timeout):
+		case <-c.done:
+			return
+		}
+
+		c.mutex.Lock()
+		switch {
+		case c.observers[key] != o || !o.awaiting || o.conID != id:
+			c.mutex.Unlock()
+			return
+		case i == coapMaxRetransmit:
+			delete(c.observers, key)
+			c.mutex.Unlock()
+			return
+		}
+		c.conn.WriteTo(b, o.addr)
+		c.mutex.Unlock()
+		timeout *= 2
+	}
+}
+
+func (c *coapServer) messageID() uint16 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.nextMessageID()
+}
+
+func (c *coapServer) nextMessageID() uint16 {
+	c.nextID++
+	return c.nextID
+}
+
+func coapJSON(code byte, v interface{}) *coapMessage {
+	payload, _ := json.Marshal(v)
+	return &coapMessage{
+		code:    code,
+		options: []coapOption{{coapContentFormat, coapUint(coapFormatJSON)}},
+		payload: payload,
+	}
+}
+
+// A response with a diagnostic payload
+func coapError(code byte, err error) *coapMessage {
+	return &coapMessage{code: code, payload: []byte(err.Error())}
+}
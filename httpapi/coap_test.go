@@ -0,0 +1,393 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Serve CoAP on a local port and return a client connected to it.
+func dialCoAP(t *testing.T, s *Server) net.Conn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.ServeCoAP(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Send a request and return the next message received.
+func coapRequest(t *testing.T, conn net.Conn, req *coapMessage) *coapMessage {
+	if _, err := conn.Write(req.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	return coapReceive(t, conn)
+}
+
+func coapReceive(t *testing.T, conn net.Conn) *coapMessage {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := parseCoAP(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func coapPath(path string, extra ...coapOption) []coapOption {
+	var opts []coapOption
+	for _, p := range strings.Split(path, "/") {
+		opts = append(opts, coapOption{coapURIPath, []byte(p)})
+	}
+	return append(opts, extra...)
+}
+
+func TestCoAP(t *testing.T) {
+	// The server reads the device in its own goroutine
+	file, mutex := iopi.NewFakeFile(), &sync.Mutex{}
+	s := NewServer(iopi.NewDevice(file, 0x20, mutex))
+	setRead := func(b byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		file.NextRead = []byte{b}
+	}
+	aliases := iopi.NewAliases()
+	aliases.Set("door", iopi.PinRef{Address: 0x20, Pin: 2})
+	s.SetAliases(aliases)
+	poller := iopi.NewPoller(s.devices[0x20], 0)
+	s.AddPoller(poller)
+
+	conn := dialCoAP(t, s)
+
+	t.Run("reads a pin", func(t *testing.T) {
+		setRead(0b00000010)
+		res := coapRequest(t, conn, &coapMessage{
+			typ: coapCON, code: coapGet, id: 7, token: []byte{0xAB},
+			options: coapPath("devices/0x20/pins/2"),
+		})
+		if res.typ != coapACK || res.id != 7 || res.code != coapContent || string(res.token) != "\xAB" {
+			t.Fatal("unexpected response", res)
+		}
+		var state PinState
+		if err := json.Unmarshal(res.payload, &state); err != nil {
+			t.Fatal(err)
+		}
+		if state.Pin != 2 || state.State != iopi.High || state.Name != "door" {
+			t.Error("unexpected state", state)
+		}
+	})
+
+	t.Run("writes a pin", func(t *testing.T) {
+		mutex.Lock()
+		file.CallHistory = nil
+		file.SetRegister(iopi.OLATA, 0x00)
+		mutex.Unlock()
+
+		res := coapRequest(t, conn, &coapMessage{
+			typ: coapCON, code: coapPut, id: 8,
+			options: coapPath("pins/door"), payload: []byte("high"),
+		})
+		if res.code != coapChanged {
+			t.Fatal("unexpected response", res.code, string(res.payload))
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOA), 0b00000010}) {
+			t.Error("pin not written", file.CallHistory)
+		}
+	})
+
+	t.Run("answers errors", func(t *testing.T) {
+		for path, code := range map[string]byte{
+			"pins/window":         coapNotFound,
+			"devices/0x21/pins/1": coapNotFound,
+			"devices/0x20/pins/0": coapNotFound,
+		} {
+			res := coapRequest(t, conn, &coapMessage{typ: coapCON, code: coapGet, id: 9, options: coapPath(path)})
+			if res.code != code {
+				t.Error("unexpected response to", path, res.code)
+			}
+		}
+		res := coapRequest(t, conn, &coapMessage{typ: coapCON, code: coapPut, id: 10, options: coapPath("pins/door"), payload: []byte("up")})
+		if res.code != coapBadRequest {
+			t.Error("unexpected response to invalid state", res.code)
+		}
+	})
+
+	t.Run("answers retransmitted requests without handling them again", func(t *testing.T) {
+		mutex.Lock()
+		file.CallHistory = nil
+		file.SetRegister(iopi.OLATA, 0x00)
+		mutex.Unlock()
+
+		req := &coapMessage{typ: coapCON, code: coapPut, id: 20, options: coapPath("pins/door"), payload: []byte("high")}
+		first := coapRequest(t, conn, req)
+		again := coapRequest(t, conn, req)
+		if again.typ != coapACK || again.id != 20 || again.code != first.code {
+			t.Error("unexpected response", again)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		writes := 0
+		for _, c := range file.CallHistory {
+			if c.Fn == "Write" && len(c.Arg) == 2 && c.Arg[0] == byte(iopi.GPIOA) {
+				writes++
+			}
+		}
+		if writes != 1 {
+			t.Error("unexpected number of writes", writes)
+		}
+	})
+
+	t.Run("answers pings with a reset", func(t *testing.T) {
+		res := coapRequest(t, conn, &coapMessage{typ: coapCON, code: coapEmpty, id: 11})
+		if res.typ != coapRST || res.id != 11 {
+			t.Error("unexpected response", res)
+		}
+	})
+
+	t.Run("notifies observers", func(t *testing.T) {
+		setRead(0x00)
+		poller.Poll()
+
+		res := coapRequest(t, conn, &coapMessage{
+			typ: coapCON, code: coapGet, id: 12, token: []byte("obs"),
+			options: coapPath("pins/door", coapOption{coapObserve, nil}),
+		})
+		if _, ok := res.option(coapObserve); !ok || res.code != coapContent {
+			t.Fatal("observation not registered", res)
+		}
+
+		setRead(0b00000010)
+		poller.Poll()
+		note := coapReceive(t, conn)
+		if note.typ != coapNON || string(note.token) != "obs" {
+			t.Fatal("unexpected notification", note)
+		}
+		var state PinState
+		json.Unmarshal(note.payload, &state)
+		if state.Pin != 2 || state.State != iopi.High {
+			t.Error("unexpected state", state)
+		}
+
+		// A reset ends the observation
+		conn.Write((&coapMessage{typ: coapRST, id: note.id}).marshal())
+		time.Sleep(10 * time.Millisecond)
+		setRead(0x00)
+		poller.Poll()
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, err := conn.Read(make([]byte, 1500)); err == nil {
+			t.Error("notified after reset")
+		}
+	})
+}
+
+func TestCoAPAuth(t *testing.T) {
+	t.Run("refuses to serve with credentials set", func(t *testing.T) {
+		s := NewServer()
+		s.SetAuth(Auth{Tokens: map[string]string{"a": "secret"}})
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := s.ServeCoAP(conn); err != ErrCoAPAuth {
+			t.Error("unexpected error", err)
+		}
+	})
+
+	t.Run("serves with credentials set if insecure", func(t *testing.T) {
+		s := NewServer(iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{}))
+		s.SetAuth(Auth{Tokens: map[string]string{"a": "secret"}})
+		s.InsecureCoAP = true
+		conn := dialCoAP(t, s)
+
+		res := coapRequest(t, conn, &coapMessage{typ: coapCON, code: coapGet, id: 1, options: coapPath("devices/0x20/pins/1")})
+		if res.code != coapContent {
+			t.Error("unexpected response", res.code)
+		}
+	})
+
+	t.Run("refuses requests once credentials are set", func(t *testing.T) {
+		s := NewServer(iopi.NewDevice(iopi.NewFakeFile(), 0x20, &sync.Mutex{}))
+		conn := dialCoAP(t, s)
+		coapRequest(t, conn, &coapMessage{typ: coapCON, code: coapEmpty, id: 1}) // serving
+		s.SetAuth(Auth{Tokens: map[string]string{"a": "secret"}})
+
+		res := coapRequest(t, conn, &coapMessage{typ: coapCON, code: coapPut, id: 2, options: coapPath("devices/0x20/pins/1"), payload: []byte("high")})
+		if res.code != coapUnauthorized {
+			t.Error("unexpected response", res.code)
+		}
+	})
+}
+
+// Receive nothing for a while
+func coapSilent(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1500)); err == nil {
+		t.Error("unexpected message")
+	}
+}
+
+func TestCoAPObservers(t *testing.T) {
+	file, mutex := iopi.NewFakeFile(), &sync.Mutex{}
+	s := NewServer(iopi.NewDevice(file, 0x20, mutex))
+	clock := iopitest.NewFakeClock(time.Unix(0, 0))
+	s.Clock = clock
+	poller := iopi.NewPoller(s.devices[0x20], 0)
+	s.AddPoller(poller)
+	poller.Poll()
+
+	// Change pin 1
+	state := byte(0)
+	toggle := func() {
+		state ^= 1
+		mutex.Lock()
+		file.NextRead = []byte{state}
+		mutex.Unlock()
+		poller.Poll()
+	}
+	// Message IDs of requests, unique so they are not taken as
+	// retransmissions
+	var id uint16
+	observe := func(t *testing.T, conn net.Conn, token string) *coapMessage {
+		id++
+		return coapRequest(t, conn, &coapMessage{
+			typ: coapCON, code: coapGet, id: id, token: []byte(token),
+			options: coapPath("devices/0x20/pins/1", coapOption{coapObserve, nil}),
+		})
+	}
+	// Register an observer and return the confirmable notification, after
+	// as many non-confirmable ones as come before it
+	confirmable := func(t *testing.T, conn net.Conn) *coapMessage {
+		observe(t, conn, "obs")
+		for i := 1; i < coapConfirmEvery; i++ {
+			toggle()
+			if note := coapReceive(t, conn); note.typ != coapNON {
+				t.Fatal("unexpected notification", note)
+			}
+		}
+		toggle()
+		note := coapReceive(t, conn)
+		if note.typ != coapCON {
+			t.Fatal("notification not confirmable", note)
+		}
+		return note
+	}
+
+	t.Run("limits observers per address", func(t *testing.T) {
+		conn := dialCoAP(t, s)
+		for i := 0; i < coapMaxObservers; i++ {
+			if _, ok := observe(t, conn, strconv.Itoa(i)).option(coapObserve); !ok {
+				t.Fatal("observation not registered", i)
+			}
+		}
+		if _, ok := observe(t, conn, "last").option(coapObserve); ok {
+			t.Error("observation beyond the limit registered")
+		}
+		if _, ok := observe(t, conn, "0").option(coapObserve); !ok {
+			t.Error("observation not registered again")
+		}
+	})
+
+	t.Run("limits observers of all addresses", func(t *testing.T) {
+		c := &coapServer{Server: s, clock: clock, observers: make(map[string]*coapObserver)}
+		ref := iopi.PinRef{Address: 0x20, Pin: 1}
+		for i := 0; i < coapMaxTotal; i++ {
+			addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i/coapMaxObservers)), Port: 5683}
+			c.observe(addr, []byte(strconv.Itoa(i)), ref, true)
+		}
+		last := &net.UDPAddr{IP: net.IPv4(10, 0, 1, 0), Port: 5683}
+		c.observe(last, []byte("last"), ref, true)
+		if len(c.observers) != coapMaxTotal || c.observing(last, []byte("last")) {
+			t.Error("observation beyond the limit registered", len(c.observers))
+		}
+	})
+
+	t.Run("retransmits confirmable notifications until acknowledged", func(t *testing.T) {
+		conn := dialCoAP(t, s)
+		note := confirmable(t, conn)
+
+		clock.BlockUntil(1)
+		clock.Advance(coapAckTimeout)
+		if again := coapReceive(t, conn); again.typ != coapCON || again.id != note.id {
+			t.Fatal("unexpected retransmission", again)
+		}
+		conn.Write((&coapMessage{typ: coapACK, id: note.id}).marshal())
+		time.Sleep(10 * time.Millisecond)
+		clock.BlockUntil(1)
+		clock.Advance(2 * coapAckTimeout)
+		coapSilent(t, conn)
+
+		toggle()
+		if note := coapReceive(t, conn); note.typ != coapNON {
+			t.Error("unexpected notification", note)
+		}
+	})
+
+	t.Run("deregisters observers not acknowledging", func(t *testing.T) {
+		conn := dialCoAP(t, s)
+		confirmable(t, conn)
+
+		timeout := coapAckTimeout
+		for i := 0; i < coapMaxRetransmit; i++ {
+			clock.BlockUntil(1)
+			clock.Advance(timeout)
+			coapReceive(t, conn)
+			timeout *= 2
+		}
+		clock.BlockUntil(1)
+		clock.Advance(timeout)
+		time.Sleep(10 * time.Millisecond)
+
+		toggle()
+		coapSilent(t, conn)
+	})
+}
+
+func TestCoAPMessage(t *testing.T) {
+	msg := &coapMessage{
+		typ: coapNON, code: coapContent, id: 0x1234, token: []byte{1, 2, 3},
+		options: []coapOption{
+			{coapURIPath, []byte("a-path-segment-longer-than-13")},
+			{coapObserve, coapUint(300)},
+			{coapContentFormat, coapUint(coapFormatJSON)},
+			{2048, []byte("x")},
+		},
+		payload: []byte("{}"),
+	}
+	parsed, err := parseCoAP(msg.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, msg) {
+		t.Errorf("roundtrip failed:\n%v\n%v", parsed, msg)
+	}
+
+	for _, b := range [][]byte{{}, {0x80, 0, 0, 0}, {0x49, 0, 0, 0}, {0x40, 0, 0, 0, 0xFF}, {0x40, 0, 0, 0, 0xD1}} {
+		if _, err := parseCoAP(b); err == nil {
+			t.Error("expected error for", b)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Serve the control protocol on a listener, typically a unix domain socket,
+// until it is closed. The protocol gives local scripts and tools the
+// devices of the server without opening the bus themselves. Each line sent
+// is a command, answered by a line of JSON:
+//
+//	get ADDR PIN | get NAME              the state of a pin, as a PinState
+//	set ADDR PIN STATE | set NAME STATE  write a pin, answered like get
+//	watch [ADDR [PINS]]                  stream pin events, e.g. watch 0x20 1,2
+//	client NAME                          name the client, see Arbiter
+//	lock ADDR PIN | lock NAME            lock a pin for the client
+//	unlock ADDR PIN | unlock NAME        release the lock of the client
+//
+// Failed commands are answered with {"error": "..."}. A watch streams
+// events until the client closes the connection. Connections are separate
+// clients named socket-1, socket-2 and so on, and their locks are released
+// when they close. A name given with the client command is scoped to the
+// connection, e.g. socket-2-backup, so a connection cannot act as a client
+// of the HTTP API or of another connection.
+func (s *Server) ServeControl(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeControlConn(conn)
+	}
+}
+
+// Serve the control protocol on a connection until it is closed, see
+// ServeControl.
+func (s *Server) ServeControlConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	conname := fmt.Sprintf("socket-%d", atomic.AddUint64(&controlClients, 1))
+	client := conname
+	defer func() {
+		if a := s.getArbiter(); a != nil {
+			a.UnlockAll(client)
+		}
+	}()
+
+	lines := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for lines.Scan() {
+		args := strings.Fields(lines.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		var res interface{}
+		var err error
+		switch args[0] {
+		case "get":
+			res, err = s.controlPin(args[1:], "", client)
+		case "set", "lock", "unlock":
+			res, err = s.controlPin(args[1:], args[0], client)
+		case "client":
+			if len(args) != 2 {
+				err = fmt.Errorf("invalid arguments: %s", strings.Join(args[1:], " "))
+				break
+			}
+			if a := s.getArbiter(); a != nil {
+				a.UnlockAll(client)
+			}
+			client = conname + "-" + args[1]
+			res = struct {
+				Client string `json:"client"`
+			}{client}
+		case "watch":
+			s.controlWatch(lines, enc, args[1:])
+			return
+		default:
+			err = fmt.Errorf("unknown command: %s", args[0])
+		}
+
+		if err != nil {
+			res = errorResponse{Error: strings.TrimSpace(err.Error())}
+		}
+		if err := enc.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+// Number of control connections served, naming their clients
+var controlClients uint64
+
+// Read the pin given by address and number or name, after writing it if
+// `op` is set, or locking or unlocking it for the client.
+func (s *Server) controlPin(args []string, op string, client string) (PinState, error) {
+	var dev *iopi.Device
+	var pin uint8
+	var err error
+
+	n := 1
+	if op == "set" {
+		n = 2
+	}
+	switch {
+	case len(args) == n:
+		ref, ok := s.getAliases().Lookup(args[0])
+		if !ok {
+			return PinState{}, fmt.Errorf("no pin named %s", args[0])
+		}
+		dev, err = s.device(strconv.Itoa(int(ref.Address)))
+		pin = ref.Pin
+	case len(args) == n+1:
+		dev, err = s.device(args[0])
+		if err == nil {
+			pin, err = parsePin(args[1])
+		}
+	default:
+		return PinState{}, fmt.Errorf("invalid arguments: %s", strings.Join(args, " "))
+	}
+	if err != nil {
+		return PinState{}, err
+	}
+
+	ref := iopi.PinRef{Address: dev.Address, Pin: pin}
+	switch op {
+	case "set":
+		state, err := iopi.ParseState(args[len(args)-1])
+		if err != nil {
+			return PinState{}, err
+		}
+		err = s.writePins(dev, []uint8{pin}, client, func() error {
+			return dev.WritePin(pin, state)
+		})
+		if err != nil {
+			return PinState{}, err
+		}
+	case "lock", "unlock":
+		a := s.getArbiter()
+		if a == nil {
+			return PinState{}, fmt.Errorf("arbitration disabled")
+		}
+		if op == "lock" {
+			err = a.Lock(ref, client)
+		} else {
+			err = a.Unlock(ref, client)
+		}
+		if err != nil {
+			return PinState{}, err
+		}
+	}
+
+	return s.pinState(dev, pin)
+}
+
+// Stream events matching the optional address and pins until the client
+// closes the connection.
+func (s *Server) controlWatch(lines *bufio.Scanner, enc *json.Encoder, args []string) {
+	q := make(map[string][]string)
+	if len(args) > 0 {
+		q["device"] = args[:1]
+	}
+	if len(args) > 1 {
+		q["pins"] = args[1:2]
+	}
+	f, err := parseFilter(q)
+	if err == nil && len(args) > 2 {
+		err = fmt.Errorf("invalid arguments: %s", strings.Join(args, " "))
+	}
+	if err != nil {
+		enc.Encode(errorResponse{Error: err.Error()})
+		return
+	}
+
+	events, cancel := s.subscribe(f)
+	defer cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		for lines.Scan() {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			if err := enc.Encode(s.getAliases().Annotate(ev)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Connect to the control protocol of a server over a pipe
+func dialControl(t *testing.T, s *Server) (net.Conn, *bufio.Scanner) {
+	client, server := net.Pipe()
+	go s.ServeControlConn(server)
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(time.Second))
+	return client, bufio.NewScanner(client)
+}
+
+// Send a command and decode the answer
+func command(t *testing.T, conn net.Conn, lines *bufio.Scanner, cmd string) map[string]interface{} {
+	fmt.Fprintln(conn, cmd)
+	if !lines.Scan() {
+		t.Fatal("no answer to", cmd, lines.Err())
+	}
+	var res map[string]interface{}
+	if err := json.Unmarshal(lines.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestControl(t *testing.T) {
+	t.Run("reads and writes pins", func(t *testing.T) {
+		s, file := newTestServer()
+		conn, lines := dialControl(t, s)
+
+		file.NextRead = []byte{0b00000100}
+		if res := command(t, conn, lines, "get 0x20 3"); res["pin"] != 3.0 || res["state"] != "high" {
+			t.Error("unexpected answer", res)
+		}
+
+		file.NextRead = []byte{0x00}
+		command(t, conn, lines, "set 32 10 high")
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOB), 0b00000010}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("resolves named pins", func(t *testing.T) {
+		s, file := newTestServer()
+		a := iopi.NewAliases()
+		a.Set("pump", iopi.PinRef{Address: 0x20, Pin: 2})
+		s.SetAliases(a)
+		conn, lines := dialControl(t, s)
+
+		file.NextRead = []byte{0x00}
+		res := command(t, conn, lines, "set pump on")
+		if res["pin"] != 2.0 || res["name"] != "pump" {
+			t.Error("unexpected answer", res)
+		}
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOA), 0b00000010}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("answers errors", func(t *testing.T) {
+		s, _ := newTestServer()
+		conn, lines := dialControl(t, s)
+
+		for _, cmd := range []string{"get", "get 0x21 1", "get 0x20 17", "get door", "set 0x20 1 maybe", "reset"} {
+			if res := command(t, conn, lines, cmd); res["error"] == nil {
+				t.Error("expected error for", cmd, res)
+			}
+		}
+	})
+
+	t.Run("locks pins for the connection", func(t *testing.T) {
+		s, _ := newTestServer()
+		s.SetArbiter(NewArbiter(LastWriterWins))
+		alice, aliceLines := dialControl(t, s)
+		bob, bobLines := dialControl(t, s)
+
+		res := command(t, alice, aliceLines, "client alice")
+		client, _ := res["client"].(string)
+		if !strings.HasPrefix(client, "socket-") || !strings.HasSuffix(client, "-alice") {
+			t.Fatal("client name not scoped", res)
+		}
+		if res := command(t, alice, aliceLines, "lock 0x20 4"); res["locked_by"] != client {
+			t.Fatal("unexpected answer", res)
+		}
+		if res := command(t, bob, bobLines, "set 0x20 4 high"); res["error"] == nil {
+			t.Error("expected error", res)
+		}
+
+		// Taking the same name does not give another connection the lock
+		command(t, bob, bobLines, "client alice")
+		if res := command(t, bob, bobLines, "unlock 0x20 4"); res["error"] == nil {
+			t.Error("expected error", res)
+		}
+		bob.Close()
+		time.Sleep(50 * time.Millisecond)
+		bob, bobLines = dialControl(t, s)
+		if res := command(t, bob, bobLines, "set 0x20 4 high"); res["error"] == nil {
+			t.Error("lock released by another connection", res)
+		}
+
+		alice.Close()
+		// Wait for the connection to close and release its locks
+		time.Sleep(50 * time.Millisecond)
+		if res := command(t, bob, bobLines, "lock 0x20 4"); res["error"] != nil {
+			t.Error("lock not released", res)
+		}
+	})
+
+	t.Run("streams events", func(t *testing.T) {
+		s, file := newTestServer()
+		poller := iopi.NewPoller(s.devices[0x20], 0)
+		s.AddPoller(poller)
+		conn, lines := dialControl(t, s)
+
+		fmt.Fprintln(conn, "watch 0x20 2")
+		// Wait for the connection to subscribe
+		time.Sleep(50 * time.Millisecond)
+
+		file.NextRead = []byte{0x00}
+		poller.Poll()
+		file.NextRead = []byte{0b00000011}
+		poller.Poll()
+
+		if !lines.Scan() {
+			t.Fatal("no event", lines.Err())
+		}
+		var ev iopi.PinEvent
+		if err := json.Unmarshal(lines.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Pin != 2 || ev.State != iopi.High {
+			t.Error("unexpected event", ev)
+		}
+	})
+}
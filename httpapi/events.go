@@ -0,0 +1,170 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Selects which events are sent to a client.
+type eventFilter struct {
+	address int // -1 for all devices
+	pins    map[uint8]bool
+}
+
+// Parse the `device` and `pins` query parameters, e.g.
+// ?device=0x20&pins=1,2,3
+func parseFilter(q url.Values) (eventFilter, error) {
+	f := eventFilter{address: -1}
+
+	if s := q.Get("device"); s != "" {
+		n, err := strconv.ParseUint(s, 0, 8)
+		if err != nil {
+			return f, fmt.Errorf("invalid device address: %s", s)
+		}
+		f.address = int(n)
+	}
+
+	if s := q.Get("pins"); s != "" {
+		f.pins = make(map[uint8]bool)
+		for _, p := range strings.Split(s, ",") {
+			pin, err := parsePin(strings.TrimSpace(p))
+			if err != nil {
+				return f, err
+			}
+			f.pins[pin] = true
+		}
+	}
+
+	return f, nil
+}
+
+func (f eventFilter) match(ev iopi.PinEvent) bool {
+	if f.address >= 0 && byte(f.address) != ev.Address {
+		return false
+	}
+	if f.pins != nil && !f.pins[ev.Pin] {
+		return false
+	}
+	return true
+}
+
+// Buffers of encoded events, shared by all streams
+var eventBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Encode an event as JSON, without a trailing newline, into a buffer to be
+// returned to eventBuffers.
+func encodeEvent(ev iopi.PinEvent) *bytes.Buffer {
+	buf := eventBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	json.NewEncoder(buf).Encode(ev)
+	buf.Truncate(buf.Len() - 1)
+	return buf
+}
+
+// Stream the events of a poller on the /events endpoint. The poller must
+// be run separately.
+func (s *Server) AddPoller(p *iopi.Poller) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pollers = append(s.pollers, p)
+}
+
+// Merge the events of all pollers into one channel. Call the returned
+// function to unsubscribe.
+func (s *Server) subscribe(f eventFilter) (<-chan iopi.PinEvent, func()) {
+	out := make(chan iopi.PinEvent)
+	done := make(chan struct{})
+	var cancels []func()
+
+	s.mutex.RLock()
+	pollers := append([]*iopi.Poller(nil), s.pollers...)
+	s.mutex.RUnlock()
+
+	for _, p := range pollers {
+		events, cancel := p.Subscribe()
+		cancels = append(cancels, cancel)
+
+		go func() {
+			for ev := range events {
+				if !f.match(ev) {
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			close(done)
+			for _, cancel := range cancels {
+				cancel()
+			}
+		})
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if isEventStream(r) {
+		s.streamEvents(w, r, f)
+		return
+	}
+	if !isWebsocket(r) {
+		writeError(w, http.StatusBadRequest, "websocket upgrade or text/event-stream required")
+		return
+	}
+
+	conn, err := upgrade(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	events, cancel := s.subscribe(f)
+	defer cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		conn.discardReads()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			buf := encodeEvent(s.getAliases().Annotate(ev))
+			err := conn.WriteText(buf.Bytes())
+			eventBuffers.Put(buf)
+			if err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Open a websocket connection and return the reader positioned after the
+// handshake response.
+func dialWebsocket(t *testing.T, url, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte("GET " + path + " HTTP/1.1\r\n" +
+		"Host: test\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"))
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("unexpected status", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Error("invalid accept header", resp.Header)
+	}
+
+	return conn, r
+}
+
+func TestEvents(t *testing.T) {
+	s, file := newTestServer()
+	poller := iopi.NewPoller(s.devices[0x20], 0)
+	s.AddPoller(poller)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	t.Run("requires websocket upgrade", func(t *testing.T) {
+		rec := do(s, "GET", "/events", "")
+		if rec.Code != http.StatusBadRequest {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+
+	t.Run("streams filtered events", func(t *testing.T) {
+		conn, r := dialWebsocket(t, ts.URL, "/events?pins=2")
+		defer conn.Close()
+
+		// Wait for the handler to subscribe
+		time.Sleep(50 * time.Millisecond)
+
+		file.NextRead = []byte{0x00}
+		poller.Poll()
+		file.NextRead = []byte{0b00000011}
+		poller.Poll()
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		hdr := make([]byte, 2)
+		if _, err := r.Read(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr[0] != 0x81 {
+			t.Fatal("expected text frame", hdr)
+		}
+		payload := make([]byte, hdr[1])
+		if _, err := r.Read(payload); err != nil {
+			t.Fatal(err)
+		}
+
+		var ev iopi.PinEvent
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Pin != 2 || ev.State != iopi.High {
+			t.Error("unexpected event", ev)
+		}
+	})
+}
+
+func TestParseFilter(t *testing.T) {
+	f, err := parseFilter(map[string][]string{"device": {"0x21"}, "pins": {"1, 16"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.match(iopi.PinEvent{Address: 0x20, Pin: 1}) {
+		t.Error("matched wrong device")
+	}
+	if !f.match(iopi.PinEvent{Address: 0x21, Pin: 16}) {
+		t.Error("did not match pin")
+	}
+	if f.match(iopi.PinEvent{Address: 0x21, Pin: 2}) {
+		t.Error("matched wrong pin")
+	}
+	if _, err := parseFilter(map[string][]string{"pins": {"0"}}); err == nil {
+		t.Error("expected error for invalid pin")
+	}
+}
+
+func TestEncodeEvent(t *testing.T) {
+	ev := iopi.PinEvent{Address: 0x20, Pin: 3, State: iopi.High, Name: "door"}
+	want, _ := json.Marshal(ev)
+
+	for i := 0; i < 2; i++ {
+		buf := encodeEvent(ev)
+		if buf.String() != string(want) {
+			t.Errorf("expected %s, got %s", want, buf)
+		}
+		eventBuffers.Put(buf)
+	}
+}
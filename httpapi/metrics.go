@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Escape a Prometheus label value
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Count configuration drift found on a device, e.g. by a config.Enforcer,
+// exported as iopi_config_drift_total.
+func (s *Server) RecordDrift(addr byte, pins int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.drift == nil {
+		s.drift = make(map[byte]uint64)
+	}
+	s.drift[addr] += uint64(pins)
+}
+
+// Write metrics in the Prometheus text format: the state of every named
+// pin, labelled with its device, port, pin, name and direction, and the
+// drift recorded for each device. Pins of devices that fail to read are
+// left out.
+func (s *Server) writeMetrics(w io.Writer) {
+	aliases := s.getAliases()
+
+	s.mutex.RLock()
+	devices := make(map[byte]*iopi.Device, len(s.devices))
+	addrs := make([]int, 0, len(s.devices))
+	for addr, dev := range s.devices {
+		devices[addr] = dev
+		addrs = append(addrs, int(addr))
+	}
+	drift := make(map[byte]uint64, len(s.drift))
+	for addr, n := range s.drift {
+		drift[addr] = n
+	}
+	s.mutex.RUnlock()
+	sort.Ints(addrs)
+
+	// Named pins of each device
+	named := make(map[byte][]iopi.PinRef)
+	for _, name := range aliases.Names() {
+		ref, _ := aliases.Lookup(name)
+		named[ref.Address] = append(named[ref.Address], ref)
+	}
+
+	fmt.Fprintln(w, "# HELP iopi_pin_state State of a named pin, 1 for high.")
+	fmt.Fprintln(w, "# TYPE iopi_pin_state gauge")
+	for _, addr := range addrs {
+		refs := named[byte(addr)]
+		if len(refs) == 0 {
+			continue
+		}
+		ports, dirs, err := readPorts(devices[byte(addr)])
+		if err != nil {
+			continue
+		}
+		sort.Slice(refs, func(i, j int) bool { return refs[i].Pin < refs[j].Pin })
+		for _, ref := range refs {
+			bit, port := iopi.GetPinPort(ref.Pin)
+			direction := "output"
+			if iopi.GetBit(dirs[port], bit) == 1 {
+				direction = "input"
+			}
+			fmt.Fprintf(w, "iopi_pin_state{address=\"0x%02x\",port=\"%s\",pin=\"%d\",name=\"%s\",direction=\"%s\"} %d\n",
+				addr, strings.TrimPrefix(port.String(), "Port"), ref.Pin,
+				labelEscaper.Replace(aliases.Name(ref)), direction, iopi.GetBit(ports[port], bit))
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP iopi_config_drift_total Pins found to differ from their configuration.")
+	fmt.Fprintln(w, "# TYPE iopi_config_drift_total counter")
+	for _, addr := range addrs {
+		fmt.Fprintf(w, "iopi_config_drift_total{address=\"0x%02x\"} %d\n", addr, drift[byte(addr)])
+	}
+}
+
+// Read the GPIO and IODIR registers of both ports of a device.
+func readPorts(dev *iopi.Device) (gpio, iodir [2]byte, err error) {
+	for _, port := range []iopi.Port{iopi.PortA, iopi.PortB} {
+		if gpio[port], err = dev.ReadPort(port); err != nil {
+			return
+		}
+		if iodir[port], err = dev.ReadByteData(iopi.IODIRA + iopi.Register(port)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.writeMetrics(w)
+}
@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"strings"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestMetrics(t *testing.T) {
+	s, file := newTestServer()
+	file.SetRegister(iopi.GPIOA, 0b00000100)
+	file.SetRegister(iopi.GPIOB, 0x00)
+	file.SetRegister(iopi.IODIRA, 0xFF)
+	file.SetRegister(iopi.IODIRB, 0x00)
+
+	aliases := iopi.NewAliases()
+	aliases.Set("door", iopi.PinRef{Address: 0x20, Pin: 3})
+	aliases.Set(`pump "1"`, iopi.PinRef{Address: 0x20, Pin: 9})
+	s.SetAliases(aliases)
+	s.RecordDrift(0x20, 2)
+	s.RecordDrift(0x20, 1)
+
+	rec := do(s, "GET", "/metrics", "")
+	if rec.Code != 200 {
+		t.Fatal("unexpected status", rec.Code)
+	}
+	for _, line := range []string{
+		`iopi_pin_state{address="0x20",port="A",pin="3",name="door",direction="input"} 1`,
+		`iopi_pin_state{address="0x20",port="B",pin="9",name="pump \"1\"",direction="output"} 0`,
+		`iopi_config_drift_total{address="0x20"} 3`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, rec.Body.String())
+		}
+	}
+
+	if rec := do(s, "POST", "/metrics", ""); rec.Code != 405 {
+		t.Error("unexpected status", rec.Code)
+	}
+}
@@ -0,0 +1,472 @@
+// Package httpapi exposes IO Pi devices over a JSON REST API.
+//
+// Routes:
+//
+//	GET /devices                        list device addresses
+//	GET /devices/{addr}/pins/{n}        read pin n (1-16)
+//	PUT /devices/{addr}/pins/{n}        write pin n, body: {"state": "high"}
+//	GET /devices/{addr}/ports/{A|B}     read a port
+//	PUT /devices/{addr}/ports/{A|B}     write a port, body: {"state": 255}
+//	GET /pins                           list named pins
+//	GET /pins/{name}                    read a named pin
+//	PUT /pins/{name}                    write a named pin, body: {"state": "high"}
+//	PUT /devices/{addr}/pins/{n}/lock   lock a pin for the client, see Arbiter
+//	DELETE /devices/{addr}/pins/{n}/lock  release the lock of the client
+//	PUT, DELETE /pins/{name}/lock       lock or release a named pin
+//	GET /events?device=0x20&pins=1,2    WebSocket stream of pin events, or
+//	                                    Server-Sent Events with Accept: text/event-stream
+//	GET /metrics                        Prometheus metrics of named pins and drift
+//
+// Pin states are "high" or "low"; 1 and 0 are accepted too. Addresses may
+// be given in decimal or hex (e.g. 32 or 0x20). Pins are
+// named with SetAliases, and their names are included in pin states and
+// events.
+//
+// Clients must authenticate if credentials are set with SetAuth.
+//
+// With an Arbiter, see SetArbiter, clients are told apart by the name they
+// authenticated with. Without credentials set, they are told apart by the
+// X-Client header, or their address. Any client can send the name of
+// another in X-Client, so locks then only protect against cooperating
+// clients. Pin states then tell which client last wrote
+// the pin and which holds its lock, and writes refused by the arbiter are
+// answered with 409 Conflict.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Server is an http.Handler serving the REST API for a set of devices.
+type Server struct {
+	Clock iopi.Clock // for CoAP retransmissions, the real clock if nil
+	// Serve CoAP with credentials set, although CoAP clients are not
+	// authenticated, see ServeCoAP
+	InsecureCoAP bool
+
+	mutex   sync.RWMutex
+	devices map[byte]*iopi.Device
+	pollers []*iopi.Poller
+	aliases *iopi.Aliases
+	arbiter *Arbiter
+	auth    Auth
+	drift   map[byte]uint64 // pins drifted by device, see RecordDrift
+}
+
+type PinState struct {
+	Pin       uint8      `json:"pin"`
+	State     iopi.State `json:"state"`
+	Name      string     `json:"name,omitempty"`
+	ChangedBy string     `json:"changed_by,omitempty"` // client that last wrote the pin
+	LockedBy  string     `json:"locked_by,omitempty"`
+}
+
+type NamedPin struct {
+	Name string `json:"name"`
+	iopi.PinRef
+}
+
+type PortState struct {
+	Port  string `json:"port"`
+	State byte   `json:"state"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Create a new server for the given devices. Devices are identified by
+// their I2C address.
+func NewServer(devices ...*iopi.Device) *Server {
+	s := &Server{devices: make(map[byte]*iopi.Device)}
+	for _, dev := range devices {
+		s.devices[dev.Address] = dev
+	}
+	return s
+}
+
+// Serve a device in addition to those given to NewServer. Replaces any
+// device with the same address.
+func (s *Server) AddDevice(dev *iopi.Device) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.devices[dev.Address] = dev
+}
+
+// Stop serving the device at `addr`, along with the events of its pollers.
+func (s *Server) RemoveDevice(addr byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.devices, addr)
+
+	pollers := s.pollers[:0]
+	for _, p := range s.pollers {
+		if p.Device().Address != addr {
+			pollers = append(pollers, p)
+		}
+	}
+	s.pollers = pollers
+}
+
+// Name pins in the API. Replaces any previous names.
+func (s *Server) SetAliases(a *iopi.Aliases) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.aliases = a
+}
+
+// Arbitrate writes of clients. Pass nil to let all clients write all pins.
+func (s *Server) SetArbiter(a *Arbiter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.arbiter = a
+}
+
+func (s *Server) getArbiter() *Arbiter {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.arbiter
+}
+
+// Write pins of a device for a client, if the arbiter lets it.
+func (s *Server) writePins(dev *iopi.Device, pins []uint8, client string, write func() error) error {
+	a := s.getArbiter()
+	if a == nil {
+		return write()
+	}
+
+	refs := make([]iopi.PinRef, len(pins))
+	for i, pin := range pins {
+		refs[i] = iopi.PinRef{Address: dev.Address, Pin: pin}
+	}
+	return a.write(refs, client, write)
+}
+
+// Read a pin, along with its name and owners.
+func (s *Server) pinState(dev *iopi.Device, pin uint8) (PinState, error) {
+	state, err := dev.ReadPin(pin)
+	if err != nil {
+		return PinState{}, err
+	}
+
+	ref := iopi.PinRef{Address: dev.Address, Pin: pin}
+	res := PinState{Pin: pin, State: state, Name: s.getAliases().Name(ref)}
+	if a := s.getArbiter(); a != nil {
+		o := a.Owner(ref)
+		res.ChangedBy, res.LockedBy = o.ChangedBy, o.LockedBy
+	}
+	return res, nil
+}
+
+// Key of the name of an authenticated client in request contexts
+type clientKey struct{}
+
+// Identify the client of a request by the name it authenticated with, or
+// without authentication by its X-Client header or its address.
+func clientID(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(string); ok {
+		return c
+	}
+	if c := r.Header.Get("X-Client"); c != "" {
+		return c
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) getAliases() *iopi.Aliases {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.aliases
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, ok := s.checkAuth(w, r)
+	if !ok {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(parts) == 1 && parts[0] == "events" {
+		s.handleEvents(w, r)
+		return
+	}
+	if len(parts) == 1 && parts[0] == "metrics" {
+		s.handleMetrics(w, r)
+		return
+	}
+
+	if parts[0] == "pins" {
+		s.handleNamedPin(w, r, parts[1:])
+		return
+	}
+
+	if len(parts) == 0 || parts[0] != "devices" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.listDevices(w)
+		return
+	}
+
+	if len(parts) != 4 && !(len(parts) == 5 && parts[2] == "pins" && parts[4] == "lock") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	dev, err := s.device(parts[1])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	switch parts[2] {
+	case "pins":
+		pin, err := parsePin(parts[3])
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if len(parts) == 5 {
+			s.handleLock(w, r, dev, pin)
+			return
+		}
+		s.handlePin(w, r, dev, pin)
+	case "ports":
+		port, err := parsePort(parts[3])
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.handlePort(w, r, dev, port)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) listDevices(w http.ResponseWriter) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	addrs := make([]string, 0, len(s.devices))
+	for addr := range s.devices {
+		addrs = append(addrs, fmt.Sprintf("0x%02x", addr))
+	}
+	sort.Strings(addrs)
+	writeJSON(w, http.StatusOK, addrs)
+}
+
+func (s *Server) handleNamedPin(w http.ResponseWriter, r *http.Request, parts []string) {
+	aliases := s.getAliases()
+
+	switch len(parts) {
+	case 0:
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		pins := make([]NamedPin, 0)
+		for _, name := range aliases.Names() {
+			ref, _ := aliases.Lookup(name)
+			pins = append(pins, NamedPin{name, ref})
+		}
+		writeJSON(w, http.StatusOK, pins)
+	case 1, 2:
+		if len(parts) == 2 && parts[1] != "lock" {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		ref, ok := aliases.Lookup(parts[0])
+		if !ok {
+			writeError(w, http.StatusNotFound, "no pin named "+parts[0])
+			return
+		}
+		dev, err := s.device(strconv.Itoa(int(ref.Address)))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if len(parts) == 2 {
+			s.handleLock(w, r, dev, ref.Pin)
+			return
+		}
+		s.handlePin(w, r, dev, ref.Pin)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) handlePin(w http.ResponseWriter, r *http.Request, dev *iopi.Device, pin uint8) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body PinState
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+			return
+		}
+		err := s.writePins(dev, []uint8{pin}, clientID(r), func() error {
+			return dev.WritePin(pin, body.State)
+		})
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	res, err := s.pinState(dev, pin)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleLock(w http.ResponseWriter, r *http.Request, dev *iopi.Device, pin uint8) {
+	a := s.getArbiter()
+	if a == nil {
+		writeError(w, http.StatusNotFound, "arbitration disabled")
+		return
+	}
+
+	ref := iopi.PinRef{Address: dev.Address, Pin: pin}
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = a.Lock(ref, clientID(r))
+	case http.MethodDelete:
+		err = a.Unlock(ref, clientID(r))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	res, err := s.pinState(dev, pin)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handlePort(w http.ResponseWriter, r *http.Request, dev *iopi.Device, port iopi.Port) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body PortState
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+			return
+		}
+		pins := iopi.PortPins(port)
+		err := s.writePins(dev, pins, clientID(r), func() error {
+			return dev.WritePort(port, body.State)
+		})
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	state, err := dev.ReadPort(port)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, PortState{Port: portName(port), State: state})
+}
+
+func (s *Server) device(addr string) (*iopi.Device, error) {
+	n, err := strconv.ParseUint(addr, 0, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device address: %s", addr)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dev, ok := s.devices[byte(n)]
+	if !ok {
+		return nil, fmt.Errorf("no device at address: %s", addr)
+	}
+	return dev, nil
+}
+
+func parsePin(s string) (uint8, error) {
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || n < 1 || n > 16 {
+		return 0, fmt.Errorf("invalid pin: %s", s)
+	}
+	return uint8(n), nil
+}
+
+func parsePort(s string) (iopi.Port, error) {
+	switch strings.ToUpper(s) {
+	case "A":
+		return iopi.PortA, nil
+	case "B":
+		return iopi.PortB, nil
+	default:
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+}
+
+func portName(port iopi.Port) string {
+	if port == iopi.PortB {
+		return "B"
+	}
+	return "A"
+}
+
+// Return the status of a failed write: 409 if refused by the arbiter.
+func errorStatus(err error) int {
+	if _, ok := err.(conflictError); ok {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: strings.TrimSpace(msg)})
+}
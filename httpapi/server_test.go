@@ -0,0 +1,179 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func newTestServer() (*Server, *iopi.FakeFile) {
+	file := iopi.NewFakeFile()
+	dev := iopi.NewDevice(file, 0x20, &sync.Mutex{})
+	return NewServer(dev), file
+}
+
+func do(s http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestListDevices(t *testing.T) {
+	s, _ := newTestServer()
+	rec := do(s, "GET", "/devices", "")
+
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `["0x20"]` {
+		t.Error("unexpected response", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPins(t *testing.T) {
+	t.Run("reads a pin", func(t *testing.T) {
+		s, file := newTestServer()
+		file.NextRead = []byte{0b00000100}
+		rec := do(s, "GET", "/devices/0x20/pins/3", "")
+
+		var res PinState
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		if rec.Code != http.StatusOK || res.Pin != 3 || res.State != iopi.High {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("writes a pin", func(t *testing.T) {
+		s, file := newTestServer()
+		file.NextRead = []byte{0x00}
+		rec := do(s, "PUT", "/devices/32/pins/10", `{"state": 1}`)
+
+		if rec.Code != http.StatusOK {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOB), 0b00000010}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("rejects invalid pin", func(t *testing.T) {
+		s, _ := newTestServer()
+		if rec := do(s, "GET", "/devices/0x20/pins/17", ""); rec.Code != http.StatusNotFound {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+
+	t.Run("rejects unknown device", func(t *testing.T) {
+		s, _ := newTestServer()
+		if rec := do(s, "GET", "/devices/0x21/pins/1", ""); rec.Code != http.StatusNotFound {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+
+	t.Run("rejects invalid body", func(t *testing.T) {
+		s, _ := newTestServer()
+		if rec := do(s, "PUT", "/devices/0x20/pins/1", "high"); rec.Code != http.StatusBadRequest {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+}
+
+func TestNamedPins(t *testing.T) {
+	newNamedServer := func() (*Server, *iopi.FakeFile) {
+		s, file := newTestServer()
+		a := iopi.NewAliases()
+		a.Set("conveyor_start", iopi.PinRef{Address: 0x20, Pin: 12})
+		s.SetAliases(a)
+		return s, file
+	}
+
+	t.Run("lists named pins", func(t *testing.T) {
+		s, _ := newNamedServer()
+		rec := do(s, "GET", "/pins", "")
+
+		expected := `[{"name":"conveyor_start","address":32,"pin":12}]`
+		if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != expected {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("writes a named pin", func(t *testing.T) {
+		s, file := newNamedServer()
+		file.NextRead = []byte{0x00}
+		rec := do(s, "PUT", "/pins/conveyor_start", `{"state": 1}`)
+
+		var res PinState
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		if rec.Code != http.StatusOK || res.Pin != 12 || res.Name != "conveyor_start" {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOB), 0b00001000}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("names pins by number", func(t *testing.T) {
+		s, _ := newNamedServer()
+		rec := do(s, "GET", "/devices/0x20/pins/12", "")
+		if !strings.Contains(rec.Body.String(), `"name":"conveyor_start"`) {
+			t.Error("unexpected response", rec.Body.String())
+		}
+	})
+
+	t.Run("rejects unknown name", func(t *testing.T) {
+		s, _ := newNamedServer()
+		if rec := do(s, "GET", "/pins/pump", ""); rec.Code != http.StatusNotFound {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+
+	t.Run("lists no pins without aliases", func(t *testing.T) {
+		s, _ := newTestServer()
+		if rec := do(s, "GET", "/pins", ""); strings.TrimSpace(rec.Body.String()) != "[]" {
+			t.Error("unexpected response", rec.Body.String())
+		}
+	})
+}
+
+func TestPorts(t *testing.T) {
+	t.Run("writes a port", func(t *testing.T) {
+		s, file := newTestServer()
+		rec := do(s, "PUT", "/devices/0x20/ports/a", `{"state": 255}`)
+
+		if rec.Code != http.StatusOK {
+			t.Error("unexpected response", rec.Code, rec.Body.String())
+		}
+		if !file.HasCall("Write", []byte{byte(iopi.GPIOA), 0xFF}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("rejects unsupported method", func(t *testing.T) {
+		s, _ := newTestServer()
+		if rec := do(s, "DELETE", "/devices/0x20/ports/B", ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+}
+
+func TestAddRemoveDevice(t *testing.T) {
+	s, _ := newTestServer()
+	dev := iopi.NewDevice(iopi.NewFakeFile(), 0x21, &sync.Mutex{})
+	s.AddDevice(dev)
+	s.AddPoller(iopi.NewPoller(dev, 0))
+
+	if rec := do(s, "GET", "/devices/0x21/pins/1", ""); rec.Code != http.StatusOK {
+		t.Error("added device not served", rec.Code)
+	}
+
+	s.RemoveDevice(0x21)
+	if rec := do(s, "GET", "/devices/0x21/pins/1", ""); rec.Code != http.StatusNotFound {
+		t.Error("removed device still served", rec.Code)
+	}
+	if len(s.pollers) != 0 {
+		t.Error("poller of removed device kept")
+	}
+}
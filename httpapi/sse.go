@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Interval of comments sent to idle event streams, keeping proxies from
+// closing them and noticing clients that went away.
+var keepaliveInterval = 30 * time.Second
+
+func isEventStream(r *http.Request) bool {
+	return r.Method == http.MethodGet && headerContains(r.Header, "Accept", "text/event-stream")
+}
+
+// Stream events as Server-Sent Events, one JSON encoded PinEvent per
+// message, until the client goes away.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, f eventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	events, cancel := s.subscribe(f)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case ev := <-events:
+			buf := encodeEvent(s.getAliases().Annotate(ev))
+			buf.WriteString("\n\n")
+			io.WriteString(w, "data: ")
+			_, err := w.Write(buf.Bytes())
+			eventBuffers.Put(buf)
+			if err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+func TestEventStream(t *testing.T) {
+	s, file := newTestServer()
+	poller := iopi.NewPoller(s.devices[0x20], 0)
+	s.AddPoller(poller)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	t.Run("streams filtered events", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", ts.URL+"/events?pins=2", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatal("unexpected response", resp.Status, resp.Header)
+		}
+
+		// Wait for the handler to subscribe
+		time.Sleep(50 * time.Millisecond)
+
+		file.NextRead = []byte{0x00}
+		poller.Poll()
+		file.NextRead = []byte{0b00000011}
+		poller.Poll()
+
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			t.Fatal("expected data line", line)
+		}
+		var ev iopi.PinEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Pin != 2 || ev.State != iopi.High {
+			t.Error("unexpected event", ev)
+		}
+	})
+
+	t.Run("rejects invalid filters", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/events?device=nope", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Error("unexpected status", rec.Code)
+		}
+	})
+}
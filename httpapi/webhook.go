@@ -0,0 +1,246 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// Webhook is an HTTP request sent on pin events, for services that cannot
+// subscribe to the event stream. The URL and body are templates executed
+// with the iopi.PinEvent, e.g.
+//
+//	url: https://example.com/hooks/{{.Name}}?state={{.State}}
+//	body: '{"text": "{{.Name}} is {{.State}}"}'
+//
+// where State formats as High or Low. The body is the event as JSON if
+// empty.
+type Webhook struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method,omitempty"` // POST if empty
+	Body    string            `yaml:"body,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Events sent, all if empty
+	Address byte      `yaml:"address,omitempty"` // I2C address of the device
+	Pins    []uint8   `yaml:"pins,omitempty"`
+	Names   []string  `yaml:"names,omitempty"` // pin names, see iopi.Aliases
+	Edge    iopi.Edge `yaml:"edge,omitempty"`  // rising, falling or both (default)
+
+	Retries int `yaml:"retries,omitempty"` // attempts after the first fails
+
+	url, body *template.Template
+}
+
+// Return true if an event is sent by the webhook.
+func (h *Webhook) match(ev iopi.PinEvent) bool {
+	if h.Address != 0 && h.Address != ev.Address {
+		return false
+	}
+	switch h.Edge {
+	case iopi.EdgeRising:
+		if ev.State == iopi.Low {
+			return false
+		}
+	case iopi.EdgeFalling:
+		if ev.State != iopi.Low {
+			return false
+		}
+	}
+	if len(h.Pins) == 0 && len(h.Names) == 0 {
+		return true
+	}
+	for _, pin := range h.Pins {
+		if pin == ev.Pin {
+			return true
+		}
+	}
+	for _, name := range h.Names {
+		if name == ev.Name && name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// A delivery that failed all attempts, as written to the dead-letter log
+type DeadLetter struct {
+	Time     time.Time     `json:"time"`
+	URL      string        `json:"url"`
+	Event    iopi.PinEvent `json:"event"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error"`
+}
+
+// Webhooks sends pin events to webhooks.
+type Webhooks struct {
+	Client  *http.Client  // http.DefaultClient if nil
+	Backoff time.Duration // before the first retry, doubled for each next
+	Clock   iopi.Clock
+
+	// Failed deliveries are written here as lines of JSON, see DeadLetter
+	DeadLetters io.Writer
+
+	hooks   []*Webhook
+	mutex   sync.Mutex
+	aliases *iopi.Aliases
+	wg      sync.WaitGroup
+}
+
+// Parse the templates of webhooks. Returns an error if a template or edge
+// is invalid.
+func NewWebhooks(hooks ...Webhook) (*Webhooks, error) {
+	w := &Webhooks{Backoff: time.Second}
+	for i := range hooks {
+		h := hooks[i]
+		switch h.Edge {
+		case "", iopi.EdgeRising, iopi.EdgeFalling, iopi.EdgeBoth:
+		default:
+			return nil, fmt.Errorf("webhook %s: invalid edge: %s", h.URL, h.Edge)
+		}
+
+		var err error
+		if h.url, err = template.New("url").Parse(h.URL); err != nil {
+			return nil, fmt.Errorf("webhook %s: invalid url: %s", h.URL, err)
+		}
+		if h.Body != "" {
+			if h.body, err = template.New("body").Parse(h.Body); err != nil {
+				return nil, fmt.Errorf("webhook %s: invalid body: %s", h.URL, err)
+			}
+		}
+		w.hooks = append(w.hooks, &h)
+	}
+	return w, nil
+}
+
+// Name the pins of events, for matching webhooks by name and templates.
+func (w *Webhooks) SetAliases(a *iopi.Aliases) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.aliases = a
+}
+
+// Send events to webhooks until the channel is closed or the context is
+// cancelled, then wait for deliveries in progress.
+func (w *Webhooks) Run(ctx context.Context, events <-chan iopi.PinEvent) {
+	defer w.wg.Wait()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			w.Fire(ctx, ev)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Send an event to the webhooks matching it, in the background.
+func (w *Webhooks) Fire(ctx context.Context, ev iopi.PinEvent) {
+	w.mutex.Lock()
+	ev = w.aliases.Annotate(ev)
+	w.mutex.Unlock()
+
+	for _, h := range w.hooks {
+		if !h.match(ev) {
+			continue
+		}
+		w.wg.Add(1)
+		go func(h *Webhook) {
+			defer w.wg.Done()
+			w.deliver(ctx, h, ev)
+		}(h)
+	}
+}
+
+// Send an event to a webhook, retrying until it succeeds or all attempts
+// fail, which is logged as a dead letter.
+func (w *Webhooks) deliver(ctx context.Context, h *Webhook, ev iopi.PinEvent) {
+	var url bytes.Buffer
+	err := h.url.Execute(&url, ev)
+
+	backoff := w.Backoff
+	attempts := 0
+	for err == nil {
+		attempts++
+		if err = w.send(ctx, h, url.String(), ev); err == nil {
+			return
+		}
+		if attempts > h.Retries {
+			break
+		}
+		if err = iopi.SleepContext(ctx, w.Clock, backoff); err != nil {
+			break
+		}
+		backoff *= 2
+	}
+
+	if w.DeadLetters == nil {
+		return
+	}
+	letter := DeadLetter{
+		Time:     iopi.ClockOr(w.Clock).Now(),
+		URL:      url.String(),
+		Event:    ev,
+		Attempts: attempts,
+		Error:    err.Error(),
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	json.NewEncoder(w.DeadLetters).Encode(letter)
+}
+
+// Make one request to a webhook.
+func (w *Webhooks) send(ctx context.Context, h *Webhook, url string, ev iopi.PinEvent) error {
+	var body bytes.Buffer
+	contentType := "application/json"
+	if h.body != nil {
+		if err := h.body.Execute(&body, ev); err != nil {
+			return err
+		}
+		contentType = "text/plain"
+	} else {
+		json.NewEncoder(&body).Encode(ev)
+	}
+
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// A webhook receiver recording requests, answering with the given status
+// codes in turn, then 200 OK.
+type receiver struct {
+	mutex    sync.Mutex
+	requests []string // method, path and body of each request
+	codes    []int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+	if len(rc.codes) > 0 {
+		w.WriteHeader(rc.codes[0])
+		rc.codes = rc.codes[1:]
+	}
+}
+
+// Fire events at webhooks and wait for their delivery.
+func fire(w *Webhooks, events ...iopi.PinEvent) {
+	ch := make(chan iopi.PinEvent, len(events))
+	for _, ev := range events {
+		ch <- ev
+	}
+	close(ch)
+	w.Run(context.Background(), ch)
+}
+
+func TestWebhooks(t *testing.T) {
+	rising := iopi.PinEvent{Address: 0x20, Pin: 3, State: iopi.High}
+	falling := iopi.PinEvent{Address: 0x20, Pin: 3, State: iopi.Low}
+
+	t.Run("templates url and body", func(t *testing.T) {
+		rc := &receiver{}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		w, err := NewWebhooks(Webhook{
+			URL:    srv.URL + "/hooks/{{.Name}}?state={{.State}}",
+			Method: "PUT",
+			Body:   "{{.Name}} is {{.State}}",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		aliases := iopi.NewAliases()
+		aliases.Set("door", iopi.PinRef{Address: 0x20, Pin: 3})
+		w.SetAliases(aliases)
+
+		fire(w, rising)
+		if len(rc.requests) != 1 || rc.requests[0] != "PUT /hooks/door?state=High door is High" {
+			t.Error("unexpected requests", rc.requests)
+		}
+	})
+
+	t.Run("sends events as json by default", func(t *testing.T) {
+		rc := &receiver{}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		w, _ := NewWebhooks(Webhook{URL: srv.URL})
+		fire(w, rising)
+
+		var want bytes.Buffer
+		json.NewEncoder(&want).Encode(rising)
+		if len(rc.requests) != 1 || rc.requests[0] != "POST / "+want.String() {
+			t.Error("unexpected requests", rc.requests)
+		}
+	})
+
+	t.Run("filters events", func(t *testing.T) {
+		rc := &receiver{}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		w, _ := NewWebhooks(
+			Webhook{URL: srv.URL + "/rising", Edge: iopi.EdgeRising, Body: "-"},
+			Webhook{URL: srv.URL + "/falling", Edge: iopi.EdgeFalling, Body: "-"},
+			Webhook{URL: srv.URL + "/other-pin", Pins: []uint8{4}, Body: "-"},
+			Webhook{URL: srv.URL + "/other-device", Address: 0x21, Body: "-"},
+		)
+		fire(w, falling)
+		if len(rc.requests) != 1 || rc.requests[0] != "POST /falling -" {
+			t.Error("unexpected requests", rc.requests)
+		}
+	})
+
+	t.Run("retries and writes dead letters", func(t *testing.T) {
+		ok := &receiver{codes: []int{500, 502}}
+		okSrv := httptest.NewServer(ok)
+		defer okSrv.Close()
+		failing := &receiver{codes: []int{500, 503}}
+		srv := httptest.NewServer(failing)
+		defer srv.Close()
+
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		clock.AutoAdvance(true)
+		var dead bytes.Buffer
+		w, _ := NewWebhooks(
+			Webhook{URL: okSrv.URL + "/ok", Retries: 2, Body: "-"},
+			Webhook{URL: srv.URL + "/dead", Retries: 1, Body: "-"},
+		)
+		w.Clock = clock
+		w.DeadLetters = &dead
+
+		fire(w, rising)
+		if len(ok.requests) != 3 || len(failing.requests) != 2 {
+			t.Error("unexpected requests", ok.requests, failing.requests)
+		}
+
+		var letter DeadLetter
+		if err := json.Unmarshal(dead.Bytes(), &letter); err != nil {
+			t.Fatal("expected one dead letter", dead.String(), err)
+		}
+		if letter.URL != srv.URL+"/dead" || letter.Attempts != 2 || letter.Event.Pin != 3 {
+			t.Error("unexpected dead letter", dead.String())
+		}
+	})
+
+	t.Run("rejects invalid webhooks", func(t *testing.T) {
+		for _, h := range []Webhook{
+			{URL: "http://example.com/{{.Name"},
+			{URL: "http://example.com/", Body: "{{end}}"},
+			{URL: "http://example.com/", Edge: "sideways"},
+		} {
+			if _, err := NewWebhooks(h); err == nil {
+				t.Error("expected error for", h)
+			}
+		}
+	})
+}
@@ -3,31 +3,47 @@ package iopi
 import (
 	"fmt"
 	"io"
-	"os"
 	"sync"
+	"time"
 
-	"golang.org/x/sys/unix"
+	"github.com/stigok/go-io-pi/bus"
+	"github.com/stigok/go-io-pi/chip/mcp23017"
 )
 
+// A register of the MCP23017, see mcp23017.Register
+type Register = mcp23017.Register
+
 type Port uint8
 type Mode byte
 type Polarity byte
 type State uint8
 
 const (
-	// As defined in the C implementation
-	IODIRA = 0x00
-	IODIRB = 0x01
-	IPOLA  = 0x02
-	IPOLB  = 0x03
-	IOCON  = 0x0A
-	GPPUA  = 0x0C
-	GPPUB  = 0x0D
-	GPIOA  = 0x12
-	GPIOB  = 0x13
+	// Registers of the MCP23017, see package mcp23017
+	IODIRA   = mcp23017.IODIRA
+	IODIRB   = mcp23017.IODIRB
+	IPOLA    = mcp23017.IPOLA
+	IPOLB    = mcp23017.IPOLB
+	GPINTENA = mcp23017.GPINTENA
+	GPINTENB = mcp23017.GPINTENB
+	DEFVALA  = mcp23017.DEFVALA
+	DEFVALB  = mcp23017.DEFVALB
+	INTCONA  = mcp23017.INTCONA
+	INTCONB  = mcp23017.INTCONB
+	IOCON    = mcp23017.IOCON
+	GPPUA    = mcp23017.GPPUA
+	GPPUB    = mcp23017.GPPUB
+	INTFA    = mcp23017.INTFA
+	INTFB    = mcp23017.INTFB
+	INTCAPA  = mcp23017.INTCAPA
+	INTCAPB  = mcp23017.INTCAPB
+	GPIOA    = mcp23017.GPIOA
+	GPIOB    = mcp23017.GPIOB
+	OLATA    = mcp23017.OLATA
+	OLATB    = mcp23017.OLATB
 
 	// As defined in /usr/include/linux/i2c-dev.h
-	I2C_SLAVE = 0x0703
+	I2C_SLAVE = bus.I2C_SLAVE
 )
 
 const (
@@ -38,131 +54,369 @@ const (
 
 const (
 	PolarityNormal   Polarity = 0x00
-	PolarityInverted          = 0xFF
+	PolarityInverted Polarity = 0xFF
 )
 
 const (
 	Output Mode = 0x00
-	Input       = 0xFF
+	Input  Mode = 0xFF
 )
 
 const (
 	Low  State = 0x00
-	High       = 0xFF
+	High State = 0xFF
 )
 
 const (
 	PullupDisabled Mode = 0x00
-	PullupEnabled       = 0xFF
+	PullupEnabled  Mode = 0xFF
 )
 
+func (p Port) String() string {
+	switch p {
+	case PortA:
+		return "PortA"
+	case PortB:
+		return "PortB"
+	default:
+		return fmt.Sprintf("Port(%d)", uint8(p))
+	}
+}
+
+// Return "Input" or "Output" for a whole port, or the bits of a mixed
+// port. Pull-up modes share the values, so PullupEnabled is "Input".
+func (m Mode) String() string {
+	switch m {
+	case Input:
+		return "Input"
+	case Output:
+		return "Output"
+	default:
+		return fmt.Sprintf("Mode(0b%08b)", byte(m))
+	}
+}
+
+func (p Polarity) String() string {
+	switch p {
+	case PolarityNormal:
+		return "Normal"
+	case PolarityInverted:
+		return "Inverted"
+	default:
+		return fmt.Sprintf("Polarity(0b%08b)", byte(p))
+	}
+}
+
+// Return "Low", or "High" for any other value, as pins read as 1 and are
+// written as High.
+func (s State) String() string {
+	if s == Low {
+		return "Low"
+	}
+	return "High"
+}
+
+// Return false for Low and true for any other value. Prefer this, or
+// Equal, to comparing with High, as pins read as 1 rather than High.
+func (s State) Bool() bool {
+	return s != Low
+}
+
+// Return true if both states are low or both are high, e.g. a pin read as
+// 1 and High.
+func (s State) Equal(other State) bool {
+	return s.Bool() == other.Bool()
+}
+
+// Return High for true and Low for false.
+func StateOf(high bool) State {
+	if high {
+		return High
+	}
+	return Low
+}
+
 type Device struct {
-	Address byte   // I2C device address
-	Path    string // e.g. /dev/i2c-1
-	bus     ReadWriteCloserSpecial
-	mutex   *sync.Mutex // enables sharing a file descriptor with other devices
+	Address   byte      // I2C device address
+	Path      string    // e.g. /dev/i2c-1
+	Numbering Numbering // of pin labels, see ParsePin and PinLabel
+	Clock     Clock     // of MeasureFrequency, the real clock if nil
+	bus       io.ReadWriteCloser
+	mutex     *sync.Mutex // enables sharing a file descriptor with other devices
+	journal   *Journal
+	store     *OutputStore
+	activeLow uint32  // bit per pin, see SetActiveLow
+	buf       [8]byte // of register transfers, guarded by mutex
+
+	// Shadow of IODIR, IPOL and GPPU, guarded by mutex. A register is
+	// cached once read or written, so per-pin setters write without
+	// reading first. Only writes through the device are seen.
+	config       [GPPUB + 1]byte
+	configCached uint16 // bit per register in config
+	advisory     bool   // see SetCacheAdvisory
+	onDrift      func(Difference)
+
+	// Pins of port A in bits 0-7 and B in 8-15, bits 16 and 17 set once
+	// the port is known. Accessed atomically, written with mutex held.
+	lastKnown uint32
+	retries   int // of short transfers, see SetRetries
+	sequencer *Sequencer
 }
 
+// Deprecated: NewDevice takes any io.ReadWriteCloser.
 type ReadWriteCloserSpecial interface {
 	io.ReadWriteCloser
 	Fd() uintptr
 	Name() string
 }
 
-// Create a new device object.
-// `bus` can be a string path to a file, or a pointer to a File so multiple
-// devices can share the same file descriptor. (e.g. two i2c addresses on same i2c bus)
-func NewDevice(file ReadWriteCloserSpecial, addr byte, mutex *sync.Mutex) *Device {
+// Returned when opening an i2c bus on a platform other than Linux
+var ErrUnsupportedPlatform = bus.ErrUnsupportedPlatform
+
+// Create a new device object on an open bus, e.g. a file returned by
+// bus.Open or a fake such as iopitest.Chip. Devices sharing the file must
+// share the mutex too. (e.g. two i2c addresses on same i2c bus)
+// Path is set from the Name method of the file, if it has one.
+// The address is validated by Init and InitLayout, see ValidateAddress.
+func NewDevice(file io.ReadWriteCloser, addr byte, mutex *sync.Mutex) *Device {
 	dev := Device{
 		Address: addr,
-		Path:    file.Name(),
 		bus:     file,
 		mutex:   mutex,
 	}
+	if named, ok := file.(interface{ Name() string }); ok {
+		dev.Path = named.Name()
+	}
 
 	return &dev
 }
 
-// Initialise device. This must be called once per device. You are expected
-// to call `.Close()` to clean up resources when you're done.
+// Initialise device. This must be called once per device. All pins are
+// reset to inputs; use InitLayout to start with some pins as outputs.
+// You are expected to call `.Close()` to clean up resources when you're done.
 func (dev *Device) Init() error {
-	file, err := os.OpenFile(dev.Path, os.O_RDWR, os.ModeCharDevice)
-	if err != nil {
-		return fmt.Errorf("failed to open i2c device at '%s': %s", dev.Path, err)
+	return dev.InitLayout(Layout{})
+}
+
+// Open the i2c bus at `path` and select the device at `addr`, without
+// touching the configuration of the chip. Unlike `Init`, pins keep their
+// current mode and state, which is what tools inspecting a running board
+// want. You are expected to call `.Close()` when you're done.
+func Open(path string, addr byte) (*Device, error) {
+	if err := ValidateAddress(addr); err != nil {
+		return nil, err
 	}
-	dev.bus = file
 
-	// Initialise the I2C bus
-	err = unix.IoctlSetInt(int(dev.bus.Fd()), I2C_SLAVE, int(dev.Address))
-	if err != nil {
-		return fmt.Errorf("failed to write to i2c device at address '%02b': %s",
-			dev.Address, err)
+	dev := &Device{
+		Address: addr,
+		Path:    path,
+		mutex:   &sync.Mutex{},
 	}
 
-	dev.driverInit()
+	if err := dev.open(); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return dev, nil
 }
 
-func (dev *Device) driverInit() {
-	// Board initialisation
-	// TODO: Handle errors
-	dev.WriteByteData(IOCON, 0x22) // MCP23017 specific
-	dev.SetPortMode(PortA, Input)
-	dev.SetPortMode(PortB, Input)
-	dev.SetPortPullup(PortA, PullupDisabled)
-	dev.SetPortPullup(PortB, PullupDisabled)
-	dev.SetPortPolarity(PortA, PolarityNormal)
-	dev.SetPortPolarity(PortB, PolarityNormal)
+func (dev *Device) open() error {
+	file, err := bus.Open(dev.Path, dev.Address)
+	if err != nil {
+		return err
+	}
+	dev.bus = file
+	return nil
 }
 
 // Clean up resources.
 func (dev *Device) Close() error {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+
 	return dev.bus.Close()
 }
 
 // Read raw data from a register.
 // This is a low-level interface. You probably want to use the higher level
 // functions to manipulate the board.
-func (dev *Device) ReadByteData(reg byte) (byte, error) {
-	buf := make([]byte, 1)
-	buf[0] = reg
+func (dev *Device) ReadByteData(reg Register) (byte, error) {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+	return dev.readByte(reg)
+}
+
+// Read a register, with the device mutex held.
+func (dev *Device) readByte(reg Register) (byte, error) {
+	buf := dev.buf[:1]
+	if err := dev.readInto(reg, buf); err != nil {
+		return 0x0, err
+	}
+	dev.compare(reg, buf[0])
+	dev.cache(reg, buf[0])
+	return buf[0], nil
+}
+
+// Read consecutive registers starting at `reg` in one transfer, relying on
+// the address pointer of the chip advancing after each byte. Init sets
+// IOCON.SEQOP, which makes the pointer toggle between the A and B
+// registers of a pair instead, so only a pair is read in one transfer
+// after Init, e.g. GPIOA and GPIOB. Fills `buf`.
+// This is a low-level interface. You probably want to use the higher level
+// functions to manipulate the board.
+func (dev *Device) ReadBlockData(reg Register, buf []byte) error {
+	if len(buf) <= len(dev.buf) {
+		return dev.readBlock(reg, buf)
+	}
+
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+	return dev.readInto(reg, buf)
+}
 
+// Read a few consecutive registers through the transfer buffer, so `buf`
+// can live on the stack of the caller.
+func (dev *Device) readBlock(reg Register, buf []byte) error {
 	dev.mutex.Lock()
 	defer dev.mutex.Unlock()
 
-	n, err := dev.bus.Write(buf)
-	if err != nil {
-		return 0x0, fmt.Errorf("failed to write to slave before read (wrote %v bytes): %s\n", n, err)
+	if err := dev.readInto(reg, dev.buf[:len(buf)]); err != nil {
+		return err
 	}
+	copy(buf, dev.buf[:len(buf)])
+	return nil
+}
 
-	n, err = dev.bus.Read(buf)
-	if err != nil {
-		return 0x0, fmt.Errorf("failed to read from slave: %s\n", err)
+// Read consecutive registers into `buf`, which may be the transfer
+// buffer, with the device mutex held. Short transfers are retried, see
+// SetRetries.
+func (dev *Device) readInto(reg Register, buf []byte) error {
+	addr := dev.buf[:1]
+	for attempt := 0; ; attempt++ {
+		addr[0] = byte(reg)
+		n, err := dev.bus.Write(addr)
+		if err != nil {
+			return dev.error("read", reg, fmt.Errorf("failed to select register (wrote %v bytes): %w", n, err))
+		}
+		if n == len(addr) {
+			if n, err = dev.bus.Read(buf); err != nil {
+				return dev.error("read", reg, err)
+			}
+			if n == len(buf) {
+				break
+			}
+			if attempt >= dev.retries {
+				return dev.error("read", reg, &ShortTransferError{Op: "read", Register: reg, N: n, Expected: len(buf)})
+			}
+		} else if attempt >= dev.retries {
+			return dev.error("read", reg, &ShortTransferError{Op: "write", Register: reg, N: n, Expected: len(addr)})
+		}
 	}
-	//fmt.Printf("read 0x%X (%v bytes) <- 0x%X\n", buf, n, reg)
 
-	return buf[0], nil
+	for i, value := range buf {
+		dev.remember(reg+Register(i), value, false)
+	}
+	return nil
 }
 
 // Write raw data to a register.
 // This is a low-level interface. You probably want to use the higher level
 // functions to manipulate the board.
-func (dev *Device) WriteByteData(reg byte, value byte) error {
-	buf := []byte{reg, value}
-
+func (dev *Device) WriteByteData(reg Register, value byte) error {
 	//fmt.Printf("write 0x%08b to addr 0x%08b\n", value, reg)
 	dev.mutex.Lock()
 	defer dev.mutex.Unlock()
+	return dev.writeByte(reg, value)
+}
 
-	n, err := dev.bus.Write(buf)
-	if err != nil {
-		return fmt.Errorf("failed to write to slave (wrote %v bytes): %s\n", n, err)
+// Write a register, with the device mutex held.
+func (dev *Device) writeByte(reg Register, value byte) error {
+	buf := dev.buf[:2]
+	for attempt := 0; ; attempt++ {
+		buf[0], buf[1] = byte(reg), value
+		n, err := dev.bus.Write(buf)
+		if err != nil {
+			return dev.error("write", reg, err)
+		}
+		if n == len(buf) {
+			break
+		}
+		if attempt >= dev.retries {
+			return dev.error("write", reg, &ShortTransferError{Op: "write", Register: reg, N: n, Expected: len(buf)})
+		}
 	}
+	dev.cache(reg, value)
+	dev.remember(reg, value, true)
 
 	return nil
 }
 
+// Return true for the configuration registers kept in the shadow.
+func shadowed(reg Register) bool {
+	switch reg {
+	case IODIRA, IODIRB, IPOLA, IPOLB, GPPUA, GPPUB:
+		return true
+	}
+	return false
+}
+
+// Record the value of a register in the shadow, with the device mutex
+// held.
+func (dev *Device) cache(reg Register, value byte) {
+	if shadowed(reg) {
+		dev.config[reg] = value
+		dev.configCached |= 1 << reg
+	}
+}
+
+// Report a value read from a register that differs from its shadow to
+// the drift handler, with the device mutex held.
+func (dev *Device) compare(reg Register, value byte) {
+	if !shadowed(reg) || dev.configCached&(1<<reg) == 0 || dev.onDrift == nil {
+		return
+	}
+	if dev.config[reg] != value {
+		dev.onDrift(Difference{Register: reg.String(), A: dev.config[reg], B: value})
+	}
+}
+
+// Treat the shadow of the configuration registers as advisory, for chips
+// that another controller writes too. Setters then read a register before
+// each write, and values read that differ from the shadow are reported to
+// the drift handler, see SetDriftHandler.
+func (dev *Device) SetCacheAdvisory(advisory bool) {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+	dev.advisory = advisory
+}
+
+// Call `fn` when a configuration register is read with a value other than
+// the last one read or written by the device, e.g. after another
+// controller changed it. The difference holds the shadowed value in A and
+// the value read in B. `fn` is called with the device locked, so it must
+// not use the device. Pass nil to stop reporting.
+func (dev *Device) SetDriftHandler(fn func(Difference)) {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+	dev.onDrift = fn
+}
+
+// Replace the bits selected by `mask` in a register with those of
+// `value`, reading the register from the shadow if it is cached.
+func (dev *Device) modifyRegister(reg Register, mask, value byte) error {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+
+	old := dev.config[reg]
+	if !shadowed(reg) || dev.configCached&(1<<reg) == 0 || dev.advisory {
+		var err error
+		if old, err = dev.readByte(reg); err != nil {
+			return err
+		}
+	}
+	return dev.writeByte(reg, old&^mask|value&mask)
+}
+
 // Collectively enable 100K pull-up resistors on all pins on a port.
 func (dev *Device) SetPortPullup(port Port, state Mode) error {
 	switch port {
@@ -179,21 +433,11 @@ func (dev *Device) SetPortPullup(port Port, state Mode) error {
 func (dev *Device) SetPinPullup(pin uint8, enabledState Mode) error {
 	pin, port := GetPinPort(pin)
 
-	var reg byte
-	if port == PortA {
-		reg = GPPUA
-	} else {
-		reg = GPPUB
+	reg := GPPUA + Register(port)
+	if err := dev.modifyRegister(reg, 1<<pin, SetBit(0, pin, int(enabledState))); err != nil {
+		return fmt.Errorf("failed to set pin pullup: %w", err)
 	}
-
-	state, err := dev.ReadByteData(reg)
-	if err != nil {
-		return fmt.Errorf("failed to set pin pullup: %s", err)
-	}
-
-	state = SetBit(state, pin, int(enabledState))
-
-	return dev.SetPortPullup(port, Mode(state))
+	return nil
 }
 
 // Collectively set the polarity of all pins on a port.
@@ -213,19 +457,11 @@ func (dev *Device) SetPortPolarity(port Port, pol Polarity) error {
 func (dev *Device) SetPinPolarity(pin uint8, pol Polarity) error {
 	pin, port := GetPinPort(pin)
 
-	var reg byte
-	if port == PortA {
-		reg = IPOLA
-	} else {
-		reg = IPOLB
-	}
-
-	state, err := dev.ReadByteData(reg)
-	if err != nil {
-		return fmt.Errorf("failed to set pin polarity: %s", err)
+	reg := IPOLA + Register(port)
+	if err := dev.modifyRegister(reg, 1<<pin, SetBit(0, pin, int(pol))); err != nil {
+		return fmt.Errorf("failed to set pin polarity: %w", err)
 	}
-
-	return dev.WriteByteData(reg, SetBit(state, pin, int(pol)))
+	return nil
 }
 
 // Collectively set all pins on a port to specific mode.
@@ -244,31 +480,99 @@ func (dev *Device) SetPortMode(port Port, mode Mode) error {
 func (dev *Device) SetPinMode(pin uint8, mode Mode) error {
 	pin, port := GetPinPort(pin)
 
-	var reg byte
-	if port == PortA {
-		reg = IODIRA
-	} else {
-		reg = IODIRB
+	reg := IODIRA + Register(port)
+	if err := dev.modifyRegister(reg, 1<<pin, SetBit(0, pin, int(mode))); err != nil {
+		return fmt.Errorf("failed to set pin direction: %w", err)
 	}
+	return nil
+}
 
-	state, err := dev.ReadByteData(reg)
-	if err != nil {
-		return fmt.Errorf("failed to set pin direction: %s", err)
+// Set the direction of the pins of a port selected by `mask`, e.g. 0x0F
+// for the first four pins, in one read-modify-write. Other pins keep
+// their mode.
+func (dev *Device) SetPinsMode(port Port, mask byte, mode Mode) error {
+	if err := dev.modifyPort(IODIRA, port, mask, byte(mode)); err != nil {
+		return fmt.Errorf("failed to set pin direction: %w", err)
 	}
+	return nil
+}
+
+// Enable or disable the pull-ups of the pins of a port selected by
+// `mask`, in one read-modify-write.
+func (dev *Device) SetPinsPullup(port Port, mask byte, state Mode) error {
+	if err := dev.modifyPort(GPPUA, port, mask, byte(state)); err != nil {
+		return fmt.Errorf("failed to set pin pullup: %w", err)
+	}
+	return nil
+}
 
-	return dev.WriteByteData(reg, SetBit(state, pin, int(mode)))
+// Set the polarity of the pins of a port selected by `mask`, in one
+// read-modify-write.
+func (dev *Device) SetPinsPolarity(port Port, mask byte, pol Polarity) error {
+	if err := dev.modifyPort(IPOLA, port, mask, byte(pol)); err != nil {
+		return fmt.Errorf("failed to set pin polarity: %w", err)
+	}
+	return nil
+}
+
+// Replace the bits selected by `mask` in the register of `port` in the
+// pair starting at `regA` with those of `value`.
+func (dev *Device) modifyPort(regA Register, port Port, mask, value byte) error {
+	if port != PortA && port != PortB {
+		return fmt.Errorf("invalid port: %v", port)
+	}
+	return dev.modifyRegister(regA+Register(port), mask, value)
+}
+
+// Record pin state changes in a journal. Pass nil to stop recording.
+func (dev *Device) SetJournal(j *Journal) {
+	dev.journal = j
+}
+
+// Return the recorded state changes of a pin since a point in time.
+// Returns nil if no journal is attached to the device.
+func (dev *Device) History(pin uint8, since time.Time) []JournalEntry {
+	if dev.journal == nil {
+		return nil
+	}
+	return dev.journal.History(pin, since)
 }
 
 // Collectively set all pins on the port to a specific state.
 func (dev *Device) WritePort(port Port, state byte) error {
+	return dev.writePort(port, state, 0xFF, "WritePort")
+}
+
+// Write a port and journal the pins selected by `mask`.
+func (dev *Device) writePort(port Port, state byte, mask byte, source string) error {
+	var err error
 	switch port {
 	case PortA:
-		return dev.WriteByteData(GPIOA, state)
+		err = dev.WriteByteData(GPIOA, state)
 	case PortB:
-		return dev.WriteByteData(GPIOB, state)
+		err = dev.WriteByteData(GPIOB, state)
 	default:
 		return fmt.Errorf("invalid port: %v\n", port)
 	}
+	if err != nil {
+		return err
+	}
+	return dev.recordPort(port, state, mask, source)
+}
+
+// Save and journal a port state written.
+func (dev *Device) recordPort(port Port, state byte, mask byte, source string) error {
+	if dev.store != nil {
+		if err := dev.saveOutputs(port, state); err != nil {
+			return err
+		}
+	}
+
+	if dev.journal != nil {
+		return dev.journal.recordPort(port, state, mask, source)
+	}
+
+	return nil
 }
 
 // Return a byte describing the state of all pins on the selected port.
@@ -284,16 +588,98 @@ func (dev *Device) ReadPort(port Port) (byte, error) {
 	}
 }
 
-// Set single pin to a specific state.
+// Return the interrupt flags and the state of both ports, with the device
+// mutex held throughout, so the flags are not cleared by another read of
+// GPIO in between.
+func (dev *Device) readFlagsAndPorts() (flags, state [2]byte, err error) {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+
+	if err := dev.readInto(INTFA, dev.buf[:2]); err != nil {
+		return flags, state, err
+	}
+	copy(flags[:], dev.buf[:2])
+	if err := dev.readInto(GPIOA, dev.buf[:2]); err != nil {
+		return flags, state, err
+	}
+	copy(state[:], dev.buf[:2])
+	return flags, state, nil
+}
+
+// Return the state of all pins on both ports, read in one transfer.
+func (dev *Device) ReadPorts() ([2]byte, error) {
+	var state [2]byte
+	err := dev.readBlock(GPIOA, state[:])
+	return state, err
+}
+
+// Return the output latches of a port. Writes of single pins modify the
+// latches rather than GPIO, which reads the level of input pins and would
+// copy it to their latches.
+func (dev *Device) readLatch(port Port) (byte, error) {
+	switch port {
+	case PortA:
+		return dev.ReadByteData(OLATA)
+	case PortB:
+		return dev.ReadByteData(OLATB)
+	default:
+		return 0x00, fmt.Errorf("invalid port: %v\n", port)
+	}
+}
+
+// Set single pin to a specific state. Writes of pins with relay timing
+// may be deferred, see SetSequencer.
 func (dev *Device) WritePin(pin uint8, state State) error {
+	if seq := dev.sequencer; seq != nil && seq.sequenced(pin) {
+		return seq.write(dev, pin, state)
+	}
+	return dev.writePin(pin, state)
+}
+
+func (dev *Device) writePin(pin uint8, state State) error {
 	pin, port := GetPinPort(pin)
-	portState, err := dev.ReadPort(port)
+	portState, err := dev.readLatch(port)
 	if err != nil {
-		return fmt.Errorf("failed to write to pin %v: %s\n", pin, err)
+		return fmt.Errorf("failed to write to pin %v: %w\n", pin, err)
 	}
 
 	newState := SetBit(portState, pin, int(state))
-	return dev.WritePort(port, newState)
+	return dev.writePort(port, newState, 1<<pin, "WritePin")
+}
+
+// Set a pin to `state` only if its output latch is `expect`, returning
+// whether the pin was written. The latch is read and written with the
+// device mutex held, so other users of the mutex cannot change the port
+// in between. Writes of pins with relay timing may be deferred, see
+// SetSequencer; true is then returned once the write is deferred, and the
+// write is only kept from racing with writes through the sequencer.
+func (dev *Device) WritePinIf(pin uint8, expect, state State) (bool, error) {
+	if pin < 1 || pin > 16 {
+		return false, fmt.Errorf("invalid pin: %d", pin)
+	}
+	if seq := dev.sequencer; seq != nil && seq.sequenced(pin) {
+		return seq.writeIf(dev, pin, expect, state)
+	}
+	bit, port := GetPinPort(pin)
+
+	dev.mutex.Lock()
+	latch, err := dev.readByte(OLATA + Register(port))
+	if err != nil {
+		dev.mutex.Unlock()
+		return false, fmt.Errorf("failed to write to pin %v: %w", pin, err)
+	}
+	if !State(GetBit(latch, bit)).Equal(expect) {
+		dev.mutex.Unlock()
+		return false, nil
+	}
+	newState := SetBit(latch, bit, int(state))
+	err = dev.writeByte(GPIOA+Register(port), newState)
+	dev.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	return true, dev.recordPort(port, newState, 1<<bit, "WritePinIf")
 }
 
 // Translate a pin number 1-16 into 0-index pin on a specific port.
@@ -312,6 +698,17 @@ func (dev *Device) ReadPin(pin uint8) (State, error) {
 	return State(GetBit(portState, pin)), err
 }
 
+// Set a pin high for true and low for false.
+func (dev *Device) WritePinBool(pin uint8, high bool) error {
+	return dev.WritePin(pin, StateOf(high))
+}
+
+// Return true if a pin is high.
+func (dev *Device) ReadPinBool(pin uint8) (bool, error) {
+	state, err := dev.ReadPin(pin)
+	return state.Bool(), err
+}
+
 // Set a single bit in a byte. All values except 0 is considered 1.
 func SetBit(byt byte, bit uint8, value int) byte {
 	if value == 0 {
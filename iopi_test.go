@@ -1,11 +1,34 @@
 package iopi
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
 	"sync"
 	"testing"
 )
 
+func TestNewDevice(t *testing.T) {
+	t.Run("takes the path from the file", func(t *testing.T) {
+		if dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}); dev.Path != "fake" {
+			t.Error("unexpected path", dev.Path)
+		}
+	})
+
+	t.Run("accepts any io.ReadWriteCloser", func(t *testing.T) {
+		// Hides Fd and Name of the fake
+		file := struct{ io.ReadWriteCloser }{NewFakeFile()}
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		if dev.Path != "" {
+			t.Error("unexpected path", dev.Path)
+		}
+		if err := dev.WriteByteData(OLATA, 0x01); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
 func TestWrite(t *testing.T) {
 	file := NewFakeFile()
 	dev := NewDevice(file, 0x20, &sync.Mutex{})
@@ -28,7 +51,7 @@ func TestRead(t *testing.T) {
 
 	// This bears the same meaning as "reads from specified register"
 	t.Run("write register addr before read", func(t *testing.T) {
-		reg := byte(0x42)
+		reg := Register(0x42)
 		_, err := dev.ReadByteData(reg)
 		if err != nil {
 			t.Error("failed to read")
@@ -44,37 +67,45 @@ func TestInit(t *testing.T) {
 	file := NewFakeFile()
 	dev := NewDevice(file, 0x20, &sync.Mutex{})
 
-	dev.driverInit()
+	if err := dev.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("uses the file given", func(t *testing.T) {
+		if file.HasCall("Close", nil) || len(file.CallHistory) == 0 {
+			t.Error("file not used")
+		}
+	})
 
 	t.Run("performs mcp23017 chip init", func(t *testing.T) {
-		if !file.HasCall("Write", []byte{IOCON, 0x22}) {
+		if !file.HasCall("Write", []byte{byte(IOCON), 0x22}) {
 			t.Error("expected registers not written to")
 		}
 	})
 
 	t.Run("port mode set to input", func(t *testing.T) {
-		if !file.HasCall("Write", []byte{IODIRA, 0xFF}) {
+		if !file.HasCall("Write", []byte{byte(IODIRA), 0xFF}) {
 			t.Error("port A not configured")
 		}
-		if !file.HasCall("Write", []byte{IODIRB, 0xFF}) {
+		if !file.HasCall("Write", []byte{byte(IODIRB), 0xFF}) {
 			t.Error("port B not configured")
 		}
 	})
 
 	t.Run("port pullup resistors disabled", func(t *testing.T) {
-		if !file.HasCall("Write", []byte{GPPUA, 0x00}) {
+		if !file.HasCall("Write", []byte{byte(GPPUA), 0x00}) {
 			t.Error("port A not configured")
 		}
-		if !file.HasCall("Write", []byte{GPPUB, 0x00}) {
+		if !file.HasCall("Write", []byte{byte(GPPUB), 0x00}) {
 			t.Error("port B not configured")
 		}
 	})
 
 	t.Run("port polarity inversion disabled", func(t *testing.T) {
-		if !file.HasCall("Write", []byte{IPOLA, 0x00}) {
+		if !file.HasCall("Write", []byte{byte(IPOLA), 0x00}) {
 			t.Error("port A not configured")
 		}
-		if !file.HasCall("Write", []byte{IPOLB, 0x00}) {
+		if !file.HasCall("Write", []byte{byte(IPOLB), 0x00}) {
 			t.Error("port B not configured")
 		}
 	})
@@ -96,7 +127,7 @@ func TestSetPortPullup(t *testing.T) {
 		dev := NewDevice(file, 0x20, &sync.Mutex{})
 
 		dev.SetPortPullup(PortA, 0x55)
-		if !file.HasCall("Write", []byte{GPPUA, 0x55}) {
+		if !file.HasCall("Write", []byte{byte(GPPUA), 0x55}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -106,7 +137,7 @@ func TestSetPortPullup(t *testing.T) {
 		dev := NewDevice(file, 0x20, &sync.Mutex{})
 
 		dev.SetPortPullup(PortB, 0x55)
-		if !file.HasCall("Write", []byte{GPPUB, 0x55}) {
+		if !file.HasCall("Write", []byte{byte(GPPUB), 0x55}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -120,7 +151,7 @@ func TestSetPinPullup(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.SetPinPullup(7, 1)
 
-		if !file.HasCall("Write", []byte{GPPUA, 0b01000000}) {
+		if !file.HasCall("Write", []byte{byte(GPPUA), 0b01000000}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -132,7 +163,7 @@ func TestSetPinPullup(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.SetPinPullup(16, 1)
 
-		if !file.HasCall("Write", []byte{GPPUB, 0b10000000}) {
+		if !file.HasCall("Write", []byte{byte(GPPUB), 0b10000000}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -144,7 +175,7 @@ func TestSetPortPolarity(t *testing.T) {
 		dev := NewDevice(file, 0x20, &sync.Mutex{})
 
 		dev.SetPortPolarity(PortA, 0x55)
-		if !file.HasCall("Write", []byte{IPOLA, 0x55}) {
+		if !file.HasCall("Write", []byte{byte(IPOLA), 0x55}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -154,7 +185,7 @@ func TestSetPortPolarity(t *testing.T) {
 		dev := NewDevice(file, 0x20, &sync.Mutex{})
 
 		dev.SetPortPolarity(PortB, PolarityInverted)
-		if !file.HasCall("Write", []byte{IPOLB, 0xFF}) {
+		if !file.HasCall("Write", []byte{byte(IPOLB), 0xFF}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -168,7 +199,7 @@ func TestSetPinPolarity(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.SetPinPolarity(7, 1)
 
-		if !file.HasCall("Write", []byte{IPOLA, 0b01000000}) {
+		if !file.HasCall("Write", []byte{byte(IPOLA), 0b01000000}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -180,7 +211,7 @@ func TestSetPinPolarity(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.SetPinPolarity(16, 1)
 
-		if !file.HasCall("Write", []byte{IPOLB, 0b10000000}) {
+		if !file.HasCall("Write", []byte{byte(IPOLB), 0b10000000}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -192,7 +223,7 @@ func TestSetPortMode(t *testing.T) {
 		dev := NewDevice(file, 0x20, &sync.Mutex{})
 
 		dev.SetPortMode(PortA, 0x55)
-		if !file.HasCall("Write", []byte{IODIRA, 0x55}) {
+		if !file.HasCall("Write", []byte{byte(IODIRA), 0x55}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -201,8 +232,8 @@ func TestSetPortMode(t *testing.T) {
 		file := NewFakeFile()
 		dev := NewDevice(file, 0x20, &sync.Mutex{})
 
-		dev.SetPortMode(PortB, High)
-		if !file.HasCall("Write", []byte{IODIRB, 0xFF}) {
+		dev.SetPortMode(PortB, Input)
+		if !file.HasCall("Write", []byte{byte(IODIRB), 0xFF}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -216,7 +247,7 @@ func TestSetPinMode(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.SetPinMode(7, 1)
 
-		if !file.HasCall("Write", []byte{IODIRA, 0b01000000}) {
+		if !file.HasCall("Write", []byte{byte(IODIRA), 0b01000000}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -228,9 +259,113 @@ func TestSetPinMode(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.SetPinMode(16, 1)
 
-		if !file.HasCall("Write", []byte{IODIRB, 0b10000000}) {
+		if !file.HasCall("Write", []byte{byte(IODIRB), 0b10000000}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+}
+
+func TestSetPins(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		set  func(dev *Device) error
+		reg  Register
+		old  byte
+		want byte
+	}{
+		{"mode", func(dev *Device) error { return dev.SetPinsMode(PortA, 0x0F, Output) }, IODIRA, 0xFF, 0xF0},
+		{"mixed mode", func(dev *Device) error { return dev.SetPinsMode(PortB, 0x0F, Mode(0x05)) }, IODIRB, 0xF0, 0xF5},
+		{"pullup", func(dev *Device) error { return dev.SetPinsPullup(PortB, 0x81, PullupEnabled) }, GPPUB, 0x10, 0x91},
+		{"polarity", func(dev *Device) error { return dev.SetPinsPolarity(PortA, 0xF0, PolarityNormal) }, IPOLA, 0xFF, 0x0F},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			file := NewFakeFile()
+			dev := NewDevice(file, 0x20, &sync.Mutex{})
+			file.SetRegister(c.reg, c.old)
+
+			if err := c.set(dev); err != nil {
+				t.Fatal(err)
+			}
+			if len(file.CallHistory) != 3 || !file.HasCall("Write", []byte{byte(c.reg), c.want}) {
+				t.Errorf("expected one read and write of 0x%02x to %s, got %v", c.want, c.reg, file.CallHistory)
+			}
+		})
+	}
+
+	t.Run("invalid port", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if err := dev.SetPinsMode(Port(2), 0x01, Input); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestConfigShadow(t *testing.T) {
+	t.Run("setters write without reading once cached", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(IODIRA, 0xFF)
+
+		for pin := uint8(1); pin <= 8; pin++ {
+			if err := dev.SetPinMode(pin, Output); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(file.CallHistory) != 2+8 {
+			t.Error("expected one read and a write per pin", file.CallHistory)
+		}
+		if !file.HasCall("Write", []byte{byte(IODIRA), 0x00}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("port writes fill the shadow", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		dev.SetPortPullup(PortB, PullupEnabled)
+		dev.SetPinPullup(9, PullupDisabled)
+		dev.SetPortPolarity(PortA, PolarityNormal)
+		dev.SetPinPolarity(2, PolarityInverted)
+
+		for _, call := range file.CallHistory {
+			if call.Fn == "Read" {
+				t.Error("unexpected read", file.CallHistory)
+			}
+		}
+		if !file.HasCall("Write", []byte{byte(GPPUB), 0xFE}) || !file.HasCall("Write", []byte{byte(IPOLA), 0x02}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("advisory shadow reads before writing", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		dev.SetCacheAdvisory(true)
+		var diffs []Difference
+		dev.SetDriftHandler(func(d Difference) { diffs = append(diffs, d) })
+
+		dev.SetPortMode(PortA, Input)
+		file.SetRegister(IODIRA, 0x7F) // changed by another controller
+		if err := dev.SetPinMode(1, Output); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(IODIRA), 0x7E}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
+		if len(diffs) != 1 || diffs[0] != (Difference{Register: "IODIRA", A: 0xFF, B: 0x7F}) {
+			t.Error("unexpected drift", diffs)
+		}
+	})
+
+	t.Run("read errors are not cached", func(t *testing.T) {
+		dev := NewDevice(failingBus{}, 0x20, &sync.Mutex{})
+		if err := dev.SetPinMode(1, Output); err == nil {
+			t.Error("expected error")
+		}
+		if dev.configCached != 0 {
+			t.Error("cached a failed read")
+		}
 	})
 }
 
@@ -241,7 +376,7 @@ func TestWritePort(t *testing.T) {
 
 		dev.WritePort(PortA, 0xFF)
 
-		if !file.HasCall("Write", []byte{GPIOA, 0xFF}) {
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0xFF}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -252,7 +387,7 @@ func TestWritePort(t *testing.T) {
 
 		dev.WritePort(PortB, 0xFF)
 
-		if !file.HasCall("Write", []byte{GPIOB, 0xFF}) {
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0xFF}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -265,7 +400,7 @@ func TestReadPort(t *testing.T) {
 
 		dev.ReadPort(PortA)
 
-		if !file.HasCall("Read", []byte{GPIOA}) {
+		if !file.HasCall("Read", []byte{byte(GPIOA)}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -276,10 +411,33 @@ func TestReadPort(t *testing.T) {
 
 		dev.ReadPort(PortB)
 
-		if !file.HasCall("Write", []byte{GPIOB}) {
+		if !file.HasCall("Write", []byte{byte(GPIOB)}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
+
+	t.Run("returns register values", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOA, 0xA5)
+		file.SetRegister(GPIOB, 0x5A)
+
+		a, err := dev.ReadPort(PortA)
+		if err != nil || a != 0xA5 {
+			t.Errorf("unexpected port A: 0x%02x, %v", a, err)
+		}
+		b, err := dev.ReadPort(PortB)
+		if err != nil || b != 0x5A {
+			t.Errorf("unexpected port B: 0x%02x, %v", b, err)
+		}
+	})
+
+	t.Run("invalid port", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if _, err := dev.ReadPort(Port(2)); err == nil {
+			t.Error("expected error for invalid port")
+		}
+	})
 }
 
 func TestWritePin(t *testing.T) {
@@ -290,7 +448,7 @@ func TestWritePin(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.WritePin(7, High)
 
-		if !file.HasCall("Write", []byte{GPIOA, 0b01000000}) {
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0b01000000}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
@@ -302,10 +460,47 @@ func TestWritePin(t *testing.T) {
 		file.NextRead = []byte{0x00, 0x00}
 		dev.WritePin(15, High)
 
-		if !file.HasCall("Write", []byte{GPIOB, 0b01000000}) {
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0b01000000}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+}
+
+func TestWritePinIf(t *testing.T) {
+	t.Run("writes when the latch matches", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		file.NextRead = []byte{0b00000001}
+		written, err := dev.WritePinIf(10, Low, High)
+		if err != nil || !written {
+			t.Fatal("pin not written", err)
+		}
+		if !file.HasCall("Write", []byte{byte(OLATB)}) || !file.HasCall("Write", []byte{byte(GPIOB), 0b00000011}) {
 			t.Error("did not write expected data", file.CallHistory)
 		}
 	})
+
+	t.Run("leaves the pin when the latch differs", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		file.NextRead = []byte{0b00000100}
+		written, err := dev.WritePinIf(3, Low, High)
+		if err != nil || written {
+			t.Fatal("pin written", err)
+		}
+		if len(registerWrites(file, GPIOA)) != 0 {
+			t.Error("unexpected write", file.CallHistory)
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if _, err := dev.WritePinIf(17, Low, High); err == nil {
+			t.Error("expected error")
+		}
+	})
 }
 
 func TestGetPinPort(t *testing.T) {
@@ -331,13 +526,94 @@ func TestGetPinPort(t *testing.T) {
 }
 
 func TestReadPin(t *testing.T) {
-	// I don't know how to test this yet
 	t.Run("pin <= 8", func(t *testing.T) {
-		t.Skip()
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOA, 0b01000000)
+		file.SetRegister(GPIOB, 0b10111111)
+
+		for pin, expected := range map[uint8]State{7: 1, 8: 0, 1: 0} {
+			state, err := dev.ReadPin(pin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != expected {
+				t.Errorf("expected pin %d to be %d, got %d", pin, expected, state)
+			}
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA)}) || file.HasCall("Write", []byte{byte(GPIOB)}) {
+			t.Error("did not read port A only", file.CallHistory)
+		}
 	})
 
 	t.Run("pin > 8", func(t *testing.T) {
-		t.Skip()
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOA, 0b10111111)
+		file.SetRegister(GPIOB, 0b01000000)
+
+		for pin, expected := range map[uint8]State{15: 1, 16: 0, 9: 0} {
+			state, err := dev.ReadPin(pin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != expected {
+				t.Errorf("expected pin %d to be %d, got %d", pin, expected, state)
+			}
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOB)}) || file.HasCall("Write", []byte{byte(GPIOA)}) {
+			t.Error("did not read port B only", file.CallHistory)
+		}
+	})
+
+	t.Run("follows changes", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOA, 0x00)
+		file.QueueRead(GPIOA, 0x01, 0x00, 0x01)
+
+		var states []State
+		for i := 0; i < 4; i++ {
+			state, _ := dev.ReadPin(1)
+			states = append(states, state)
+		}
+		if !reflect.DeepEqual(states, []State{1, 0, 1, 0}) {
+			t.Error("unexpected states", states)
+		}
+	})
+}
+
+func TestPinBool(t *testing.T) {
+	t.Run("reads and writes pins as booleans", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(OLATB, 0x00)
+
+		if err := dev.WritePinBool(9, true); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0x01}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+		file.SetRegister(GPIOB, 0x01)
+		if high, err := dev.ReadPinBool(9); err != nil || !high {
+			t.Error("expected pin 9 high", err)
+		}
+		if high, err := dev.ReadPinBool(10); err != nil || high {
+			t.Error("expected pin 10 low", err)
+		}
+	})
+
+	t.Run("compares states", func(t *testing.T) {
+		if !State(1).Equal(High) || !High.Equal(State(1)) || Low.Equal(State(1)) || !Low.Equal(Low) {
+			t.Error("unexpected comparison")
+		}
+		if State(1).Bool() != true || Low.Bool() != false {
+			t.Error("unexpected bool")
+		}
+		if StateOf(true) != High || StateOf(false) != Low {
+			t.Error("unexpected state")
+		}
 	})
 }
 
@@ -359,3 +635,165 @@ func TestGetBit(t *testing.T) {
 		t.Error("expected bit was not set")
 	}
 }
+
+func TestConstants(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"PortA", PortA, Port(0)},
+		{"PortB", PortB, Port(1)},
+		{"Output", Output, Mode(0x00)},
+		{"Input", Input, Mode(0xFF)},
+		{"PullupDisabled", PullupDisabled, Mode(0x00)},
+		{"PullupEnabled", PullupEnabled, Mode(0xFF)},
+		{"PolarityNormal", PolarityNormal, Polarity(0x00)},
+		{"PolarityInverted", PolarityInverted, Polarity(0xFF)},
+		{"Low", Low, State(0x00)},
+		{"High", High, State(0xFF)},
+	} {
+		// Compares types as well as values
+		if c.value != c.expected {
+			t.Errorf("%s: expected %T %v, got %T %v", c.name, c.expected, c.expected, c.value, c.value)
+		}
+	}
+}
+
+func TestStringers(t *testing.T) {
+	for _, c := range []struct {
+		value    fmt.Stringer
+		expected string
+	}{
+		{PortA, "PortA"},
+		{PortB, "PortB"},
+		{Port(2), "Port(2)"},
+		{Input, "Input"},
+		{Output, "Output"},
+		{Mode(0x55), "Mode(0b01010101)"},
+		{PolarityNormal, "Normal"},
+		{PolarityInverted, "Inverted"},
+		{Polarity(0x0F), "Polarity(0b00001111)"},
+		{Low, "Low"},
+		{High, "High"},
+		{State(1), "High"},
+	} {
+		if s := c.value.String(); s != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, s)
+		}
+	}
+
+	if s := fmt.Sprintf("pin %d is %s on %s", 3, High, PortA); s != "pin 3 is High on PortA" {
+		t.Error("unexpected formatting", s)
+	}
+}
+
+// A bus that transfers nothing and allocates nothing
+type nopBus struct{}
+
+func (nopBus) Read(b []byte) (int, error)  { return len(b), nil }
+func (nopBus) Write(b []byte) (int, error) { return len(b), nil }
+func (nopBus) Close() error                { return nil }
+
+// A bus reading one byte at most
+type shortBus struct{ nopBus }
+
+func (shortBus) Read(b []byte) (int, error) { return 1, nil }
+
+// A bus failing all reads
+type failingBus struct{ nopBus }
+
+func (failingBus) Read(b []byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestRegisterAllocations(t *testing.T) {
+	dev := NewDevice(nopBus{}, 0x20, &sync.Mutex{})
+
+	if n := testing.AllocsPerRun(100, func() { dev.ReadByteData(GPIOA) }); n != 0 {
+		t.Error("ReadByteData allocates", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { dev.WriteByteData(OLATA, 0x55) }); n != 0 {
+		t.Error("WriteByteData allocates", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { dev.ReadPort(PortB) }); n != 0 {
+		t.Error("ReadPort allocates", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { dev.ReadPorts() }); n != 0 {
+		t.Error("ReadPorts allocates", n)
+	}
+}
+
+func BenchmarkReadByteData(b *testing.B) {
+	dev := NewDevice(nopBus{}, 0x20, &sync.Mutex{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dev.ReadByteData(GPIOA)
+	}
+}
+
+func BenchmarkWriteByteData(b *testing.B) {
+	dev := NewDevice(nopBus{}, 0x20, &sync.Mutex{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dev.WriteByteData(OLATA, byte(i))
+	}
+}
+
+func TestReadBlockData(t *testing.T) {
+	t.Run("reads consecutive registers in one transfer", func(t *testing.T) {
+		file := NewFakeFile()
+		file.SetRegister(GPIOA, 0x12)
+		file.SetRegister(GPIOB, 0x34)
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		state, err := dev.ReadPorts()
+		if err != nil || state != [2]byte{0x12, 0x34} {
+			t.Error("unexpected state", state, err)
+		}
+		if len(file.CallHistory) != 2 {
+			t.Error("expected a single transfer", file.CallHistory)
+		}
+	})
+
+	t.Run("reads both ports after Init", func(t *testing.T) {
+		dev, err := Open("sim://read-ports", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dev.Close()
+		if err := dev.Init(); err != nil {
+			t.Fatal(err)
+		}
+		chip, _ := SimChip("sim://read-ports", 0x20)
+		chip.SetInput(1, true)
+		chip.SetInput(16, true)
+
+		state, err := dev.ReadPorts()
+		if err != nil || state != [2]byte{0x01, 0x80} {
+			t.Errorf("unexpected state %x: %v", state, err)
+		}
+	})
+
+	t.Run("rejects short reads", func(t *testing.T) {
+		dev := NewDevice(shortBus{}, 0x20, &sync.Mutex{})
+		if err := dev.ReadBlockData(GPIOA, make([]byte, 2)); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("reads more than the transfer buffer", func(t *testing.T) {
+		dev, err := Open("sim://read-block", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dev.Close()
+		dev.WriteByteData(OLATB, 0x5A)
+
+		buf := make([]byte, 22)
+		if err := dev.ReadBlockData(IODIRA, buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf[OLATB] != 0x5A || buf[IODIRA] != 0xFF {
+			t.Error("unexpected registers", buf)
+		}
+	})
+}
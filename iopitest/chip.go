@@ -0,0 +1,318 @@
+// Package iopitest provides a fake MCP23017 for testing code using IO Pi
+// boards without hardware. The fake models the register map of the chip,
+// so pin modes, pull-ups, polarity and interrupts behave as on a real
+// board.
+//
+//	chip := iopitest.NewChip()
+//	dev := iopi.NewDevice(chip, 0x20, &sync.Mutex{})
+//	dev.SetPinMode(1, iopi.Input)
+//	chip.SetInput(1, true)
+//	state, _ := dev.ReadPin(1) // high
+//
+// Pins are numbered 1-16 as in package iopi. Inputs not driven with
+// SetInput read high with the pull-up enabled, and low otherwise.
+package iopitest
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registers with IOCON.BANK = 0, as used by package iopi
+const (
+	iodir   = 0x00
+	ipol    = 0x02
+	gpinten = 0x04
+	defval  = 0x06
+	intcon  = 0x08
+	iocon   = 0x0A
+	iocon2  = 0x0B // mirrors IOCON
+	gppu    = 0x0C
+	intf    = 0x0E
+	intcap  = 0x10
+	gpio    = 0x12
+	olat    = 0x14
+
+	numRegisters = 0x16
+)
+
+// IOCON bits
+const (
+	ioconMirror = 1 << 6 // INTA and INTB are internally connected
+	ioconSeqop  = 1 << 5 // address pointer toggles within a register pair
+)
+
+// Chip is a fake MCP23017 on an I2C bus. It implements the file interface
+// taken by iopi.NewDevice, and is safe for concurrent use.
+type Chip struct {
+	mutex   sync.Mutex
+	regs    [numRegisters]byte
+	pointer byte
+	driven  [2]byte // input pins driven by SetInput
+	level   [2]byte // level of driven pins
+	closed  bool
+	faults  []*fault
+}
+
+// Create a chip in its power-on state: all pins inputs and all other
+// registers cleared.
+func NewChip() *Chip {
+	c := &Chip{}
+	c.regs[iodir] = 0xFF
+	c.regs[iodir+1] = 0xFF
+	return c
+}
+
+// Return the register address for `port` (0 for A, 1 for B) in the pair
+// of registers starting at `reg`.
+func portReg(reg byte, port int) byte {
+	return reg + byte(port)
+}
+
+func pinPort(pin uint8) (bit uint8, port int) {
+	if pin < 1 || pin > 16 {
+		panic(fmt.Sprintf("iopitest: invalid pin: %d", pin))
+	}
+	if pin > 8 {
+		return pin - 9, 1
+	}
+	return pin - 1, 0
+}
+
+// Write sets the register pointer to the first byte, and writes any
+// following bytes to the registers from there.
+func (c *Chip) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return 0, fmt.Errorf("iopitest: write to closed chip")
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if b[0] >= numRegisters {
+		return 0, fmt.Errorf("iopitest: invalid register: 0x%02x", b[0])
+	}
+
+	if f := c.inject(WriteOp, b[0]); f != nil {
+		if !f.Short {
+			return 0, f.Err
+		}
+		c.pointer = b[0]
+		return 1, nil
+	}
+
+	c.pointer = b[0]
+	for _, v := range b[1:] {
+		c.writeRegister(c.pointer, v)
+		c.advance()
+	}
+	return len(b), nil
+}
+
+// Read reads the registers from the register pointer.
+func (c *Chip) Read(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return 0, fmt.Errorf("iopitest: read from closed chip")
+	}
+
+	n := len(b)
+	if f := c.inject(ReadOp, c.pointer); f != nil {
+		if !f.Short {
+			return 0, f.Err
+		}
+		n--
+	}
+
+	for i := range b[:n] {
+		b[i] = c.readRegister(c.pointer)
+		c.advance()
+	}
+	return n, nil
+}
+
+func (c *Chip) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	return nil
+}
+
+func (c *Chip) Fd() uintptr {
+	return 0
+}
+
+func (c *Chip) Name() string {
+	return "iopitest"
+}
+
+// Move the register pointer to the next register. With sequential
+// operation disabled, it toggles between the A and B registers of a pair
+// instead, as the chip does in byte mode with IOCON.BANK = 0.
+func (c *Chip) advance() {
+	if c.regs[iocon]&ioconSeqop != 0 {
+		c.pointer ^= 1
+		return
+	}
+	c.pointer = (c.pointer + 1) % numRegisters
+}
+
+func (c *Chip) writeRegister(reg, v byte) {
+	port := int(reg % 2)
+	before := c.pins(port)
+
+	switch reg {
+	case intf, intf + 1, intcap, intcap + 1:
+		// read-only
+	case gpio, gpio + 1:
+		c.regs[olat+reg-gpio] = v
+	case iocon, iocon2:
+		c.regs[iocon], c.regs[iocon2] = v, v
+	default:
+		c.regs[reg] = v
+	}
+
+	// A change of mode or pull-up may change the level of inputs
+	c.change(port, before)
+}
+
+func (c *Chip) readRegister(reg byte) byte {
+	switch reg {
+	case gpio, gpio + 1:
+		port := int(reg - gpio)
+		v := c.gpio(port)
+		c.clearInterrupt(port)
+		return v
+	case intcap, intcap + 1:
+		port := int(reg - intcap)
+		v := c.regs[reg]
+		c.clearInterrupt(port)
+		return v
+	default:
+		return c.regs[reg]
+	}
+}
+
+// Return the level of the pins of a port: outputs drive their latch,
+// driven inputs their level, and other inputs float high with the pull-up
+// enabled and low otherwise.
+func (c *Chip) pins(port int) byte {
+	inputs := c.regs[portReg(iodir, port)]
+	outputs := ^inputs & c.regs[portReg(olat, port)]
+	driven := inputs & c.driven[port] & c.level[port]
+	floating := inputs &^ c.driven[port] & c.regs[portReg(gppu, port)]
+	return outputs | driven | floating
+}
+
+// Return the value of the GPIO register, with the polarity of inputs
+// inverted as set by IPOL.
+func (c *Chip) gpio(port int) byte {
+	return c.pins(port) ^ (c.regs[portReg(ipol, port)] & c.regs[portReg(iodir, port)])
+}
+
+// Raise interrupts for enabled pins that changed from `before`, or that
+// differ from DEFVAL.
+func (c *Chip) change(port int, before byte) {
+	after := c.pins(port)
+	enabled := c.regs[portReg(gpinten, port)] & c.regs[portReg(iodir, port)]
+	onChange := enabled &^ c.regs[portReg(intcon, port)]
+	c.raise(port, (before^after)&onChange)
+	c.compare(port)
+}
+
+// Raise interrupts for pins compared against DEFVAL.
+func (c *Chip) compare(port int) {
+	enabled := c.regs[portReg(gpinten, port)] & c.regs[portReg(iodir, port)]
+	onCompare := enabled & c.regs[portReg(intcon, port)]
+	c.raise(port, (c.pins(port)^c.regs[portReg(defval, port)])&onCompare)
+}
+
+func (c *Chip) raise(port int, flags byte) {
+	if flags == 0 {
+		return
+	}
+	// INTCAP holds the port as it was at the first interrupt
+	if c.regs[portReg(intf, port)] == 0 {
+		c.regs[portReg(intcap, port)] = c.gpio(port)
+	}
+	c.regs[portReg(intf, port)] |= flags
+}
+
+// Clear the interrupt of a port, as reading GPIO or INTCAP does. Pins
+// compared against DEFVAL interrupt again if they still differ.
+func (c *Chip) clearInterrupt(port int) {
+	c.regs[portReg(intf, port)] = 0
+	c.compare(port)
+}
+
+// Drive an input pin high or low from outside the chip. Has no visible
+// effect on outputs until the pin is set to input.
+func (c *Chip) SetInput(pin uint8, high bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bit, port := pinPort(pin)
+	before := c.pins(port)
+	c.driven[port] |= 1 << bit
+	if high {
+		c.level[port] |= 1 << bit
+	} else {
+		c.level[port] &^= 1 << bit
+	}
+	c.change(port, before)
+}
+
+// Stop driving an input pin, leaving it floating.
+func (c *Chip) Release(pin uint8) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bit, port := pinPort(pin)
+	before := c.pins(port)
+	c.driven[port] &^= 1 << bit
+	c.change(port, before)
+}
+
+// Return the level of a pin as seen from outside the chip.
+func (c *Chip) Level(pin uint8) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bit, port := pinPort(pin)
+	return c.pins(port)&(1<<bit) != 0
+}
+
+// Return true if the pin is an output.
+func (c *Chip) IsOutput(pin uint8) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bit, port := pinPort(pin)
+	return c.regs[portReg(iodir, port)]&(1<<bit) == 0
+}
+
+// Return the value of a register without side effects.
+func (c *Chip) Register(reg byte) byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.regs[reg]
+}
+
+// Return true if the interrupt output of a port (0 for INTA, 1 for INTB)
+// is active. With IOCON.MIRROR set, both outputs are active when either
+// port has an interrupt.
+func (c *Chip) Interrupt(port int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.regs[iocon]&ioconMirror != 0 {
+		return c.regs[intf] != 0 || c.regs[intf+1] != 0
+	}
+	return c.regs[portReg(intf, port)] != 0
+}
@@ -0,0 +1,163 @@
+package iopitest_test
+
+import (
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func newTestDevice(t *testing.T) (*iopi.Device, *iopitest.Chip) {
+	chip := iopitest.NewChip()
+	dev := iopi.NewDevice(chip, 0x20, &sync.Mutex{})
+	return dev, chip
+}
+
+func TestChip(t *testing.T) {
+	t.Run("starts with all pins as inputs", func(t *testing.T) {
+		_, chip := newTestDevice(t)
+		for pin := uint8(1); pin <= 16; pin++ {
+			if chip.IsOutput(pin) || chip.Level(pin) {
+				t.Error("unexpected power-on state of pin", pin)
+			}
+		}
+	})
+
+	t.Run("drives outputs from the latch", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+
+		if err := dev.SetPinMode(3, iopi.Output); err != nil {
+			t.Fatal(err)
+		}
+		if err := dev.WritePin(3, iopi.High); err != nil {
+			t.Fatal(err)
+		}
+		if !chip.IsOutput(3) || !chip.Level(3) {
+			t.Error("output not driven")
+		}
+		if chip.Register(byte(iopi.OLATA)) != 0x04 {
+			t.Errorf("unexpected OLATA: 0x%02x", chip.Register(byte(iopi.OLATA)))
+		}
+
+		// Inputs do not affect outputs
+		chip.SetInput(3, false)
+		if state, _ := dev.ReadPin(3); state != 1 {
+			t.Error("output overridden by input")
+		}
+	})
+
+	t.Run("reads inputs with pull-ups and polarity", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+
+		if state, _ := dev.ReadPin(10); state != 0 {
+			t.Error("floating input without pull-up read high")
+		}
+		dev.SetPinPullup(10, iopi.PullupEnabled)
+		if state, _ := dev.ReadPin(10); state != 1 {
+			t.Error("floating input with pull-up read low")
+		}
+		chip.SetInput(10, false)
+		if state, _ := dev.ReadPin(10); state != 0 {
+			t.Error("driven input read high")
+		}
+		dev.SetPinPolarity(10, iopi.PolarityInverted)
+		if state, _ := dev.ReadPin(10); state != 1 {
+			t.Error("inverted input read low")
+		}
+		chip.Release(10)
+		if state, _ := dev.ReadPin(10); state != 0 {
+			t.Error("released inverted input with pull-up read high")
+		}
+	})
+
+	t.Run("raises interrupts on change", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+		dev.WriteByteData(iopi.GPINTENA, 0x01)
+
+		chip.SetInput(1, true)
+		if !chip.Interrupt(0) || chip.Interrupt(1) {
+			t.Fatal("interrupt not raised on INTA only")
+		}
+		if intf, _ := dev.ReadByteData(iopi.INTFA); intf != 0x01 {
+			t.Errorf("unexpected INTFA: 0x%02x", intf)
+		}
+
+		chip.SetInput(1, false)
+		if intcap, _ := dev.ReadByteData(iopi.INTCAPA); intcap != 0x01 {
+			t.Errorf("INTCAPA not captured at first interrupt: 0x%02x", intcap)
+		}
+		if chip.Interrupt(0) {
+			t.Error("interrupt not cleared by reading INTCAP")
+		}
+	})
+
+	t.Run("raises interrupts on comparison with DEFVAL", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+		dev.WriteByteData(iopi.IOCON, 0x40) // mirror
+		dev.WriteByteData(iopi.DEFVALB, 0x00)
+		dev.WriteByteData(iopi.INTCONB, 0x02)
+		dev.WriteByteData(iopi.GPINTENB, 0x02)
+
+		chip.SetInput(10, true)
+		if !chip.Interrupt(0) || !chip.Interrupt(1) {
+			t.Fatal("mirrored interrupt not raised")
+		}
+		dev.ReadPort(iopi.PortB)
+		if !chip.Interrupt(1) {
+			t.Error("interrupt cleared while pin differs from DEFVAL")
+		}
+		chip.SetInput(10, false)
+		dev.ReadPort(iopi.PortB)
+		if chip.Interrupt(1) {
+			t.Error("interrupt not cleared")
+		}
+	})
+
+	t.Run("applies a layout", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+
+		layout := iopi.Layout{State: [2]byte{0x01, 0}, Outputs: [2]byte{0x01, 0}}
+		if err := dev.InitLayout(layout); err != nil {
+			t.Fatal(err)
+		}
+		if !chip.IsOutput(1) || !chip.Level(1) || chip.IsOutput(2) {
+			t.Error("unexpected pin state after layout")
+		}
+	})
+
+	t.Run("reads and writes sequentially", func(t *testing.T) {
+		chip := iopitest.NewChip()
+		chip.Write([]byte{byte(iopi.OLATA), 0xAA, 0x55})
+
+		chip.Write([]byte{byte(iopi.OLATA)})
+		buf := make([]byte, 2)
+		chip.Read(buf)
+		if buf[0] != 0xAA || buf[1] != 0x55 {
+			t.Errorf("unexpected sequential read: %x", buf)
+		}
+
+		// With SEQOP set, the pointer toggles between OLATA and OLATB
+		chip.Write([]byte{byte(iopi.IOCON), 0x20})
+		chip.Write([]byte{byte(iopi.OLATB)})
+		buf = make([]byte, 3)
+		chip.Read(buf)
+		if buf[0] != 0x55 || buf[1] != 0xAA || buf[2] != 0x55 {
+			t.Errorf("pointer did not toggle with SEQOP set: %x", buf)
+		}
+	})
+
+	t.Run("fails when closed or addressed out of range", func(t *testing.T) {
+		chip := iopitest.NewChip()
+		if _, err := chip.Write([]byte{0x16}); err == nil {
+			t.Error("expected error for invalid register")
+		}
+		chip.Close()
+		if _, err := chip.Write([]byte{byte(iopi.GPIOA)}); err == nil {
+			t.Error("expected error writing closed chip")
+		}
+		if _, err := chip.Read(make([]byte, 1)); err == nil {
+			t.Error("expected error reading closed chip")
+		}
+	})
+}
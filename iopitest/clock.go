@@ -0,0 +1,118 @@
+package iopitest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock for testing timing dependent features of package
+// iopi, implementing iopi.Clock. Time only moves when advanced, or by
+// itself on every wait if AutoAdvance is set.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	auto    bool
+	waiters []waiter
+	changed chan struct{} // closed when waiters are added
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// Create a fake clock set to `t`.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t, changed: make(chan struct{})}
+}
+
+// Make every wait advance the clock by its duration and return at once,
+// so code sleeping runs without delay while seeing time pass.
+func (c *FakeClock) AutoAdvance(auto bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.auto = auto
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Return a channel receiving the time once the clock has been advanced by
+// at least `d`.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if c.auto && d > 0 {
+		c.now = c.now.Add(d)
+	}
+	if d <= 0 || c.auto {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, waiter{c.now.Add(d), ch})
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return ch
+}
+
+// Move the clock forward by `d`, firing waits that are due in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set the clock to `t`, firing waits that are due in order. The clock is
+// never moved backwards.
+func (c *FakeClock) Set(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if t.Before(c.now) {
+		t = c.now
+	}
+
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].at.Before(c.waiters[j].at)
+	})
+	n := 0
+	for _, w := range c.waiters {
+		if w.at.After(t) {
+			break
+		}
+		w.ch <- w.at
+		n++
+	}
+	c.waiters = c.waiters[n:]
+	c.now = t
+}
+
+// Return the number of waits not yet due.
+func (c *FakeClock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.waiters)
+}
+
+// Block until at least `n` waits are pending, e.g. until a goroutine
+// under test is waiting before advancing the clock.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mutex.Lock()
+		if len(c.waiters) >= n {
+			c.mutex.Unlock()
+			return
+		}
+		changed := c.changed
+		c.mutex.Unlock()
+		<-changed
+	}
+}
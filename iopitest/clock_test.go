@@ -0,0 +1,116 @@
+package iopitest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+var _ iopi.Clock = (*iopitest.FakeClock)(nil)
+
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	t.Run("fires waits when advanced", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(start)
+		a := clock.After(2 * time.Second)
+		b := clock.After(time.Second)
+
+		clock.Advance(time.Second - 1)
+		if fired(a) || fired(b) || clock.Waiters() != 2 {
+			t.Fatal("fired early")
+		}
+		clock.Advance(1)
+		if fired(a) || !fired(b) {
+			t.Error("expected only the first wait to fire")
+		}
+		clock.Advance(time.Hour)
+		if !fired(a) || clock.Waiters() != 0 {
+			t.Error("expected the second wait to fire")
+		}
+		if now := clock.Now(); !now.Equal(start.Add(time.Second + time.Hour)) {
+			t.Error("unexpected time", now)
+		}
+	})
+
+	t.Run("never moves backwards", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(start)
+		clock.Set(start.Add(-time.Hour))
+		if !clock.Now().Equal(start) {
+			t.Error("clock moved backwards")
+		}
+	})
+
+	t.Run("fires zero waits at once", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(start)
+		if !fired(clock.After(0)) {
+			t.Error("zero wait not fired")
+		}
+	})
+
+	t.Run("advances by itself", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(start)
+		clock.AutoAdvance(true)
+		if !fired(clock.After(time.Minute)) {
+			t.Error("wait not fired")
+		}
+		if !clock.Now().Equal(start.Add(time.Minute)) {
+			t.Error("clock not advanced", clock.Now())
+		}
+	})
+
+	t.Run("runs a blinker without sleeping", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+		dev.SetPinMode(1, iopi.Output)
+		clock := iopitest.NewFakeClock(start)
+		b := iopi.NewBlinker(dev)
+		b.Clock = clock
+
+		if err := b.PlayCount(1, iopi.Pattern{time.Second, time.Second}, 1); err != nil {
+			t.Fatal(err)
+		}
+		clock.BlockUntil(1)
+		if !chip.Level(1) {
+			t.Error("pin not on")
+		}
+		clock.Advance(time.Second)
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		b.Wait(1)
+		if chip.Level(1) {
+			t.Error("pin not off")
+		}
+	})
+
+	t.Run("paces a timeline", func(t *testing.T) {
+		dev, _ := newTestDevice(t)
+		clock := iopitest.NewFakeClock(start)
+		clock.AutoAdvance(true)
+		p := iopi.NewPlayer(dev)
+		p.Clock = clock
+
+		tl := iopi.SquareWave(1, time.Hour, 3)
+		report, err := p.Play(context.Background(), tl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := clock.Now().Sub(start); elapsed != tl[len(tl)-1].At {
+			t.Error("unexpected duration", elapsed)
+		}
+		if report.MaxLate() != 0 {
+			t.Error("unexpected lateness", report.MaxLate())
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package iopitest
+
+import "syscall"
+
+// A kind of transfer on the bus.
+type Op int
+
+const (
+	AnyOp Op = iota
+	ReadOp
+	WriteOp
+)
+
+// A fault injected into the transfers of a chip, to exercise the error
+// handling of code using it. A fault matches transfers of its Op
+// addressing any of its Registers, where a write addresses the register
+// in its first byte and a read the register it starts at.
+type Fault struct {
+	Op        Op
+	Registers []byte // all registers if empty
+	After     int    // let this many matching transfers through first
+	Count     int    // fail this many matching transfers, or all if 0
+	Err       error  // returned by failed transfers, EIO if nil
+	// Transfer one byte less than asked without an error, instead of
+	// returning Err. A short write sets the register pointer only, so
+	// a single byte write is not short.
+	Short bool
+}
+
+type fault struct {
+	Fault
+	seen   int // matching transfers
+	failed int
+}
+
+// Inject a fault. Faults are checked in the order injected, and the first
+// one failing a transfer applies.
+func (c *Chip) Inject(f Fault) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if f.Err == nil {
+		f.Err = syscall.EIO
+	}
+	c.faults = append(c.faults, &fault{Fault: f})
+}
+
+// Fail the nth write from now, counting from 1, with EIO.
+func (c *Chip) FailWrite(n int) {
+	c.Inject(Fault{Op: WriteOp, After: n - 1, Count: 1})
+}
+
+// Remove all injected faults.
+func (c *Chip) ClearFaults() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.faults = nil
+}
+
+// Return the fault applying to a transfer, or nil if the transfer should
+// succeed.
+func (c *Chip) inject(op Op, reg byte) *Fault {
+	var applied *Fault
+	for _, f := range c.faults {
+		if !f.match(op, reg) {
+			continue
+		}
+		f.seen++
+		if applied != nil || f.seen <= f.After || (f.Count > 0 && f.failed >= f.Count) {
+			continue
+		}
+		f.failed++
+		applied = &f.Fault
+	}
+	return applied
+}
+
+func (f *fault) match(op Op, reg byte) bool {
+	if f.Op != AnyOp && f.Op != op {
+		return false
+	}
+	if len(f.Registers) == 0 {
+		return true
+	}
+	for _, r := range f.Registers {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package iopitest_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestFaults(t *testing.T) {
+	t.Run("fails the nth write", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+		chip.FailWrite(2)
+
+		var errs []bool
+		for i := 0; i < 3; i++ {
+			errs = append(errs, dev.WriteByteData(iopi.OLATA, byte(i)) != nil)
+		}
+		if errs[0] || !errs[1] || errs[2] {
+			t.Error("unexpected failures", errs)
+		}
+		if chip.Register(byte(iopi.OLATA)) != 2 {
+			t.Error("failed write applied")
+		}
+	})
+
+	t.Run("fails transfers to specific registers", func(t *testing.T) {
+		dev, chip := newTestDevice(t)
+		chip.Inject(iopitest.Fault{Op: iopitest.ReadOp, Registers: []byte{byte(iopi.GPIOB)}})
+
+		if _, err := dev.ReadPort(iopi.PortA); err != nil {
+			t.Error("unexpected error for port A", err)
+		}
+		if _, err := dev.ReadPort(iopi.PortB); err == nil {
+			t.Error("expected error for port B")
+		}
+		chip.Write([]byte{byte(iopi.GPIOB)})
+		if _, err := chip.Read(make([]byte, 1)); err != syscall.EIO {
+			t.Error("expected EIO, got", err)
+		}
+
+		chip.ClearFaults()
+		if _, err := dev.ReadPort(iopi.PortB); err != nil {
+			t.Error("fault not cleared", err)
+		}
+	})
+
+	t.Run("returns short transfers", func(t *testing.T) {
+		_, chip := newTestDevice(t)
+		chip.Inject(iopitest.Fault{Short: true, Count: 2})
+
+		if n, err := chip.Write([]byte{byte(iopi.OLATA), 0xFF}); n != 1 || err != nil {
+			t.Error("unexpected write", n, err)
+		}
+		if chip.Register(byte(iopi.OLATA)) != 0 {
+			t.Error("short write applied")
+		}
+		buf := []byte{0xAA, 0xAA}
+		if n, err := chip.Read(buf); n != 1 || err != nil || buf[1] != 0xAA {
+			t.Error("unexpected read", n, err, buf)
+		}
+		if n, _ := chip.Read(buf); n != 2 {
+			t.Error("fault applied beyond count", n)
+		}
+	})
+
+	t.Run("returns custom errors", func(t *testing.T) {
+		_, chip := newTestDevice(t)
+		busy := errors.New("busy")
+		chip.Inject(iopitest.Fault{Err: busy})
+		if _, err := chip.Write([]byte{byte(iopi.GPIOA)}); err != busy {
+			t.Error("expected custom error, got", err)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package iopitest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Paths of PEM files written by WriteCertificates
+type Certificates struct {
+	CA         string // certificate authority signing the others
+	ServerCert string // for localhost and 127.0.0.1
+	ServerKey  string
+	ClientCert string // for client authentication
+	ClientKey  string
+}
+
+// Write a certificate authority, and a server and a client certificate
+// signed by it, to `dir`, for testing TLS connections. The certificates
+// are valid for a day.
+func WriteCertificates(dir string) (Certificates, error) {
+	c := Certificates{
+		CA:         filepath.Join(dir, "ca.pem"),
+		ServerCert: filepath.Join(dir, "server.pem"),
+		ServerKey:  filepath.Join(dir, "server-key.pem"),
+		ClientCert: filepath.Join(dir, "client.pem"),
+		ClientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "iopitest CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caKey, caDER, err := writeCertificate(c.CA, "", ca, nil, nil)
+	if err != nil {
+		return c, err
+	}
+	parent, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return c, err
+	}
+
+	server := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if _, _, err := writeCertificate(c.ServerCert, c.ServerKey, server, parent, caKey); err != nil {
+		return c, err
+	}
+
+	client := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "iopitest client"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if _, _, err := writeCertificate(c.ClientCert, c.ClientKey, client, parent, caKey); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// Create a certificate signed by `parent`, or self-signed if nil, and
+// write it and its key, unless `keyPath` is empty.
+func writeCertificate(certPath, keyPath string, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(24 * time.Hour)
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der); err != nil {
+		return nil, nil, err
+	}
+
+	if keyPath != "" {
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writePEM(keyPath, "EC PRIVATE KEY", keyDER); err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, der, nil
+}
+
+func writePEM(path, kind string, der []byte) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)
+}
@@ -0,0 +1,38 @@
+package iopitest_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"testing"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestWriteCertificates(t *testing.T) {
+	certs, err := iopitest.WriteCertificates(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := os.ReadFile(certs.CA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		t.Fatal("no ca certificate")
+	}
+
+	for _, pair := range [][2]string{{certs.ServerCert, certs.ServerKey}, {certs.ClientCert, certs.ClientKey}} {
+		cert, err := tls.LoadX509KeyPair(pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		opts := x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+		if _, err := leaf.Verify(opts); err != nil {
+			t.Error("certificate not signed by the ca", pair[0], err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package iopitest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/stigok/go-io-pi/chip/mcp23017"
+)
+
+// Trace records the register transactions on a file, e.g. a Chip, one
+// line per transaction, so the bus traffic of a scenario can be compared
+// against a golden file:
+//
+//	write IODIRA 0xfe
+//	read GPIOA 0x01
+//
+// A write of only the register address followed by a read is recorded as
+// a read of that register. Failed transactions are recorded with their
+// error.
+type Trace struct {
+	file    io.ReadWriteCloser
+	mutex   sync.Mutex
+	lines   []string
+	pointer int // register addressed by a pending write, -1 if none
+}
+
+// Create a trace of the transactions on `file`.
+func NewTrace(file io.ReadWriteCloser) *Trace {
+	return &Trace{file: file, pointer: -1}
+}
+
+func (t *Trace) Write(b []byte) (int, error) {
+	n, err := t.file.Write(b)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.flush()
+	switch {
+	case err != nil:
+		t.record("write", b, err)
+	case len(b) == 1:
+		t.pointer = int(b[0])
+	default:
+		t.record("write", b, nil)
+	}
+	return n, err
+}
+
+func (t *Trace) Read(b []byte) (int, error) {
+	n, err := t.file.Read(b)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	reg := []byte{}
+	if t.pointer >= 0 {
+		reg = []byte{byte(t.pointer)}
+		t.pointer = -1
+	}
+	t.record("read", append(reg, b[:n]...), err)
+	return n, err
+}
+
+func (t *Trace) Close() error {
+	t.mutex.Lock()
+	t.flush()
+	t.lines = append(t.lines, "close")
+	t.mutex.Unlock()
+
+	return t.file.Close()
+}
+
+// Return the name of the file traced, if it has one.
+func (t *Trace) Name() string {
+	if named, ok := t.file.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return ""
+}
+
+// Record a pending register address never read from.
+func (t *Trace) flush() {
+	if t.pointer >= 0 {
+		t.lines = append(t.lines, "address "+mcp23017.Register(t.pointer).String())
+		t.pointer = -1
+	}
+}
+
+// Record a transaction of a register address followed by data.
+func (t *Trace) record(op string, b []byte, err error) {
+	line := op
+	if len(b) > 0 {
+		line += " " + mcp23017.Register(b[0]).String()
+		for _, v := range b[1:] {
+			line += fmt.Sprintf(" 0x%02x", v)
+		}
+	}
+	if err != nil {
+		line += fmt.Sprintf(" error: %s", err)
+	}
+	t.lines = append(t.lines, line)
+}
+
+// Return the transactions recorded so far.
+func (t *Trace) Lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+	if t.pointer >= 0 {
+		lines = append(lines, "address "+mcp23017.Register(t.pointer).String())
+	}
+	return lines
+}
+
+// Return the transactions recorded so far, one per line.
+func (t *Trace) String() string {
+	lines := t.Lines()
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Forget the transactions recorded so far, e.g. after setting up a
+// scenario.
+func (t *Trace) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.lines = nil
+	t.pointer = -1
+}
@@ -0,0 +1,53 @@
+package iopitest_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestTrace(t *testing.T) {
+	t.Run("records transactions by register", func(t *testing.T) {
+		trace := iopitest.NewTrace(iopitest.NewChip())
+		dev := iopi.NewDevice(trace, 0x20, &sync.Mutex{})
+
+		dev.WriteByteData(iopi.OLATB, 0x5A)
+		dev.ReadByteData(iopi.OLATB)
+		trace.Write([]byte{byte(iopi.GPIOA)}) // address without reading
+		dev.Close()
+
+		expected := []string{
+			"write OLATB 0x5a",
+			"read OLATB 0x5a",
+			"address GPIOA",
+			"close",
+		}
+		if lines := trace.Lines(); !reflect.DeepEqual(lines, expected) {
+			t.Errorf("expected %q, got %q", expected, lines)
+		}
+	})
+
+	t.Run("records errors", func(t *testing.T) {
+		chip := iopitest.NewChip()
+		chip.FailWrite(1)
+		trace := iopitest.NewTrace(chip)
+		iopi.NewDevice(trace, 0x20, &sync.Mutex{}).WriteByteData(iopi.IODIRA, 0)
+
+		expected := "write IODIRA 0x00 error: input/output error\n"
+		if s := trace.String(); s != expected {
+			t.Errorf("expected %q, got %q", expected, s)
+		}
+	})
+
+	t.Run("resets", func(t *testing.T) {
+		trace := iopitest.NewTrace(iopitest.NewChip())
+		trace.Write([]byte{0x15, 0x01})
+		trace.Reset()
+		if s := trace.String(); s != "" {
+			t.Error("expected empty trace, got", s)
+		}
+	})
+}
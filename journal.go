@@ -0,0 +1,122 @@
+package iopi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A single recorded change of pin state.
+type JournalEntry struct {
+	Time   time.Time `json:"time"`
+	Pin    uint8     `json:"pin"`
+	State  State     `json:"state"`
+	Source string    `json:"source"` // API call that caused the change
+}
+
+// Journal keeps an in-memory log of pin state changes, and optionally
+// appends every entry as a line of JSON to an io.Writer (e.g. an open file).
+// A Journal can be shared between several devices on the same bus, but the
+// pin numbers in the entries will not tell them apart.
+type Journal struct {
+	Clock Clock
+
+	mutex   sync.Mutex
+	size    int
+	entries []JournalEntry
+	last    map[uint8]State
+	out     io.Writer
+}
+
+// Create a new journal holding at most `size` entries in memory. The oldest
+// entries are dropped when the journal is full. A size of 0 means unlimited.
+// `out` may be nil if entries should not be persisted.
+func NewJournal(size int, out io.Writer) *Journal {
+	return &Journal{
+		size: size,
+		last: make(map[uint8]State),
+		out:  out,
+	}
+}
+
+// Record a pin state. Nothing is recorded if the state is the same as the
+// last recorded state of the pin.
+func (j *Journal) record(pin uint8, state State, source string) error {
+	if state != Low {
+		state = High
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if prev, ok := j.last[pin]; ok && prev == state {
+		return nil
+	}
+	j.last[pin] = state
+
+	entry := JournalEntry{
+		Time:   ClockOr(j.Clock).Now(),
+		Pin:    pin,
+		State:  state,
+		Source: source,
+	}
+
+	j.entries = append(j.entries, entry)
+	if j.size > 0 && len(j.entries) > j.size {
+		j.entries = j.entries[len(j.entries)-j.size:]
+	}
+
+	if j.out != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode journal entry: %w", err)
+		}
+		if _, err := j.out.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write journal entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Record the state of the pins on a port selected by `mask`.
+func (j *Journal) recordPort(port Port, state byte, mask byte, source string) error {
+	offset := uint8(1)
+	if port == PortB {
+		offset = 9
+	}
+
+	for bit := uint8(0); bit < 8; bit++ {
+		if GetBit(mask, bit) == 0 {
+			continue
+		}
+		err := j.record(offset+bit, State(GetBit(state, bit)), source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return all recorded changes of a pin at or after `since`, oldest first.
+// A pin number of 0 returns the changes of all pins.
+func (j *Journal) History(pin uint8, since time.Time) []JournalEntry {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var res []JournalEntry
+	for _, e := range j.entries {
+		if pin != 0 && e.Pin != pin {
+			continue
+		}
+		if e.Time.Before(since) {
+			continue
+		}
+		res = append(res, e)
+	}
+
+	return res
+}
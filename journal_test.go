@@ -0,0 +1,102 @@
+package iopi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	t.Run("records pin changes made by WritePin", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		j := NewJournal(0, nil)
+		dev.SetJournal(j)
+
+		file.NextRead = []byte{0x00}
+		dev.WritePin(3, High)
+
+		hist := dev.History(3, time.Time{})
+		if len(hist) != 1 {
+			t.Fatal("expected one entry, got", hist)
+		}
+		if hist[0].State != High || hist[0].Source != "WritePin" {
+			t.Error("unexpected entry", hist[0])
+		}
+		if len(dev.History(4, time.Time{})) != 0 {
+			t.Error("untouched pin should not be journaled")
+		}
+	})
+
+	t.Run("records only changed pins on WritePort", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		j := NewJournal(0, nil)
+		dev.SetJournal(j)
+
+		dev.WritePort(PortB, 0b00000001)
+		dev.WritePort(PortB, 0b00000011)
+
+		if n := len(j.History(0, time.Time{})); n != 9 {
+			t.Error("expected 9 entries, got", n)
+		}
+		hist := j.History(10, time.Time{})
+		if len(hist) != 2 || hist[1].State != High {
+			t.Error("unexpected history for pin 10", hist)
+		}
+	})
+
+	t.Run("filters by time", func(t *testing.T) {
+		j := NewJournal(0, nil)
+		j.record(1, High, "test")
+		since := time.Now().Add(time.Second)
+
+		if len(j.History(1, since)) != 0 {
+			t.Error("expected no entries")
+		}
+	})
+
+	t.Run("drops oldest entries when full", func(t *testing.T) {
+		j := NewJournal(2, nil)
+		j.record(1, High, "a")
+		j.record(1, Low, "b")
+		j.record(1, High, "c")
+
+		hist := j.History(1, time.Time{})
+		if len(hist) != 2 || hist[0].Source != "b" {
+			t.Error("unexpected history", hist)
+		}
+	})
+
+	t.Run("writes entries as json lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		j := NewJournal(0, &buf)
+		j.record(5, High, "test")
+
+		var entry JournalEntry
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Pin != 5 || entry.State != High {
+			t.Error("unexpected entry", entry)
+		}
+		if !strings.Contains(buf.String(), `"state":"high"`) {
+			t.Error("state not written by name", buf.String())
+		}
+	})
+
+	t.Run("reads entries with numeric states", func(t *testing.T) {
+		// As written before states were marshalled by name
+		line := `{"time":"2026-01-01T00:00:00Z","pin":5,"state":1,"source":"WritePin"}`
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Pin != 5 || entry.State != High || entry.Source != "WritePin" {
+			t.Error("unexpected entry", entry)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package iopi
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	knownA = 1 << 16
+	knownB = 1 << 17
+)
+
+// Return the state of a port as last read or written by the device,
+// without using the bus or waiting for the device, for status displays
+// polling often. The state may be stale; it is updated by reads of the
+// port, including those of a running Poller, and by writes of outputs.
+// Returns false if the port has not been read or written yet.
+func (dev *Device) LastKnownPort(port Port) (byte, bool) {
+	if port != PortA && port != PortB {
+		return 0, false
+	}
+	v := atomic.LoadUint32(&dev.lastKnown)
+	return byte(v >> (8 * port)), v&(knownA<<port) != 0
+}
+
+// Return the state of a pin as last read or written by the device, see
+// LastKnownPort.
+func (dev *Device) LastKnownPin(pin uint8) (State, bool, error) {
+	if pin < 1 || pin > 16 {
+		return Low, false, fmt.Errorf("invalid pin: %d", pin)
+	}
+	bit, port := GetPinPort(pin)
+	state, ok := dev.LastKnownPort(port)
+	return State(GetBit(state, bit)), ok, nil
+}
+
+// Update the last known state after a transfer of a register, with the
+// device mutex held. GPIO reads update all pins, and writes of GPIO and
+// any transfer of the latches update the outputs, or all pins if their
+// modes are unknown. A port is known once all its pins have been updated.
+func (dev *Device) remember(reg Register, value byte, write bool) {
+	var port Port
+	var iodir Register
+	switch reg {
+	case GPIOA, OLATA:
+		port, iodir = PortA, IODIRA
+	case GPIOB, OLATB:
+		port, iodir = PortB, IODIRB
+	default:
+		return
+	}
+
+	mask := byte(0xFF)
+	if reg == OLATA || reg == OLATB || write {
+		if dev.configCached&(1<<iodir) != 0 {
+			mask = ^dev.config[iodir]
+		}
+	}
+
+	v := atomic.LoadUint32(&dev.lastKnown)
+	shift := 8 * uint32(port)
+	old := byte(v >> shift)
+	v = v&^(0xFF<<shift) | uint32(old&^mask|value&mask)<<shift
+	if mask == 0xFF {
+		v |= knownA << port
+	}
+	atomic.StoreUint32(&dev.lastKnown, v)
+}
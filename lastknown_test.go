@@ -0,0 +1,75 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLastKnown(t *testing.T) {
+	t.Run("unknown until read or written", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if _, ok := dev.LastKnownPort(PortA); ok {
+			t.Error("expected unknown port")
+		}
+		if _, ok, err := dev.LastKnownPin(16); ok || err != nil {
+			t.Error("expected unknown pin", err)
+		}
+		if _, _, err := dev.LastKnownPin(0); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("remembers reads and writes", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOB, 0x81)
+
+		dev.WritePort(PortA, 0x0F)
+		dev.ReadPort(PortB)
+		if state, ok := dev.LastKnownPort(PortA); !ok || state != 0x0F {
+			t.Errorf("unexpected port A 0x%02x", state)
+		}
+		if state, ok, _ := dev.LastKnownPin(16); !ok || state == Low {
+			t.Error("expected pin 16 high")
+		}
+		if state, ok, _ := dev.LastKnownPin(10); !ok || state != Low {
+			t.Error("expected pin 10 low")
+		}
+	})
+
+	t.Run("writes update outputs only", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOA, 0xF0)
+
+		dev.ReadPort(PortA)
+		dev.SetPortMode(PortA, Mode(0xF0))
+		dev.WritePort(PortA, 0x05)
+		if state, _ := dev.LastKnownPort(PortA); state != 0xF5 {
+			t.Errorf("unexpected port A 0x%02x", state)
+		}
+	})
+
+	t.Run("remembers polled ports", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(GPIOA, 0x12)
+		file.SetRegister(GPIOB, 0x34)
+
+		if _, err := dev.ReadPorts(); err != nil {
+			t.Fatal(err)
+		}
+		a, okA := dev.LastKnownPort(PortA)
+		b, okB := dev.LastKnownPort(PortB)
+		if !okA || !okB || a != 0x12 || b != 0x34 {
+			t.Errorf("unexpected ports 0x%02x 0x%02x", a, b)
+		}
+	})
+
+	t.Run("does not allocate", func(t *testing.T) {
+		dev := NewDevice(nopBus{}, 0x20, &sync.Mutex{})
+		if n := testing.AllocsPerRun(100, func() { dev.LastKnownPin(3) }); n != 0 {
+			t.Error("LastKnownPin allocates", n)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package iopi
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Latency of register reads measured by Device.Benchmark
+type Latency struct {
+	Min time.Duration
+	Avg time.Duration
+	P99 time.Duration // 99th percentile
+}
+
+func (l Latency) String() string {
+	return fmt.Sprintf("min %s, avg %s, p99 %s", l.Min, l.Avg, l.P99)
+}
+
+// Measure `n` round-trip reads of a register, so applications can tune
+// polling intervals and PWM rates to the bus of the installation. Reads
+// GPIOA, which has no side effects, and includes the time waiting for the
+// bus mutex.
+func (dev *Device) Benchmark(n int) (Latency, error) {
+	if n < 1 {
+		return Latency{}, fmt.Errorf("invalid number of reads: %d", n)
+	}
+
+	samples := make([]time.Duration, n)
+	var total time.Duration
+	for i := range samples {
+		start := time.Now()
+		if _, err := dev.ReadByteData(GPIOA); err != nil {
+			return Latency{}, fmt.Errorf("failed to benchmark: %w", err)
+		}
+		samples[i] = time.Since(start)
+		total += samples[i]
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return Latency{
+		Min: samples[0],
+		Avg: total / time.Duration(n),
+		P99: samples[(n*99+99)/100-1],
+	}, nil
+}
@@ -0,0 +1,34 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBenchmark(t *testing.T) {
+	t.Run("measures reads", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		l, err := dev.Benchmark(50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(file.CallHistory) != 2*50 {
+			t.Error("expected 50 reads", len(file.CallHistory))
+		}
+		if l.Min > l.Avg || l.Min > l.P99 {
+			t.Error("unexpected latency", l)
+		}
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		dev := NewDevice(failingBus{}, 0x20, &sync.Mutex{})
+		if _, err := dev.Benchmark(10); err == nil {
+			t.Error("expected error")
+		}
+		if _, err := dev.Benchmark(0); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
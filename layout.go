@@ -0,0 +1,60 @@
+package iopi
+
+import "fmt"
+
+// The configuration of the pins at startup, applied by InitLayout. Each
+// field holds a bit per pin of port A and B. The zero value is the chip
+// reset default: all pins are inputs without pull-ups, and latches are low.
+type Layout struct {
+	State    [2]byte // output latches
+	Outputs  [2]byte // pins set to output, all others are inputs
+	Pullup   [2]byte // pins with the 100K pull-up resistor enabled
+	Inverted [2]byte // inputs with inverted polarity
+}
+
+// Initialise the device and program all pins from a layout in one pass.
+// Output latches are set before anything else, and directions last, so
+// pins switched to output start in their safe state and no pin is
+// briefly misconfigured, e.g. relays glitching through the chip default.
+// The bus at Path is opened unless the device already has one, e.g. from
+// NewDevice or Open. You are expected to call `.Close()` to clean up
+// resources when you're done.
+func (dev *Device) InitLayout(l Layout) error {
+	if err := ValidateAddress(dev.Address); err != nil {
+		return err
+	}
+	if dev.bus == nil {
+		if err := dev.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := dev.applyLayout(l); err != nil {
+		return fmt.Errorf("failed to initialise device: %w", err)
+	}
+
+	return nil
+}
+
+// Write the registers of a layout, in the order they must be applied.
+func (dev *Device) applyLayout(l Layout) error {
+	for _, w := range []struct {
+		reg Register
+		val byte
+	}{
+		{IOCON, 0x22}, // MCP23017 specific, register addresses depend on it
+		{OLATA, l.State[PortA]},
+		{OLATB, l.State[PortB]},
+		{IPOLA, l.Inverted[PortA]},
+		{IPOLB, l.Inverted[PortB]},
+		{GPPUA, l.Pullup[PortA]},
+		{GPPUB, l.Pullup[PortB]},
+		{IODIRA, ^l.Outputs[PortA]},
+		{IODIRB, ^l.Outputs[PortB]},
+	} {
+		if err := dev.WriteByteData(w.reg, w.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestApplyLayout(t *testing.T) {
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+	err := dev.applyLayout(Layout{
+		State:    [2]byte{0x81, 0x02},
+		Outputs:  [2]byte{0x0F, 0x00},
+		Pullup:   [2]byte{0x00, 0x30},
+		Inverted: [2]byte{0x10, 0x00},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Latches first and directions last, one write per register
+	expected := []Call{
+		{"Write", []byte{byte(IOCON), 0x22}},
+		{"Write", []byte{byte(OLATA), 0x81}},
+		{"Write", []byte{byte(OLATB), 0x02}},
+		{"Write", []byte{byte(IPOLA), 0x10}},
+		{"Write", []byte{byte(IPOLB), 0x00}},
+		{"Write", []byte{byte(GPPUA), 0x00}},
+		{"Write", []byte{byte(GPPUB), 0x30}},
+		{"Write", []byte{byte(IODIRA), 0xF0}},
+		{"Write", []byte{byte(IODIRB), 0xFF}},
+	}
+	if len(file.CallHistory) != len(expected) {
+		t.Fatal("unexpected calls", file.CallHistory)
+	}
+	for i, c := range expected {
+		if file.CallHistory[i].String() != c.String() {
+			t.Error("unexpected call", i, file.CallHistory[i])
+		}
+	}
+}
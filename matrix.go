@@ -0,0 +1,134 @@
+package iopi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Matrix drives an 8x8 LED matrix by time-multiplexing its rows, with the
+// rows on port A (pin 1 is row 0) and the columns on port B (pin 9 is
+// column 0). One row is lit at a time while Run refreshes the display.
+//
+// Each row takes two or three bus transactions, which is about 1ms at
+// 100kHz, so expect a refresh rate around 100Hz on a 400kHz bus and some
+// flicker on slower buses. Refresh writes bypass the journal and output
+// store of the device.
+type Matrix struct {
+	RowActiveLow    bool          // rows are selected by pulling them low, e.g. common cathode rows
+	ColumnActiveLow bool          // LEDs light when their column is low
+	RowTime         time.Duration // extra time each row is lit; 0 is as fast as the bus allows
+	Clock           Clock
+
+	dev   *Device
+	mutex sync.Mutex
+	buf   [8]byte // a bit per column of each row
+}
+
+// Create a matrix on a device. Both ports must be set to output beforehand.
+func NewMatrix(dev *Device) *Matrix {
+	return &Matrix{dev: dev}
+}
+
+// Turn the LED at column `x` and row `y` on or off.
+func (m *Matrix) Set(x, y int, on bool) error {
+	if x < 0 || x > 7 || y < 0 || y > 7 {
+		return fmt.Errorf("invalid position: %d,%d", x, y)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	v := 0
+	if on {
+		v = 1
+	}
+	m.buf[y] = SetBit(m.buf[y], uint8(x), v)
+	return nil
+}
+
+// Replace the frame buffer with a bit per column of each row.
+func (m *Matrix) SetFrame(rows [8]byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.buf = rows
+}
+
+// Return a copy of the frame buffer.
+func (m *Matrix) Frame() [8]byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.buf
+}
+
+// Turn all LEDs off.
+func (m *Matrix) Clear() {
+	m.SetFrame([8]byte{})
+}
+
+// Refresh the display until the context is cancelled, then blank it.
+func (m *Matrix) Run(ctx context.Context) error {
+	defer m.blank()
+
+	for {
+		for row := 0; row < 8; row++ {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+
+			if err := m.showRow(row); err != nil {
+				return err
+			}
+			sleep(m.Clock, m.RowTime)
+		}
+	}
+}
+
+// Light a single row of the frame buffer. Columns are blanked while the
+// row is switched, so the previous row does not ghost into the next.
+func (m *Matrix) showRow(row int) error {
+	m.mutex.Lock()
+	cols := m.buf[row]
+	m.mutex.Unlock()
+
+	for _, w := range []struct {
+		reg Register
+		val byte
+	}{
+		{GPIOB, m.columns(0)},
+		{GPIOA, m.rows(1 << row)},
+		{GPIOB, m.columns(cols)},
+	} {
+		if err := m.dev.WriteByteData(w.reg, w.val); err != nil {
+			return fmt.Errorf("failed to refresh matrix: %w", err)
+		}
+	}
+	return nil
+}
+
+// Turn all rows and columns off.
+func (m *Matrix) blank() error {
+	if err := m.dev.WriteByteData(GPIOB, m.columns(0)); err != nil {
+		return err
+	}
+	return m.dev.WriteByteData(GPIOA, m.rows(0))
+}
+
+// Return the port value selecting rows, given a bit per row.
+func (m *Matrix) rows(selected byte) byte {
+	if m.RowActiveLow {
+		return ^selected
+	}
+	return selected
+}
+
+// Return the port value lighting columns, given a bit per column.
+func (m *Matrix) columns(lit byte) byte {
+	if m.ColumnActiveLow {
+		return ^lit
+	}
+	return lit
+}
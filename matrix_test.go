@@ -0,0 +1,72 @@
+package iopi
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatrix(t *testing.T) {
+	t.Run("sets pixels", func(t *testing.T) {
+		m := NewMatrix(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}))
+		m.Set(0, 0, true)
+		m.Set(7, 2, true)
+		m.Set(0, 0, false)
+
+		if m.Frame() != [8]byte{0, 0, 0x80} {
+			t.Error("unexpected frame", m.Frame())
+		}
+		if m.Set(8, 0, true) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("shows rows with blanking", func(t *testing.T) {
+		file := NewFakeFile()
+		m := NewMatrix(NewDevice(file, 0x20, &sync.Mutex{}))
+		m.RowActiveLow = true
+		m.SetFrame([8]byte{0, 0, 0x81})
+
+		if err := m.showRow(2); err != nil {
+			t.Fatal(err)
+		}
+		expected := []Call{
+			{"Write", []byte{byte(GPIOB), 0x00}},
+			{"Write", []byte{byte(GPIOA), 0xFB}},
+			{"Write", []byte{byte(GPIOB), 0x81}},
+		}
+		if !reflect.DeepEqual(file.CallHistory, expected) {
+			t.Error("unexpected calls", file.CallHistory)
+		}
+	})
+
+	t.Run("refreshes until cancelled", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		m := NewMatrix(dev)
+		m.ColumnActiveLow = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every row was selected, and the display is blank afterwards
+		rows := make(map[byte]bool)
+		for _, v := range registerWrites(file, GPIOA) {
+			rows[v] = true
+		}
+		for row := 0; row < 8; row++ {
+			if !rows[1<<row] {
+				t.Error("row not shown", row)
+			}
+		}
+		calls := file.CallHistory[len(file.CallHistory)-2:]
+		if calls[0].Arg[1] != 0xFF || calls[1].Arg[1] != 0x00 {
+			t.Error("display not blanked", calls)
+		}
+	})
+}
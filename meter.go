@@ -0,0 +1,189 @@
+package iopi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// PulseMeter accumulates the pulses of an S0 or other impulse output of an
+// energy, gas or water meter on an input pin, and calculates the total and
+// the current rate of consumption. Totals are persisted so they survive a
+// restart.
+type PulseMeter struct {
+	// Pulses per unit, e.g. 1000 for a meter marked 1000 imp/kWh
+	PulsesPerUnit float64
+	// Pulses sooner than this after the previous pulse are taken as
+	// contact bounce. S0 pulses and pauses are at least 30ms long.
+	MinGap time.Duration
+	// Pulses pull the pin low, as S0 outputs do when wired with a pull-up
+	ActiveLow bool
+	// Persist the total at most this often while running. It is always
+	// persisted when Run returns.
+	SaveInterval time.Duration
+	Clock        Clock
+
+	pin    uint8
+	poller *Poller
+	path   string
+	mutex  sync.Mutex
+	pulses uint64
+	last   time.Time     // time of the last pulse
+	period time.Duration // between the last two pulses
+	dirty  bool          // pulses not yet persisted
+}
+
+type storedPulses struct {
+	Pulses uint64 `json:"pulses"`
+}
+
+// Create a meter counting pulses on a pin watched by a poller, persisting
+// the total to the file at `path`. The total is not persisted if path is
+// empty. The poller must be run separately, and often enough to see every
+// pulse.
+func NewPulseMeter(poller *Poller, pin uint8, pulsesPerUnit float64, path string) *PulseMeter {
+	return &PulseMeter{
+		PulsesPerUnit: pulsesPerUnit,
+		MinGap:        30 * time.Millisecond,
+		ActiveLow:     true,
+		SaveInterval:  time.Minute,
+		pin:           pin,
+		poller:        poller,
+		path:          path,
+	}
+}
+
+// Restore the persisted total. Returns an error satisfying os.IsNotExist if
+// nothing has been stored yet.
+func (m *PulseMeter) Load() error {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return err
+	}
+
+	var stored storedPulses
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to parse meter total: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pulses = stored.Pulses
+	return nil
+}
+
+// Persist the total if it changed since it was last persisted.
+func (m *PulseMeter) Save() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.path == "" || !m.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(storedPulses{m.pulses})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.path, data); err != nil {
+		return fmt.Errorf("failed to save meter total: %w", err)
+	}
+	m.dirty = false
+	return nil
+}
+
+// Count pulses until the context is cancelled, persisting the total every
+// SaveInterval and on return.
+func (m *PulseMeter) Run(ctx context.Context) error {
+	events, cancel := m.poller.Subscribe()
+	defer cancel()
+
+	clock := ClockOr(m.Clock)
+	save := clock.After(m.SaveInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return m.Save()
+		case ev := <-events:
+			if ev.Pin == m.pin {
+				m.count(ev)
+			}
+		case <-save:
+			if err := m.Save(); err != nil {
+				return err
+			}
+			save = clock.After(m.SaveInterval)
+		}
+	}
+}
+
+// Count a change of the pin if it starts a pulse.
+func (m *PulseMeter) count(ev PinEvent) {
+	if (ev.State == Low) != m.ActiveLow {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.last.IsZero() {
+		gap := ev.Time.Sub(m.last)
+		if gap < m.MinGap {
+			return
+		}
+		m.period = gap
+	}
+	m.last = ev.Time
+	m.pulses++
+	m.dirty = true
+}
+
+// Return the number of pulses counted.
+func (m *PulseMeter) Pulses() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.pulses
+}
+
+// Return the total in units, e.g. kWh.
+func (m *PulseMeter) Total() float64 {
+	return float64(m.Pulses()) / m.PulsesPerUnit
+}
+
+// Set the total in units, e.g. to match the display of the meter. The new
+// total is persisted on the next save.
+func (m *PulseMeter) SetTotal(units float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.pulses = uint64(units*m.PulsesPerUnit + 0.5)
+	m.dirty = true
+}
+
+// Return the current rate in units per hour, e.g. kW for a meter counting
+// kWh. The rate is taken from the time between the last two pulses, and
+// falls off as the next pulse is overdue. It is 0 until two pulses have
+// been counted.
+func (m *PulseMeter) Rate() float64 {
+	return m.rateAt(ClockOr(m.Clock).Now())
+}
+
+func (m *PulseMeter) rateAt(now time.Time) float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.period == 0 {
+		return 0
+	}
+
+	period := m.period
+	if since := now.Sub(m.last); since > period {
+		period = since
+	}
+	return time.Hour.Seconds() / period.Seconds() / m.PulsesPerUnit
+}
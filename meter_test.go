@@ -0,0 +1,87 @@
+package iopi
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPulseMeter(t *testing.T) {
+	newMeter := func(path string) *PulseMeter {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		return NewPulseMeter(NewPoller(dev, time.Millisecond, 3), 3, 1000, path)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pulse := func(m *PulseMeter, at time.Duration) {
+		m.count(PinEvent{Pin: 3, State: Low, Time: start.Add(at)})
+		m.count(PinEvent{Pin: 3, State: High, Time: start.Add(at + 50*time.Millisecond)})
+	}
+
+	t.Run("counts pulses and calculates rate", func(t *testing.T) {
+		m := newMeter("")
+
+		// 1000 imp/kWh with a pulse every 3.6s is 1 kW
+		for i := 0; i < 10; i++ {
+			pulse(m, time.Duration(i)*3600*time.Millisecond)
+		}
+		if m.Pulses() != 10 || m.Total() != 0.01 {
+			t.Error("unexpected total", m.Pulses(), m.Total())
+		}
+
+		last := start.Add(9 * 3600 * time.Millisecond)
+		if r := m.rateAt(last.Add(time.Second)); math.Abs(r-1) > 1e-9 {
+			t.Error("unexpected rate", r)
+		}
+		if r := m.rateAt(last.Add(7200 * time.Millisecond)); math.Abs(r-0.5) > 1e-9 {
+			t.Error("rate not falling off", r)
+		}
+	})
+
+	t.Run("ignores bounces", func(t *testing.T) {
+		m := newMeter("")
+		pulse(m, 0)
+		pulse(m, 5*time.Millisecond)
+		pulse(m, 100*time.Millisecond)
+		if m.Pulses() != 2 {
+			t.Error("unexpected pulses", m.Pulses())
+		}
+	})
+
+	t.Run("counts active high pulses", func(t *testing.T) {
+		m := newMeter("")
+		m.ActiveLow = false
+		m.count(PinEvent{Pin: 3, State: High, Time: start})
+		m.count(PinEvent{Pin: 3, State: Low, Time: start.Add(time.Second)})
+		if m.Pulses() != 1 {
+			t.Error("unexpected pulses", m.Pulses())
+		}
+	})
+
+	t.Run("persists totals", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "meter.json")
+
+		m := newMeter(path)
+		if err := m.Load(); !os.IsNotExist(err) {
+			t.Error("expected not exist error, got", err)
+		}
+		m.SetTotal(1234.5)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := newMeter(path)
+		if err := loaded.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Pulses() != 1234500 {
+			t.Error("unexpected pulses", loaded.Pulses())
+		}
+	})
+}
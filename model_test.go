@@ -0,0 +1,205 @@
+package iopi
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// A reference model of what the API promises for each pin, with none of
+// the register access of the driver.
+type pinModel struct {
+	output   [17]bool
+	pullup   [17]bool
+	inverted [17]bool
+	latch    [17]bool
+	driven   [17]bool // driven from outside the chip
+	external [17]bool // level of driven pins
+}
+
+// Return the level of a pin as seen from outside the chip.
+func (m *pinModel) level(pin uint8) bool {
+	switch {
+	case m.output[pin]:
+		return m.latch[pin]
+	case m.driven[pin]:
+		return m.external[pin]
+	default:
+		return m.pullup[pin]
+	}
+}
+
+// Return the state ReadPin should return.
+func (m *pinModel) read(pin uint8) State {
+	level := m.level(pin)
+	if !m.output[pin] && m.inverted[pin] {
+		level = !level
+	}
+	if level {
+		return 1
+	}
+	return 0
+}
+
+func portPins(port Port) []uint8 {
+	if port == PortB {
+		return []uint8{9, 10, 11, 12, 13, 14, 15, 16}
+	}
+	return []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+}
+
+// An API call applied to both the model and the driver
+type modelOp struct {
+	name  string
+	apply func(m *pinModel, dev *Device, chip *iopitest.Chip) error
+}
+
+func randomOp(r *rand.Rand) modelOp {
+	pin := uint8(r.Intn(16) + 1)
+	port := Port(r.Intn(2))
+	on := r.Intn(2) == 1
+	val := byte(r.Intn(256))
+
+	bitsOf := func(set func(pin uint8, on bool)) {
+		for i, p := range portPins(port) {
+			set(p, val&(1<<i) != 0)
+		}
+	}
+
+	switch r.Intn(10) {
+	case 0:
+		mode := Input
+		if on {
+			mode = Output
+		}
+		return modelOp{fmt.Sprintf("SetPinMode(%d, %t)", pin, on), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			m.output[pin] = on
+			return dev.SetPinMode(pin, mode)
+		}}
+	case 1:
+		return modelOp{fmt.Sprintf("SetPortMode(%d, 0x%02x)", port, val), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			bitsOf(func(p uint8, on bool) { m.output[p] = !on })
+			return dev.SetPortMode(port, Mode(val))
+		}}
+	case 2:
+		mode := PullupDisabled
+		if on {
+			mode = PullupEnabled
+		}
+		return modelOp{fmt.Sprintf("SetPinPullup(%d, %t)", pin, on), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			m.pullup[pin] = on
+			return dev.SetPinPullup(pin, mode)
+		}}
+	case 3:
+		return modelOp{fmt.Sprintf("SetPortPullup(%d, 0x%02x)", port, val), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			bitsOf(func(p uint8, on bool) { m.pullup[p] = on })
+			return dev.SetPortPullup(port, Mode(val))
+		}}
+	case 4:
+		pol := PolarityNormal
+		if on {
+			pol = PolarityInverted
+		}
+		return modelOp{fmt.Sprintf("SetPinPolarity(%d, %t)", pin, on), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			m.inverted[pin] = on
+			return dev.SetPinPolarity(pin, pol)
+		}}
+	case 5:
+		state := Low
+		if on {
+			state = High
+		}
+		return modelOp{fmt.Sprintf("WritePin(%d, %t)", pin, on), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			m.latch[pin] = on
+			return dev.WritePin(pin, state)
+		}}
+	case 6:
+		return modelOp{fmt.Sprintf("WritePort(%d, 0x%02x)", port, val), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			bitsOf(func(p uint8, on bool) { m.latch[p] = on })
+			return dev.WritePort(port, val)
+		}}
+	case 7:
+		pins := []uint8{pin, uint8(r.Intn(16) + 1)}
+		if pins[0] == pins[1] {
+			pins = pins[:1]
+		}
+		v := uint(r.Intn(1 << len(pins)))
+		return modelOp{fmt.Sprintf("PinGroup(%v).WriteValue(%d)", pins, v), func(m *pinModel, dev *Device, _ *iopitest.Chip) error {
+			for i, p := range pins {
+				m.latch[p] = v&(1<<i) != 0
+			}
+			return NewPinGroup(dev, pins...).WriteValue(v)
+		}}
+	case 8:
+		return modelOp{fmt.Sprintf("chip.SetInput(%d, %t)", pin, on), func(m *pinModel, _ *Device, chip *iopitest.Chip) error {
+			m.driven[pin], m.external[pin] = true, on
+			chip.SetInput(pin, on)
+			return nil
+		}}
+	default:
+		return modelOp{fmt.Sprintf("chip.Release(%d)", pin), func(m *pinModel, _ *Device, chip *iopitest.Chip) error {
+			m.driven[pin] = false
+			chip.Release(pin)
+			return nil
+		}}
+	}
+}
+
+// Return a description of the pins where the driver and model differ.
+func compareModel(m *pinModel, dev *Device, chip *iopitest.Chip) (string, error) {
+	var diffs []string
+	for pin := uint8(1); pin <= 16; pin++ {
+		state, err := dev.ReadPin(pin)
+		if err != nil {
+			return "", err
+		}
+		if state != m.read(pin) {
+			diffs = append(diffs, fmt.Sprintf("pin %d read %d, model %d", pin, state, m.read(pin)))
+		}
+		if chip.IsOutput(pin) != m.output[pin] {
+			diffs = append(diffs, fmt.Sprintf("pin %d output %t, model %t", pin, chip.IsOutput(pin), m.output[pin]))
+		}
+		if chip.Level(pin) != m.level(pin) {
+			diffs = append(diffs, fmt.Sprintf("pin %d level %t, model %t", pin, chip.Level(pin), m.level(pin)))
+		}
+	}
+	return strings.Join(diffs, "; "), nil
+}
+
+// Apply random sequences of calls to the driver on a fake chip and to a
+// reference model, and check that all pins agree after every call.
+func TestModel(t *testing.T) {
+	const sequences, length = 200, 50
+
+	for seed := int64(1); seed <= sequences; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		chip := iopitest.NewChip()
+		dev := NewDevice(chip, 0x20, &sync.Mutex{})
+		if err := dev.Init(); err != nil {
+			t.Fatal(err)
+		}
+		m := &pinModel{}
+
+		var log []string
+		for i := 0; i < length; i++ {
+			op := randomOp(r)
+			log = append(log, op.name)
+			if err := op.apply(m, dev, chip); err != nil {
+				t.Fatalf("seed %d: %s failed: %s", seed, op.name, err)
+			}
+
+			diff, err := compareModel(m, dev, chip)
+			if err != nil {
+				t.Fatalf("seed %d: %s", seed, err)
+			}
+			if diff != "" {
+				t.Fatalf("seed %d: driver and model differ after:\n\t%s\n%s",
+					seed, strings.Join(log, "\n\t"), diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package iopi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Returned when triggering a Momentary output that is pulsing or has not
+// yet rested for its hold-off time
+var ErrBusy = errors.New("momentary output is busy")
+
+// Momentary drives an output pin of pulse-activated hardware, such as a
+// garage door opener, gate controller or reset line, which must be pulsed
+// rather than held. Pulses turn the pin on with SetActive, so active-low
+// relay boards work too. The pin must be set to output beforehand.
+type Momentary struct {
+	Width   time.Duration // of a pulse
+	Holdoff time.Duration // from the end of a pulse until the next may start
+	Clock   Clock
+
+	dev   *Device
+	pin   uint8
+	mutex sync.Mutex
+	busy  bool
+	until time.Time // end of the hold-off of the last pulse
+}
+
+func NewMomentary(dev *Device, pin uint8, width time.Duration) *Momentary {
+	return &Momentary{Width: width, dev: dev, pin: pin}
+}
+
+// Pulse the pin, returning once it is off again. Returns ErrBusy without
+// touching the pin if a pulse is in progress or within its hold-off time,
+// so repeated presses of a button don't reverse a door halfway. The pin is
+// turned off early if the context is cancelled.
+func (m *Momentary) Trigger(ctx context.Context) error {
+	clock := ClockOr(m.Clock)
+
+	m.mutex.Lock()
+	if m.busy || clock.Now().Before(m.until) {
+		m.mutex.Unlock()
+		return ErrBusy
+	}
+	m.busy = true
+	m.mutex.Unlock()
+
+	defer func() {
+		m.mutex.Lock()
+		m.busy = false
+		m.until = clock.Now().Add(m.Holdoff)
+		m.mutex.Unlock()
+	}()
+
+	if err := m.dev.SetActive(m.pin, true); err != nil {
+		return fmt.Errorf("failed to pulse pin %d: %w", m.pin, err)
+	}
+	SleepContext(ctx, clock, m.Width)
+	if err := m.dev.SetActive(m.pin, false); err != nil {
+		return fmt.Errorf("failed to release pin %d: %w", m.pin, err)
+	}
+	return ctx.Err()
+}
+
+// Return true while a pulse is in progress or within its hold-off time.
+func (m *Momentary) Busy() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.busy || ClockOr(m.Clock).Now().Before(m.until)
+}
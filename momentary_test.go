@@ -0,0 +1,82 @@
+package iopi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+func TestMomentary(t *testing.T) {
+	t.Run("pulses the pin", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(OLATA, 0x00)
+		clock := newRecordingClock()
+		m := NewMomentary(dev, 2, 500*time.Millisecond)
+		m.Clock = clock
+
+		if err := m.Trigger(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0x02}) {
+			t.Error("pin not turned on", file.CallHistory)
+		}
+		last := file.CallHistory[len(file.CallHistory)-1]
+		if last.Fn != "Write" || last.Arg[0] != byte(GPIOA) || GetBit(last.Arg[1], 1) != 0 {
+			t.Error("pin not left off", last)
+		}
+		if waits := clock.Waits(); len(waits) != 1 || waits[0] != 500*time.Millisecond {
+			t.Error("unexpected waits", waits)
+		}
+	})
+
+	t.Run("refuses triggers within the hold-off", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		clock.AutoAdvance(true)
+		m := NewMomentary(dev, 1, time.Second)
+		m.Holdoff = 10 * time.Second
+		m.Clock = clock
+
+		if err := m.Trigger(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if !m.Busy() {
+			t.Error("expected busy during hold-off")
+		}
+		if err := m.Trigger(context.Background()); err != ErrBusy {
+			t.Error("expected ErrBusy, got", err)
+		}
+
+		clock.Advance(10 * time.Second)
+		if m.Busy() {
+			t.Error("expected idle after hold-off")
+		}
+		if err := m.Trigger(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("releases early when cancelled", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		dev.SetActiveLow(3, true)
+		file.SetRegister(OLATA, 0xFF)
+		m := NewMomentary(dev, 3, time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := m.Trigger(ctx); err != context.Canceled {
+			t.Error("expected cancellation, got", err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0xFB}) {
+			t.Error("active-low pin not pulled low", file.CallHistory)
+		}
+		if m.Busy() {
+			t.Error("expected idle")
+		}
+	})
+}
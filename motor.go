@@ -0,0 +1,153 @@
+package iopi
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type MotorDirection int
+
+const (
+	Coast   MotorDirection = iota // bridge off, the motor turns freely
+	Forward                       // A high side and B low side on
+	Reverse                       // B high side and A low side on
+	Brake                         // motor terminals shorted
+)
+
+func (d MotorDirection) String() string {
+	switch d {
+	case Coast:
+		return "coast"
+	case Forward:
+		return "forward"
+	case Reverse:
+		return "reverse"
+	case Brake:
+		return "brake"
+	default:
+		return "unknown"
+	}
+}
+
+// Pins of an H-bridge, numbered 1-16. Driver chips like the L298 take two
+// inputs, A and B. Bridges of discrete transistors also take LowA and LowB
+// for the low side switches, and A and B drive the high side. Enable is
+// optional. Unused pins are 0.
+type MotorPins struct {
+	A, B       uint8
+	LowA, LowB uint8
+	Enable     uint8
+}
+
+// Motor drives a DC motor through an H-bridge. All bridge pins are switched
+// off for DeadTime between conflicting states, so both switches of a leg
+// are never on at once, and the motor is not reversed at speed.
+type Motor struct {
+	DeadTime time.Duration
+	Clock    Clock
+
+	pins      MotorPins
+	bridge    *PinGroup
+	mutex     sync.Mutex
+	direction MotorDirection
+}
+
+// Create a motor on an H-bridge. Pins must be set to output beforehand.
+// The motor starts coasting.
+func NewMotor(dev *Device, pins MotorPins) (*Motor, error) {
+	if (pins.LowA == 0) != (pins.LowB == 0) {
+		return nil, fmt.Errorf("both or none of the low side pins must be given")
+	}
+
+	var used []uint8
+	for _, pin := range []uint8{pins.A, pins.B, pins.LowA, pins.LowB, pins.Enable} {
+		if pin != 0 {
+			used = append(used, pin)
+		}
+	}
+	if pins.A == 0 || pins.B == 0 {
+		return nil, fmt.Errorf("pins A and B are required")
+	}
+
+	m := &Motor{
+		DeadTime: 100 * time.Millisecond,
+		pins:     pins,
+		bridge:   NewPinGroup(dev, used...),
+	}
+	if err := m.bridge.WriteValue(0); err != nil {
+		return nil, fmt.Errorf("failed to stop motor: %w", err)
+	}
+	return m, nil
+}
+
+// Return the current direction.
+func (m *Motor) Direction() MotorDirection {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.direction
+}
+
+// Drive the motor in a direction. Blocks for DeadTime if the bridge must
+// be switched off first.
+func (m *Motor) Set(dir MotorDirection) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if dir == m.direction {
+		return nil
+	}
+	state, err := m.state(dir)
+	if err != nil {
+		return err
+	}
+
+	if m.direction != Coast && dir != Coast {
+		if err := m.bridge.WriteValue(0); err != nil {
+			return fmt.Errorf("failed to stop motor: %w", err)
+		}
+		m.direction = Coast
+		sleep(m.Clock, m.DeadTime)
+	}
+
+	if err := m.bridge.WriteValue(state); err != nil {
+		return fmt.Errorf("failed to drive motor %s: %w", dir, err)
+	}
+	m.direction = dir
+	return nil
+}
+
+// Return the value of the bridge pins for a direction.
+func (m *Motor) state(dir MotorDirection) (uint, error) {
+	levels := make(map[uint8]bool)
+	discrete := m.pins.LowA != 0
+
+	switch dir {
+	case Coast:
+	case Forward:
+		levels[m.pins.A] = true
+		levels[m.pins.LowB] = discrete
+	case Reverse:
+		levels[m.pins.B] = true
+		levels[m.pins.LowA] = discrete
+	case Brake:
+		if discrete {
+			levels[m.pins.LowA], levels[m.pins.LowB] = true, true
+		} else {
+			levels[m.pins.A], levels[m.pins.B] = true, true
+		}
+	default:
+		return 0, fmt.Errorf("invalid direction: %d", dir)
+	}
+	if dir != Coast {
+		levels[m.pins.Enable] = true
+	}
+
+	var state uint
+	for i, pin := range m.bridge.pins {
+		if levels[pin] {
+			state |= 1 << i
+		}
+	}
+	return state, nil
+}
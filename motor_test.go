@@ -0,0 +1,91 @@
+package iopi
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMotor(t *testing.T, pins MotorPins) (*Motor, *FakeFile, *recordingClock) {
+	file := NewFakeFile()
+	m, err := NewMotor(NewDevice(file, 0x20, &sync.Mutex{}), pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newRecordingClock()
+	m.Clock = clock
+	return m, file, clock
+}
+
+// Return the states of pins 1-4 written to port A
+func bridgeStates(file *FakeFile) []byte {
+	var states []byte
+	for _, v := range registerWrites(file, GPIOA) {
+		states = append(states, v&0x0F)
+	}
+	return states
+}
+
+func TestMotor(t *testing.T) {
+	t.Run("drives a two pin bridge with enable", func(t *testing.T) {
+		m, file, clock := newTestMotor(t, MotorPins{A: 1, B: 2, Enable: 3})
+
+		m.Set(Forward)
+		m.Set(Coast)
+		m.Set(Reverse)
+		m.Set(Brake)
+
+		expected := []byte{0b000, 0b101, 0b000, 0b110, 0b000, 0b111}
+		if states := bridgeStates(file); !reflect.DeepEqual(states, expected) {
+			t.Errorf("unexpected states: %03b", states)
+		}
+		if len(clock.Waits()) != 1 || m.Direction() != Brake {
+			t.Error("expected dead time before braking", clock.Waits(), m.Direction())
+		}
+	})
+
+	t.Run("switches off between directions", func(t *testing.T) {
+		m, file, clock := newTestMotor(t, MotorPins{A: 1, B: 2, LowA: 3, LowB: 4})
+		m.DeadTime = time.Second
+
+		m.Set(Forward)
+		m.Set(Reverse)
+
+		expected := []byte{0b0000, 0b1001, 0b0000, 0b0110}
+		if states := bridgeStates(file); !reflect.DeepEqual(states, expected) {
+			t.Errorf("unexpected states: %04b", states)
+		}
+		if !reflect.DeepEqual(clock.Waits(), []time.Duration{time.Second}) {
+			t.Error("unexpected dead time", clock.Waits())
+		}
+	})
+
+	t.Run("brakes with low sides", func(t *testing.T) {
+		m, file, _ := newTestMotor(t, MotorPins{A: 1, B: 2, LowA: 3, LowB: 4})
+		m.Set(Brake)
+		if states := bridgeStates(file); states[len(states)-1] != 0b1100 {
+			t.Errorf("unexpected state: %04b", states)
+		}
+	})
+
+	t.Run("ignores repeated directions", func(t *testing.T) {
+		m, file, _ := newTestMotor(t, MotorPins{A: 1, B: 2})
+		m.Set(Forward)
+		n := len(file.CallHistory)
+		m.Set(Forward)
+		if len(file.CallHistory) != n {
+			t.Error("unexpected writes")
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		for _, pins := range []MotorPins{{A: 1}, {A: 1, B: 2, LowA: 3}} {
+			if _, err := NewMotor(dev, pins); err == nil {
+				t.Error("expected error for", pins)
+			}
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package iopi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// How pins are numbered, to match the silkscreen or datasheet at hand.
+// Pin numbers passed to and returned from the rest of the package are
+// always 1-16; a numbering only converts to and from labels.
+type Numbering uint8
+
+const (
+	NumberFromOne  Numbering = iota // 1-16, as printed on the IO Pi boards
+	NumberFromZero                  // 0-15
+	NumberByPort                    // A0-A7 and B0-B7, as in the datasheet
+)
+
+func (n Numbering) String() string {
+	switch n {
+	case NumberFromOne:
+		return "one"
+	case NumberFromZero:
+		return "zero"
+	case NumberByPort:
+		return "port"
+	default:
+		return fmt.Sprintf("Numbering(%d)", uint8(n))
+	}
+}
+
+// Parse a numbering: one, zero or port, in any case.
+func ParseNumbering(s string) (Numbering, error) {
+	switch strings.ToLower(s) {
+	case "one":
+		return NumberFromOne, nil
+	case "zero":
+		return NumberFromZero, nil
+	case "port":
+		return NumberByPort, nil
+	default:
+		return 0, fmt.Errorf("invalid numbering: %s", s)
+	}
+}
+
+// Return the label of a pin numbered from 1. Pins past 16 continue the
+// numbering, e.g. pin 17 is C0 by port, for boards with several chips.
+func (n Numbering) Format(pin int) string {
+	switch n {
+	case NumberFromZero:
+		return strconv.Itoa(pin - 1)
+	case NumberByPort:
+		return fmt.Sprintf("%c%d", 'A'+(pin-1)/8, (pin-1)%8)
+	default:
+		return strconv.Itoa(pin)
+	}
+}
+
+// Return the pin numbered from 1 of a label, see Format. Port letters may
+// be given in any case. The pin is not checked against the number of pins
+// available.
+func (n Numbering) Parse(s string) (int, error) {
+	if n == NumberByPort {
+		if len(s) != 2 {
+			return 0, fmt.Errorf("invalid pin: %s", s)
+		}
+		port := strings.ToUpper(s)[0]
+		bit := s[1]
+		if port < 'A' || port > 'Z' || bit < '0' || bit > '7' {
+			return 0, fmt.Errorf("invalid pin: %s", s)
+		}
+		return int(port-'A')*8 + int(bit-'0') + 1, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pin: %s", s)
+	}
+	if n == NumberFromZero {
+		i++
+	}
+	if i < 1 {
+		return 0, fmt.Errorf("invalid pin: %s", s)
+	}
+	return i, nil
+}
+
+// Return the label of a pin in the numbering of the device.
+func (dev *Device) PinLabel(pin uint8) string {
+	return dev.Numbering.Format(int(pin))
+}
+
+// Return the pin of a label in the numbering of the device, e.g. 9 for
+// "B0" when numbered by port.
+func (dev *Device) ParsePin(s string) (uint8, error) {
+	pin, err := dev.Numbering.Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	if pin > 16 {
+		return 0, fmt.Errorf("invalid pin: %s", s)
+	}
+	return uint8(pin), nil
+}
@@ -0,0 +1,76 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNumbering(t *testing.T) {
+	t.Run("converts labels", func(t *testing.T) {
+		for _, c := range []struct {
+			n     Numbering
+			pin   int
+			label string
+		}{
+			{NumberFromOne, 1, "1"},
+			{NumberFromOne, 16, "16"},
+			{NumberFromZero, 1, "0"},
+			{NumberFromZero, 16, "15"},
+			{NumberByPort, 1, "A0"},
+			{NumberByPort, 8, "A7"},
+			{NumberByPort, 9, "B0"},
+			{NumberByPort, 16, "B7"},
+		} {
+			if label := c.n.Format(c.pin); label != c.label {
+				t.Errorf("%s: pin %d formatted as %s", c.n, c.pin, label)
+			}
+			if pin, err := c.n.Parse(c.label); err != nil || pin != c.pin {
+				t.Errorf("%s: %s parsed as %d, %v", c.n, c.label, pin, err)
+			}
+		}
+	})
+
+	t.Run("rejects invalid labels", func(t *testing.T) {
+		for _, c := range []struct {
+			n     Numbering
+			label string
+		}{
+			{NumberFromOne, "0"},
+			{NumberFromOne, "A0"},
+			{NumberFromZero, "-1"},
+			{NumberByPort, "A8"},
+			{NumberByPort, "1"},
+			{NumberByPort, "A10"},
+		} {
+			if _, err := c.n.Parse(c.label); err == nil {
+				t.Errorf("%s: expected error for %s", c.n, c.label)
+			}
+		}
+	})
+
+	t.Run("parses numbering names", func(t *testing.T) {
+		for _, n := range []Numbering{NumberFromOne, NumberFromZero, NumberByPort} {
+			if parsed, err := ParseNumbering(n.String()); err != nil || parsed != n {
+				t.Error("unexpected numbering", parsed, err)
+			}
+		}
+		if _, err := ParseNumbering("two"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("parses device pins", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		dev.Numbering = NumberByPort
+
+		if pin, err := dev.ParsePin("b3"); err != nil || pin != 12 {
+			t.Error("unexpected pin", pin, err)
+		}
+		if dev.PinLabel(12) != "B3" {
+			t.Error("unexpected label", dev.PinLabel(12))
+		}
+		if _, err := dev.ParsePin("C0"); err == nil {
+			t.Error("expected error for pin on another chip")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package iopi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// OutputStore persists the output latches of a device to a file on every
+// change, so outputs can be restored after a restart. The file is replaced
+// atomically, so it is never left half-written.
+type OutputStore struct {
+	path  string
+	mutex sync.Mutex
+	state storedOutputs
+	saved bool
+}
+
+type storedOutputs struct {
+	PortA byte `json:"port_a"`
+	PortB byte `json:"port_b"`
+}
+
+// Create a store backed by the file at `path`. The file is created on the
+// first write.
+func NewOutputStore(path string) *OutputStore {
+	return &OutputStore{path: path}
+}
+
+// Read the stored output state. Returns an error satisfying os.IsNotExist
+// if nothing has been stored yet.
+func (s *OutputStore) Load() (portA, portB byte, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse output state: %w", err)
+	}
+	s.saved = true
+
+	return s.state.PortA, s.state.PortB, nil
+}
+
+// Return whether the store holds the state of both ports, either loaded
+// or saved.
+func (s *OutputStore) seeded() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.saved
+}
+
+// Store the state of a port. Nothing is written if it did not change.
+func (s *OutputStore) save(port Port, state byte) error {
+	return s.saveBoth(port, state, nil)
+}
+
+// Store the state of a port, and of the other port if `other` is not nil.
+func (s *OutputStore) saveBoth(port Port, state byte, other *byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	next := s.state
+	if port == PortA {
+		next.PortA = state
+		if other != nil {
+			next.PortB = *other
+		}
+	} else {
+		next.PortB = state
+		if other != nil {
+			next.PortA = *other
+		}
+	}
+	if s.saved && next == s.state {
+		return nil
+	}
+
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save output state: %w", err)
+	}
+
+	s.state, s.saved = next, true
+	return nil
+}
+
+// Replace the file at `path` with `data`, so it is never left
+// half-written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Persist output state in a store on every port or pin write. Pass nil to
+// stop persisting. Until the store holds a state, the first write also
+// saves the output latch of the other port, so it is not stored as zero.
+func (dev *Device) SetOutputStore(s *OutputStore) {
+	dev.store = s
+}
+
+// Save a port state written to the store.
+func (dev *Device) saveOutputs(port Port, state byte) error {
+	if dev.store.seeded() {
+		return dev.store.save(port, state)
+	}
+
+	other, err := dev.readLatch(1 - port)
+	if err != nil {
+		return fmt.Errorf("failed to save output state: %w", err)
+	}
+	return dev.store.saveBoth(port, state, &other)
+}
+
+// Write the output latches saved in the store back to the device. Pin
+// modes are not changed, so this can be done before pins are switched to
+// output to avoid glitches. Returns an error satisfying os.IsNotExist if
+// nothing has been stored yet.
+func (dev *Device) RestoreOutputs(s *OutputStore) error {
+	a, b, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	if err := dev.WriteByteData(OLATA, a); err != nil {
+		return fmt.Errorf("failed to restore outputs: %w", err)
+	}
+	if err := dev.WriteByteData(OLATB, b); err != nil {
+		return fmt.Errorf("failed to restore outputs: %w", err)
+	}
+	return nil
+}
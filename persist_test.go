@@ -0,0 +1,91 @@
+package iopi
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestOutputStore(t *testing.T) {
+	t.Run("saves port writes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outputs.json")
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		dev.SetOutputStore(NewOutputStore(path))
+
+		dev.WritePort(PortA, 0x0F)
+		dev.WritePort(PortB, 0xF0)
+
+		a, b, err := NewOutputStore(path).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a != 0x0F || b != 0xF0 {
+			t.Errorf("unexpected state: 0x%02X 0x%02X", a, b)
+		}
+	})
+
+	t.Run("leaves no temporary files", func(t *testing.T) {
+		dir := t.TempDir()
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		dev.SetOutputStore(NewOutputStore(filepath.Join(dir, "outputs.json")))
+
+		dev.WritePort(PortA, 0x01)
+		dev.WritePort(PortA, 0x02)
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Error("unexpected files", entries)
+		}
+	})
+
+	t.Run("keeps the latch of a port never written", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outputs.json")
+		file := NewFakeFile()
+		file.SetRegister(OLATA, 0x00)
+		file.SetRegister(OLATB, 0xFF)
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		dev.SetOutputStore(NewOutputStore(path))
+
+		if err := dev.WritePin(1, High); err != nil {
+			t.Fatal(err)
+		}
+
+		// Restart
+		file = NewFakeFile()
+		dev = NewDevice(file, 0x20, &sync.Mutex{})
+		if err := dev.RestoreOutputs(NewOutputStore(path)); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(OLATA), 0x01}) || !file.HasCall("Write", []byte{byte(OLATB), 0xFF}) {
+			t.Error("outputs not restored", file.CallHistory)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, _, err := NewOutputStore(filepath.Join(t.TempDir(), "nope")).Load()
+		if !os.IsNotExist(err) {
+			t.Error("expected not exist error", err)
+		}
+	})
+}
+
+func TestRestoreOutputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outputs.json")
+	os.WriteFile(path, []byte(`{"port_a": 1, "port_b": 128}`), 0644)
+
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+	if err := dev.RestoreOutputs(NewOutputStore(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !file.HasCall("Write", []byte{byte(OLATA), 0x01}) || !file.HasCall("Write", []byte{byte(OLATB), 0x80}) {
+		t.Error("outputs not restored", file.CallHistory)
+	}
+	for _, c := range file.CallHistory {
+		if c.Arg[0] == byte(IODIRA) || c.Arg[0] == byte(IODIRB) {
+			t.Error("pin modes changed")
+		}
+	}
+}
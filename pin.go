@@ -0,0 +1,186 @@
+package iopi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Edge selects which transitions trigger a watch handler. The values match
+// embd.Edge.
+type Edge string
+
+const (
+	EdgeNone    Edge = "none"
+	EdgeRising  Edge = "rising"
+	EdgeFalling Edge = "falling"
+	EdgeBoth    Edge = "both"
+)
+
+// Pin is a handle to a single pin on a device. Its method set mirrors the
+// DigitalPin interface of github.com/kidoman/embd, with Mode and Edge in
+// place of embd.Direction and embd.Edge. Package embdpin adapts it to
+// embd.DigitalPin.
+type Pin struct {
+	// How often the pin is sampled by Watch and TimePulse
+	PollInterval time.Duration
+	Clock        Clock
+
+	dev    *Device
+	n      uint8
+	mutex  sync.Mutex
+	cancel func() // stops an active watch
+}
+
+// Return a handle to pin 1-16 on the device.
+func (dev *Device) Pin(n uint8) *Pin {
+	return &Pin{
+		PollInterval: 10 * time.Millisecond,
+		dev:          dev,
+		n:            n,
+	}
+}
+
+// Return the pin number.
+func (p *Pin) N() int {
+	return int(p.n)
+}
+
+// Read the pin, returning 0 or 1.
+func (p *Pin) Read() (int, error) {
+	state, err := p.dev.ReadPin(p.n)
+	return int(state), err
+}
+
+// Write 0 for low, anything else for high.
+func (p *Pin) Write(val int) error {
+	state := Low
+	if val != 0 {
+		state = High
+	}
+	return p.dev.WritePin(p.n, state)
+}
+
+// Set the pin to Input or Output.
+func (p *Pin) SetDirection(mode Mode) error {
+	return p.dev.SetPinMode(p.n, mode)
+}
+
+// Invert the logic level read from an input pin.
+func (p *Pin) ActiveLow(b bool) error {
+	pol := PolarityNormal
+	if b {
+		pol = PolarityInverted
+	}
+	return p.dev.SetPinPolarity(p.n, pol)
+}
+
+// Enable the internal 100K pull-up resistor.
+func (p *Pin) PullUp() error {
+	return p.dev.SetPinPullup(p.n, PullupEnabled)
+}
+
+// The MCP23017 has no pull-down resistors.
+func (p *Pin) PullDown() error {
+	return errors.New("pull-down resistors are not supported")
+}
+
+// Call `handler` on every matching transition of the pin, detected by
+// polling every `PollInterval`. Replaces any previous watch.
+func (p *Pin) Watch(edge Edge, handler func(*Pin)) error {
+	switch edge {
+	case EdgeRising, EdgeFalling, EdgeBoth:
+	case EdgeNone:
+		return p.StopWatching()
+	default:
+		return fmt.Errorf("invalid edge: %s", edge)
+	}
+
+	p.StopWatching()
+
+	poller := NewPoller(p.dev, p.PollInterval, p.n)
+	poller.Clock = p.Clock
+	if err := poller.Poll(); err != nil {
+		return fmt.Errorf("failed to watch pin %d: %w", p.n, err)
+	}
+
+	events, unsubscribe := poller.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go poller.Run(ctx)
+	go func() {
+		for ev := range events {
+			if edge == EdgeBoth ||
+				(edge == EdgeRising && ev.State != Low) ||
+				(edge == EdgeFalling && ev.State == Low) {
+				handler(p)
+			}
+		}
+	}()
+
+	p.mutex.Lock()
+	p.cancel = func() {
+		cancel()
+		unsubscribe()
+	}
+	p.mutex.Unlock()
+
+	return nil
+}
+
+// Stop calling the watch handler.
+func (p *Pin) StopWatching() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	return nil
+}
+
+// Wait for the pin to enter `state` (0 or 1) and return how long it stays
+// there. The resolution is limited by `PollInterval`.
+func (p *Pin) TimePulse(state int) (time.Duration, error) {
+	want := 0
+	if state != 0 {
+		want = 1
+	}
+
+	clock := ClockOr(p.Clock)
+	wait := func(match bool) (time.Time, error) {
+		for {
+			val, err := p.Read()
+			if err != nil {
+				return time.Time{}, err
+			}
+			if (val == want) == match {
+				return clock.Now(), nil
+			}
+			sleep(clock, p.PollInterval)
+		}
+	}
+
+	// Skip a pulse that is already in progress
+	if _, err := wait(false); err != nil {
+		return 0, err
+	}
+	start, err := wait(true)
+	if err != nil {
+		return 0, err
+	}
+	end, err := wait(false)
+	if err != nil {
+		return 0, err
+	}
+
+	return end.Sub(start), nil
+}
+
+// Stop watching the pin. The device is not closed.
+func (p *Pin) Close() error {
+	return p.StopWatching()
+}
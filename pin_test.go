@@ -0,0 +1,90 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	t.Run("writes through device", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		pin := dev.Pin(10)
+
+		file.NextRead = []byte{0x00}
+		pin.Write(1)
+
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0b00000010}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+		if pin.N() != 10 {
+			t.Error("unexpected pin number", pin.N())
+		}
+	})
+
+	t.Run("reads 0 or 1", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		file.NextRead = []byte{0b00000100}
+		val, err := dev.Pin(3).Read()
+		if err != nil || val != 1 {
+			t.Error("unexpected value", val, err)
+		}
+	})
+
+	t.Run("active low sets polarity", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		file.NextRead = []byte{0x00}
+		dev.Pin(1).ActiveLow(true)
+
+		if !file.HasCall("Write", []byte{byte(IPOLA), 0b00000001}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+	})
+
+	t.Run("pull-down unsupported", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if dev.Pin(1).PullDown() == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("rejects invalid edge", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		if dev.Pin(1).Watch("sideways", func(*Pin) {}) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("watch calls handler on edge", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		pin := dev.Pin(2)
+		pin.PollInterval = time.Millisecond
+
+		// Without a queued value the fake reads back the register address
+		// (GPIOA = 0b00010010), so pin 2 rises after the first poll.
+		file.NextRead = []byte{0x00}
+		called := make(chan struct{}, 1)
+		err := pin.Watch(EdgeRising, func(*Pin) {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pin.Close()
+
+		select {
+		case <-called:
+		case <-time.After(time.Second):
+			t.Error("handler not called")
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package iopi
+
+import "fmt"
+
+// PinGroup treats a set of pins, possibly spanning both ports, as a
+// multi-bit value, e.g. for DIP switches or parallel data buses. Bit 0 of
+// a value is the first pin of the group, bit 1 the second, and so on.
+type PinGroup struct {
+	dev  *Device
+	pins []uint8
+}
+
+// Create a group of pins, in bit order from the least significant bit.
+func NewPinGroup(dev *Device, pins ...uint8) *PinGroup {
+	return &PinGroup{dev: dev, pins: append([]uint8(nil), pins...)}
+}
+
+// Return the pins of the group, in bit order.
+func (g *PinGroup) Pins() []uint8 {
+	return append([]uint8(nil), g.pins...)
+}
+
+func (g *PinGroup) validate() error {
+	if len(g.pins) == 0 || len(g.pins) > 16 {
+		return fmt.Errorf("invalid number of pins in group: %d", len(g.pins))
+	}
+	var seen [2]byte
+	for _, pin := range g.pins {
+		if pin < 1 || pin > 16 {
+			return fmt.Errorf("invalid pin: %d", pin)
+		}
+		bit, port := GetPinPort(pin)
+		if GetBit(seen[port], bit) == 1 {
+			return fmt.Errorf("pin %d used twice in group", pin)
+		}
+		seen[port] = SetBit(seen[port], bit, 1)
+	}
+	return nil
+}
+
+// Return the port values and masks of the pins for a value.
+func (g *PinGroup) pack(v uint) (value, mask [2]byte) {
+	for i, pin := range g.pins {
+		bit, port := GetPinPort(pin)
+		mask[port] = SetBit(mask[port], bit, 1)
+		if v&(1<<i) != 0 {
+			value[port] = SetBit(value[port], bit, 1)
+		}
+	}
+	return value, mask
+}
+
+// Set the pins to the bits of a value. Pins outside the group keep their
+// state, and ports where all pins are in the group are written without
+// being read first.
+func (g *PinGroup) WriteValue(v uint) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+	if v>>len(g.pins) != 0 {
+		return fmt.Errorf("value %d does not fit in %d pins", v, len(g.pins))
+	}
+
+	value, mask := g.pack(v)
+	for _, port := range []Port{PortA, PortB} {
+		if mask[port] == 0 {
+			continue
+		}
+
+		state := value[port]
+		if mask[port] != 0xFF {
+			cur, err := g.dev.readLatch(port)
+			if err != nil {
+				return fmt.Errorf("failed to write pin group: %w", err)
+			}
+			state = cur&^mask[port] | state
+		}
+		if err := g.dev.writePort(port, state, mask[port], "PinGroup"); err != nil {
+			return fmt.Errorf("failed to write pin group: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read the pins as a value, reading each port once.
+func (g *PinGroup) ReadValue() (uint, error) {
+	if err := g.validate(); err != nil {
+		return 0, err
+	}
+
+	_, mask := g.pack(0)
+	var state [2]byte
+	for _, port := range []Port{PortA, PortB} {
+		if mask[port] == 0 {
+			continue
+		}
+		val, err := g.dev.ReadPort(port)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read pin group: %w", err)
+		}
+		state[port] = val
+	}
+
+	var v uint
+	for i, pin := range g.pins {
+		bit, port := GetPinPort(pin)
+		if GetBit(state[port], bit) == 1 {
+			v |= 1 << i
+		}
+	}
+	return v, nil
+}
+
+// Set all pins of the group to a mode.
+func (g *PinGroup) SetMode(mode Mode) error {
+	for _, pin := range g.pins {
+		if err := g.dev.SetPinMode(pin, mode); err != nil {
+			return fmt.Errorf("failed to set mode of pin group: %w", err)
+		}
+	}
+	return nil
+}
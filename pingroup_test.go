@@ -0,0 +1,69 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPinGroup(t *testing.T) {
+	t.Run("writes values across ports", func(t *testing.T) {
+		file := NewFakeFile()
+		g := NewPinGroup(NewDevice(file, 0x20, &sync.Mutex{}), 8, 9, 1)
+
+		file.SetRegister(OLATA, 0x00)
+		file.SetRegister(OLATB, 0x13)
+		if err := g.WriteValue(0b101); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0x81}) {
+			t.Error("port A not written", file.CallHistory)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOB), 0x12}) {
+			t.Error("port B not written", file.CallHistory)
+		}
+		if file.HasCall("Write", []byte{byte(GPIOA)}) || file.HasCall("Write", []byte{byte(GPIOB)}) {
+			t.Error("GPIO read instead of the output latches", file.CallHistory)
+		}
+	})
+
+	t.Run("reads values", func(t *testing.T) {
+		file := NewFakeFile()
+		g := NewPinGroup(NewDevice(file, 0x20, &sync.Mutex{}), 2, 3, 4, 5)
+
+		file.NextRead = []byte{0b00011010}
+		v, err := g.ReadValue()
+		if err != nil || v != 0b1101 {
+			t.Errorf("unexpected value: %04b %v", v, err)
+		}
+		if len(file.CallHistory) != 2 {
+			t.Error("expected a single port read", file.CallHistory)
+		}
+	})
+
+	t.Run("rejects values that do not fit", func(t *testing.T) {
+		g := NewPinGroup(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), 1, 2)
+		if g.WriteValue(4) == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		for _, pins := range [][]uint8{nil, {0}, {17}, {1, 1}} {
+			if _, err := NewPinGroup(dev, pins...).ReadValue(); err == nil {
+				t.Error("expected error for", pins)
+			}
+		}
+	})
+
+	t.Run("sets mode of all pins", func(t *testing.T) {
+		file := NewFakeFile()
+		g := NewPinGroup(NewDevice(file, 0x20, &sync.Mutex{}), 1, 9)
+		if err := g.SetMode(Output); err != nil {
+			t.Fatal(err)
+		}
+		if len(registerWrites(file, IODIRA)) != 1 || len(registerWrites(file, IODIRB)) != 1 {
+			t.Error("unexpected calls", file.CallHistory)
+		}
+	})
+}
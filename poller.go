@@ -0,0 +1,325 @@
+package iopi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A change of state on a pin, as detected by a Poller.
+type PinEvent struct {
+	Address byte      `json:"address"` // I2C address of the device
+	Pin     uint8     `json:"pin"`
+	State   State     `json:"state"`
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name,omitempty"` // set from Aliases, see Aliases.Annotate
+}
+
+// Poller periodically reads the ports of a device and emits a PinEvent to
+// all subscribers whenever a watched pin changes state.
+type Poller struct {
+	Interval time.Duration
+	Clock    Clock
+
+	// Poll adaptively if larger than Interval: every Interval while pins
+	// change, backing off exponentially up to MaxInterval while idle.
+	MaxInterval time.Duration
+
+	dev   *Device
+	mask  [2]byte // watched pins per port
+	mutex sync.Mutex
+	subs  map[chan PinEvent]struct{}
+	last  [2]byte
+	ready bool // true after the first poll
+
+	debounce [16]time.Duration
+	since    [16]time.Time // when a debounced pin started to differ
+
+	latch   [2]byte // pins latching changes, see SetLatching
+	latched [2]byte // pins changed since last acknowledged
+	raw     [2]byte // state read by the last poll, before debouncing
+
+	rising  [16]uint64
+	falling [16]uint64
+}
+
+// Size of subscriber channels. Events are dropped for subscribers that
+// do not keep up.
+const subscriberBuffer = 64
+
+// Create a poller watching `pins` on a device. All 16 pins are watched if
+// no pins are given.
+func NewPoller(dev *Device, interval time.Duration, pins ...uint8) *Poller {
+	p := &Poller{
+		Interval: interval,
+		dev:      dev,
+		subs:     make(map[chan PinEvent]struct{}),
+	}
+
+	if len(pins) == 0 {
+		p.mask = [2]byte{0xFF, 0xFF}
+	}
+	for _, pin := range pins {
+		bit, port := GetPinPort(pin)
+		p.mask[port] = SetBit(p.mask[port], bit, 1)
+	}
+
+	return p
+}
+
+// Return the device being polled.
+func (p *Poller) Device() *Device {
+	return p.dev
+}
+
+// Subscribe to pin events. Call the returned function to unsubscribe, which
+// also closes the channel.
+func (p *Poller) Subscribe() (<-chan PinEvent, func()) {
+	ch := make(chan PinEvent, subscriberBuffer)
+
+	p.mutex.Lock()
+	p.subs[ch] = struct{}{}
+	p.mutex.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.mutex.Lock()
+			delete(p.subs, ch)
+			p.mutex.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Poll the device every `Interval`, or adaptively, see MaxInterval, until
+// the context is cancelled. Returns the first read error, or nil when
+// cancelled.
+func (p *Poller) Run(ctx context.Context) error {
+	clock := ClockOr(p.Clock)
+	wait := p.Interval
+
+	for {
+		active, err := p.poll()
+		if err != nil {
+			return err
+		}
+		wait = p.nextInterval(wait, active)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(wait):
+		}
+	}
+}
+
+// Return the time to wait for the next poll, after waiting `wait` for the
+// last, which found pins changing if `active`.
+func (p *Poller) nextInterval(wait time.Duration, active bool) time.Duration {
+	if p.MaxInterval <= p.Interval || active {
+		return p.Interval
+	}
+	if wait < time.Millisecond {
+		wait = time.Millisecond
+	}
+	if wait *= 2; wait > p.MaxInterval {
+		wait = p.MaxInterval
+	}
+	return wait
+}
+
+// Read the watched ports once and emit events for changed pins. The first
+// call only records the initial state.
+func (p *Poller) Poll() error {
+	_, err := p.poll()
+	return err
+}
+
+// Poll once. Returns true if a watched or latching pin changed, or a
+// debounced pin is settling.
+func (p *Poller) poll() (bool, error) {
+	p.mutex.Lock()
+	latch := p.latch
+	p.mutex.Unlock()
+
+	state, flags, err := p.read(latch)
+	if err != nil {
+		return false, fmt.Errorf("failed to poll device: %w", err)
+	}
+
+	now := ClockOr(p.Clock).Now()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.ready {
+		p.last, p.raw, p.ready = state, state, true
+		return false, nil
+	}
+
+	active := false
+	for _, port := range []Port{PortA, PortB} {
+		if flags[port] != 0 || (state[port]^p.raw[port])&(p.mask[port]|p.latch[port]) != 0 {
+			active = true
+		}
+		p.latched[port] |= (flags[port] | (state[port] ^ p.raw[port])) & p.latch[port]
+		p.raw[port] = state[port]
+
+		changed := (state[port] ^ p.last[port]) & p.mask[port]
+		for bit := uint8(0); bit < 8; bit++ {
+			pin := pinNumber(port, bit)
+			if GetBit(changed, bit) == 0 {
+				p.since[pin-1] = time.Time{}
+				continue
+			}
+
+			// A debounced pin must hold its new state for the whole
+			// debounce time before the change is reported.
+			if d := p.debounce[pin-1]; d > 0 {
+				if p.since[pin-1].IsZero() {
+					p.since[pin-1] = now
+				}
+				if now.Sub(p.since[pin-1]) < d {
+					active = true
+					continue
+				}
+			}
+			p.since[pin-1] = time.Time{}
+
+			val := GetBit(state[port], bit)
+			p.last[port] = SetBit(p.last[port], bit, int(val))
+			if val == 1 {
+				p.rising[pin-1]++
+			} else {
+				p.falling[pin-1]++
+			}
+			p.emit(PinEvent{
+				Address: p.dev.Address,
+				Pin:     pin,
+				State:   State(val),
+				Time:    now,
+			})
+		}
+	}
+
+	return active, nil
+}
+
+// Read the ports watched or latching, and the interrupt flags of latching
+// ports, in as few transfers as possible. The registers of both ports
+// form a pair, so they are read together, see ReadBlockData.
+func (p *Poller) read(latch [2]byte) (state, flags [2]byte, err error) {
+	switch {
+	case latch != [2]byte{}:
+		// The interrupt flags must be read before GPIO, which clears them
+		flags, state, err = p.dev.readFlagsAndPorts()
+		flags = [2]byte{flags[PortA] & latch[PortA], flags[PortB] & latch[PortB]}
+	case p.mask[PortA] != 0 && p.mask[PortB] != 0:
+		state, err = p.dev.ReadPorts()
+	default:
+		for _, port := range []Port{PortA, PortB} {
+			if p.mask[port] == 0 {
+				continue
+			}
+			if state[port], err = p.dev.ReadPort(port); err != nil {
+				break
+			}
+		}
+	}
+	return state, flags, err
+}
+
+// Only report a change of a pin once it has been stable for `d`. A
+// duration of 0 disables debouncing. The resolution is limited by the
+// polling interval.
+func (p *Poller) SetDebounce(pin uint8, d time.Duration) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.debounce[pin-1] = d
+	return nil
+}
+
+// Latch changes of an input pin until acknowledged with
+// ReadAndClearLatched, so pulses shorter than the polling interval are not
+// missed. Enables interrupt-on-change for the pin, as the chip flags
+// changes between polls.
+func (p *Poller) SetLatching(pin uint8, enabled bool) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	bit, port := GetPinPort(pin)
+
+	var val byte
+	if enabled {
+		val = 0xFF
+	}
+	if err := p.dev.modifyPort(GPINTENA, port, 1<<bit, val); err != nil {
+		return fmt.Errorf("failed to enable interrupt of pin %d: %w", pin, err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.latch[port] = SetBit(p.latch[port], bit, int(val))
+	p.latched[port] = SetBit(p.latched[port], bit, 0)
+	return nil
+}
+
+// Return true if a latching pin changed since the last call, and clear
+// the latch. See SetLatching.
+func (p *Poller) ReadAndClearLatched(pin uint8) bool {
+	bit, port := GetPinPort(pin)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	latched := GetBit(p.latched[port], bit) != 0
+	p.latched[port] = SetBit(p.latched[port], bit, 0)
+	return latched
+}
+
+// Return the number of rising and falling edges of a watched pin reported
+// since the poller was created or the counts were reset. Returns zero
+// counts for invalid pins.
+func (p *Poller) Transitions(pin uint8) (rising, falling uint64) {
+	if pin < 1 || pin > 16 {
+		return 0, 0
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.rising[pin-1], p.falling[pin-1]
+}
+
+// Reset the edge counts of a pin, see Transitions. Invalid pins are
+// ignored.
+func (p *Poller) ResetTransitions(pin uint8) {
+	if pin < 1 || pin > 16 {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.rising[pin-1], p.falling[pin-1] = 0, 0
+}
+
+// Send an event to all subscribers without blocking.
+func (p *Poller) emit(ev PinEvent) {
+	for ch := range p.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Translate a 0-index pin on a port into a pin number 1-16.
+func pinNumber(port Port, bit uint8) uint8 {
+	if port == PortB {
+		return bit + 1 + 8
+	}
+	return bit + 1
+}
@@ -0,0 +1,314 @@
+package iopi
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoller(t *testing.T) {
+	t.Run("emits events for changed pins", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		p := NewPoller(dev, 0)
+		events, cancel := p.Subscribe()
+		defer cancel()
+
+		file.NextRead = []byte{0x00}
+		p.Poll()
+		file.NextRead = []byte{0b00000100}
+		p.Poll()
+
+		select {
+		case ev := <-events:
+			if ev.Pin != 3 || ev.State != 1 || ev.Address != 0x20 {
+				t.Error("unexpected event", ev)
+			}
+		default:
+			t.Fatal("no event emitted")
+		}
+	})
+
+	t.Run("ignores pins not watched", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		p := NewPoller(dev, 0, 1)
+		events, cancel := p.Subscribe()
+		defer cancel()
+
+		file.NextRead = []byte{0x00}
+		p.Poll()
+		file.NextRead = []byte{0b00000010}
+		p.Poll()
+
+		if len(events) != 0 {
+			t.Error("unexpected event", <-events)
+		}
+	})
+
+	t.Run("only reads ports with watched pins", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		p := NewPoller(dev, 0, 12)
+		p.Poll()
+
+		if len(file.CallHistory) != 2 {
+			t.Error("expected a single port read", file.CallHistory)
+		}
+	})
+
+	t.Run("unsubscribe closes channel", func(t *testing.T) {
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		p := NewPoller(dev, 0)
+		events, cancel := p.Subscribe()
+		cancel()
+		cancel()
+
+		if _, ok := <-events; ok {
+			t.Error("channel not closed")
+		}
+	})
+}
+
+func TestPollerDebounce(t *testing.T) {
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+	p := NewPoller(dev, 0, 1)
+	p.SetDebounce(1, 20*time.Millisecond)
+	events, cancel := p.Subscribe()
+	defer cancel()
+
+	poll := func(v byte) {
+		file.NextRead = []byte{v}
+		p.Poll()
+	}
+
+	poll(0)
+	poll(1) // bounce
+	poll(0)
+	poll(1)
+	if len(events) != 0 {
+		t.Fatal("change reported before debounce time", <-events)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	poll(1)
+	if len(events) != 1 {
+		t.Fatal("stable change not reported")
+	}
+	if ev := <-events; ev.State != 1 {
+		t.Error("unexpected event", ev)
+	}
+}
+
+func TestPollerLatching(t *testing.T) {
+	t.Run("latches pulses between polls", func(t *testing.T) {
+		dev, err := Open("sim://poller-latch", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dev.Close()
+		if err := dev.Init(); err != nil {
+			t.Fatal(err)
+		}
+		chip, _ := SimChip("sim://poller-latch", 0x20)
+
+		p := NewPoller(dev, 0, 9)
+		for _, pin := range []uint8{3, 11} {
+			if err := p.SetLatching(pin, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p.Poll()
+
+		for _, pin := range []uint8{3, 11} {
+			chip.SetInput(pin, true)
+			chip.SetInput(pin, false)
+			if err := p.Poll(); err != nil {
+				t.Fatal(err)
+			}
+			if !p.ReadAndClearLatched(pin) {
+				t.Error("pulse not latched on pin", pin)
+			}
+			if p.ReadAndClearLatched(pin) {
+				t.Error("latch not cleared on pin", pin)
+			}
+		}
+
+		p.Poll()
+		if p.ReadAndClearLatched(3) {
+			t.Error("latched without a change")
+		}
+	})
+
+	t.Run("latches changes seen by polling", func(t *testing.T) {
+		file := NewFakeFile()
+		p := NewPoller(NewDevice(file, 0x20, &sync.Mutex{}), 0, 1)
+		p.SetLatching(2, true)
+
+		file.SetRegister(INTFA, 0x00)
+		file.QueueRead(GPIOA, 0x00, 0b00000010)
+		p.Poll()
+		p.Poll()
+		if !p.ReadAndClearLatched(2) {
+			t.Error("change not latched")
+		}
+		if !file.HasCall("Write", []byte{byte(INTFA)}) {
+			t.Error("interrupt flags not read", file.CallHistory)
+		}
+	})
+
+	t.Run("rejects invalid pins", func(t *testing.T) {
+		p := NewPoller(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), 0)
+		if p.SetLatching(0, true) == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestPollerTransitions(t *testing.T) {
+	file := NewFakeFile()
+	p := NewPoller(NewDevice(file, 0x20, &sync.Mutex{}), 0, 1, 2)
+
+	file.QueueRead(GPIOA, 0b00, 0b01, 0b00, 0b01, 0b11)
+	for i := 0; i < 5; i++ {
+		p.Poll()
+	}
+
+	if rising, falling := p.Transitions(1); rising != 2 || falling != 1 {
+		t.Error("unexpected pin 1 edges", rising, falling)
+	}
+	if rising, falling := p.Transitions(2); rising != 1 || falling != 0 {
+		t.Error("unexpected pin 2 edges", rising, falling)
+	}
+
+	p.ResetTransitions(1)
+	if rising, falling := p.Transitions(1); rising != 0 || falling != 0 {
+		t.Error("edges not reset", rising, falling)
+	}
+	if rising, _ := p.Transitions(2); rising != 1 {
+		t.Error("other pin reset")
+	}
+
+	for _, pin := range []uint8{0, 17} {
+		p.ResetTransitions(pin)
+		if rising, falling := p.Transitions(pin); rising != 0 || falling != 0 {
+			t.Error("unexpected edges of invalid pin", pin)
+		}
+		if err := p.SetDebounce(pin, time.Second); err == nil {
+			t.Error("expected error for invalid pin", pin)
+		}
+	}
+}
+
+func TestPollerAdaptive(t *testing.T) {
+	t.Run("backs off while idle and speeds up on changes", func(t *testing.T) {
+		file := NewFakeFile()
+		file.SetRegister(GPIOA, 0x01)
+		file.QueueRead(GPIOA, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01)
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		clock := newRecordingClock()
+		p := NewPoller(dev, 10*time.Millisecond, 1)
+		p.MaxInterval = 50 * time.Millisecond
+		p.Clock = clock
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- p.Run(ctx) }()
+		for len(clock.Waits()) < 8 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		<-done
+
+		ms := time.Millisecond
+		want := []time.Duration{20 * ms, 40 * ms, 50 * ms, 50 * ms, 50 * ms, 10 * ms, 20 * ms, 40 * ms}
+		if waits := clock.Waits()[:8]; !reflect.DeepEqual(waits, want) {
+			t.Error("unexpected waits", waits)
+		}
+	})
+
+	t.Run("polls at a fixed interval by default", func(t *testing.T) {
+		p := NewPoller(nil, 10*time.Millisecond)
+		for _, active := range []bool{false, true, false} {
+			if d := p.nextInterval(10*time.Millisecond, active); d != 10*time.Millisecond {
+				t.Error("unexpected interval", d)
+			}
+		}
+	})
+}
+
+func TestPollerTransfers(t *testing.T) {
+	type transfer struct {
+		reg Register
+		n   int
+	}
+	for name, c := range map[string]struct {
+		pins      []uint8
+		latch     uint8
+		transfers []transfer
+	}{
+		"one port":            {[]uint8{1, 2}, 0, []transfer{{GPIOA, 1}}},
+		"both ports":          {nil, 0, []transfer{{GPIOA, 2}}},
+		"latching with flags": {[]uint8{1}, 9, []transfer{{INTFA, 2}, {GPIOA, 2}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := NewFakeFile()
+			p := NewPoller(NewDevice(file, 0x20, &sync.Mutex{}), 0, c.pins...)
+			if c.latch != 0 {
+				p.SetLatching(c.latch, true)
+			}
+
+			file.CallHistory = nil
+			if err := p.Poll(); err != nil {
+				t.Fatal(err)
+			}
+			if len(file.CallHistory) != 2*len(c.transfers) {
+				t.Fatal("unexpected transfers", file.CallHistory)
+			}
+			for i, tr := range c.transfers {
+				write, read := file.CallHistory[2*i], file.CallHistory[2*i+1]
+				if write.Fn != "Write" || !reflect.DeepEqual(write.Arg, []byte{byte(tr.reg)}) {
+					t.Error("unexpected write", write)
+				}
+				if read.Fn != "Read" || len(read.Arg) != tr.n {
+					t.Error("unexpected read", read)
+				}
+			}
+		})
+	}
+
+	t.Run("reads sequential registers of the chip", func(t *testing.T) {
+		dev, err := Open("sim://poller-transfers", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dev.Close()
+		if err := dev.Init(); err != nil {
+			t.Fatal(err)
+		}
+		chip, _ := SimChip("sim://poller-transfers", 0x20)
+
+		chip.SetInput(3, false) // sim chips outlive a test run
+		chip.SetInput(12, false)
+
+		p := NewPoller(dev, 0)
+		events, cancel := p.Subscribe()
+		defer cancel()
+		p.Poll()
+		chip.SetInput(3, true)
+		chip.SetInput(12, true)
+		p.Poll()
+
+		got := map[uint8]bool{}
+		for len(events) > 0 {
+			ev := <-events
+			got[ev.Pin] = ev.State != Low
+		}
+		if !reflect.DeepEqual(got, map[uint8]bool{3: true, 12: true}) {
+			t.Error("unexpected events", got)
+		}
+	})
+}
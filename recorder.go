@@ -0,0 +1,228 @@
+package iopi
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+type RecordFormat uint8
+
+const (
+	FormatCSV  RecordFormat = iota
+	FormatJSON              // one JSON object per line
+)
+
+// Recorder samples a set of pins and appends a row per sample to a file,
+// turning the board into a simple data logger.
+type Recorder struct {
+	Interval time.Duration // time between samples in `Run`
+	Format   RecordFormat
+	OnChange bool  // only write a row when at least one pin changed
+	MaxSize  int64 // rotate the file when it grows beyond this many bytes, 0 disables
+	MaxFiles int   // number of rotated files to keep, e.g. path.1, path.2
+	Clock    Clock
+
+	dev  *Device
+	path string
+	pins []uint8
+	file *os.File
+	size int64
+	last []State
+}
+
+// A single sample of the recorded pins, as written in JSON format.
+type Record struct {
+	Time time.Time        `json:"time"`
+	Pins map[string]uint8 `json:"pins"`
+}
+
+// Create a recorder writing samples of `pins` to the file at `path`.
+// Defaults to sampling once per second in CSV format.
+func NewRecorder(dev *Device, path string, pins ...uint8) *Recorder {
+	return &Recorder{
+		Interval: time.Second,
+		Format:   FormatCSV,
+		dev:      dev,
+		path:     path,
+		pins:     pins,
+	}
+}
+
+// Sample the pins every `Interval` until the context is cancelled.
+// Returns the first error encountered, or nil when cancelled.
+func (r *Recorder) Run(ctx context.Context) error {
+	clock := ClockOr(r.Clock)
+
+	for {
+		if err := r.Sample(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(r.Interval):
+		}
+	}
+}
+
+// Read the pins once and write a row to the file.
+func (r *Recorder) Sample() error {
+	var ports [2]byte
+	var read [2]bool
+	states := make([]State, len(r.pins))
+
+	for i, p := range r.pins {
+		bit, port := GetPinPort(p)
+		if !read[port] {
+			val, err := r.dev.ReadPort(port)
+			if err != nil {
+				return fmt.Errorf("failed to sample pin %d: %w", p, err)
+			}
+			ports[port], read[port] = val, true
+		}
+		states[i] = State(GetBit(ports[port], bit))
+	}
+
+	if r.OnChange && r.last != nil && statesEqual(states, r.last) {
+		return nil
+	}
+	r.last = states
+
+	return r.write(ClockOr(r.Clock).Now(), states)
+}
+
+// Close the underlying file.
+func (r *Recorder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *Recorder) write(t time.Time, states []State) error {
+	if r.file != nil && r.MaxSize > 0 && r.size >= r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	var line []byte
+	switch r.Format {
+	case FormatCSV:
+		row := []string{t.Format(time.RFC3339Nano)}
+		for _, s := range states {
+			row = append(row, strconv.Itoa(int(s)))
+		}
+		line = csvLine(row)
+	case FormatJSON:
+		rec := Record{Time: t, Pins: make(map[string]uint8)}
+		for i, p := range r.pins {
+			rec.Pins[strconv.Itoa(int(p))] = uint8(states[i])
+		}
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+		line = append(data, '\n')
+	default:
+		return fmt.Errorf("invalid record format: %v", r.Format)
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+
+	return nil
+}
+
+// Open the file for appending, writing a CSV header if it is empty.
+func (r *Recorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open record file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open record file: %w", err)
+	}
+	r.file, r.size = file, info.Size()
+
+	if r.size == 0 && r.Format == FormatCSV {
+		header := []string{"time"}
+		for _, p := range r.pins {
+			header = append(header, fmt.Sprintf("pin%d", p))
+		}
+		n, err := r.file.Write(csvLine(header))
+		r.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to write record header: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Shift path.N to path.N+1, dropping files beyond MaxFiles, then move the
+// current file to path.1.
+func (r *Recorder) rotate() error {
+	if err := r.Close(); err != nil {
+		return fmt.Errorf("failed to rotate record file: %w", err)
+	}
+
+	if r.MaxFiles < 1 {
+		if err := os.Remove(r.path); err != nil {
+			return fmt.Errorf("failed to rotate record file: %w", err)
+		}
+		return nil
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.MaxFiles))
+	for i := r.MaxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate record file: %w", err)
+	}
+
+	return nil
+}
+
+func csvLine(fields []string) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(fields)
+	w.Flush()
+	return buf.Bytes()
+}
+
+func statesEqual(a, b []State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
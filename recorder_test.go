@@ -0,0 +1,113 @@
+package iopi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func tempPath(t *testing.T, name string) string {
+	dir, err := ioutil.TempDir("", "iopi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, name)
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("writes csv rows with header", func(t *testing.T) {
+		path := tempPath(t, "log.csv")
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		rec := NewRecorder(dev, path, 1, 2)
+
+		file.NextRead = []byte{0b00000010}
+		if err := rec.Sample(); err != nil {
+			t.Fatal(err)
+		}
+		rec.Close()
+
+		data, _ := ioutil.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 || lines[0] != "time,pin1,pin2" {
+			t.Fatal("unexpected output", lines)
+		}
+		if !strings.HasSuffix(lines[1], ",0,1") {
+			t.Error("unexpected row", lines[1])
+		}
+	})
+
+	t.Run("writes json lines", func(t *testing.T) {
+		path := tempPath(t, "log.json")
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		rec := NewRecorder(dev, path, 9)
+		rec.Format = FormatJSON
+
+		file.NextRead = []byte{0b00000001}
+		rec.Sample()
+		rec.Close()
+
+		data, _ := ioutil.ReadFile(path)
+		var r Record
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Pins["9"] != 1 {
+			t.Error("unexpected record", r)
+		}
+		if len(file.CallHistory) != 2 {
+			t.Error("expected a single port read", file.CallHistory)
+		}
+	})
+
+	t.Run("skips unchanged samples", func(t *testing.T) {
+		path := tempPath(t, "log.csv")
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		rec := NewRecorder(dev, path, 1)
+		rec.OnChange = true
+
+		for _, v := range []byte{0, 0, 1, 1} {
+			file.NextRead = []byte{v}
+			rec.Sample()
+		}
+		rec.Close()
+
+		data, _ := ioutil.ReadFile(path)
+		if n := strings.Count(string(data), "\n"); n != 3 {
+			t.Error("expected header and two rows, got lines:", n)
+		}
+	})
+
+	t.Run("rotates files", func(t *testing.T) {
+		path := tempPath(t, "log.csv")
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		rec := NewRecorder(dev, path, 1)
+		rec.MaxSize = 1
+		rec.MaxFiles = 2
+
+		for i := 0; i < 4; i++ {
+			file.NextRead = []byte{0}
+			if err := rec.Sample(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec.Close()
+
+		for _, p := range []string{path, path + ".1", path + ".2"} {
+			if _, err := os.Stat(p); err != nil {
+				t.Error("missing file", p)
+			}
+		}
+		if _, err := os.Stat(path + ".3"); err == nil {
+			t.Error("too many files kept")
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package iopi
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Timing limits of an output switching a relay or contactor, e.g. of a
+// compressor that must not be restarted right after stopping.
+type RelayTiming struct {
+	MinOn  time.Duration // before the output may be turned off again
+	MinOff time.Duration // before the output may be turned on again
+	// Before the output may be turned on after any pin with relay timing
+	// was turned on
+	Stagger time.Duration
+}
+
+// Sequencer enforces relay timing on the writes of output pins, see
+// Device.SetSequencer. A write that would break the timing of its pin is
+// deferred until it is allowed, rather than refused, and replaced by any
+// later write of the pin. Turning pins on is also staggered by the
+// Stagger of their timing, to limit the inrush current of many relays
+// switching at once. Call Stop to cancel deferred writes when done with
+// the device.
+type Sequencer struct {
+	// Called when a deferred write fails
+	OnError func(pin uint8, err error)
+	Clock   Clock
+
+	mutex   sync.Mutex
+	timing  map[uint8]RelayTiming
+	state   map[uint8]State     // last written
+	changed map[uint8]time.Time // of the last write changing the state
+	pending map[uint8]*deferred // deferred write of a pin
+	started time.Time           // when the last pin was, or is scheduled to be, turned on
+}
+
+// A deferred write of a pin
+type deferred struct {
+	cancel   chan struct{} // closed when replaced or stopped
+	at       time.Time
+	reserved bool      // the start at `at`, see allowed
+	started  time.Time // of the Sequencer before the start was reserved
+}
+
+func NewSequencer() *Sequencer {
+	return &Sequencer{
+		timing:  make(map[uint8]RelayTiming),
+		state:   make(map[uint8]State),
+		changed: make(map[uint8]time.Time),
+		pending: make(map[uint8]*deferred),
+	}
+}
+
+// Enforce relay timing on writes of a pin. The state of the pin is
+// unknown until it is first written, so the first write is not delayed
+// by the minimum times.
+func (s *Sequencer) SetTiming(pin uint8, t RelayTiming) error {
+	if pin < 1 || pin > 16 {
+		return fmt.Errorf("invalid pin: %d", pin)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.timing[pin] = t
+	return nil
+}
+
+// Apply the relay timing of a sequencer to writes of pins with WritePin,
+// WritePinIf and Coalescer, and functions using them such as SetActive.
+// Port writes are not affected.
+// Set the sequencer before using the device, or nil to remove it.
+func (dev *Device) SetSequencer(s *Sequencer) {
+	dev.sequencer = s
+}
+
+func (s *Sequencer) sequenced(pin uint8) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.timing[pin]
+	return ok
+}
+
+// Write a pin now if its timing allows, or defer the write.
+func (s *Sequencer) write(dev *Device, pin uint8, state State) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writeLocked(dev, pin, state)
+}
+
+// Write a pin like write if its output latch is `expect`, returning
+// whether it was. A deferred write counts as written. Other writes of the
+// pin through the sequencer wait until the write is made or deferred.
+func (s *Sequencer) writeIf(dev *Device, pin uint8, expect, state State) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bit, port := GetPinPort(pin)
+	latch, err := dev.readLatch(port)
+	if err != nil {
+		return false, fmt.Errorf("failed to write to pin %v: %w", pin, err)
+	}
+	if !State(GetBit(latch, bit)).Equal(expect) {
+		return false, nil
+	}
+	return true, s.writeLocked(dev, pin, state)
+}
+
+func (s *Sequencer) writeLocked(dev *Device, pin uint8, state State) error {
+	s.cancel(pin)
+
+	clock := ClockOr(s.Clock)
+	now := clock.Now()
+	started := s.started
+	at := s.allowed(pin, state, now)
+	if !at.After(now) {
+		return s.apply(dev, pin, state, now)
+	}
+
+	d := &deferred{cancel: make(chan struct{}), at: at, reserved: state.Bool(), started: started}
+	s.pending[pin] = d
+	go func() {
+		select {
+		case <-clock.After(at.Sub(now)):
+		case <-d.cancel:
+			return
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.pending[pin] != d {
+			return // cancelled while waiting for the mutex
+		}
+		delete(s.pending, pin)
+		if err := s.apply(dev, pin, state, clock.Now()); err != nil && s.OnError != nil {
+			s.OnError(pin, err)
+		}
+	}()
+	return nil
+}
+
+// Cancel the deferred write of a pin, if any, with the mutex held. Its
+// stagger slot is released unless a later start was reserved after it.
+func (s *Sequencer) cancel(pin uint8) {
+	d, ok := s.pending[pin]
+	if !ok {
+		return
+	}
+	delete(s.pending, pin)
+	close(d.cancel)
+	if d.reserved && s.started.Equal(d.at) {
+		s.started = d.started
+	}
+}
+
+// Cancel all deferred writes, so none are made after the device is done
+// with. Later writes are timed as before.
+func (s *Sequencer) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for pin := range s.pending {
+		s.cancel(pin)
+	}
+}
+
+// Return the earliest time a pin may be written to `state`, reserving the
+// start if the pin is turned on, with the mutex held.
+func (s *Sequencer) allowed(pin uint8, state State, now time.Time) time.Time {
+	old, known := s.state[pin]
+	if known && old.Equal(state) {
+		return now
+	}
+
+	at := now
+	t := s.timing[pin]
+	if known {
+		min := t.MinOn
+		if state.Bool() {
+			min = t.MinOff
+		}
+		if end := s.changed[pin].Add(min); end.After(at) {
+			at = end
+		}
+	}
+	if state.Bool() {
+		if next := s.started.Add(t.Stagger); t.Stagger > 0 && !s.started.IsZero() && next.After(at) {
+			at = next
+		}
+		if at.After(s.started) {
+			s.started = at
+		}
+	}
+	return at
+}
+
+func (s *Sequencer) apply(dev *Device, pin uint8, state State, now time.Time) error {
+	if err := dev.writePin(pin, state); err != nil {
+		return err
+	}
+	if old, known := s.state[pin]; !known || !old.Equal(state) {
+		s.changed[pin] = now
+	}
+	s.state[pin] = state
+	return nil
+}
@@ -0,0 +1,178 @@
+package iopi
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Wait for the latch of a pin to reach a state
+func waitLatch(t *testing.T, dev *Device, pin uint8, state State) {
+	t.Helper()
+	bit, port := GetPinPort(pin)
+	for i := 0; ; i++ {
+		latch, _ := dev.readLatch(port)
+		if State(GetBit(latch, bit)).Equal(state) {
+			return
+		}
+		if i == 100 {
+			t.Fatalf("pin %d not %s", pin, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newSequencedDevice(t *testing.T, name string) (*Device, *Sequencer, *iopitest.FakeClock) {
+	dev, err := Open(SimPrefix+name, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dev.Close() })
+	dev.SetPortMode(PortA, Output)
+	dev.WritePort(PortA, 0) // sim devices outlive a test run
+
+	clock := iopitest.NewFakeClock(time.Unix(0, 0))
+	seq := NewSequencer()
+	seq.Clock = clock
+	dev.SetSequencer(seq)
+	return dev, seq, clock
+}
+
+func TestSequencer(t *testing.T) {
+	t.Run("enforces minimum on and off times", func(t *testing.T) {
+		dev, seq, clock := newSequencedDevice(t, "relay-min")
+		seq.SetTiming(1, RelayTiming{MinOn: time.Minute, MinOff: 5 * time.Minute})
+
+		dev.WritePin(1, High)
+		waitLatch(t, dev, 1, High)
+
+		dev.WritePin(1, Low)
+		clock.BlockUntil(1)
+		waitLatch(t, dev, 1, High)
+		clock.Advance(time.Minute)
+		waitLatch(t, dev, 1, Low)
+
+		dev.WritePin(1, High)
+		clock.BlockUntil(1)
+		clock.Advance(4 * time.Minute)
+		waitLatch(t, dev, 1, Low)
+		clock.Advance(time.Minute)
+		waitLatch(t, dev, 1, High)
+	})
+
+	t.Run("replaces deferred writes", func(t *testing.T) {
+		dev, seq, clock := newSequencedDevice(t, "relay-replace")
+		seq.SetTiming(2, RelayTiming{MinOn: time.Minute})
+
+		dev.WritePin(2, High)
+		dev.WritePin(2, Low)
+		clock.BlockUntil(1)
+		dev.WritePin(2, High)
+		clock.Advance(time.Minute)
+		time.Sleep(5 * time.Millisecond)
+		waitLatch(t, dev, 2, High)
+	})
+
+	t.Run("staggers turning pins on", func(t *testing.T) {
+		dev, seq, clock := newSequencedDevice(t, "relay-stagger")
+		for pin := uint8(1); pin <= 3; pin++ {
+			seq.SetTiming(pin, RelayTiming{Stagger: time.Second})
+			dev.WritePin(pin, High)
+		}
+		seq.SetTiming(4, RelayTiming{})
+		dev.WritePin(4, High)
+
+		waitLatch(t, dev, 1, High)
+		waitLatch(t, dev, 4, High)
+		clock.BlockUntil(2)
+		waitLatch(t, dev, 2, Low)
+		clock.Advance(time.Second)
+		waitLatch(t, dev, 2, High)
+		waitLatch(t, dev, 3, Low)
+		clock.Advance(time.Second)
+		waitLatch(t, dev, 3, High)
+	})
+
+	t.Run("releases the stagger slot of replaced writes", func(t *testing.T) {
+		dev, seq, clock := newSequencedDevice(t, "relay-restagger")
+		seq.SetTiming(1, RelayTiming{Stagger: time.Second})
+		seq.SetTiming(2, RelayTiming{Stagger: time.Second})
+		dev.WritePin(1, High)
+		for i := 0; i < 3; i++ {
+			dev.WritePin(2, High)
+		}
+
+		clock.BlockUntil(3) // including the waits of replaced writes
+		clock.Advance(time.Second)
+		waitLatch(t, dev, 2, High)
+	})
+
+	t.Run("cancels deferred writes when stopped", func(t *testing.T) {
+		dev, seq, clock := newSequencedDevice(t, "relay-stop")
+		seq.SetTiming(1, RelayTiming{MinOn: time.Minute})
+		dev.WritePin(1, High)
+		dev.WritePin(1, Low)
+		clock.BlockUntil(1)
+
+		seq.Stop()
+		clock.Advance(time.Minute)
+		time.Sleep(5 * time.Millisecond)
+		waitLatch(t, dev, 1, High)
+
+		dev.WritePin(1, Low)
+		waitLatch(t, dev, 1, Low)
+	})
+
+	t.Run("times conditional and coalesced writes", func(t *testing.T) {
+		dev, seq, clock := newSequencedDevice(t, "relay-other")
+		seq.SetTiming(1, RelayTiming{MinOn: time.Minute})
+		seq.SetTiming(2, RelayTiming{MinOn: time.Minute})
+		dev.WritePin(1, High)
+		dev.WritePin(2, High)
+		waitLatch(t, dev, 2, High)
+
+		if written, err := dev.WritePinIf(1, High, Low); err != nil || !written {
+			t.Fatal("pin not written", err)
+		}
+		if written, _ := dev.WritePinIf(2, Low, High); written {
+			t.Error("pin written although its latch differs")
+		}
+		clock.BlockUntil(1)
+		waitLatch(t, dev, 1, High)
+
+		c := NewCoalescer(dev, time.Hour)
+		c.WritePin(2, Low)
+		c.WritePin(3, High)
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		waitLatch(t, dev, 3, High)
+		clock.BlockUntil(2)
+		waitLatch(t, dev, 2, High)
+
+		clock.Advance(time.Minute)
+		waitLatch(t, dev, 1, Low)
+		waitLatch(t, dev, 2, Low)
+	})
+
+	t.Run("leaves other pins alone", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		file.SetRegister(OLATA, 0)
+		seq := NewSequencer()
+		seq.SetTiming(1, RelayTiming{MinOn: time.Hour})
+		dev.SetSequencer(seq)
+
+		if err := dev.WritePin(8, High); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(GPIOA), 0x80}) {
+			t.Error("did not write expected data", file.CallHistory)
+		}
+		if err := seq.SetTiming(17, RelayTiming{}); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
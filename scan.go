@@ -0,0 +1,73 @@
+package iopi
+
+import (
+	"fmt"
+
+	"github.com/stigok/go-io-pi/bus"
+)
+
+// Range of valid 7-bit i2c addresses, excluding reserved addresses
+const (
+	MinAddress = bus.MinAddress
+	MaxAddress = bus.MaxAddress
+)
+
+// Range of addresses the MCP23017 can be strapped to with its A0-A2 pins
+const (
+	MinChipAddress = 0x20
+	MaxChipAddress = 0x27
+)
+
+// AddressError is returned for an i2c address outside MinAddress and
+// MaxAddress, which no device can answer at.
+type AddressError struct {
+	Address byte
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("invalid i2c address 0x%02x: must be 0x%02x-0x%02x", e.Address, MinAddress, MaxAddress)
+}
+
+// Return an *AddressError if `addr` is not a valid 7-bit i2c address.
+// Valid addresses outside the range of the MCP23017 are accepted, as the
+// bus may hold a compatible chip; check those with IsChipAddress.
+func ValidateAddress(addr byte) error {
+	if addr < MinAddress || addr > MaxAddress {
+		return &AddressError{Address: addr}
+	}
+	return nil
+}
+
+// Return true if an MCP23017 can be strapped to `addr`.
+func IsChipAddress(addr byte) bool {
+	return addr >= MinChipAddress && addr <= MaxChipAddress
+}
+
+// Probe all valid i2c addresses on the bus at `path` by attempting a one
+// byte read, and return the addresses that answered, see bus.Scan.
+func Scan(path string) ([]byte, error) {
+	return bus.Scan(path)
+}
+
+// Make a best effort to identify the chip. The MCP23017 mirrors IOCON at
+// two addresses in its default register layout, which most other devices
+// will not. Returns an empty string if the chip is not recognised.
+//
+// This writes a register pointer to the device, which changes the outputs
+// of simple expanders like the PCF8574, so only use it on addresses
+// expected to hold an MCP23017.
+func (dev *Device) Identify() (string, error) {
+	a, err := dev.ReadByteData(IOCON)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify device: %w", err)
+	}
+	b, err := dev.ReadByteData(IOCON + 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify device: %w", err)
+	}
+
+	if a == b {
+		return "MCP23017", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,56 @@
+package iopi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestIdentify(t *testing.T) {
+	t.Run("unknown chip", func(t *testing.T) {
+		// The fake reads back the register address, so the IOCON mirror
+		// does not match.
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+		name, err := dev.Identify()
+		if err != nil || name != "" {
+			t.Error("unexpected result", name, err)
+		}
+	})
+
+	t.Run("mcp23017", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		// Make the first read return the same value as the second
+		file.NextRead = []byte{byte(IOCON + 1)}
+		name, err := dev.Identify()
+		if err != nil || name != "MCP23017" {
+			t.Error("unexpected result", name, err)
+		}
+	})
+}
+
+func TestValidateAddress(t *testing.T) {
+	for _, addr := range []byte{0x03, 0x20, 0x27, 0x48, 0x77} {
+		if err := ValidateAddress(addr); err != nil {
+			t.Error("unexpected error", err)
+		}
+	}
+	for _, addr := range []byte{0x00, 0x02, 0x78, 0xFF} {
+		var addrErr *AddressError
+		if err := ValidateAddress(addr); !errors.As(err, &addrErr) || addrErr.Address != addr {
+			t.Error("expected address error for", addr, err)
+		}
+	}
+
+	if !IsChipAddress(0x27) || IsChipAddress(0x28) || IsChipAddress(0x1F) {
+		t.Error("unexpected chip address range")
+	}
+
+	if _, err := Open(SimPrefix+"validate", 0x80); err == nil {
+		t.Error("expected Open to reject address")
+	}
+	dev := NewDevice(NewFakeFile(), 0x02, &sync.Mutex{})
+	if err := dev.Init(); err == nil {
+		t.Error("expected Init to reject address")
+	}
+}
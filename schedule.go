@@ -0,0 +1,421 @@
+package iopi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A time-based rule setting a pin to a state within a daily time window,
+// e.g. "pin 5 high weekdays 07:00-19:00". Outside of its window the pin is
+// set to the opposite state. A window ending before it starts spans
+// midnight, and belongs to the day it starts on.
+type Rule struct {
+	Pin   uint8
+	State State
+	Days  []time.Weekday // every day if empty
+	Start time.Duration  // since midnight
+	End   time.Duration  // since midnight
+}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var dayGroups = map[string][]time.Weekday{
+	"daily":    nil,
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Parse a rule written as "pin <n> <high|low> <days> <HH:MM>-<HH:MM>",
+// where days is daily, weekdays, weekends or a comma separated list of
+// days, e.g. mon,wed,fri.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) != 5 || fields[0] != "pin" {
+		return r, fmt.Errorf("invalid rule: %q", s)
+	}
+
+	pin, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil || pin < 1 || pin > 16 {
+		return r, fmt.Errorf("invalid pin in rule: %s", fields[1])
+	}
+	r.Pin = uint8(pin)
+
+	switch fields[2] {
+	case "high", "on", "1":
+		r.State = High
+	case "low", "off", "0":
+		r.State = Low
+	default:
+		return r, fmt.Errorf("invalid state in rule: %s", fields[2])
+	}
+
+	if days, ok := dayGroups[fields[3]]; ok {
+		r.Days = days
+	} else {
+		for _, name := range strings.Split(fields[3], ",") {
+			day := indexOf(dayNames, name)
+			if day < 0 {
+				return r, fmt.Errorf("invalid day in rule: %s", name)
+			}
+			r.Days = append(r.Days, time.Weekday(day))
+		}
+	}
+
+	window := strings.SplitN(fields[4], "-", 2)
+	if len(window) != 2 {
+		return r, fmt.Errorf("invalid time window in rule: %s", fields[4])
+	}
+	if r.Start, err = parseTimeOfDay(window[0]); err != nil {
+		return r, err
+	}
+	if r.End, err = parseTimeOfDay(window[1]); err != nil {
+		return r, err
+	}
+	if r.Start == r.End {
+		return r, fmt.Errorf("empty time window in rule: %s", fields[4])
+	}
+
+	return r, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Format the rule as accepted by ParseRule.
+func (r Rule) String() string {
+	state := "high"
+	if r.State == Low {
+		state = "low"
+	}
+
+	days := "daily"
+	if len(r.Days) > 0 {
+		names := make([]string, len(r.Days))
+		for i, d := range r.Days {
+			names[i] = dayNames[d]
+		}
+		days = strings.Join(names, ",")
+		for group, list := range dayGroups {
+			if list != nil && sameDays(list, r.Days) {
+				days = group
+			}
+		}
+	}
+
+	return fmt.Sprintf("pin %d %s %s %s-%s", r.Pin, state, days,
+		formatTimeOfDay(r.Start), formatTimeOfDay(r.End))
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+func sameDays(a, b []time.Weekday) bool {
+	var x, y [7]bool
+	for _, d := range a {
+		x[d] = true
+	}
+	for _, d := range b {
+		y[d] = true
+	}
+	return x == y
+}
+
+func (r Rule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rule) UnmarshalText(text []byte) error {
+	rule, err := ParseRule(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rule
+	return nil
+}
+
+func (r Rule) onDay(d time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, day := range r.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the start and end of the window starting on the day of `t`.
+func (r Rule) window(t time.Time) (time.Time, time.Time) {
+	start := clockTime(t, r.Start)
+	end := clockTime(t, r.End)
+	if r.End < r.Start {
+		end = clockTime(t.AddDate(0, 0, 1), r.End)
+	}
+	return start, end
+}
+
+// Return the time on the day of `t` when the clock shows `offset` since
+// midnight, which is not `offset` after midnight on days changing to or
+// from daylight saving time.
+func clockTime(t time.Time, offset time.Duration) time.Time {
+	y, m, d := t.Date()
+	h, min, sec := int(offset/time.Hour), int(offset%time.Hour/time.Minute), int(offset%time.Minute/time.Second)
+	return time.Date(y, m, d, h, min, sec, 0, t.Location())
+}
+
+// Return true if `t` is within a window of the rule.
+func (r Rule) Active(t time.Time) bool {
+	// A window started the day before may still be open
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		if !r.onDay(day.Weekday()) {
+			continue
+		}
+		start, end := r.window(day)
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// A scheduled change of a pin.
+type Transition struct {
+	Pin   uint8     `json:"pin"`
+	State State     `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+// Scheduler sets output pins of a device according to time-based rules.
+// Pins are only written when the state given by their rules changes, so
+// pins may be changed by hand in between. Pins must be set to output
+// beforehand.
+type Scheduler struct {
+	// How often rules are evaluated
+	Interval time.Duration
+	// Source of the current time. Defaults to RealClock.
+	Clock Clock
+	// Called when writing a pin fails. The write is retried on the next
+	// evaluation.
+	OnError func(pin uint8, err error)
+
+	dev     *Device
+	path    string
+	mutex   sync.Mutex
+	rules   []Rule
+	applied map[uint8]State
+}
+
+type storedRules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Create a scheduler persisting its rules to the file at `path`. Rules are
+// not persisted if path is empty.
+func NewScheduler(dev *Device, path string) *Scheduler {
+	return &Scheduler{
+		Interval: time.Second,
+		dev:      dev,
+		path:     path,
+		applied:  make(map[uint8]State),
+	}
+}
+
+// Replace the rules with those stored in the file. Returns an error
+// satisfying os.IsNotExist if nothing has been stored yet.
+func (s *Scheduler) Load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var stored storedRules
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to parse schedule: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rules = stored.Rules
+	s.applied = make(map[uint8]State)
+	return nil
+}
+
+// Write the rules to the file, replacing it atomically.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(storedRules{s.rules}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save schedule: %w", err)
+	}
+	return nil
+}
+
+// Add a rule and persist the rules.
+func (s *Scheduler) Add(r Rule) error {
+	if r.Pin < 1 || r.Pin > 16 {
+		return fmt.Errorf("invalid pin: %d", r.Pin)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rules = append(s.rules, r)
+	return s.save()
+}
+
+// Remove the rule at index `i` of Rules and persist the rules.
+func (s *Scheduler) Remove(i int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i < 0 || i >= len(s.rules) {
+		return fmt.Errorf("no rule at index: %d", i)
+	}
+	s.rules = append(s.rules[:i], s.rules[i+1:]...)
+	return s.save()
+}
+
+// Return a copy of the rules.
+func (s *Scheduler) Rules() []Rule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Rule(nil), s.rules...)
+}
+
+// Return the state the rules give each scheduled pin at `t`. A pin is in
+// the state of an active rule, with later rules taking precedence, or in
+// the opposite state of its last rule if none are active.
+func stateAt(rules []Rule, t time.Time) map[uint8]State {
+	states := make(map[uint8]State)
+	active := make(map[uint8]bool)
+
+	for _, r := range rules {
+		switch {
+		case r.Active(t):
+			states[r.Pin], active[r.Pin] = r.State, true
+		case !active[r.Pin]:
+			states[r.Pin] = StateOf(!r.State.Bool())
+		}
+	}
+	return states
+}
+
+// Evaluate the rules and write pins whose scheduled state changed since
+// the last evaluation. The first evaluation writes all scheduled pins.
+func (s *Scheduler) Apply() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var firstErr error
+	for pin, state := range stateAt(s.rules, ClockOr(s.Clock).Now()) {
+		if last, ok := s.applied[pin]; ok && last.Equal(state) {
+			continue
+		}
+		if err := s.dev.WritePin(pin, state); err != nil {
+			if s.OnError != nil {
+				s.OnError(pin, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		s.applied[pin] = state
+	}
+	return firstErr
+}
+
+// Evaluate the rules every `Interval` until the context is cancelled.
+// Write errors are reported to OnError.
+func (s *Scheduler) Run(ctx context.Context) error {
+	clock := ClockOr(s.Clock)
+
+	for {
+		s.Apply()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(s.Interval):
+		}
+	}
+}
+
+// Return the next `n` scheduled transitions within a week from now, in
+// order of time. Returns nil if `n` is not positive.
+func (s *Scheduler) Next(n int) []Transition {
+	if n <= 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	rules := append([]Rule(nil), s.rules...)
+	now := ClockOr(s.Clock).Now()
+	s.mutex.Unlock()
+
+	// Pins can only change state at the start or end of a window
+	var times []time.Time
+	for day := -1; day <= 7; day++ {
+		t := now.AddDate(0, 0, day)
+		for _, r := range rules {
+			if !r.onDay(t.Weekday()) {
+				continue
+			}
+			start, end := r.window(t)
+			times = append(times, start, end)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	var out []Transition
+	last := stateAt(rules, now)
+	for _, t := range times {
+		if !t.After(now) {
+			continue
+		}
+		states := stateAt(rules, t)
+		for pin := uint8(1); pin <= 16; pin++ {
+			if state, ok := states[pin]; ok && !state.Equal(last[pin]) {
+				out = append(out, Transition{Pin: pin, State: state, Time: t})
+			}
+		}
+		last = states
+		if len(out) >= n {
+			return out[:n]
+		}
+	}
+	return out
+}
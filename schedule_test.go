@@ -0,0 +1,218 @@
+package iopi
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Monday 1 January 2024 at hh:mm UTC, plus `days`
+func monday(days, hh, mm int) time.Time {
+	return time.Date(2024, 1, 1+days, hh, mm, 0, 0, time.UTC)
+}
+
+func TestParseRule(t *testing.T) {
+	t.Run("parses and formats rules", func(t *testing.T) {
+		for _, s := range []string{
+			"pin 5 high weekdays 07:00-19:00",
+			"pin 16 low daily 22:30-06:00",
+			"pin 1 high weekends 10:00-11:00",
+			"pin 2 high mon,wed,fri 00:00-23:59",
+		} {
+			r, err := ParseRule(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.String() != s {
+				t.Errorf("expected %q, got %q", s, r.String())
+			}
+		}
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		for _, s := range []string{
+			"",
+			"pin 17 high daily 07:00-08:00",
+			"pin 1 maybe daily 07:00-08:00",
+			"pin 1 high someday 07:00-08:00",
+			"pin 1 high daily 07:00",
+			"pin 1 high daily 25:00-08:00",
+			"pin 1 high daily 07:00-07:00",
+		} {
+			if _, err := ParseRule(s); err == nil {
+				t.Errorf("expected error for %q", s)
+			}
+		}
+	})
+}
+
+func TestRuleActive(t *testing.T) {
+	weekdays, _ := ParseRule("pin 5 high weekdays 07:00-19:00")
+	overnight, _ := ParseRule("pin 5 high fri 22:00-06:00")
+
+	for _, c := range []struct {
+		rule   Rule
+		t      time.Time
+		active bool
+	}{
+		{weekdays, monday(0, 6, 59), false},
+		{weekdays, monday(0, 7, 0), true},
+		{weekdays, monday(0, 18, 59), true},
+		{weekdays, monday(0, 19, 0), false},
+		{weekdays, monday(5, 12, 0), false}, // saturday
+		{overnight, monday(4, 23, 0), true},
+		{overnight, monday(5, 5, 59), true}, // saturday morning
+		{overnight, monday(5, 23, 0), false},
+		{overnight, monday(0, 1, 0), false},
+	} {
+		if c.rule.Active(c.t) != c.active {
+			t.Errorf("%s at %s: expected active %t", c.rule, c.t, c.active)
+		}
+	}
+
+	t.Run("follows the clock on daylight saving changes", func(t *testing.T) {
+		oslo, err := time.LoadLocation("Europe/Oslo")
+		if err != nil {
+			t.Skip("no time zone data:", err)
+		}
+		daily, _ := ParseRule("pin 5 high daily 07:00-19:00")
+		// Clocks go forward on 2026-03-29 and back on 2026-10-25
+		for _, day := range []int{29, 25} {
+			month := time.March
+			if day == 25 {
+				month = time.October
+			}
+			if daily.Active(time.Date(2026, month, day, 6, 59, 0, 0, oslo)) || !daily.Active(time.Date(2026, month, day, 7, 0, 0, 0, oslo)) {
+				t.Errorf("window not opened at 07:00 on %s %d", month, day)
+			}
+			if !daily.Active(time.Date(2026, month, day, 18, 59, 0, 0, oslo)) || daily.Active(time.Date(2026, month, day, 19, 0, 0, 0, oslo)) {
+				t.Errorf("window not closed at 19:00 on %s %d", month, day)
+			}
+		}
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("writes pins on transitions only", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		s := NewScheduler(dev, "")
+
+		clock := iopitest.NewFakeClock(monday(0, 6, 0))
+		s.Clock = clock
+		r, _ := ParseRule("pin 5 high weekdays 07:00-19:00")
+		s.Add(r)
+
+		expect := func(writes int, state byte) {
+			t.Helper()
+			if err := s.Apply(); err != nil {
+				t.Fatal(err)
+			}
+			if n := gpioWrites(dev, file, GPIOA); n != writes {
+				t.Fatalf("expected %d writes, got %d", writes, n)
+			}
+			last := file.CallHistory[len(file.CallHistory)-1]
+			if GetBit(last.Arg[1], 4) != state {
+				t.Error("unexpected pin state", last)
+			}
+		}
+
+		expect(1, 0)
+		expect(1, 0)
+		clock.Set(monday(0, 7, 0))
+		expect(2, 1)
+		clock.Set(monday(0, 8, 0))
+		expect(2, 1)
+		clock.Set(monday(0, 19, 0))
+		expect(3, 0)
+	})
+
+	t.Run("switches off rules of any high state", func(t *testing.T) {
+		r, _ := ParseRule("pin 5 high weekdays 07:00-19:00")
+		r.State = State(1) // as unmarshalled from JSON
+		if state := stateAt([]Rule{r}, monday(0, 6, 0))[5]; state != Low {
+			t.Error("unexpected state outside the window", state)
+		}
+		if state := stateAt([]Rule{r}, monday(0, 8, 0))[5]; !state.Bool() {
+			t.Error("unexpected state inside the window", state)
+		}
+	})
+
+	t.Run("lists no transitions unless asked for some", func(t *testing.T) {
+		s := NewScheduler(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), "")
+		r, _ := ParseRule("pin 5 high daily 07:00-19:00")
+		s.Add(r)
+		if next := s.Next(-1); next != nil {
+			t.Error("unexpected transitions", next)
+		}
+	})
+
+	t.Run("lists next transitions", func(t *testing.T) {
+		s := NewScheduler(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), "")
+		s.Clock = iopitest.NewFakeClock(monday(4, 12, 0)) // friday
+		a, _ := ParseRule("pin 5 high weekdays 07:00-19:00")
+		b, _ := ParseRule("pin 6 low daily 23:00-01:00")
+		s.Add(a)
+		s.Add(b)
+
+		expected := []Transition{
+			{5, Low, monday(4, 19, 0)},
+			{6, Low, monday(4, 23, 0)},
+			{6, High, monday(5, 1, 0)},
+			{6, Low, monday(5, 23, 0)},
+			{6, High, monday(6, 1, 0)},
+			{6, Low, monday(6, 23, 0)},
+			{6, High, monday(7, 1, 0)},
+			{5, High, monday(7, 7, 0)},
+		}
+		next := s.Next(len(expected))
+		if len(next) != len(expected) {
+			t.Fatal("unexpected transitions", next)
+		}
+		for i := range expected {
+			if next[i] != expected[i] {
+				t.Errorf("expected %v, got %v", expected[i], next[i])
+			}
+		}
+	})
+
+	t.Run("persists rules", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schedule.json")
+		dev := NewDevice(NewFakeFile(), 0x20, &sync.Mutex{})
+
+		s := NewScheduler(dev, path)
+		if err := s.Load(); !os.IsNotExist(err) {
+			t.Error("expected not exist error, got", err)
+		}
+		a, _ := ParseRule("pin 5 high weekdays 07:00-19:00")
+		b, _ := ParseRule("pin 6 low daily 23:00-01:00")
+		s.Add(a)
+		s.Add(b)
+		if err := s.Remove(0); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := NewScheduler(dev, path)
+		if err := loaded.Load(); err != nil {
+			t.Fatal(err)
+		}
+		rules := loaded.Rules()
+		if len(rules) != 1 || rules[0].String() != b.String() {
+			t.Error("unexpected rules", rules)
+		}
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		s := NewScheduler(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}), "")
+		if s.Add(Rule{Pin: 0}) == nil {
+			t.Error("expected error for invalid pin")
+		}
+		if s.Remove(0) == nil {
+			t.Error("expected error for missing rule")
+		}
+	})
+}
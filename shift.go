@@ -0,0 +1,65 @@
+package iopi
+
+import "fmt"
+
+type BitOrder int
+
+const (
+	MSBFirst BitOrder = iota
+	LSBFirst
+)
+
+// ShiftRegister drives shift registers like the 74HC595 by bit-banging
+// their data, clock and latch pins. Each bit takes a couple of bus
+// transactions, so expect hundreds rather than millions of bits per second.
+type ShiftRegister struct {
+	Order BitOrder
+
+	pins *PinGroup // data, clock and latch
+}
+
+// Create a shift register on three output pins. Pins must be set to output
+// beforehand.
+func NewShiftRegister(dev *Device, data, clock, latch uint8) *ShiftRegister {
+	return &ShiftRegister{pins: NewPinGroup(dev, data, clock, latch)}
+}
+
+// Bits of the pins in the group
+const (
+	shiftData  = 1 << 0
+	shiftClock = 1 << 1
+	shiftLatch = 1 << 2
+)
+
+// Shift out bytes and latch them to the outputs. With registers daisy
+// chained, the last byte ends up in the register nearest the expander.
+func (s *ShiftRegister) ShiftOut(data []byte) error {
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			bit := b >> (7 - i) & 1
+			if s.Order == LSBFirst {
+				bit = b >> i & 1
+			}
+
+			var state uint
+			if bit == 1 {
+				state = shiftData
+			}
+			// Registers sample data on the rising edge of the clock
+			if err := s.pins.WriteValue(state); err != nil {
+				return fmt.Errorf("failed to shift out: %w", err)
+			}
+			if err := s.pins.WriteValue(state | shiftClock); err != nil {
+				return fmt.Errorf("failed to shift out: %w", err)
+			}
+		}
+	}
+
+	if err := s.pins.WriteValue(shiftLatch); err != nil {
+		return fmt.Errorf("failed to latch: %w", err)
+	}
+	if err := s.pins.WriteValue(0); err != nil {
+		return fmt.Errorf("failed to latch: %w", err)
+	}
+	return nil
+}
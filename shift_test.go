@@ -0,0 +1,53 @@
+package iopi
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Decode the bits sampled on rising clock edges and the number of latches
+// from port A writes, with data, clock and latch on pins 1-3.
+func decodeShift(file *FakeFile) ([]byte, int) {
+	var bits []byte
+	latches := 0
+	var last byte
+	for _, v := range registerWrites(file, GPIOA) {
+		if v&0x02 != 0 && last&0x02 == 0 {
+			bits = append(bits, v&0x01)
+		}
+		if v&0x04 != 0 && last&0x04 == 0 {
+			latches++
+		}
+		last = v
+	}
+	return bits, latches
+}
+
+func TestShiftOut(t *testing.T) {
+	t.Run("shifts msb first and latches", func(t *testing.T) {
+		file := NewFakeFile()
+		s := NewShiftRegister(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2, 3)
+
+		if err := s.ShiftOut([]byte{0xA0, 0x01}); err != nil {
+			t.Fatal(err)
+		}
+		bits, latches := decodeShift(file)
+		expected := []byte{1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+		if !reflect.DeepEqual(bits, expected) || latches != 1 {
+			t.Error("unexpected bits", bits, latches)
+		}
+	})
+
+	t.Run("shifts lsb first", func(t *testing.T) {
+		file := NewFakeFile()
+		s := NewShiftRegister(NewDevice(file, 0x20, &sync.Mutex{}), 1, 2, 3)
+		s.Order = LSBFirst
+
+		s.ShiftOut([]byte{0x03})
+		bits, _ := decodeShift(file)
+		if !reflect.DeepEqual(bits, []byte{1, 1, 0, 0, 0, 0, 0, 0}) {
+			t.Error("unexpected bits", bits)
+		}
+	})
+}
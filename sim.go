@@ -0,0 +1,24 @@
+package iopi
+
+import (
+	"github.com/stigok/go-io-pi/bus"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Bus paths starting with SimPrefix select a simulated bus, see
+// bus.SimPrefix.
+const SimPrefix = bus.SimPrefix
+
+// Addresses of the chips on a simulated bus
+var SimAddresses = bus.SimAddresses
+
+// Return true if the path selects a simulated bus.
+func IsSimulated(path string) bool {
+	return bus.IsSimulated(path)
+}
+
+// Return the chip at `addr` on the simulated bus at `path`, e.g. to drive
+// its inputs.
+func SimChip(path string, addr byte) (*iopitest.Chip, error) {
+	return bus.SimChip(path, addr)
+}
@@ -0,0 +1,59 @@
+package iopi
+
+import "testing"
+
+func TestSim(t *testing.T) {
+	t.Run("keeps state across reopening", func(t *testing.T) {
+		dev, err := Open("sim://keep", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dev.Init(); err != nil {
+			t.Fatal(err)
+		}
+		dev.SetPinMode(2, Output)
+		dev.WritePin(2, High)
+		dev.Close()
+
+		dev, err = Open("sim://keep", 0x20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, _ := dev.ReadPin(2); state != 1 {
+			t.Error("output not kept")
+		}
+
+		chip, _ := SimChip("sim://keep", 0x20)
+		if !chip.IsOutput(2) || !chip.Level(2) {
+			t.Error("output not on chip")
+		}
+	})
+
+	t.Run("reads driven inputs", func(t *testing.T) {
+		dev, _ := Open("sim://inputs", 0x21)
+		chip, _ := SimChip("sim://inputs", 0x21)
+
+		chip.SetInput(16, true)
+		if state, _ := dev.ReadPin(16); state != 1 {
+			t.Error("driven input not read")
+		}
+
+		other, _ := Open("sim://other", 0x21)
+		if state, _ := other.ReadPin(16); state != 0 {
+			t.Error("buses not independent")
+		}
+	})
+
+	t.Run("only has chips at the IO Pi addresses", func(t *testing.T) {
+		if _, err := Open("sim://demo", 0x30); err == nil {
+			t.Error("expected error for missing device")
+		}
+		found, err := Scan("sim://demo")
+		if err != nil || string(found) != string(SimAddresses) {
+			t.Error("unexpected scan", found, err)
+		}
+		if _, err := SimChip("/dev/i2c-1", 0x20); err == nil {
+			t.Error("expected error for real bus")
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package iopi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Configuration and output latch state of a single port.
+type PortSnapshot struct {
+	Mode      byte `json:"mode"`      // IODIR
+	Polarity  byte `json:"polarity"`  // IPOL
+	Pullup    byte `json:"pullup"`    // GPPU
+	Output    byte `json:"output"`    // OLAT
+	Interrupt byte `json:"interrupt"` // GPINTEN
+	Default   byte `json:"default"`   // DEFVAL
+	Compare   byte `json:"compare"`   // INTCON
+}
+
+// Snapshot holds the complete writable register state of a device. It can
+// be serialised (e.g. as JSON) and written back to the same or another
+// device with `Restore`.
+type Snapshot struct {
+	Config byte         `json:"config"` // IOCON
+	PortA  PortSnapshot `json:"port_a"`
+	PortB  PortSnapshot `json:"port_b"`
+}
+
+// IOCON.BANK. Changes the register addresses, which this package does not
+// support.
+const ioconBank = 0x80
+
+// A register backing a field of PortSnapshot.
+type snapshotField struct {
+	reg Register
+	val *byte
+}
+
+// Registers backing the fields of PortSnapshot, in the order they are
+// written on restore. OLAT is written before IODIR so pins switched to
+// output start in their latched state.
+func portRegisters(port Port, snap *PortSnapshot) []snapshotField {
+	off := Register(0)
+	if port == PortB {
+		off = 1
+	}
+
+	return []snapshotField{
+		{OLATA + off, &snap.Output},
+		{IPOLA + off, &snap.Polarity},
+		{GPPUA + off, &snap.Pullup},
+		{DEFVALA + off, &snap.Default},
+		{INTCONA + off, &snap.Compare},
+		{GPINTENA + off, &snap.Interrupt},
+		{IODIRA + off, &snap.Mode},
+	}
+}
+
+// Read the current register state of the device.
+func (dev *Device) Snapshot() (Snapshot, error) {
+	var snap Snapshot
+
+	cfg, err := dev.ReadByteData(IOCON)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	snap.Config = cfg
+
+	for _, port := range []Port{PortA, PortB} {
+		ps := &snap.PortA
+		if port == PortB {
+			ps = &snap.PortB
+		}
+		for _, r := range portRegisters(port, ps) {
+			val, err := dev.ReadByteData(r.reg)
+			if err != nil {
+				return Snapshot{}, fmt.Errorf("failed to read snapshot: %w", err)
+			}
+			*r.val = val
+		}
+	}
+
+	return snap, nil
+}
+
+// Write a snapshot back to the device.
+func (dev *Device) Restore(snap Snapshot) error {
+	if snap.Config&ioconBank != 0 {
+		return fmt.Errorf("failed to restore snapshot: IOCON.BANK=1 is not supported")
+	}
+
+	err := dev.WriteByteData(IOCON, snap.Config)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	for _, port := range []Port{PortA, PortB} {
+		ps := snap.PortA
+		if port == PortB {
+			ps = snap.PortB
+		}
+		for _, r := range portRegisters(port, &ps) {
+			if err := dev.WriteByteData(r.reg, *r.val); err != nil {
+				return fmt.Errorf("failed to restore snapshot: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// A single difference between two snapshots. Per-port registers are
+// compared bit by bit, so Pin is set to the affected pin (1-16). Pin is 0
+// for registers that are not related to a pin, such as IOCON.
+type Difference struct {
+	Register string
+	Pin      uint8
+	A, B     byte
+}
+
+func (d Difference) String() string {
+	if d.Pin == 0 {
+		return fmt.Sprintf("%s: 0x%02X != 0x%02X", d.Register, d.A, d.B)
+	}
+	return fmt.Sprintf("%s pin %d: %d != %d", d.Register, d.Pin, d.A, d.B)
+}
+
+// Compare two snapshots. Returns nil if they are equal.
+func DiffConfig(a, b Snapshot) []Difference {
+	var diffs []Difference
+
+	if a.Config != b.Config {
+		diffs = append(diffs, Difference{IOCON.String(), 0, a.Config, b.Config})
+	}
+
+	for _, port := range []Port{PortA, PortB} {
+		pa, pb, offset := &a.PortA, &b.PortA, uint8(1)
+		if port == PortB {
+			pa, pb, offset = &a.PortB, &b.PortB, 9
+		}
+
+		fa, fb := portRegisters(port, pa), portRegisters(port, pb)
+		for i := range fa {
+			for bit := uint8(0); bit < 8; bit++ {
+				va, vb := GetBit(*fa[i].val, bit), GetBit(*fb[i].val, bit)
+				if va != vb {
+					diffs = append(diffs, Difference{fa[i].reg.String(), offset + bit, va, vb})
+				}
+			}
+		}
+	}
+
+	return diffs
+}
+
+// Format a list of differences, one per line.
+func FormatDiff(diffs []Difference) string {
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Compare the live register state of the device against a snapshot, where
+// the device is `A` and the snapshot is `B` in the returned differences.
+// Returns nil differences if the device matches.
+func (dev *Device) VerifyAgainst(snap Snapshot) ([]Difference, error) {
+	live, err := dev.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify device: %w", err)
+	}
+
+	return DiffConfig(live, snap), nil
+}
@@ -0,0 +1,160 @@
+package iopi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+	// The fake echoes back the register address on read
+	snap, err := dev.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("reads port A registers", func(t *testing.T) {
+		if snap.PortA.Mode != byte(IODIRA) || snap.PortA.Output != byte(OLATA) || snap.PortA.Pullup != byte(GPPUA) {
+			t.Error("unexpected port A snapshot", snap.PortA)
+		}
+	})
+
+	t.Run("reads port B registers", func(t *testing.T) {
+		if snap.PortB.Mode != byte(IODIRB) || snap.PortB.Output != byte(OLATB) || snap.PortB.Compare != byte(INTCONB) {
+			t.Error("unexpected port B snapshot", snap.PortB)
+		}
+	})
+
+	t.Run("reads config register", func(t *testing.T) {
+		if snap.Config != byte(IOCON) {
+			t.Error("unexpected config", snap.Config)
+		}
+	})
+
+	t.Run("survives json round trip", func(t *testing.T) {
+		data, err := json.Marshal(snap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Snapshot
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(snap, decoded) {
+			t.Error("snapshot changed after round trip")
+		}
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Run("writes all registers", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		snap := Snapshot{Config: 0x22}
+		snap.PortA.Mode = 0x0F
+		snap.PortB.Output = 0xAA
+
+		if err := dev.Restore(snap); err != nil {
+			t.Fatal(err)
+		}
+		if !file.HasCall("Write", []byte{byte(IOCON), 0x22}) {
+			t.Error("config not written", file.CallHistory)
+		}
+		if !file.HasCall("Write", []byte{byte(IODIRA), 0x0F}) {
+			t.Error("port A mode not written", file.CallHistory)
+		}
+		if !file.HasCall("Write", []byte{byte(OLATB), 0xAA}) {
+			t.Error("port B output not written", file.CallHistory)
+		}
+	})
+
+	t.Run("writes output latch before direction", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		dev.Restore(Snapshot{})
+
+		olat, iodir := -1, -1
+		for i, c := range file.CallHistory {
+			switch Register(c.Arg[0]) {
+			case OLATA:
+				olat = i
+			case IODIRA:
+				iodir = i
+			}
+		}
+		if olat > iodir {
+			t.Error("IODIRA written before OLATA")
+		}
+	})
+
+	t.Run("rejects bank mode", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+		if dev.Restore(Snapshot{Config: 0x80}) == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestDiffConfig(t *testing.T) {
+	t.Run("equal snapshots", func(t *testing.T) {
+		if diffs := DiffConfig(Snapshot{}, Snapshot{}); diffs != nil {
+			t.Error("expected no differences", diffs)
+		}
+	})
+
+	t.Run("reports differing pins", func(t *testing.T) {
+		a, b := Snapshot{}, Snapshot{}
+		b.PortA.Mode = 0b00000100
+		b.PortB.Pullup = 0b10000000
+
+		diffs := DiffConfig(a, b)
+		expected := []Difference{
+			{"IODIRA", 3, 0, 1},
+			{"GPPUB", 16, 0, 1},
+		}
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Error("unexpected differences", diffs)
+		}
+	})
+
+	t.Run("reports config register", func(t *testing.T) {
+		diffs := DiffConfig(Snapshot{Config: 0x22}, Snapshot{})
+		if len(diffs) != 1 || diffs[0].String() != "IOCON: 0x22 != 0x00" {
+			t.Error("unexpected differences", diffs)
+		}
+	})
+
+	t.Run("formats readable lines", func(t *testing.T) {
+		out := FormatDiff([]Difference{{"IODIRA", 3, 0, 1}, {"OLATB", 9, 1, 0}})
+		if out != "IODIRA pin 3: 0 != 1\nOLATB pin 9: 1 != 0" {
+			t.Error("unexpected output", out)
+		}
+	})
+}
+
+func TestVerifyAgainst(t *testing.T) {
+	file := NewFakeFile()
+	dev := NewDevice(file, 0x20, &sync.Mutex{})
+
+	golden, _ := dev.Snapshot()
+	diffs, err := dev.VerifyAgainst(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs != nil {
+		t.Error("expected device to match", diffs)
+	}
+
+	golden.PortA.Output ^= 0x01
+	diffs, _ = dev.VerifyAgainst(golden)
+	if len(diffs) != 1 || diffs[0].Register != "OLATA" || diffs[0].Pin != 1 {
+		t.Error("unexpected differences", diffs)
+	}
+}
@@ -0,0 +1,107 @@
+package iopi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type StepMode int
+
+const (
+	FullStep StepMode = iota // two coils energised at a time, full torque
+	HalfStep                 // alternating one and two coils, double resolution
+)
+
+// Coil states of a half step cycle, bit 0 being the first pin. The odd
+// entries energise two coils and form the full step cycle.
+var halfSteps = [8]uint{0b0001, 0b0011, 0b0010, 0b0110, 0b0100, 0b1100, 0b1000, 0b1001}
+
+// Stepper drives a unipolar stepper motor through four output pins, e.g.
+// via a ULN2003 driver. The position is counted in steps of the mode in
+// use, so keep the mode between calls to MoveTo.
+type Stepper struct {
+	Mode  StepMode
+	Delay time.Duration // between steps at full speed
+
+	// Accelerate from StartDelay to Delay over the first Ramp steps of a
+	// move, and decelerate over the last. Disabled if Ramp is 0.
+	Ramp       int
+	StartDelay time.Duration
+
+	Clock Clock
+
+	coils    *PinGroup
+	phase    int // index in halfSteps
+	position int
+}
+
+// Create a stepper on four output pins, in the order of the coils (IN1 to
+// IN4 on a ULN2003 board). Pins must be set to output beforehand.
+func NewStepper(dev *Device, pins [4]uint8) *Stepper {
+	return &Stepper{
+		Delay: 2 * time.Millisecond,
+		coils: NewPinGroup(dev, pins[:]...),
+	}
+}
+
+// Move a number of steps, backwards if negative. Returns early if the
+// context is cancelled, with the position of the last step taken.
+func (s *Stepper) Step(ctx context.Context, steps int) error {
+	dir, n := 1, steps
+	if steps < 0 {
+		dir, n = -1, -steps
+	}
+
+	for i := 0; i < n; i++ {
+		if s.Mode == FullStep {
+			s.phase = (s.phase | 1) + 2*dir
+		} else {
+			s.phase += dir
+		}
+		s.phase = (s.phase + len(halfSteps)) % len(halfSteps)
+
+		if err := s.coils.WriteValue(halfSteps[s.phase]); err != nil {
+			return fmt.Errorf("failed to step: %w", err)
+		}
+		s.position += dir
+
+		if err := SleepContext(ctx, s.Clock, s.delay(i, n)); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Move to an absolute position, see Position.
+func (s *Stepper) MoveTo(ctx context.Context, position int) error {
+	return s.Step(ctx, position-s.position)
+}
+
+// Return the position in steps, relative to where the stepper was created
+// or last reset with SetPosition.
+func (s *Stepper) Position() int {
+	return s.position
+}
+
+// Set the current position, e.g. to 0 after homing.
+func (s *Stepper) SetPosition(position int) {
+	s.position = position
+}
+
+// Turn off all coils, letting the motor turn freely and stay cool.
+func (s *Stepper) Release() error {
+	return s.coils.WriteValue(0)
+}
+
+// Return the delay after step `i` of a move of `n` steps.
+func (s *Stepper) delay(i, n int) time.Duration {
+	k := i
+	if n-1-i < k {
+		k = n - 1 - i
+	}
+	if s.Ramp <= 0 || k >= s.Ramp || s.StartDelay <= s.Delay {
+		return s.Delay
+	}
+	return s.StartDelay - (s.StartDelay-s.Delay)*time.Duration(k)/time.Duration(s.Ramp)
+}
@@ -0,0 +1,97 @@
+package iopi
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStepper() (*Stepper, *FakeFile, *recordingClock) {
+	file := NewFakeFile()
+	s := NewStepper(NewDevice(file, 0x20, &sync.Mutex{}), [4]uint8{1, 2, 3, 4})
+	clock := newRecordingClock()
+	s.Clock = clock
+	return s, file, clock
+}
+
+// Return the coil states written to port A, pins 1-4
+func coilStates(file *FakeFile) []byte {
+	var states []byte
+	for _, c := range registerWrites(file, GPIOA) {
+		states = append(states, c&0x0F)
+	}
+	return states
+}
+
+func TestStepper(t *testing.T) {
+	t.Run("full steps", func(t *testing.T) {
+		s, file, _ := newTestStepper()
+		s.Step(context.Background(), 5)
+
+		expected := []byte{0b0110, 0b1100, 0b1001, 0b0011, 0b0110}
+		if states := coilStates(file); !reflect.DeepEqual(states, expected) {
+			t.Errorf("unexpected coils: %04b", states)
+		}
+		if s.Position() != 5 {
+			t.Error("unexpected position", s.Position())
+		}
+	})
+
+	t.Run("half steps backwards", func(t *testing.T) {
+		s, file, _ := newTestStepper()
+		s.Mode = HalfStep
+		s.Step(context.Background(), -3)
+
+		expected := []byte{0b1001, 0b1000, 0b1100}
+		if states := coilStates(file); !reflect.DeepEqual(states, expected) {
+			t.Errorf("unexpected coils: %04b", states)
+		}
+		if s.Position() != -3 {
+			t.Error("unexpected position", s.Position())
+		}
+	})
+
+	t.Run("moves to position", func(t *testing.T) {
+		s, _, _ := newTestStepper()
+		s.SetPosition(10)
+		s.MoveTo(context.Background(), 4)
+		if s.Position() != 4 {
+			t.Error("unexpected position", s.Position())
+		}
+	})
+
+	t.Run("ramps speed", func(t *testing.T) {
+		s, _, clock := newTestStepper()
+		s.Delay = time.Millisecond
+		s.StartDelay = 5 * time.Millisecond
+		s.Ramp = 2
+		s.Step(context.Background(), 6)
+
+		ms := time.Millisecond
+		expected := []time.Duration{5 * ms, 3 * ms, ms, ms, 3 * ms, 5 * ms}
+		if delays := clock.Waits(); !reflect.DeepEqual(delays, expected) {
+			t.Error("unexpected delays", delays)
+		}
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		s, _, _ := newTestStepper()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		s.Step(ctx, 100)
+		if s.Position() != 1 {
+			t.Error("unexpected position", s.Position())
+		}
+	})
+
+	t.Run("releases coils", func(t *testing.T) {
+		s, file, _ := newTestStepper()
+		s.Step(context.Background(), 1)
+		s.Release()
+		if states := coilStates(file); states[len(states)-1] != 0 {
+			t.Error("coils not released", states)
+		}
+	})
+}
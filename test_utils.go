@@ -8,10 +8,16 @@ type Call struct {
 	Arg []byte
 }
 
+// FakeFile records calls and echoes writes back on reads. For a fake that
+// behaves like the chip, see package iopitest.
 type FakeFile struct {
 	Buf         []byte
 	CallHistory []Call
 	NextRead    []byte
+
+	registers map[byte]byte   // see SetRegister
+	queue     map[byte][]byte // see QueueRead
+	pointer   byte            // register addressed by the last write
 }
 
 func NewFakeFile() *FakeFile {
@@ -27,7 +33,8 @@ func (c Call) String() string {
 
 // Records a call to the file API
 func (f *FakeFile) recordCall(fn string, arg []byte) {
-	call := Call{fn, arg}
+	// Copied, as callers may reuse the buffer
+	call := Call{fn, append([]byte(nil), arg...)}
 	f.CallHistory = append(f.CallHistory, call)
 }
 
@@ -46,25 +53,68 @@ func (f *FakeFile) Read(b []byte) (int, error) {
 	f.recordCall("Read", b)
 
 	// Allow for faking outputs
+	n := 0
 	if f.NextRead != nil {
-		n := copy(b, f.NextRead)
+		n = copy(b, f.NextRead)
 		f.NextRead = nil
-		return n, nil
+		if len(b) == 1 || n == len(b) {
+			return n, nil
+		}
 	}
 
-	n := copy(b, f.Buf)
-	return n, nil
+	// Further bytes come from the following registers, as on the chip
+	for i := n; i < len(b); i++ {
+		b[i] = f.readRegister(f.pointer + byte(i))
+	}
+	return len(b), nil
+}
+
+// Return the next value read from a register.
+func (f *FakeFile) readRegister(reg byte) byte {
+	if q := f.queue[reg]; len(q) > 0 {
+		f.queue[reg] = q[1:]
+		return q[0]
+	}
+	if v, ok := f.registers[reg]; ok {
+		return v
+	}
+	return f.Buf[0]
 }
 
 func (f *FakeFile) Write(b []byte) (int, error) {
 	f.recordCall("Write", b)
 
+	if len(b) > 0 {
+		f.pointer = b[0]
+	}
+	if _, ok := f.registers[f.pointer]; ok && len(b) > 1 {
+		f.registers[f.pointer] = b[1]
+	}
+
 	//fmt.Printf("write befor: %b\n", b)
 	n := copy(f.Buf, b)
 	//fmt.Printf("write after: %b\n", f.Buf)
 	return n, nil
 }
 
+// Store a value read from a register until it is written. Reads of
+// registers without a stored value echo the last write.
+func (f *FakeFile) SetRegister(reg Register, value byte) {
+	if f.registers == nil {
+		f.registers = make(map[byte]byte)
+	}
+	f.registers[byte(reg)] = value
+}
+
+// Queue values read from a register, one per read, before any stored
+// value of the register.
+func (f *FakeFile) QueueRead(reg Register, values ...byte) {
+	if f.queue == nil {
+		f.queue = make(map[byte][]byte)
+	}
+	f.queue[byte(reg)] = append(f.queue[byte(reg)], values...)
+}
+
 func (f *FakeFile) Close() error {
 	f.recordCall("Close", nil)
 	return nil
@@ -0,0 +1,128 @@
+package iopi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A pin transition at an offset from the start of a timeline.
+type Step struct {
+	At    time.Duration
+	Pin   uint8
+	State State
+}
+
+// Pin transitions in order of time, e.g. a slow waveform or test stimulus.
+type Timeline []Step
+
+// Requested and achieved offset of a step played by a Player.
+type StepTiming struct {
+	Step
+	Achieved time.Duration // when the write completed
+}
+
+// Return how late the step was written.
+func (t StepTiming) Late() time.Duration {
+	return t.Achieved - t.At
+}
+
+// Timing of all steps played from a timeline, in order.
+type PlayReport []StepTiming
+
+// Return the most any step was late.
+func (r PlayReport) MaxLate() time.Duration {
+	var max time.Duration
+	for _, t := range r {
+		if t.Late() > max {
+			max = t.Late()
+		}
+	}
+	return max
+}
+
+// Return how late steps were written on average.
+func (r PlayReport) MeanLate() time.Duration {
+	if len(r) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, t := range r {
+		sum += t.Late()
+	}
+	return sum / time.Duration(len(r))
+}
+
+// Player writes the steps of a timeline at their offsets from the start.
+// Offsets are measured on the monotonic clock from the start of playback,
+// so a late step doesn't delay the following ones. Steps are never
+// skipped, late steps are written as soon as possible. Pins must be set to
+// output beforehand.
+type Player struct {
+	// Busy-wait the last part of each delay, trading CPU for precision.
+	// Timers are commonly a millisecond or more late.
+	Spin  time.Duration
+	Clock Clock
+
+	dev *Device
+}
+
+func NewPlayer(dev *Device) *Player {
+	return &Player{dev: dev}
+}
+
+// Play a timeline until done or the context is cancelled, returning the
+// timing of the steps written.
+func (p *Player) Play(ctx context.Context, tl Timeline) (PlayReport, error) {
+	for i, e := range tl {
+		if e.Pin < 1 || e.Pin > 16 {
+			return nil, fmt.Errorf("invalid pin at step %d: %d", i, e.Pin)
+		}
+		if e.At < 0 || (i > 0 && e.At < tl[i-1].At) {
+			return nil, fmt.Errorf("step %d is out of order: %s", i, e.At)
+		}
+	}
+
+	clock := ClockOr(p.Clock)
+	report := make(PlayReport, 0, len(tl))
+	start := clock.Now()
+
+	for _, e := range tl {
+		if err := p.wait(ctx, start.Add(e.At)); err != nil {
+			return report, err
+		}
+		if err := p.dev.WritePin(e.Pin, e.State); err != nil {
+			return report, fmt.Errorf("failed to write step at %s: %w", e.At, err)
+		}
+		report = append(report, StepTiming{e, clock.Now().Sub(start)})
+	}
+
+	return report, nil
+}
+
+// Wait until `deadline`, sleeping for all but the last `Spin` of it.
+func (p *Player) wait(ctx context.Context, deadline time.Time) error {
+	clock := ClockOr(p.Clock)
+	if err := SleepContext(ctx, clock, deadline.Sub(clock.Now())-p.Spin); err != nil {
+		return err
+	}
+	for clock.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build a square wave on a pin, starting high, with `period` per cycle.
+func SquareWave(pin uint8, period time.Duration, cycles int) Timeline {
+	tl := make(Timeline, 0, 2*cycles+1)
+	for i := 0; i < 2*cycles; i++ {
+		state := High
+		if i%2 != 0 {
+			state = Low
+		}
+		tl = append(tl, Step{time.Duration(i) * period / 2, pin, state})
+	}
+	return append(tl, Step{time.Duration(cycles) * period, pin, Low})
+}
@@ -0,0 +1,69 @@
+package iopi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlayer(t *testing.T) {
+	t.Run("plays steps in order and reports timing", func(t *testing.T) {
+		file := NewFakeFile()
+		dev := NewDevice(file, 0x20, &sync.Mutex{})
+		p := NewPlayer(dev)
+		p.Spin = time.Millisecond
+
+		tl := SquareWave(2, 4*time.Millisecond, 3)
+		report, err := p.Play(context.Background(), tl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(report) != 7 || gpioWrites(dev, file, GPIOA) != 7 {
+			t.Fatal("unexpected number of steps", len(report))
+		}
+		for i, timing := range report {
+			if timing.Step != tl[i] {
+				t.Error("unexpected step", timing.Step)
+			}
+			if timing.Late() < 0 {
+				t.Error("step written early", timing)
+			}
+		}
+		if report.MaxLate() < report.MeanLate() {
+			t.Error("max less than mean", report.MaxLate(), report.MeanLate())
+		}
+		if tl[6].At != 12*time.Millisecond || tl[6].State != Low {
+			t.Error("unexpected last step", tl[6])
+		}
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		p := NewPlayer(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(5*time.Millisecond, cancel)
+
+		report, err := p.Play(ctx, Timeline{{0, 1, High}, {time.Minute, 1, Low}})
+		if err != context.Canceled {
+			t.Error("expected cancellation, got", err)
+		}
+		if len(report) != 1 {
+			t.Error("unexpected report", report)
+		}
+	})
+
+	t.Run("rejects invalid timelines", func(t *testing.T) {
+		p := NewPlayer(NewDevice(NewFakeFile(), 0x20, &sync.Mutex{}))
+		for _, tl := range []Timeline{
+			{{0, 17, High}},
+			{{time.Second, 1, High}, {0, 1, Low}},
+			{{-time.Second, 1, High}},
+		} {
+			if _, err := p.Play(context.Background(), tl); err == nil {
+				t.Error("expected error for", tl)
+			}
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package iopi
+
+import "fmt"
+
+// DeviceError is returned when a transfer of a register fails, naming the
+// chip and register, so errors of boards sharing a program can be told
+// apart. Errors of the higher level functions wrap it, see errors.As.
+type DeviceError struct {
+	Path     string // of the bus, empty if unknown
+	Address  byte
+	Op       string // "read" or "write"
+	Register Register
+	Err      error
+}
+
+func (e *DeviceError) Error() string {
+	dev := fmt.Sprintf("device 0x%02x", e.Address)
+	if e.Path != "" {
+		dev += " on " + e.Path
+	}
+	return fmt.Sprintf("failed to %s %s of %s: %s", e.Op, e.Register, dev, e.Err)
+}
+
+func (e *DeviceError) Unwrap() error {
+	return e.Err
+}
+
+// Return an error of a transfer of a register by the device.
+func (dev *Device) error(op string, reg Register, err error) error {
+	return &DeviceError{Path: dev.Path, Address: dev.Address, Op: op, Register: reg, Err: err}
+}
+
+// ShortTransferError is wrapped in a DeviceError when the bus transfers
+// fewer bytes than asked for, which would leave a register half written
+// or read.
+type ShortTransferError struct {
+	Op       string // "read" or "write"
+	Register Register
+	N        int // bytes transferred
+	Expected int
+}
+
+func (e *ShortTransferError) Error() string {
+	return fmt.Sprintf("short %s of %s: transferred %d of %d bytes", e.Op, e.Register, e.N, e.Expected)
+}
+
+// Retry transfers of a register cut short by the bus up to `n` times
+// before returning a ShortTransferError. A retry repeats the whole
+// transfer, including the register address. 0 disables retries.
+func (dev *Device) SetRetries(n int) {
+	dev.mutex.Lock()
+	defer dev.mutex.Unlock()
+	dev.retries = n
+}
@@ -0,0 +1,105 @@
+package iopi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// A bus cutting the first `short` transfers one byte short
+type shortTransfers struct {
+	nopBus
+	short int
+	calls int
+}
+
+func (b *shortTransfers) transfer(p []byte) (int, error) {
+	b.calls++
+	if b.short > 0 {
+		b.short--
+		return len(p) - 1, nil
+	}
+	return len(p), nil
+}
+
+func (b *shortTransfers) Read(p []byte) (int, error)  { return b.transfer(p) }
+func (b *shortTransfers) Write(p []byte) (int, error) { return b.transfer(p) }
+
+func TestShortTransfers(t *testing.T) {
+	t.Run("reports short writes", func(t *testing.T) {
+		dev := NewDevice(&shortTransfers{short: 1}, 0x20, &sync.Mutex{})
+
+		err := dev.WriteByteData(OLATA, 0x01)
+		var short *ShortTransferError
+		if !errors.As(err, &short) {
+			t.Fatal("expected short transfer error", err)
+		}
+		if short.Op != "write" || short.Register != OLATA || short.N != 1 || short.Expected != 2 {
+			t.Error("unexpected error", short)
+		}
+	})
+
+	t.Run("reports short reads", func(t *testing.T) {
+		dev := NewDevice(readShort{}, 0x20, &sync.Mutex{})
+
+		_, err := dev.ReadByteData(GPIOA)
+		var short *ShortTransferError
+		if !errors.As(err, &short) || short.Op != "read" || short.N != 0 || short.Expected != 1 {
+			t.Error("expected short read", err)
+		}
+	})
+
+	t.Run("retries short transfers", func(t *testing.T) {
+		bus := &shortTransfers{short: 2}
+		dev := NewDevice(bus, 0x20, &sync.Mutex{})
+		dev.SetRetries(2)
+
+		if err := dev.WriteByteData(OLATA, 0x01); err != nil {
+			t.Fatal(err)
+		}
+		if bus.calls != 3 {
+			t.Error("expected 3 attempts, got", bus.calls)
+		}
+
+		bus.short, bus.calls = 3, 0
+		if err := dev.WriteByteData(OLATA, 0x01); err == nil {
+			t.Error("expected error after retries")
+		}
+	})
+}
+
+// A bus reading nothing
+type readShort struct{ nopBus }
+
+func (readShort) Read(p []byte) (int, error) { return 0, nil }
+
+func TestDeviceError(t *testing.T) {
+	t.Run("names the device and register", func(t *testing.T) {
+		dev := NewDevice(failingBus{}, 0x21, &sync.Mutex{})
+		dev.Path = "/dev/i2c-1"
+
+		err := dev.SetPinMode(10, Output)
+		var devErr *DeviceError
+		if !errors.As(err, &devErr) {
+			t.Fatal("expected device error", err)
+		}
+		if devErr.Path != "/dev/i2c-1" || devErr.Address != 0x21 || devErr.Op != "read" || devErr.Register != IODIRB {
+			t.Error("unexpected error", devErr)
+		}
+		want := "failed to set pin direction: failed to read IODIRB of device 0x21 on /dev/i2c-1: read failed"
+		if err.Error() != want {
+			t.Errorf("expected %q, got %q", want, err)
+		}
+	})
+
+	t.Run("wraps short transfers", func(t *testing.T) {
+		dev := NewDevice(&shortTransfers{short: 1}, 0x20, &sync.Mutex{})
+
+		err := dev.WritePort(PortB, 0xFF)
+		var devErr *DeviceError
+		var short *ShortTransferError
+		if !errors.As(err, &devErr) || !errors.As(err, &short) || devErr.Op != "write" {
+			t.Error("unexpected error", err)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+// Package zones controls irrigation and similar zones switched by output
+// pins, e.g. the valves of a garden: zones run by schedule or by hand for
+// a limited time, and no more of them at once than the supply allows, e.g.
+// the capacity of a pump. Zones beyond that wait in turn. The pins are
+// driven by package iopi.
+package zones
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+)
+
+// A zone switched by an output pin, on when the pin is active, see
+// iopi.Device.SetActive. The pin must be set to output beforehand.
+type Zone struct {
+	Name       string
+	Device     *iopi.Device
+	Pin        uint8
+	MaxRuntime time.Duration // of a run, unlimited if 0
+}
+
+// A daily run of a zone
+type Schedule struct {
+	Zone     string
+	Days     []time.Weekday // every day if empty
+	Start    time.Duration  // since midnight
+	Duration time.Duration
+}
+
+func (s Schedule) onDay(d time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, day := range s.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// State of a zone
+type State string
+
+const (
+	Off     State = "off"
+	Queued  State = "queued" // waiting for a running zone to finish
+	Running State = "running"
+)
+
+// Status of a zone
+type Status struct {
+	Name  string    `json:"name"`
+	State State     `json:"state"`
+	Until time.Time `json:"until,omitempty"` // end of the run, if running
+	Skip  time.Time `json:"skip,omitempty"`  // scheduled runs skipped until, see Skip
+}
+
+type zone struct {
+	Zone
+	state    State
+	duration time.Duration // of the queued or current run
+	until    time.Time
+	skip     time.Time
+}
+
+// Controller runs zones. Zones are started by hand with Start, or by the
+// schedules while Run is running.
+type Controller struct {
+	// Zones running at once, unlimited if 0
+	MaxActive int
+	// How often schedules and run times are checked, every second if 0
+	Interval time.Duration
+	Clock    iopi.Clock
+	// Called when switching a zone fails. A zone failing to start is
+	// stopped.
+	OnError func(zone string, err error)
+
+	mutex     sync.Mutex
+	zones     []*zone // in the order given, which is the order of the queue
+	byName    map[string]*zone
+	queue     []*zone
+	schedules []Schedule
+	last      time.Time // of the last check of the schedules
+}
+
+// Create a controller of zones with unique names. All zones start off.
+func New(zones ...Zone) (*Controller, error) {
+	c := &Controller{Interval: time.Second, byName: make(map[string]*zone)}
+	for _, z := range zones {
+		if z.Name == "" || c.byName[z.Name] != nil {
+			return nil, fmt.Errorf("invalid or duplicate zone name: %q", z.Name)
+		}
+		if z.Device == nil || z.Pin < 1 || z.Pin > 16 {
+			return nil, fmt.Errorf("zone %s: invalid pin: %d", z.Name, z.Pin)
+		}
+		zn := &zone{Zone: z, state: Off}
+		c.zones = append(c.zones, zn)
+		c.byName[z.Name] = zn
+	}
+	return c, nil
+}
+
+// Replace the schedules. Returns an error if a schedule names an unknown
+// zone.
+func (c *Controller) SetSchedules(schedules []Schedule) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, s := range schedules {
+		if c.byName[s.Zone] == nil {
+			return fmt.Errorf("schedule of unknown zone: %s", s.Zone)
+		}
+		if s.Duration <= 0 {
+			return fmt.Errorf("schedule of zone %s: invalid duration: %s", s.Zone, s.Duration)
+		}
+	}
+	c.schedules = append([]Schedule(nil), schedules...)
+	return nil
+}
+
+// Run a zone for `d`, or its maximum runtime if 0, limited by the maximum
+// runtime. The zone is queued if MaxActive zones are running. A running or
+// queued zone is given the new duration, counted from now if running.
+func (c *Controller) Start(name string, d time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	z := c.byName[name]
+	if z == nil {
+		return fmt.Errorf("unknown zone: %s", name)
+	}
+	return c.start(z, d, c.now())
+}
+
+func (c *Controller) start(z *zone, d time.Duration, now time.Time) error {
+	if z.MaxRuntime > 0 && (d <= 0 || d > z.MaxRuntime) {
+		d = z.MaxRuntime
+	}
+	if d <= 0 {
+		return fmt.Errorf("zone %s: no duration given", z.Name)
+	}
+	z.duration = d
+
+	switch {
+	case z.state == Running:
+		z.until = now.Add(d)
+	case z.state == Queued:
+	case c.MaxActive > 0 && c.running() >= c.MaxActive:
+		z.state = Queued
+		c.queue = append(c.queue, z)
+	default:
+		return c.switchOn(z, now)
+	}
+	return nil
+}
+
+// Stop a running or queued zone.
+func (c *Controller) Stop(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	z := c.byName[name]
+	if z == nil {
+		return fmt.Errorf("unknown zone: %s", name)
+	}
+	err := c.stop(z)
+	c.advance(c.now())
+	return err
+}
+
+// Stop all zones, e.g. on shutdown.
+func (c *Controller) StopAll() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var first error
+	for _, z := range c.zones {
+		if err := c.stop(z); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (c *Controller) stop(z *zone) error {
+	switch z.state {
+	case Queued:
+		for i, q := range c.queue {
+			if q == z {
+				c.queue = append(c.queue[:i], c.queue[i+1:]...)
+				break
+			}
+		}
+		z.state = Off
+	case Running:
+		// Still running, and stopped again by Check, if the write fails
+		if err := z.Device.SetActive(z.Pin, false); err != nil {
+			return fmt.Errorf("failed to stop zone %s: %w", z.Name, err)
+		}
+		z.state, z.until = Off, time.Time{}
+	}
+	return nil
+}
+
+// Skip the scheduled runs of a zone until `t`, e.g. after rain. Runs
+// started by hand are not affected. Pass the zero time to resume.
+func (c *Controller) Skip(name string, t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	z := c.byName[name]
+	if z == nil {
+		return fmt.Errorf("unknown zone: %s", name)
+	}
+	z.skip = t
+	return nil
+}
+
+// Return the status of all zones, in the order they were given to New.
+func (c *Controller) Status() []Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var status []Status
+	for _, z := range c.zones {
+		status = append(status, Status{Name: z.Name, State: z.state, Until: z.until, Skip: z.skip})
+	}
+	return status
+}
+
+// Start scheduled runs, stop zones at the end of their runs and start
+// queued zones until the context is cancelled, then stop all zones.
+func (c *Controller) Run(ctx context.Context) error {
+	defer c.StopAll()
+
+	clock := iopi.ClockOr(c.Clock)
+	interval := c.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		c.Check()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clock.After(interval):
+		}
+	}
+}
+
+// Check schedules and run times once, as done by Run.
+func (c *Controller) Check() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	for _, z := range c.zones {
+		if z.state == Running && !now.Before(z.until) {
+			if err := c.stop(z); err != nil {
+				c.report(z, err)
+			}
+		}
+	}
+
+	if !c.last.IsZero() {
+		for _, s := range c.schedules {
+			z := c.byName[s.Zone]
+			if c.due(s, now) && !now.Before(z.skip) {
+				if err := c.start(z, s.Duration, now); err != nil {
+					c.report(z, err)
+				}
+			}
+		}
+	}
+	c.last = now
+
+	c.advance(now)
+}
+
+// Return true if a schedule starts after the last check and by `now`.
+func (c *Controller) due(s Schedule, now time.Time) bool {
+	for day := c.last; !day.After(now.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		// By the clock, so runs keep their time on daylight saving changes
+		y, m, d := day.Date()
+		h, min, sec := int(s.Start/time.Hour), int(s.Start%time.Hour/time.Minute), int(s.Start%time.Minute/time.Second)
+		start := time.Date(y, m, d, h, min, sec, 0, now.Location())
+		if start.After(c.last) && !start.After(now) && s.onDay(start.Weekday()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start queued zones while fewer than MaxActive are running.
+func (c *Controller) advance(now time.Time) {
+	for len(c.queue) > 0 && (c.MaxActive <= 0 || c.running() < c.MaxActive) {
+		z := c.queue[0]
+		c.queue = c.queue[1:]
+		if err := c.switchOn(z, now); err != nil {
+			c.report(z, err)
+		}
+	}
+}
+
+func (c *Controller) switchOn(z *zone, now time.Time) error {
+	if err := z.Device.SetActive(z.Pin, true); err != nil {
+		z.state = Off
+		z.Device.SetActive(z.Pin, false)
+		return fmt.Errorf("failed to start zone %s: %w", z.Name, err)
+	}
+	z.state, z.until = Running, now.Add(z.duration)
+	return nil
+}
+
+func (c *Controller) running() int {
+	n := 0
+	for _, z := range c.zones {
+		if z.state == Running {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Controller) report(z *zone, err error) {
+	if c.OnError != nil {
+		c.OnError(z.Name, err)
+	}
+}
+
+func (c *Controller) now() time.Time {
+	return iopi.ClockOr(c.Clock).Now()
+}
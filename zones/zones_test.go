@@ -0,0 +1,239 @@
+package zones
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	iopi "github.com/stigok/go-io-pi"
+	"github.com/stigok/go-io-pi/iopitest"
+)
+
+// Open a simulated device with all pins set to output
+func openDevice(t *testing.T, name string) *iopi.Device {
+	dev, err := iopi.Open(iopi.SimPrefix+name, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dev.Close() })
+	dev.SetPortMode(iopi.PortA, iopi.Output)
+	return dev
+}
+
+func isOn(t *testing.T, dev *iopi.Device, pin uint8) bool {
+	on, err := dev.IsActive(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return on
+}
+
+func states(c *Controller) []State {
+	var s []State
+	for _, st := range c.Status() {
+		s = append(s, st.State)
+	}
+	return s
+}
+
+func TestController(t *testing.T) {
+	t.Run("runs zones for their duration", func(t *testing.T) {
+		dev := openDevice(t, "zones-run")
+		clock := iopitest.NewFakeClock(time.Date(2026, 6, 1, 6, 0, 0, 0, time.UTC))
+		c, err := New(Zone{Name: "lawn", Device: dev, Pin: 1, MaxRuntime: 30 * time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Clock = clock
+
+		if err := c.Start("lawn", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if !isOn(t, dev, 1) {
+			t.Error("zone not started")
+		}
+		if st := c.Status()[0]; st.Until != clock.Now().Add(30*time.Minute) {
+			t.Error("run not limited to the maximum runtime", st)
+		}
+
+		clock.Advance(30 * time.Minute)
+		c.Check()
+		if isOn(t, dev, 1) || c.Status()[0].State != Off {
+			t.Error("zone not stopped")
+		}
+	})
+
+	t.Run("queues zones beyond the capacity", func(t *testing.T) {
+		dev := openDevice(t, "zones-queue")
+		clock := iopitest.NewFakeClock(time.Date(2026, 6, 1, 6, 0, 0, 0, time.UTC))
+		c, _ := New(
+			Zone{Name: "a", Device: dev, Pin: 1},
+			Zone{Name: "b", Device: dev, Pin: 2},
+			Zone{Name: "c", Device: dev, Pin: 3},
+		)
+		c.Clock = clock
+		c.MaxActive = 1
+
+		c.Start("a", 10*time.Minute)
+		c.Start("b", 5*time.Minute)
+		c.Start("c", 5*time.Minute)
+		if got := states(c); got[0] != Running || got[1] != Queued || got[2] != Queued {
+			t.Error("unexpected states", got)
+		}
+
+		clock.Advance(10 * time.Minute)
+		c.Check()
+		if got := states(c); got[0] != Off || got[1] != Running || got[2] != Queued {
+			t.Error("unexpected states", got)
+		}
+		if isOn(t, dev, 1) || !isOn(t, dev, 2) {
+			t.Error("unexpected pins")
+		}
+
+		if err := c.Stop("b"); err != nil {
+			t.Fatal(err)
+		}
+		if got := states(c); got[1] != Off || got[2] != Running {
+			t.Error("unexpected states after stop", got)
+		}
+	})
+
+	t.Run("runs schedules unless skipped", func(t *testing.T) {
+		dev := openDevice(t, "zones-schedule")
+		clock := iopitest.NewFakeClock(time.Date(2026, 6, 1, 5, 59, 0, 0, time.UTC)) // a Monday
+		c, _ := New(Zone{Name: "beds", Device: dev, Pin: 4})
+		c.Clock = clock
+		err := c.SetSchedules([]Schedule{{Zone: "beds", Days: []time.Weekday{time.Monday}, Start: 6 * time.Hour, Duration: 15 * time.Minute}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Check()
+		clock.Advance(2 * time.Minute)
+		c.Check()
+		if !isOn(t, dev, 4) {
+			t.Fatal("scheduled run not started")
+		}
+		clock.Advance(15 * time.Minute)
+		c.Check()
+		if isOn(t, dev, 4) {
+			t.Fatal("scheduled run not stopped")
+		}
+
+		// Next Monday, skipped
+		c.Skip("beds", clock.Now().AddDate(0, 0, 8))
+		clock.Advance(7 * 24 * time.Hour)
+		c.Check()
+		if isOn(t, dev, 4) {
+			t.Error("skipped run started")
+		}
+	})
+
+	t.Run("runs schedules by the clock on daylight saving changes", func(t *testing.T) {
+		oslo, err := time.LoadLocation("Europe/Oslo")
+		if err != nil {
+			t.Skip("no time zone data:", err)
+		}
+		dev := openDevice(t, "zones-dst")
+		clock := iopitest.NewFakeClock(time.Date(2026, 3, 29, 5, 59, 0, 0, oslo)) // clocks went forward at 02:00
+		c, _ := New(Zone{Name: "beds", Device: dev, Pin: 5})
+		c.Clock = clock
+		c.SetSchedules([]Schedule{{Zone: "beds", Start: 6 * time.Hour, Duration: 15 * time.Minute}})
+
+		c.Check()
+		clock.Advance(2 * time.Minute)
+		c.Check()
+		if !isOn(t, dev, 5) {
+			t.Fatal("scheduled run not started at 06:00")
+		}
+		clock.Advance(15 * time.Minute)
+		c.Check()
+		if isOn(t, dev, 5) {
+			t.Error("scheduled run not stopped")
+		}
+	})
+
+	t.Run("keeps zones running when stopping them fails", func(t *testing.T) {
+		dev := openDevice(t, "zones-stop-fail")
+		chip, _ := iopi.SimChip(iopi.SimPrefix+"zones-stop-fail", 0x20)
+		c, _ := New(Zone{Name: "a", Device: dev, Pin: 1}, Zone{Name: "b", Device: dev, Pin: 2})
+		c.MaxActive = 1
+		c.Start("a", time.Hour)
+		c.Start("b", time.Hour)
+
+		chip.Inject(iopitest.Fault{Op: iopitest.WriteOp, Registers: []byte{byte(iopi.GPIOA)}, Count: 1})
+		if err := c.Stop("a"); err == nil {
+			t.Fatal("expected error")
+		}
+		if got := states(c); got[0] != Running || got[1] != Queued || !isOn(t, dev, 1) {
+			t.Error("zone not kept running", got)
+		}
+
+		if err := c.Stop("a"); err != nil {
+			t.Fatal(err)
+		}
+		if got := states(c); got[0] != Off || got[1] != Running {
+			t.Error("unexpected states", got)
+		}
+		c.StopAll()
+	})
+
+	t.Run("stops zones when done", func(t *testing.T) {
+		dev := openDevice(t, "zones-done")
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		c, _ := New(Zone{Name: "lawn", Device: dev, Pin: 1})
+		c.Clock = clock
+		c.Start("lawn", time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- c.Run(ctx) }()
+		clock.BlockUntil(1)
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if isOn(t, dev, 1) {
+			t.Error("zone left on")
+		}
+	})
+
+	t.Run("checks every second without an interval", func(t *testing.T) {
+		clock := iopitest.NewFakeClock(time.Unix(0, 0))
+		c, _ := New()
+		c.Clock = clock
+		c.Interval = 0
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- c.Run(ctx) }()
+		clock.BlockUntil(1)
+		clock.Advance(time.Second - 1)
+		if clock.Waiters() != 1 {
+			t.Error("checked before a second passed")
+		}
+		cancel()
+		<-done
+	})
+
+	t.Run("rejects invalid zones and schedules", func(t *testing.T) {
+		dev := openDevice(t, "zones-invalid")
+		if _, err := New(Zone{Name: "a", Device: dev, Pin: 1}, Zone{Name: "a", Device: dev, Pin: 2}); err == nil {
+			t.Error("expected error for duplicate name")
+		}
+		if _, err := New(Zone{Name: "a", Device: dev, Pin: 17}); err == nil {
+			t.Error("expected error for invalid pin")
+		}
+
+		c, _ := New(Zone{Name: "a", Device: dev, Pin: 1})
+		if err := c.SetSchedules([]Schedule{{Zone: "b", Duration: time.Minute}}); err == nil {
+			t.Error("expected error for unknown zone")
+		}
+		if err := c.Start("a", 0); err == nil {
+			t.Error("expected error without duration")
+		}
+		if err := c.Start("b", time.Minute); err == nil {
+			t.Error("expected error for unknown zone")
+		}
+	})
+}